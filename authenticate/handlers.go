@@ -20,8 +20,9 @@ import (
 	"github.com/pomerium/pomerium/internal/handlers"
 	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/identity"
-	"github.com/pomerium/pomerium/internal/identity/oauth/apple"
+	"github.com/pomerium/pomerium/internal/identity/oauth"
 	"github.com/pomerium/pomerium/internal/identity/oidc"
+	"github.com/pomerium/pomerium/internal/identity/saml"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/middleware"
 	"github.com/pomerium/pomerium/internal/sessions"
@@ -42,6 +43,7 @@ func (a *Authenticate) Handler() http.Handler {
 func (a *Authenticate) Mount(r *mux.Router) {
 	r.StrictSlash(true)
 	r.Use(middleware.SetHeaders(httputil.HeadersContentSecurityPolicy))
+	r.Use(mapSAMLResponse)
 	r.Use(func(h http.Handler) http.Handler {
 		options := a.options.Load()
 		state := a.state.Load()
@@ -59,10 +61,10 @@ func (a *Authenticate) Mount(r *mux.Router) {
 			csrf.ErrorHandler(httputil.HandlerFunc(httputil.CSRFFailureHandler)),
 		}
 
-		if options.Provider == apple.Name {
+		if usesFormPostResponse(options) {
 			// csrf.SameSiteLaxMode will cause browsers to reset
-			// the session on POST. This breaks Appleid being able
-			// to verify the csrf token.
+			// the session on POST. This breaks Appleid and SAML
+			// identity providers being able to verify the csrf token.
 			csrfOptions = append(csrfOptions, csrf.SameSite(csrf.SameSiteNoneMode))
 		} else {
 			csrfOptions = append(csrfOptions, csrf.SameSite(csrf.SameSiteLaxMode))
@@ -81,6 +83,20 @@ func (a *Authenticate) Mount(r *mux.Router) {
 	a.mountDashboard(r)
 }
 
+// mapSAMLResponse maps a SAML response posted to the callback to the code and
+// state form values, so that it is handled like an OAuth 2.0 response.
+func mapSAMLResponse(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/oauth2/callback" {
+			if res := r.PostFormValue(saml.ResponseFormValue); res != "" {
+				r.Form.Set("code", res)
+				r.Form.Set("state", r.PostForm.Get(saml.RelayStateFormValue))
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
 func (a *Authenticate) mountDashboard(r *mux.Router) {
 	sr := httputil.DashboardSubrouter(r)
 	c := cors.New(cors.Options{
@@ -103,6 +119,7 @@ func (a *Authenticate) mountDashboard(r *mux.Router) {
 	// routes that need a session:
 	sr = sr.NewRoute().Subrouter()
 	sr.Use(a.RetrieveSession)
+	sr.Use(a.selectIdentityProvider)
 	sr.Use(a.VerifySession)
 	sr.Path("/").Handler(a.requireValidSignatureOnRedirect(a.userInfo))
 	sr.Path("/sign_in").Handler(httputil.HandlerFunc(a.SignIn))
@@ -153,7 +170,7 @@ func (a *Authenticate) VerifySession(next http.Handler) http.Handler {
 			return a.reauthenticateOrFail(w, r, err)
 		}
 
-		_, err = loadIdentityProfile(r, state.cookieCipher)
+		profile, err := loadIdentityProfile(r, state.cookieCipher)
 		if err != nil {
 			log.FromRequest(r).Info().
 				Err(err).
@@ -162,6 +179,15 @@ func (a *Authenticate) VerifySession(next http.Handler) http.Handler {
 			return a.reauthenticateOrFail(w, r, err)
 		}
 
+		if err := a.getStepUpParamsForRequest(r).check(sessionState, profile); err != nil {
+			log.FromRequest(r).Info().
+				Err(err).
+				Str("idp_id", idpID).
+				Str("id", sessionState.ID).
+				Msg("authenticate: session does not meet step-up requirements")
+			return a.reauthenticateOrFail(w, r, err)
+		}
+
 		next.ServeHTTP(w, r.WithContext(ctx))
 		return nil
 	})
@@ -189,7 +215,7 @@ func (a *Authenticate) SignIn(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	idpID := requestParams.Get(urlutil.QueryIdentityProviderID)
+	idpID := a.getIdentityProviderIDForURLValues(r.Form)
 
 	s, err := a.getSessionFromCtx(ctx)
 	if err != nil {
@@ -320,10 +346,20 @@ func (a *Authenticate) reauthenticateOrFail(w http.ResponseWriter, r *http.Reque
 	nonce := csrf.Token(r)
 	now := time.Now().Unix()
 	b := []byte(fmt.Sprintf("%s|%d|", nonce, now))
-	enc := cryptutil.Encrypt(state.cookieCipher, []byte(redirectURL.String()), b)
+	// the PKCE code verifier is kept secret along with the redirect url, and
+	// only its challenge is sent to the identity provider. Identity providers
+	// with PKCE disabled get an empty verifier and no challenge.
+	var verifier string
+	var opts []oauth2.AuthCodeOption
+	if identity.SupportsPKCE(authenticator) {
+		verifier = oauth.NewCodeVerifier()
+		opts = oauth.S256ChallengeOption(verifier)
+	}
+	enc := cryptutil.Encrypt(state.cookieCipher, []byte(verifier+"|"+redirectURL.String()), b)
 	b = append(b, enc...)
 	encodedState := base64.URLEncoding.EncodeToString(b)
-	signinURL, err := authenticator.GetSignInURL(encodedState)
+	opts = append(opts, a.getStepUpParamsForRequest(r).authCodeOptions()...)
+	signinURL, err := authenticator.GetSignInURL(r.Context(), encodedState, opts...)
 	if err != nil {
 		return httputil.NewError(http.StatusInternalServerError,
 			fmt.Errorf("failed to get sign in url: %w", err))
@@ -345,6 +381,19 @@ func (a *Authenticate) OAuthCallback(w http.ResponseWriter, r *http.Request) err
 	return nil
 }
 
+// splitStateData splits the decrypted state data into the PKCE code verifier
+// and the redirect url. The verifier is empty if the identity provider doesn't
+// support PKCE, or if the sign in was started before PKCE was used, in which
+// case the state data is only the redirect url.
+func splitStateData(data string) (verifier, redirectURL string) {
+	verifier, redirectURL, ok := strings.Cut(data, "|")
+	// a code verifier never contains a colon, while a redirect url always does
+	if !ok || strings.Contains(verifier, ":") {
+		return "", data
+	}
+	return verifier, redirectURL
+}
+
 func (a *Authenticate) statusForErrorCode(errorCode string) int {
 	switch errorCode {
 	case "access_denied", "unauthorized_client":
@@ -381,7 +430,7 @@ func (a *Authenticate) getOAuthCallback(w http.ResponseWriter, r *http.Request)
 	}
 
 	// split state into concat'd components
-	// (nonce|timestamp|redirect_url|encrypted_data(redirect_url)+mac(nonce,ts))
+	// (nonce|timestamp|encrypted_data(code_verifier|redirect_url)+mac(nonce,ts))
 	statePayload := strings.SplitN(string(bytes), "|", 3)
 	if len(statePayload) != 3 {
 		return nil, httputil.NewError(http.StatusBadRequest, fmt.Errorf("state malformed, size: %d", len(statePayload)))
@@ -389,14 +438,15 @@ func (a *Authenticate) getOAuthCallback(w http.ResponseWriter, r *http.Request)
 
 	// Use our AEAD construct to enforce secrecy and authenticity:
 	// mac: to validate the nonce again, and above timestamp
-	// decrypt: to prevent leaking 'redirect_uri' to IdP or logs
+	// decrypt: to prevent leaking 'redirect_uri' and the code verifier to IdP or logs
 	b := []byte(fmt.Sprint(statePayload[0], "|", statePayload[1], "|"))
-	redirectString, err := cryptutil.Decrypt(state.cookieCipher, []byte(statePayload[2]), b)
+	decrypted, err := cryptutil.Decrypt(state.cookieCipher, []byte(statePayload[2]), b)
 	if err != nil {
 		return nil, httputil.NewError(http.StatusBadRequest, err)
 	}
+	verifier, redirectString := splitStateData(string(decrypted))
 
-	redirectURL, err := urlutil.ParseAndValidateURL(string(redirectString))
+	redirectURL, err := urlutil.ParseAndValidateURL(redirectString)
 	if err != nil {
 		return nil, httputil.NewError(http.StatusBadRequest, err)
 	}
@@ -422,8 +472,12 @@ Or contact your administrator.
 	// Successful Authentication Response: rfc6749#section-4.1.2 & OIDC#3.1.2.5
 	//
 	// Exchange the supplied Authorization Code for a valid user session.
+	var opts []oauth2.AuthCodeOption
+	if verifier != "" {
+		opts = append(opts, oauth.VerifierOption(verifier))
+	}
 	var claims identity.SessionClaims
-	accessToken, err := authenticator.Authenticate(ctx, code, &claims)
+	accessToken, err := authenticator.Authenticate(ctx, code, &claims, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error redeeming authenticate code: %w", err)
 	}
@@ -440,7 +494,7 @@ Or contact your administrator.
 	}
 
 	// save the session and access token to the databroker
-	profile, err := a.buildIdentityProfile(ctx, r, &newState, claims, accessToken)
+	profile, err := a.buildIdentityProfile(ctx, idpID, &newState, claims, accessToken)
 	if err != nil {
 		return nil, httputil.NewError(http.StatusInternalServerError, err)
 	}
@@ -450,6 +504,13 @@ Or contact your administrator.
 	if err := state.sessionStore.SaveSession(w, r, &newState); err != nil {
 		return nil, fmt.Errorf("failed saving new session: %w", err)
 	}
+
+	// identity providers may ignore the step-up parameters, in which case
+	// signing in again would redirect to the identity provider forever
+	if err := a.getStepUpParamsForURLValues(redirectURL.Query()).check(&newState, profile); err != nil {
+		return nil, httputil.NewError(http.StatusForbidden,
+			fmt.Errorf("identity provider did not meet the step-up requirements: %w", err))
+	}
 	return redirectURL, nil
 }
 
@@ -26,12 +26,15 @@ import (
 	"github.com/pomerium/pomerium/internal/encoding/mock"
 	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/identity"
+	identitystate "github.com/pomerium/pomerium/internal/identity/identity"
+	"github.com/pomerium/pomerium/internal/identity/oauth"
 	"github.com/pomerium/pomerium/internal/identity/oidc"
 	"github.com/pomerium/pomerium/internal/sessions"
 	mstore "github.com/pomerium/pomerium/internal/sessions/mock"
 	"github.com/pomerium/pomerium/internal/urlutil"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/hpke"
 )
 
 func testAuthenticate() *Authenticate {
@@ -322,10 +325,10 @@ func TestAuthenticate_OAuthCallback(t *testing.T) {
 			params.Add("error", tt.paramErr)
 			params.Add("code", tt.code)
 			nonce := cryptutil.NewBase64Key() // mock csrf
-			// (nonce|timestamp|redirect_url|encrypt(redirect_url),mac(nonce,ts))
+			// (nonce|timestamp|encrypt(code_verifier|redirect_url),mac(nonce,ts))
 			b := []byte(fmt.Sprintf("%s|%d|%s", nonce, tt.ts, tt.extraMac))
 
-			enc := cryptutil.Encrypt(a.state.Load().cookieCipher, []byte(tt.redirectURI), b)
+			enc := cryptutil.Encrypt(a.state.Load().cookieCipher, []byte("VERIFIER|"+tt.redirectURI), b)
 			b = append(b, enc...)
 			encodedState := base64.URLEncoding.EncodeToString(b)
 			if tt.extraState != "" {
@@ -456,6 +459,285 @@ func TestAuthenticate_SessionValidatorMiddleware(t *testing.T) {
 	}
 }
 
+type signInURLProvider struct {
+	identity.MockProvider
+}
+
+func (signInURLProvider) GetSignInURL(_ context.Context, state string, opts ...oauth2.AuthCodeOption) (string, error) {
+	cfg := &oauth2.Config{Endpoint: oauth2.Endpoint{AuthURL: "https://idp.example.com/authorize"}}
+	return cfg.AuthCodeURL(state, opts...), nil
+}
+
+func TestAuthenticate_reauthenticateOrFailStepUp(t *testing.T) {
+	t.Parallel()
+
+	aead, err := chacha20poly1305.NewX(cryptutil.NewKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hpkePrivateKey := hpke.DerivePrivateKey([]byte("authenticate"))
+	a := &Authenticate{
+		cfg: getAuthenticateConfig(WithGetIdentityProvider(func(options *config.Options, idpID string) (identity.Authenticator, error) {
+			return signInURLProvider{}, nil
+		})),
+		state: atomicutil.NewValue(&authenticateState{
+			redirectURL:    uriParseHelper("https://authenticate.example.com"),
+			sessionStore:   &mstore.Store{},
+			cookieCipher:   aead,
+			hpkePrivateKey: hpkePrivateKey,
+		}),
+		options: config.NewAtomicOptions(),
+	}
+
+	params, err := hpke.EncryptURLValues(hpke.DerivePrivateKey([]byte("authorize")), hpkePrivateKey.PublicKey(), url.Values{
+		urlutil.QueryMaxAge:    {"900"},
+		urlutil.QueryACRValues: {"phrh phr"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/.pomerium/sign_in?"+params.Encode(), nil)
+	w := httptest.NewRecorder()
+	err = a.reauthenticateOrFail(w, r, errors.New("session exceeds max auth age"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "idp.example.com", location.Host)
+	assert.Equal(t, "login", location.Query().Get("prompt"))
+	assert.Equal(t, "900", location.Query().Get("max_age"))
+	assert.Equal(t, "phrh phr", location.Query().Get("acr_values"))
+	assert.Equal(t, "S256", location.Query().Get("code_challenge_method"))
+	assert.NotEmpty(t, location.Query().Get("code_challenge"))
+	assert.NotEmpty(t, location.Query().Get("state"))
+}
+
+// stepUpIgnoringProvider is an identity provider which ignores the prompt,
+// max_age and acr_values parameters.
+type stepUpIgnoringProvider struct {
+	identity.MockProvider
+}
+
+func (stepUpIgnoringProvider) UpdateUserInfo(_ context.Context, _ *oauth2.Token, v interface{}) error {
+	claims := v.(*identity.SessionClaims)
+	claims.Claims = map[string]interface{}{
+		"auth_time": time.Now().Add(-time.Hour).Unix(),
+		"acr":       "pwd",
+	}
+	return nil
+}
+
+func TestAuthenticate_OAuthCallbackStepUp(t *testing.T) {
+	t.Parallel()
+
+	aead, err := chacha20poly1305.NewX(cryptutil.NewKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hpkePrivateKey := hpke.DerivePrivateKey([]byte("authenticate"))
+	a := &Authenticate{
+		cfg: getAuthenticateConfig(WithGetIdentityProvider(func(options *config.Options, idpID string) (identity.Authenticator, error) {
+			return stepUpIgnoringProvider{}, nil
+		})),
+		state: atomicutil.NewValue(&authenticateState{
+			redirectURL:    uriParseHelper("https://authenticate.example.com"),
+			sessionStore:   &mstore.Store{},
+			cookieCipher:   aead,
+			hpkePrivateKey: hpkePrivateKey,
+		}),
+		options: config.NewAtomicOptions(),
+	}
+
+	callback := func(t *testing.T, stepUp url.Values) int {
+		params, err := hpke.EncryptURLValues(hpke.DerivePrivateKey([]byte("authorize")), hpkePrivateKey.PublicKey(), stepUp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		redirectURL := "https://authenticate.example.com/.pomerium/sign_in?" + params.Encode()
+
+		b := []byte(fmt.Sprintf("%s|%d|", cryptutil.NewBase64Key(), time.Now().Unix()))
+		b = append(b, cryptutil.Encrypt(aead, []byte("VERIFIER|"+redirectURL), b)...)
+
+		r := httptest.NewRequest(http.MethodGet, "/oauth2/callback?"+url.Values{
+			"code":  {"CODE"},
+			"state": {base64.URLEncoding.EncodeToString(b)},
+		}.Encode(), nil)
+		w := httptest.NewRecorder()
+		httputil.HandlerFunc(a.OAuthCallback).ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusFound, callback(t, url.Values{}))
+	assert.Equal(t, http.StatusForbidden, callback(t, url.Values{urlutil.QueryMaxAge: {"900"}}),
+		"should not redirect to the identity provider again if it ignores max_age")
+	assert.Equal(t, http.StatusFound, callback(t, url.Values{urlutil.QueryMaxAge: {"7200"}}))
+	assert.Equal(t, http.StatusForbidden, callback(t, url.Values{urlutil.QueryACRValues: {"phrh"}}),
+		"should not redirect to the identity provider again if it ignores acr_values")
+	assert.Equal(t, http.StatusFound, callback(t, url.Values{urlutil.QueryACRValues: {"phrh pwd"}}))
+}
+
+type pkceProvider struct {
+	signInURLProvider
+	supported bool
+	verifier  *string
+}
+
+func (p pkceProvider) SupportsPKCE() bool {
+	return p.supported
+}
+
+func (p pkceProvider) Authenticate(_ context.Context, _ string, _ identitystate.State, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	u, err := url.Parse((&oauth2.Config{}).AuthCodeURL("", opts...))
+	if err != nil {
+		return nil, err
+	}
+	*p.verifier = u.Query().Get("code_verifier")
+	return &oauth2.Token{}, nil
+}
+
+func TestAuthenticate_PKCE(t *testing.T) {
+	t.Parallel()
+
+	aead, err := chacha20poly1305.NewX(cryptutil.NewKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var verifier string
+	a := &Authenticate{
+		cfg: getAuthenticateConfig(WithGetIdentityProvider(func(options *config.Options, idpID string) (identity.Authenticator, error) {
+			return pkceProvider{supported: true, verifier: &verifier}, nil
+		})),
+		state: atomicutil.NewValue(&authenticateState{
+			redirectURL:  uriParseHelper("https://authenticate.example.com"),
+			sessionStore: &mstore.Store{},
+			cookieCipher: aead,
+		}),
+		options: config.NewAtomicOptions(),
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "https://authenticate.example.com/.pomerium/sign_in?pomerium_redirect_uri=https://corp.example.com", nil)
+	w := httptest.NewRecorder()
+	err = a.reauthenticateOrFail(w, r, errors.New("no session"))
+	assert.NoError(t, err)
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := location.Query().Get("code_challenge")
+	assert.NotContains(t, location.RawQuery, "code_verifier")
+
+	r = httptest.NewRequest(http.MethodGet, "/oauth2/callback?"+url.Values{
+		"code":  {"CODE"},
+		"state": {location.Query().Get("state")},
+	}.Encode(), nil)
+	r.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	httputil.HandlerFunc(a.OAuthCallback).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	assert.NotEmpty(t, verifier)
+	assert.Equal(t, oauth.S256Challenge(verifier), challenge)
+}
+
+func TestAuthenticate_PKCEDisabled(t *testing.T) {
+	t.Parallel()
+
+	aead, err := chacha20poly1305.NewX(cryptutil.NewKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := "UNSET"
+	a := &Authenticate{
+		cfg: getAuthenticateConfig(WithGetIdentityProvider(func(options *config.Options, idpID string) (identity.Authenticator, error) {
+			return pkceProvider{verifier: &verifier}, nil
+		})),
+		state: atomicutil.NewValue(&authenticateState{
+			redirectURL:  uriParseHelper("https://authenticate.example.com"),
+			sessionStore: &mstore.Store{},
+			cookieCipher: aead,
+		}),
+		options: config.NewAtomicOptions(),
+	}
+
+	callback := func(t *testing.T, state string) int {
+		r := httptest.NewRequest(http.MethodGet, "/oauth2/callback?"+url.Values{
+			"code":  {"CODE"},
+			"state": {state},
+		}.Encode(), nil)
+		r.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		httputil.HandlerFunc(a.OAuthCallback).ServeHTTP(w, r)
+		return w.Code
+	}
+
+	t.Run("sign in", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "https://authenticate.example.com/.pomerium/sign_in?pomerium_redirect_uri=https://corp.example.com", nil)
+		w := httptest.NewRecorder()
+		err := a.reauthenticateOrFail(w, r, errors.New("no session"))
+		assert.NoError(t, err)
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NotContains(t, location.RawQuery, "code_challenge")
+
+		assert.Equal(t, http.StatusFound, callback(t, location.Query().Get("state")))
+		assert.Empty(t, verifier)
+	})
+	t.Run("state without verifier", func(t *testing.T) {
+		// sign ins started before PKCE was used only have the redirect url in the state
+		verifier = "UNSET"
+		b := []byte(fmt.Sprintf("%s|%d|", cryptutil.NewBase64Key(), time.Now().Unix()))
+		b = append(b, cryptutil.Encrypt(aead, []byte("https://corp.example.com/?a=b|c"), b)...)
+
+		assert.Equal(t, http.StatusFound, callback(t, base64.URLEncoding.EncodeToString(b)))
+		assert.Empty(t, verifier)
+	})
+}
+
+func TestSplitStateData(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		data, verifier, redirectURL string
+	}{
+		{"VERIFIER|https://corp.example.com", "VERIFIER", "https://corp.example.com"},
+		{"|https://corp.example.com", "", "https://corp.example.com"},
+		{"https://corp.example.com", "", "https://corp.example.com"},
+		{"https://corp.example.com/?a=b|c", "", "https://corp.example.com/?a=b|c"},
+	} {
+		verifier, redirectURL := splitStateData(tc.data)
+		assert.Equal(t, tc.verifier, verifier, tc.data)
+		assert.Equal(t, tc.redirectURL, redirectURL, tc.data)
+	}
+}
+
+func TestMapSAMLResponse(t *testing.T) {
+	t.Parallel()
+
+	var code, state string
+	h := mapSAMLResponse(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, state = r.FormValue("code"), r.FormValue("state")
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/oauth2/callback", strings.NewReader(url.Values{
+		"SAMLResponse": {"RESPONSE"},
+		"RelayState":   {"STATE"},
+	}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "RESPONSE", code)
+	assert.Equal(t, "STATE", state)
+
+	r = httptest.NewRequest(http.MethodGet, "/oauth2/callback?code=CODE&state=STATE", nil)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "CODE", code)
+	assert.Equal(t, "STATE", state)
+}
+
 func TestAuthenticate_userInfo(t *testing.T) {
 	t.Parallel()
 
@@ -578,3 +860,72 @@ func mustParseURL(rawurl string) *url.URL {
 	}
 	return u
 }
+
+func TestAuthenticate_selectIdentityProvider(t *testing.T) {
+	t.Parallel()
+
+	hpkePrivateKey := hpke.DerivePrivateKey([]byte("authenticate"))
+	a := &Authenticate{
+		cfg: getAuthenticateConfig(),
+		state: atomicutil.NewValue(&authenticateState{
+			hpkePrivateKey: hpkePrivateKey,
+			sharedEncoder:  mock.Encoder{UnmarshalError: sessions.ErrNoSessionFound},
+		}),
+		options: config.NewAtomicOptions(),
+	}
+	a.options.Store(&config.Options{
+		IdentityProviders: []config.IdentityProviderOptions{
+			{ID: "okta", Name: "Okta", Provider: "okta", Domains: []string{"example.com"}},
+			{ID: "azure", Name: "Azure AD", Provider: "azure"},
+		},
+	})
+
+	params, err := hpke.EncryptURLValues(hpke.DerivePrivateKey([]byte("authorize")), hpkePrivateKey.PublicKey(), url.Values{
+		urlutil.QueryRedirectURI:        {"https://app.example.com"},
+		urlutil.QueryIdentityProviderID: {""},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var idpID string
+	h := a.selectIdentityProvider(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idpID = a.getIdentityProviderIDForRequest(r)
+		assert.Equal(t, idpID, r.URL.Query().Get(urlutil.QueryIdentityProviderID))
+	}))
+	serve := func(extra url.Values) *httptest.ResponseRecorder {
+		idpID = ""
+		q := url.Values{}
+		for k, vs := range params {
+			q[k] = vs
+		}
+		for k, vs := range extra {
+			q[k] = vs
+		}
+		r := httptest.NewRequest(http.MethodGet, "/.pomerium/sign_in?"+q.Encode(), nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("choose", func(t *testing.T) {
+		w := serve(nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"page":"SelectIdentityProvider"`)
+		assert.Contains(t, w.Body.String(), `"name":"Azure AD"`)
+		assert.Empty(t, idpID)
+	})
+	t.Run("chosen", func(t *testing.T) {
+		serve(url.Values{urlutil.QueryIdentityProviderID: {"azure"}})
+		assert.Equal(t, "azure", idpID)
+	})
+	t.Run("login hint", func(t *testing.T) {
+		serve(url.Values{"login_hint": {"alice@example.com"}})
+		assert.Equal(t, "okta", idpID)
+	})
+	t.Run("unknown", func(t *testing.T) {
+		w := serve(url.Values{urlutil.QueryIdentityProviderID: {"google"}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Empty(t, idpID)
+	})
+}
@@ -31,5 +31,8 @@ func defaultGetIdentityProvider(options *config.Options, idpID string) (identity
 		ClientSecret:    idp.GetClientSecret(),
 		Scopes:          idp.GetScopes(),
 		AuthCodeOptions: idp.GetRequestParams(),
+
+		AllowSHA1Signatures: options.SAMLAllowSHA1,
+		DisablePKCE:         options.IsPKCEDisabledForID(idpID),
 	})
 }
@@ -25,13 +25,12 @@ var cookieChunker = httputil.NewCookieChunker()
 
 func (a *Authenticate) buildIdentityProfile(
 	ctx context.Context,
-	r *http.Request,
+	idpID string,
 	sessionState *sessions.State,
 	claims identity.SessionClaims,
 	oauthToken *oauth2.Token,
 ) (*identitypb.Profile, error) {
 	options := a.options.Load()
-	idpID := r.FormValue(urlutil.QueryIdentityProviderID)
 
 	authenticator, err := a.cfg.getIdentityProvider(options, idpID)
 	if err != nil {
@@ -0,0 +1,155 @@
+package authenticate
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/handlers"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/identity/oauth/apple"
+	"github.com/pomerium/pomerium/internal/identity/saml"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/grpc/identity"
+	"github.com/pomerium/pomerium/pkg/hpke"
+)
+
+// queryLoginHint is the email address of the user signing in, used to choose
+// the identity provider from its domain.
+const queryLoginHint = "login_hint"
+
+// selectIdentityProvider lets users choose the identity provider to sign in
+// with when a route allows several of them. An identity provider is chosen
+// without asking if the user already signed in with one of them, or if the
+// domain of the login hint is one of its domains.
+func (a *Authenticate) selectIdentityProvider(next http.Handler) http.Handler {
+	return httputil.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if err := r.ParseForm(); err != nil {
+			return httputil.NewError(http.StatusBadRequest, err)
+		}
+
+		state := a.state.Load()
+		options := a.options.Load()
+
+		// only sign in requests without an identity provider need one chosen
+		_, requestParams, err := hpke.DecryptURLValues(state.hpkePrivateKey, r.Form)
+		if err != nil || requestParams.Get(urlutil.QueryIdentityProviderID) != "" {
+			next.ServeHTTP(w, r)
+			return nil
+		}
+
+		// programmatic logins redirect to the client, so use the route's callback
+		requestURL := requestParams.Get(urlutil.QueryCallbackURI)
+		if requestURL == "" {
+			requestURL = requestParams.Get(urlutil.QueryRedirectURI)
+		}
+		idps, err := options.GetIdentityProvidersForRequestURL(requestURL)
+		if err != nil {
+			return httputil.NewError(http.StatusBadRequest, err)
+		}
+
+		idpID := r.Form.Get(urlutil.QueryIdentityProviderID)
+		if idpID == "" {
+			if s, err := a.getSessionFromCtx(r.Context()); err == nil && hasIdentityProvider(idps, s.IdentityProviderID) {
+				idpID = s.IdentityProviderID
+			}
+		}
+		if idpID == "" {
+			idpID = getIdentityProviderIDForLoginHint(options, idps, r.Form.Get(queryLoginHint))
+		}
+		if idpID == "" && len(idps) == 1 {
+			idpID = idps[0].GetId()
+		}
+
+		if idpID == "" {
+			a.renderSelectIdentityProvider(w, r, idps)
+			return nil
+		}
+		if !hasIdentityProvider(idps, idpID) {
+			return httputil.NewError(http.StatusBadRequest, errors.New("identity provider not allowed"))
+		}
+
+		// the identity provider is kept in the url so that it survives the
+		// redirect to the identity provider
+		q := r.URL.Query()
+		q.Set(urlutil.QueryIdentityProviderID, idpID)
+		r.URL.RawQuery = q.Encode()
+		r.Form.Set(urlutil.QueryIdentityProviderID, idpID)
+
+		next.ServeHTTP(w, r)
+		return nil
+	})
+}
+
+func (a *Authenticate) renderSelectIdentityProvider(w http.ResponseWriter, r *http.Request, idps []*identity.Provider) {
+	options := a.options.Load()
+
+	// the identity provider is chosen by signing in again with its id as a
+	// query parameter
+	signInURL := url.URL{Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+	data := handlers.SelectIdentityProviderData{
+		URL:             signInURL.String(),
+		BrandingOptions: options.BrandingOptions,
+	}
+	for _, idp := range idps {
+		name := idp.GetType()
+		if idpOptions, ok := options.GetIdentityProviderOptions(idp.GetId()); ok {
+			name = idpOptions.GetName()
+		}
+
+		u := signInURL
+		q := u.Query()
+		q.Del(queryLoginHint)
+		q.Set(urlutil.QueryIdentityProviderID, idp.GetId())
+		u.RawQuery = q.Encode()
+
+		data.IdentityProviders = append(data.IdentityProviders, handlers.SelectIdentityProviderOption{
+			ID:   idp.GetId(),
+			Name: name,
+			URL:  u.String(),
+		})
+	}
+	handlers.SelectIdentityProvider(data).ServeHTTP(w, r)
+}
+
+// getIdentityProviderIDForLoginHint returns the id of the first of the
+// identity providers whose domains include the domain of the login hint.
+func getIdentityProviderIDForLoginHint(options *config.Options, idps []*identity.Provider, loginHint string) string {
+	_, domain, ok := strings.Cut(loginHint, "@")
+	if !ok || domain == "" {
+		return ""
+	}
+
+	for _, idp := range idps {
+		if idpOptions, ok := options.GetIdentityProviderOptions(idp.GetId()); ok && idpOptions.HasDomain(domain) {
+			return idp.GetId()
+		}
+	}
+	return ""
+}
+
+// usesFormPostResponse returns true if any of the identity providers posts its
+// response to the callback.
+func usesFormPostResponse(options *config.Options) bool {
+	providers := []string{options.Provider}
+	for _, idp := range options.IdentityProviders {
+		providers = append(providers, idp.Provider)
+	}
+	for _, provider := range providers {
+		if provider == apple.Name || provider == saml.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasIdentityProvider(idps []*identity.Provider, idpID string) bool {
+	for _, idp := range idps {
+		if idp.GetId() == idpID {
+			return true
+		}
+	}
+	return false
+}
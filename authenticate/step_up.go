@@ -0,0 +1,106 @@
+package authenticate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"golang.org/x/oauth2"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	identitypb "github.com/pomerium/pomerium/pkg/grpc/identity"
+	"github.com/pomerium/pomerium/pkg/hpke"
+)
+
+// stepUpParams are additional authentication requirements requested by
+// authorize in the encrypted sign in query string.
+type stepUpParams struct {
+	maxAge    time.Duration
+	acrValues []string
+}
+
+func (a *Authenticate) getStepUpParamsForRequest(r *http.Request) stepUpParams {
+	if err := r.ParseForm(); err != nil {
+		return stepUpParams{}
+	}
+	return a.getStepUpParamsForURLValues(r.Form)
+}
+
+// getStepUpParamsForURLValues returns the step-up parameters of a sign in
+// url's query string.
+func (a *Authenticate) getStepUpParamsForURLValues(values url.Values) stepUpParams {
+	var p stepUpParams
+
+	_, requestParams, err := hpke.DecryptURLValues(a.state.Load().hpkePrivateKey, values)
+	if err != nil {
+		return p
+	}
+
+	if seconds, err := strconv.ParseInt(requestParams.Get(urlutil.QueryMaxAge), 10, 64); err == nil && seconds > 0 {
+		p.maxAge = time.Duration(seconds) * time.Second
+	}
+	p.acrValues = strings.Fields(requestParams.Get(urlutil.QueryACRValues))
+	return p
+}
+
+// check returns an error if the session doesn't meet the requirements, in which
+// case the user needs to log in again.
+func (p stepUpParams) check(s *sessions.State, profile *identitypb.Profile) error {
+	if err := p.checkMaxAge(s, profile); err != nil {
+		return err
+	}
+	if len(p.acrValues) > 0 && !slices.Contains(p.acrValues, getACR(profile)) {
+		return fmt.Errorf("session acr does not match any of %v", p.acrValues)
+	}
+	return nil
+}
+
+// checkMaxAge returns an error if the session exceeds the max auth age.
+func (p stepUpParams) checkMaxAge(s *sessions.State, profile *identitypb.Profile) error {
+	if p.maxAge > 0 && time.Since(getAuthTime(s, profile)) > p.maxAge {
+		return errors.New("session exceeds max auth age")
+	}
+	return nil
+}
+
+// authCodeOptions returns the options to add to the identity provider's sign in
+// url so that the requirements are met when the user logs in.
+//
+// https://openid.net/specs/openid-connect-core-1_0.html#AuthRequest
+func (p stepUpParams) authCodeOptions() []oauth2.AuthCodeOption {
+	var opts []oauth2.AuthCodeOption
+	if p.maxAge > 0 {
+		opts = append(opts,
+			oauth2.SetAuthURLParam("prompt", "login"),
+			oauth2.SetAuthURLParam("max_age", strconv.FormatInt(int64(p.maxAge/time.Second), 10)))
+	}
+	if len(p.acrValues) > 0 {
+		opts = append(opts, oauth2.SetAuthURLParam("acr_values", strings.Join(p.acrValues, " ")))
+	}
+	return opts
+}
+
+// getAuthTime returns the time the user last authenticated with the identity
+// provider. The auth_time claim is used if available, otherwise the time the
+// session was issued.
+func getAuthTime(s *sessions.State, profile *identitypb.Profile) time.Time {
+	if v, ok := profile.GetClaims().GetFields()["auth_time"].GetKind().(*structpb.Value_NumberValue); ok {
+		return time.Unix(int64(v.NumberValue), 0)
+	}
+	if s.IssuedAt != nil {
+		return s.IssuedAt.Time()
+	}
+	return time.Time{}
+}
+
+// getACR returns the authentication context class reference for the session.
+func getACR(profile *identitypb.Profile) string {
+	return profile.GetClaims().GetFields()["acr"].GetStringValue()
+}
@@ -0,0 +1,333 @@
+package authorize
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+const (
+	accessHistoryType = "pomerium.io/AccessHistory"
+	// accessHistoryCapacity is the number of access history records, one for
+	// each session or service account and replica, kept in the databroker
+	accessHistoryCapacity = 10_000
+	// accessHistoryMaxEntries is the number of route and source ip pairs kept
+	// for each session or service account
+	accessHistoryMaxEntries = 100
+)
+
+// An AccessHistory lists the routes accessed by a session or service account.
+//
+// Each authorize replica stores the accesses it tracked in its own record, and
+// the records of a session are merged when the history is read.
+type AccessHistory struct {
+	SessionID      string               `json:"session_id"`
+	UserID         string               `json:"user_id"`
+	ServiceAccount bool                 `json:"service_account"`
+	Entries        []AccessHistoryEntry `json:"entries"`
+}
+
+// An AccessHistoryEntry counts the accesses to a route from a source ip.
+type AccessHistoryEntry struct {
+	RouteID   string    `json:"route_id"`
+	Route     string    `json:"route"`
+	SourceIP  string    `json:"source_ip"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Count     uint64    `json:"count"`
+}
+
+// A RouteAccess is an access to a route by a session or service account.
+type RouteAccess struct {
+	SessionID      string
+	UserID         string
+	ServiceAccount bool
+	RouteID        string
+	Route          string
+	SourceIP       string
+	Time           time.Time
+}
+
+// mergeHistory merges the entries of another record of the same session's
+// history.
+func (h *AccessHistory) mergeHistory(other *AccessHistory) {
+	for _, entry := range other.Entries {
+		h.merge(entry)
+	}
+}
+
+// add adds the access to the history.
+func (h *AccessHistory) add(access RouteAccess) {
+	h.merge(AccessHistoryEntry{
+		RouteID:   access.RouteID,
+		Route:     access.Route,
+		SourceIP:  access.SourceIP,
+		FirstSeen: access.Time,
+		LastSeen:  access.Time,
+		Count:     1,
+	})
+}
+
+// merge merges the entry with the history's entry for the same route and
+// source ip. If there are too many entries, the least recently seen are
+// removed.
+func (h *AccessHistory) merge(entry AccessHistoryEntry) {
+	for i := range h.Entries {
+		e := &h.Entries[i]
+		if e.RouteID != entry.RouteID || e.SourceIP != entry.SourceIP {
+			continue
+		}
+		if entry.FirstSeen.Before(e.FirstSeen) {
+			e.FirstSeen = entry.FirstSeen
+		}
+		if entry.LastSeen.After(e.LastSeen) {
+			e.LastSeen = entry.LastSeen
+			e.Route = entry.Route
+		}
+		e.Count += entry.Count
+		return
+	}
+
+	h.Entries = append(h.Entries, entry)
+	sort.SliceStable(h.Entries, func(i, j int) bool {
+		return h.Entries[i].LastSeen.After(h.Entries[j].LastSeen)
+	})
+	if len(h.Entries) > accessHistoryMaxEntries {
+		h.Entries = h.Entries[:accessHistoryMaxEntries]
+	}
+}
+
+// trackRouteAccess tracks the access of an allowed request to its route.
+func (a *Authorize) trackRouteAccess(
+	req *evaluator.Request,
+	res *evaluator.Result,
+	s sessionOrServiceAccount,
+) {
+	if req.Policy == nil || s == nil || req.Session.ID == "" || !isAllowed(res.Allow, res.Deny) {
+		return
+	}
+
+	routeID, err := req.Policy.RouteID()
+	if err != nil {
+		return
+	}
+
+	_, isServiceAccount := s.(*user.ServiceAccount)
+	a.accessTracker.TrackRouteAccess(RouteAccess{
+		SessionID:      req.Session.ID,
+		UserID:         s.GetUserId(),
+		ServiceAccount: isServiceAccount,
+		RouteID:        strconv.FormatUint(routeID, 10),
+		Route:          req.Policy.From,
+		SourceIP:       req.HTTP.IP,
+		Time:           time.Now(),
+	})
+}
+
+// GetAccessHistory gets the access history of a session or service account.
+func GetAccessHistory(
+	ctx context.Context,
+	client databroker.DataBrokerServiceClient,
+	sessionID string,
+) (*AccessHistory, error) {
+	histories, err := queryAccessHistories(ctx, client, sessionID, func(h *AccessHistory) bool {
+		return h.SessionID == sessionID
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(histories) == 0 {
+		return nil, status.Error(codes.NotFound, "access history not found")
+	}
+	return histories[0], nil
+}
+
+// ListAccessHistoriesForUser lists the access histories of the sessions and
+// service accounts of a user.
+func ListAccessHistoriesForUser(
+	ctx context.Context,
+	client databroker.DataBrokerServiceClient,
+	userID string,
+) ([]*AccessHistory, error) {
+	return queryAccessHistories(ctx, client, userID, func(h *AccessHistory) bool {
+		return h.UserID == userID
+	})
+}
+
+// queryAccessHistories queries the access history records matching the query
+// and the filter, and merges the records of each session.
+func queryAccessHistories(
+	ctx context.Context,
+	client databroker.DataBrokerServiceClient,
+	query string,
+	filter func(h *AccessHistory) bool,
+) ([]*AccessHistory, error) {
+	res, err := client.Query(ctx, &databroker.QueryRequest{
+		Type:  accessHistoryType,
+		Query: query,
+		Limit: accessHistoryCapacity,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the query matches any field, so only keep the matching histories
+	var histories []*AccessHistory
+	lookup := make(map[string]*AccessHistory)
+	for _, record := range res.GetRecords() {
+		h, err := decodeAccessHistoryRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		if !filter(h) {
+			continue
+		}
+		if existing, ok := lookup[h.SessionID]; ok {
+			existing.mergeHistory(h)
+			continue
+		}
+		lookup[h.SessionID] = h
+		histories = append(histories, h)
+	}
+	return histories, nil
+}
+
+// AccessHistoryHandler returns an http handler which renders the access
+// history of a session, or of all the sessions of a user, as JSON.
+func (a *Authorize) AccessHistoryHandler() http.Handler {
+	return httputil.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		client := a.GetDataBrokerServiceClient()
+
+		histories := []*AccessHistory{}
+		switch {
+		case r.FormValue("session_id") != "":
+			h, err := GetAccessHistory(r.Context(), client, r.FormValue("session_id"))
+			if status.Code(err) == codes.NotFound {
+				break
+			} else if err != nil {
+				return err
+			}
+			histories = append(histories, h)
+		case r.FormValue("user_id") != "":
+			hs, err := ListAccessHistoriesForUser(r.Context(), client, r.FormValue("user_id"))
+			if err != nil {
+				return err
+			}
+			histories = append(histories, hs...)
+		default:
+			return httputil.NewError(http.StatusBadRequest, fmt.Errorf("session_id or user_id is required"))
+		}
+
+		httputil.RenderJSON(w, http.StatusOK, map[string]any{
+			"histories": histories,
+		})
+		return nil
+	})
+}
+
+// updateAccessHistory merges the pending history with the history stored in
+// the databroker.
+func (tracker *AccessTracker) updateAccessHistory(
+	ctx context.Context,
+	client databroker.DataBrokerServiceClient,
+	pending *AccessHistory,
+) error {
+	ctx, clearTimeout := context.WithTimeout(ctx, accessTrackerUpdateTimeout)
+	defer clearTimeout()
+
+	if !tracker.hasSetAccessHistoryCapacity {
+		_, err := client.SetOptions(ctx, &databroker.SetOptionsRequest{
+			Type: accessHistoryType,
+			Options: &databroker.Options{
+				Capacity: proto.Uint64(accessHistoryCapacity),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("error setting access history capacity: %w", err)
+		}
+		tracker.hasSetAccessHistoryCapacity = true
+	}
+
+	// each replica only updates its own record of the session's history, so
+	// that concurrent updates from other replicas aren't overwritten
+	var h *AccessHistory
+	res, err := client.Get(ctx, &databroker.GetRequest{
+		Type: accessHistoryType,
+		Id:   accessHistoryRecordID(pending.SessionID, tracker.replicaID),
+	})
+	switch {
+	case status.Code(err) == codes.NotFound:
+		h = &AccessHistory{SessionID: pending.SessionID}
+	case err != nil:
+		return err
+	default:
+		if h, err = decodeAccessHistoryRecord(res.GetRecord()); err != nil {
+			return err
+		}
+	}
+	h.UserID = pending.UserID
+	h.ServiceAccount = pending.ServiceAccount
+	for _, entry := range pending.Entries {
+		h.merge(entry)
+	}
+
+	record, err := newAccessHistoryRecord(h, tracker.replicaID)
+	if err != nil {
+		return err
+	}
+	_, err = client.Put(ctx, &databroker.PutRequest{Records: []*databroker.Record{record}})
+	return err
+}
+
+// accessHistoryRecordID returns the id of a replica's record of a session's
+// access history.
+func accessHistoryRecordID(sessionID, replicaID string) string {
+	return sessionID + "/" + replicaID
+}
+
+func newAccessHistoryRecord(h *AccessHistory, replicaID string) (*databroker.Record, error) {
+	bs, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	data := new(structpb.Struct)
+	if err := data.UnmarshalJSON(bs); err != nil {
+		return nil, err
+	}
+	return &databroker.Record{
+		Type: accessHistoryType,
+		Id:   accessHistoryRecordID(h.SessionID, replicaID),
+		Data: protoutil.NewAny(data),
+	}, nil
+}
+
+func decodeAccessHistoryRecord(record *databroker.Record) (*AccessHistory, error) {
+	var data structpb.Struct
+	if err := record.GetData().UnmarshalTo(&data); err != nil {
+		return nil, err
+	}
+	bs, err := data.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	h := new(AccessHistory)
+	if err := json.Unmarshal(bs, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
@@ -0,0 +1,224 @@
+package authorize
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type testAccessHistoryClient struct {
+	databroker.DataBrokerServiceClient
+
+	mu      sync.Mutex
+	records map[string]*databroker.Record
+}
+
+func (client *testAccessHistoryClient) GetDataBrokerServiceClient() databroker.DataBrokerServiceClient {
+	return client
+}
+
+func (client *testAccessHistoryClient) Get(_ context.Context, in *databroker.GetRequest, _ ...grpc.CallOption) (*databroker.GetResponse, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	record, ok := client.records[in.GetType()+"/"+in.GetId()]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	return &databroker.GetResponse{Record: proto.Clone(record).(*databroker.Record)}, nil
+}
+
+func (client *testAccessHistoryClient) Put(_ context.Context, in *databroker.PutRequest, _ ...grpc.CallOption) (*databroker.PutResponse, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	for _, record := range in.GetRecords() {
+		client.records[record.GetType()+"/"+record.GetId()] = proto.Clone(record).(*databroker.Record)
+	}
+	return &databroker.PutResponse{Records: in.GetRecords()}, nil
+}
+
+func (client *testAccessHistoryClient) Query(_ context.Context, in *databroker.QueryRequest, _ ...grpc.CallOption) (*databroker.QueryResponse, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	res := new(databroker.QueryResponse)
+	for _, record := range client.records {
+		var data structpb.Struct
+		_ = record.GetData().UnmarshalTo(&data)
+		bs, _ := data.MarshalJSON()
+		if record.GetType() == in.GetType() && strings.Contains(string(bs), in.GetQuery()) {
+			res.Records = append(res.Records, record)
+		}
+	}
+	return res, nil
+}
+
+func (client *testAccessHistoryClient) SetOptions(_ context.Context, in *databroker.SetOptionsRequest, _ ...grpc.CallOption) (*databroker.SetOptionsResponse, error) {
+	return &databroker.SetOptionsResponse{Options: in.GetOptions()}, nil
+}
+
+func TestAccessHistory(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	h := new(AccessHistory)
+	h.add(RouteAccess{RouteID: "1", Route: "https://a.example.com", SourceIP: "10.0.0.1", Time: start.Add(time.Minute)})
+	h.add(RouteAccess{RouteID: "1", Route: "https://a.example.com", SourceIP: "10.0.0.1", Time: start})
+	h.add(RouteAccess{RouteID: "2", Route: "https://b.example.com", SourceIP: "10.0.0.1", Time: start.Add(2 * time.Minute)})
+	assert.Equal(t, []AccessHistoryEntry{
+		{
+			RouteID: "2", Route: "https://b.example.com", SourceIP: "10.0.0.1",
+			FirstSeen: start.Add(2 * time.Minute), LastSeen: start.Add(2 * time.Minute), Count: 1,
+		},
+		{
+			RouteID: "1", Route: "https://a.example.com", SourceIP: "10.0.0.1",
+			FirstSeen: start, LastSeen: start.Add(time.Minute), Count: 2,
+		},
+	}, h.Entries)
+
+	for i := 0; i < accessHistoryMaxEntries; i++ {
+		h.add(RouteAccess{RouteID: fmt.Sprint(i + 10), Time: start.Add(time.Hour)})
+	}
+	assert.Len(t, h.Entries, accessHistoryMaxEntries)
+	for _, e := range h.Entries {
+		assert.Equal(t, start.Add(time.Hour), e.LastSeen, "should drop the least recently seen entries")
+	}
+}
+
+func TestAccessTracker_routeAccess(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	client := &testAccessHistoryClient{records: make(map[string]*databroker.Record)}
+	tracker := NewAccessTracker(client, 200, time.Millisecond*100)
+	go tracker.Run(ctx)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	tracker.TrackRouteAccess(RouteAccess{
+		SessionID: "s1", UserID: "u1", RouteID: "1", Route: "https://a.example.com", SourceIP: "10.0.0.1", Time: now,
+	})
+	tracker.TrackRouteAccess(RouteAccess{
+		SessionID: "s1", UserID: "u1", RouteID: "1", Route: "https://a.example.com", SourceIP: "10.0.0.1", Time: now,
+	})
+	tracker.TrackRouteAccess(RouteAccess{
+		SessionID: "s2", UserID: "u2", RouteID: "1", Route: "https://a.example.com", SourceIP: "10.0.0.2", Time: now,
+	})
+
+	assert.Eventually(t, func() bool {
+		h, err := GetAccessHistory(ctx, client, "s1")
+		return err == nil && len(h.Entries) == 1 && h.Entries[0].Count == 2
+	}, time.Second*10, time.Millisecond*10)
+
+	// accesses submitted later are added to the stored history
+	tracker.TrackRouteAccess(RouteAccess{
+		SessionID: "s1", UserID: "u1", RouteID: "1", Route: "https://a.example.com", SourceIP: "10.0.0.1", Time: now.Add(time.Second),
+	})
+	assert.Eventually(t, func() bool {
+		h, err := GetAccessHistory(ctx, client, "s1")
+		return err == nil && len(h.Entries) == 1 && h.Entries[0].Count == 3
+	}, time.Second*10, time.Millisecond*10)
+
+	histories, err := ListAccessHistoriesForUser(ctx, client, "u2")
+	require.NoError(t, err)
+	assert.Equal(t, []*AccessHistory{{
+		SessionID: "s2",
+		UserID:    "u2",
+		Entries: []AccessHistoryEntry{{
+			RouteID: "1", Route: "https://a.example.com", SourceIP: "10.0.0.2",
+			FirstSeen: now, LastSeen: now, Count: 1,
+		}},
+	}}, histories)
+}
+
+func TestAccessTracker_replicas(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	// both replicas update the history of the same session at the same time
+	client := &testAccessHistoryClient{records: make(map[string]*databroker.Record)}
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := 0; i < 2; i++ {
+		tracker := NewAccessTracker(client, 200, time.Millisecond*100)
+		go tracker.Run(ctx)
+		for j := 0; j < 3; j++ {
+			tracker.TrackRouteAccess(RouteAccess{
+				SessionID: "s1", UserID: "u1", RouteID: "1", Route: "https://a.example.com", SourceIP: "10.0.0.1",
+				Time: now.Add(time.Duration(i) * time.Second),
+			})
+		}
+	}
+
+	assert.Eventually(t, func() bool {
+		h, err := GetAccessHistory(ctx, client, "s1")
+		return err == nil && len(h.Entries) == 1 && h.Entries[0].Count == 6
+	}, time.Second*10, time.Millisecond*10, "should merge the histories of both replicas")
+
+	h, err := GetAccessHistory(ctx, client, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, []AccessHistoryEntry{{
+		RouteID: "1", Route: "https://a.example.com", SourceIP: "10.0.0.1",
+		FirstSeen: now, LastSeen: now.Add(time.Second), Count: 6,
+	}}, h.Entries)
+
+	histories, err := ListAccessHistoriesForUser(ctx, client, "u1")
+	require.NoError(t, err)
+	assert.Len(t, histories, 1)
+}
+
+func TestAuthorize_AccessHistoryHandler(t *testing.T) {
+	t.Parallel()
+
+	client := &testAccessHistoryClient{records: make(map[string]*databroker.Record)}
+	record, err := newAccessHistoryRecord(&AccessHistory{SessionID: "s1", UserID: "u1"}, "r1")
+	require.NoError(t, err)
+	_, err = client.Put(context.Background(), &databroker.PutRequest{Records: []*databroker.Record{record}})
+	require.NoError(t, err)
+
+	a := &Authorize{state: atomicutil.NewValue(&authorizeState{dataBrokerClient: client})}
+
+	for _, tc := range []struct {
+		query  string
+		status int
+		count  int
+	}{
+		{"session_id=s1", http.StatusOK, 1},
+		{"session_id=s2", http.StatusOK, 0},
+		{"user_id=u1", http.StatusOK, 1},
+		{"", http.StatusBadRequest, 0},
+	} {
+		w := httptest.NewRecorder()
+		a.AccessHistoryHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?"+tc.query, nil))
+		if !assert.Equal(t, tc.status, w.Code, tc.query) || tc.status != http.StatusOK {
+			continue
+		}
+
+		var res struct {
+			Histories []*AccessHistory `json:"histories"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Len(t, res.Histories, tc.count, tc.query)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -32,10 +33,17 @@ type AccessTracker struct {
 	provider               AccessTrackerProvider
 	sessionAccesses        chan string
 	serviceAccountAccesses chan string
+	routeAccesses          chan RouteAccess
 	maxSize                int
 	debouncePeriod         time.Duration
 
 	droppedAccesses int64
+
+	// replicaID identifies the access history records written by this
+	// tracker
+	replicaID string
+
+	hasSetAccessHistoryCapacity bool
 }
 
 // NewAccessTracker creates a new SessionAccessTracker.
@@ -48,8 +56,10 @@ func NewAccessTracker(
 		provider:               provider,
 		sessionAccesses:        make(chan string, maxSize),
 		serviceAccountAccesses: make(chan string, maxSize),
+		routeAccesses:          make(chan RouteAccess, maxSize),
 		maxSize:                maxSize,
 		debouncePeriod:         debouncePeriod,
+		replicaID:              uuid.New().String(),
 	}
 }
 
@@ -66,6 +76,22 @@ func (tracker *AccessTracker) Run(ctx context.Context) {
 	runTrackServiceAccountAccess := func(serviceAccountID string) {
 		serviceAccountAccesses.Add(serviceAccountID)
 	}
+	// histories holds the accesses to routes since the last submit, by session
+	histories := make(map[string]*AccessHistory)
+	runTrackRouteAccess := func(access RouteAccess) {
+		h, ok := histories[access.SessionID]
+		if !ok {
+			if len(histories) >= tracker.maxSize {
+				atomic.AddInt64(&tracker.droppedAccesses, 1)
+				return
+			}
+			h = &AccessHistory{SessionID: access.SessionID}
+			histories[access.SessionID] = h
+		}
+		h.UserID = access.UserID
+		h.ServiceAccount = access.ServiceAccount
+		h.add(access)
+	}
 	runSubmit := func() {
 		if dropped := atomic.SwapInt64(&tracker.droppedAccesses, 0); dropped > 0 {
 			log.Error(ctx).
@@ -97,6 +123,15 @@ func (tracker *AccessTracker) Run(ctx context.Context) {
 
 		sessionAccesses = sets.NewSizeLimited[string](tracker.maxSize)
 		serviceAccountAccesses = sets.NewSizeLimited[string](tracker.maxSize)
+
+		for sessionID, h := range histories {
+			err = tracker.updateAccessHistory(ctx, client, h)
+			if err != nil {
+				log.Error(ctx).Err(err).Msg("authorize: error updating access history")
+				return
+			}
+			delete(histories, sessionID)
+		}
 	}
 
 	for {
@@ -107,6 +142,8 @@ func (tracker *AccessTracker) Run(ctx context.Context) {
 			runTrackSessionAccess(id)
 		case id := <-tracker.serviceAccountAccesses:
 			runTrackServiceAccountAccess(id)
+		case access := <-tracker.routeAccesses:
+			runTrackRouteAccess(access)
 		case <-ticker.C:
 			runSubmit()
 		}
@@ -122,6 +159,15 @@ func (tracker *AccessTracker) TrackServiceAccountAccess(serviceAccountID string)
 	}
 }
 
+// TrackRouteAccess tracks an access to a route for the access history.
+func (tracker *AccessTracker) TrackRouteAccess(access RouteAccess) {
+	select {
+	case tracker.routeAccesses <- access:
+	default:
+		atomic.AddInt64(&tracker.droppedAccesses, 1)
+	}
+}
+
 // TrackSessionAccess tracks a session access.
 func (tracker *AccessTracker) TrackSessionAccess(sessionID string) {
 	select {
@@ -14,9 +14,12 @@ import (
 	"github.com/pomerium/pomerium/authorize/internal/store"
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/audit"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/ratelimit"
 	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/internal/tokenexchange"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 	"github.com/pomerium/pomerium/pkg/grpc"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
@@ -29,8 +32,16 @@ type Authorize struct {
 	store          *store.Store
 	currentOptions *atomicutil.Value[*config.Options]
 	accessTracker  *AccessTracker
+	denialTracker  *DenialTracker
+	auditChain     *audit.Chain
 	globalCache    storage.Cache
 
+	rateLimitCounter       *ratelimit.MemoryCounter
+	sharedRateLimitCounter *ratelimit.DataBrokerCounter
+	tokenExchangeCache     *tokenexchange.Cache
+	decisionCache          *evaluator.DecisionCache
+	decisionCacheSyncers   []*databroker.Syncer
+
 	// The stateLock prevents updating the evaluator store simultaneously with an evaluation.
 	// This should provide a consistent view of the data at a given server/record version and
 	// avoid partial updates.
@@ -42,11 +53,18 @@ func New(cfg *config.Config) (*Authorize, error) {
 	a := &Authorize{
 		currentOptions: config.NewAtomicOptions(),
 		store:          store.New(),
+		auditChain:     audit.NewChain(),
 		globalCache:    storage.NewGlobalCache(time.Minute),
 	}
 	a.accessTracker = NewAccessTracker(a, accessTrackerMaxSize, accessTrackerDebouncePeriod)
-
-	state, err := newAuthorizeStateFromConfig(cfg, a.store)
+	a.denialTracker = NewDenialTracker(denialTrackerWindow, denialTrackerResolution)
+	a.rateLimitCounter = ratelimit.NewMemoryCounter()
+	a.sharedRateLimitCounter = ratelimit.NewDataBrokerCounter(a)
+	a.tokenExchangeCache = newTokenExchangeCache()
+	a.decisionCache = evaluator.NewDecisionCache(decisionCacheSize, decisionCacheTTL, decisionCacheRecordTypes)
+	a.decisionCacheSyncers = newDecisionCacheSyncers(a)
+
+	state, err := newAuthorizeStateFromConfig(cfg, a.store, a.decisionCache, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -67,10 +85,27 @@ func (a *Authorize) Run(ctx context.Context) error {
 		a.accessTracker.Run(ctx)
 		return nil
 	})
+	eg.Go(func() error {
+		_ = a.sharedRateLimitCounter.Run(ctx)
+		return nil
+	})
+	for _, syncer := range a.decisionCacheSyncers {
+		syncer := syncer
+		eg.Go(func() error {
+			_ = syncer.Run(ctx)
+			return nil
+		})
+	}
 	eg.Go(func() error {
 		_ = grpc.WaitForReady(ctx, a.state.Load().dataBrokerClientConnection, time.Second*10)
 		return nil
 	})
+	eg.Go(func() error {
+		// write any queued audit records before exiting
+		<-ctx.Done()
+		a.state.Load().close(nil)
+		return nil
+	})
 	return eg.Wait()
 }
 
@@ -86,7 +121,11 @@ func validateOptions(o *config.Options) error {
 }
 
 // newPolicyEvaluator returns an policy evaluator.
-func newPolicyEvaluator(opts *config.Options, store *store.Store) (*evaluator.Evaluator, error) {
+func newPolicyEvaluator(
+	opts *config.Options,
+	store *store.Store,
+	decisionCache *evaluator.DecisionCache,
+) (*evaluator.Evaluator, error) {
 	metrics.AddPolicyCountCallback("pomerium-authorize", func() int64 {
 		return int64(len(opts.GetAllPolicies()))
 	})
@@ -116,15 +155,20 @@ func newPolicyEvaluator(opts *config.Options, store *store.Store) (*evaluator.Ev
 		evaluator.WithAuthenticateURL(authenticateURL.String()),
 		evaluator.WithGoogleCloudServerlessAuthenticationServiceAccount(opts.GetGoogleCloudServerlessAuthenticationServiceAccount()),
 		evaluator.WithJWTClaimsHeaders(opts.JWTClaimsHeaders),
+		evaluator.WithDecisionCache(decisionCache),
 	)
 }
 
 // OnConfigChange updates internal structures based on config.Options
 func (a *Authorize) OnConfigChange(ctx context.Context, cfg *config.Config) {
 	a.currentOptions.Store(cfg.Options)
-	if state, err := newAuthorizeStateFromConfig(cfg, a.store); err != nil {
+	previous := a.state.Load()
+	if state, err := newAuthorizeStateFromConfig(cfg, a.store, a.decisionCache, previous); err != nil {
 		log.Error(ctx).Err(err).Msg("authorize: error updating state")
 	} else {
 		a.state.Store(state)
+		previous.close(state)
+		// decisions made with the previous policies are no longer valid
+		a.decisionCache.Clear()
 	}
 }
@@ -2,12 +2,20 @@ package authorize
 
 import (
 	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/audit"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
 )
 
 func TestNew(t *testing.T) {
@@ -123,6 +131,70 @@ func TestAuthorize_OnConfigChange(t *testing.T) {
 	}
 }
 
+func TestAuthorize_OnConfigChangeAudit(t *testing.T) {
+	t.Parallel()
+
+	kek, err := cryptutil.GenerateKeyEncryptionKey()
+	require.NoError(t, err)
+
+	name := filepath.Join(t.TempDir(), "audit.jsonl")
+	o := &config.Options{
+		AuthenticateURLString: "https://authN.example.com",
+		DataBrokerURLString:   "https://databroker.example.com",
+		SharedKey:             "gXK6ggrlIW2HyKyUF9rUO4azrDgxhDPWqw9y+lJU7B8=",
+		Policies:              testPolicies(t),
+		AuditKey: &config.PublicKeyEncryptionKeyOptions{
+			ID:   kek.Public().ID(),
+			Data: base64.StdEncoding.EncodeToString(kek.Public().KeyBytes()),
+		},
+		AuditSinks: []config.AuditSinkOptions{{
+			Type:          config.AuditSinkTypeFile,
+			Path:          name,
+			FlushInterval: time.Millisecond,
+			Backpressure:  config.AuditSinkBackpressureBlock,
+		}},
+	}
+	a, err := New(&config.Config{Options: o})
+	require.NoError(t, err)
+
+	// log checks while the config is reloaded
+	ctx := context.Background()
+	done := make(chan struct{})
+	var eg errgroup.Group
+	for i := 0; i < 4; i++ {
+		eg.Go(func() error {
+			for {
+				select {
+				case <-done:
+					return nil
+				default:
+				}
+				a.logAuthorizeCheck(ctx, new(envoy_service_auth_v3.CheckRequest), new(envoy_service_auth_v3.CheckResponse), nil, nil, nil)
+			}
+		})
+	}
+	for i := 0; i < 10; i++ {
+		time.Sleep(5 * time.Millisecond)
+		a.OnConfigChange(ctx, &config.Config{Options: o})
+	}
+	close(done)
+	require.NoError(t, eg.Wait())
+	a.state.Load().close(nil)
+
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	v := audit.NewVerifier(nil)
+	require.NoError(t, audit.ReadEntries(f, func(line int, entry *audit.Entry) error {
+		v.Add(name, line, entry)
+		return nil
+	}))
+	assert.Greater(t, v.Count(), 0)
+	assert.Equal(t, 1, v.Chains())
+	assert.Empty(t, v.Problems())
+}
+
 func testPolicies(t *testing.T) []config.Policy {
 	testPolicy := config.Policy{
 		From:         "https://pomerium.io",
@@ -138,3 +210,35 @@ func testPolicies(t *testing.T) []config.Policy {
 	}
 	return policies
 }
+
+func TestNewAuditSinks(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	name := filepath.Join(t.TempDir(), "audit.jsonl")
+	sinks, err := newAuditSinks(&config.Options{
+		AuditSinks: []config.AuditSinkOptions{{Type: config.AuditSinkTypeFile, Path: name}},
+	}, nil, nil)
+	require.NoError(t, err)
+	previous := &authorizeState{auditSinks: sinks}
+
+	o := &config.Options{
+		AuditSinks: []config.AuditSinkOptions{
+			{Type: config.AuditSinkTypeFile, Path: name, MaxBackups: 2},
+			{Type: config.AuditSinkTypeFile, Path: filepath.Join(t.TempDir(), "missing", "audit.jsonl")},
+		},
+	}
+	_, err = newAuditSinks(o, nil, previous)
+	assert.Error(t, err)
+	assert.True(t, previous.auditSinks[0].Add(ctx, &audit.Entry{RequestID: "r1"}),
+		"should keep the previous file sink open if a sink can't be created")
+
+	o.AuditSinks = o.AuditSinks[:1]
+	sinks, err = newAuditSinks(o, nil, previous)
+	require.NoError(t, err)
+	assert.False(t, previous.auditSinks[0].Add(ctx, &audit.Entry{RequestID: "r2"}),
+		"should close the replaced file sink")
+	next := &authorizeState{auditSinks: sinks}
+	previous.close(next)
+	next.close(nil)
+}
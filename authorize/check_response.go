@@ -3,11 +3,13 @@ package authorize
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 
 	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
@@ -22,6 +24,7 @@ import (
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/telemetry/requestid"
 	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/contextutil"
 	"github.com/pomerium/pomerium/pkg/policy/criteria"
 	"github.com/pomerium/pomerium/pkg/webauthnutil"
 )
@@ -36,7 +39,17 @@ func (a *Authorize) handleResult(
 	// logged in yet, so redirect to authenticate
 	if result.Allow.Reasons.Has(criteria.ReasonUserUnauthenticated) ||
 		result.Deny.Reasons.Has(criteria.ReasonUserUnauthenticated) {
-		return a.requireLoginResponse(ctx, in, request)
+		return a.requireLoginResponse(ctx, in, request, result)
+	}
+
+	// when the max auth age is exceeded or the authentication context
+	// doesn't match it means they need to log in again, so redirect to
+	// authenticate. Only the reasons of the rule deciding the request are
+	// used, since a deny rule which didn't match reports them too.
+	if decidingResult := getDecidingResult(result); decidingResult != nil &&
+		(decidingResult.Reasons.Has(criteria.ReasonMaxAuthAgeExceeded) ||
+			decidingResult.Reasons.Has(criteria.ReasonACRUnauthorized)) {
+		return a.requireLoginResponse(ctx, in, request, result)
 	}
 
 	// when the user's device is unauthenticated it means they haven't
@@ -75,6 +88,12 @@ func (a *Authorize) handleResultDenied(
 	result *evaluator.Result,
 	reasons criteria.Reasons,
 ) (*envoy_service_auth_v3.CheckResponse, error) {
+	// only show the reasons, explanation and remediation to users when the
+	// route has show_error_details enabled
+	if request != nil && request.Policy != nil && request.Policy.ShowErrorDetails {
+		ctx = withDeniedResult(ctx, reasons, result.Traces)
+	}
+
 	denyStatusCode := int32(http.StatusForbidden)
 	denyStatusText := http.StatusText(http.StatusForbidden)
 
@@ -90,6 +109,15 @@ func (a *Authorize) handleResultDenied(
 	case reasons.Has(criteria.ReasonInvalidClientCertificate):
 		denyStatusCode = httputil.StatusInvalidClientCertificate
 		denyStatusText = httputil.DetailsText(httputil.StatusInvalidClientCertificate)
+	case reasons.Has(criteria.ReasonRateLimited):
+		var headers map[string]string
+		if retryAfter, ok := getAdditionalData(result, "retry_after"); ok {
+			headers = map[string]string{"Retry-After": retryAfter}
+		}
+		return a.deniedResponse(ctx, in, http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests), headers)
+	case reasons.Has(criteria.ReasonTokenExchangeFailed):
+		denyStatusCode = http.StatusBadGateway
+		denyStatusText = http.StatusText(http.StatusBadGateway)
 	}
 
 	return a.deniedResponse(ctx, in, denyStatusCode, denyStatusText, nil)
@@ -119,6 +147,12 @@ func (a *Authorize) deniedResponse(
 	in *envoy_service_auth_v3.CheckRequest,
 	code int32, reason string, headers map[string]string,
 ) (*envoy_service_auth_v3.CheckResponse, error) {
+	// gRPC clients don't understand http error pages, so return the error as
+	// a gRPC status
+	if isGRPCRequest(in) {
+		return a.grpcDeniedResponse(ctx, in, code, reason, headers), nil
+	}
+
 	respHeader := []*envoy_config_core_v3.HeaderValueOption{}
 
 	// create a http response writer recorder
@@ -136,6 +170,13 @@ func (a *Authorize) deniedResponse(
 		RequestID:       requestid.FromContext(ctx),
 		BrandingOptions: a.currentOptions.Load().BrandingOptions,
 	}
+	if dr, ok := ctx.Value(deniedResultKey{}).(deniedResult); ok {
+		httpErr.Reasons = dr.reasons.Strings()
+		httpErr.Explanation, httpErr.Remediation = dr.explanation()
+	}
+	if policy := a.getMatchingPolicy(getCheckRequestURL(in)); policy != nil {
+		httpErr.Template = policy.GetDenyTemplate()
+	}
 	httpErr.ErrorResponse(ctx, w, r)
 
 	// transpose the go http response writer into a envoy response
@@ -169,15 +210,58 @@ func (a *Authorize) deniedResponse(
 	}, nil
 }
 
+// grpcDeniedResponse returns a trailers-only gRPC response with the gRPC
+// status for the http status code. Any headers are returned as metadata.
+func (a *Authorize) grpcDeniedResponse(
+	ctx context.Context,
+	in *envoy_service_auth_v3.CheckRequest,
+	code int32, reason string, headers map[string]string,
+) *envoy_service_auth_v3.CheckResponse {
+	grpcCode := grpcCodeForHTTPStatus(int(code))
+
+	respHeaders := http.Header{}
+	for k, v := range headers {
+		respHeaders.Set(k, v)
+	}
+	if requestID := requestid.FromContext(ctx); requestID != "" {
+		respHeaders.Set("X-Request-Id", requestID)
+	}
+
+	// gRPC-Web clients expect the same content type they sent
+	respHeader := []*envoy_config_core_v3.HeaderValueOption{
+		mkHeader("content-type", in.GetAttributes().GetRequest().GetHttp().GetHeaders()["content-type"]),
+		mkHeader("grpc-status", strconv.Itoa(int(grpcCode))),
+		mkHeader("grpc-message", encodeGRPCMessage(reason)),
+	}
+	for _, h := range toEnvoyHeaders(respHeaders) {
+		h.Header.Key = strings.ToLower(h.Header.Key)
+		respHeader = append(respHeader, h)
+	}
+
+	return &envoy_service_auth_v3.CheckResponse{
+		Status: &status.Status{Code: int32(grpcCode), Message: reason},
+		HttpResponse: &envoy_service_auth_v3.CheckResponse_DeniedResponse{
+			DeniedResponse: &envoy_service_auth_v3.DeniedHttpResponse{
+				// gRPC errors are always sent with a 200 status code
+				Status: &envoy_type_v3.HttpStatus{
+					Code: envoy_type_v3.StatusCode_OK,
+				},
+				Headers: respHeader,
+			},
+		},
+	}
+}
+
 func (a *Authorize) requireLoginResponse(
 	ctx context.Context,
 	in *envoy_service_auth_v3.CheckRequest,
 	request *evaluator.Request,
+	result *evaluator.Result,
 ) (*envoy_service_auth_v3.CheckResponse, error) {
 	options := a.currentOptions.Load()
 	state := a.state.Load()
 
-	if !a.shouldRedirect(in) {
+	if !a.shouldRedirect(in) && !isGRPCRequest(in) {
 		return a.deniedResponse(ctx, in, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized), nil)
 	}
 
@@ -186,7 +270,9 @@ func (a *Authorize) requireLoginResponse(
 		return nil, err
 	}
 
-	idp, err := options.GetIdentityProviderForPolicy(request.Policy)
+	// with several identity providers the id is empty, and authenticate lets
+	// the user choose one
+	idpID, err := options.GetSignInIdentityProviderIDForPolicy(request.Policy)
 	if err != nil {
 		return nil, err
 	}
@@ -200,17 +286,40 @@ func (a *Authorize) requireLoginResponse(
 	checkRequestURL := getCheckRequestURL(in)
 	checkRequestURL.Scheme = "https"
 
+	// if the policy has a max auth age or requires an authentication context,
+	// authenticate will require the user to log in again with the identity
+	// provider
+	signInURL := *authenticateURL
+	q := signInURL.Query()
+	if decidingResult := getDecidingResult(result); decidingResult != nil {
+		if maxAge, ok := decidingResult.AdditionalData["max_age"]; ok {
+			q.Set(urlutil.QueryMaxAge, fmt.Sprint(maxAge))
+		}
+		if acrValues, ok := decidingResult.AdditionalData["acr_values"]; ok {
+			q.Set(urlutil.QueryACRValues, fmt.Sprint(acrValues))
+		}
+	}
+	signInURL.RawQuery = q.Encode()
+
 	redirectTo, err := urlutil.SignInURL(
 		state.hpkePrivateKey,
 		authenticateHPKEPublicKey,
-		authenticateURL,
+		&signInURL,
 		&checkRequestURL,
-		idp.GetId(),
+		idpID,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	// gRPC clients can't follow redirects, so the sign in url is returned in
+	// the metadata instead
+	if isGRPCRequest(in) {
+		return a.deniedResponse(ctx, in, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized), map[string]string{
+			httputil.HeaderPomeriumSignInURL: redirectTo,
+		})
+	}
+
 	return a.deniedResponse(ctx, in, http.StatusFound, "Login", map[string]string{
 		"Location": redirectTo,
 	})
@@ -248,17 +357,67 @@ func (a *Authorize) requireWebAuthnResponse(
 		q.Set(urlutil.QueryDeviceType, webauthnutil.DefaultDeviceType)
 	}
 	q.Set(urlutil.QueryRedirectURI, checkRequestURL.String())
-	idp, err := opts.GetIdentityProviderForPolicy(request.Policy)
+	idpID, err := opts.GetSignInIdentityProviderIDForPolicy(request.Policy)
 	if err != nil {
 		return nil, err
 	}
-	q.Set(urlutil.QueryIdentityProviderID, idp.GetId())
+	q.Set(urlutil.QueryIdentityProviderID, idpID)
 	signinURL := urlutil.WebAuthnURL(getHTTPRequestFromCheckRequest(in), &checkRequestURL, state.sharedKey, q)
 	return a.deniedResponse(ctx, in, http.StatusFound, "Login", map[string]string{
 		"Location": signinURL,
 	})
 }
 
+// getAdditionalData returns additional data set by a criterion, like the max
+// auth age or acr values, as a string.
+func getAdditionalData(result *evaluator.Result, key string) (string, bool) {
+	for _, additionalData := range []map[string]interface{}{
+		result.Allow.AdditionalData,
+		result.Deny.AdditionalData,
+	} {
+		if v, ok := additionalData[key]; ok {
+			return fmt.Sprint(v), true
+		}
+	}
+	return "", false
+}
+
+// getDecidingResult returns the rule result which denied the request: the deny
+// result if a deny rule matched, otherwise the allow result. It returns nil if
+// the request is allowed.
+func getDecidingResult(result *evaluator.Result) *evaluator.RuleResult {
+	switch {
+	case result.Deny.Value:
+		return &result.Deny
+	case !result.Allow.Value:
+		return &result.Allow
+	}
+	return nil
+}
+
+type deniedResultKey struct{}
+
+// deniedResult is the part of a denied evaluator result that is shown to users.
+type deniedResult struct {
+	reasons criteria.Reasons
+	traces  []contextutil.PolicyEvaluationTrace
+}
+
+func withDeniedResult(ctx context.Context, reasons criteria.Reasons, traces []contextutil.PolicyEvaluationTrace) context.Context {
+	return context.WithValue(ctx, deniedResultKey{}, deniedResult{reasons: reasons, traces: traces})
+}
+
+// explanation returns the explanation and remediation of the first policy
+// that didn't allow the request.
+func (dr deniedResult) explanation() (explanation, remediation string) {
+	for _, trace := range dr.traces {
+		if (!trace.Allow || trace.Deny) && (trace.Explanation != "" || trace.Remediation != "") {
+			return trace.Explanation, trace.Remediation
+		}
+	}
+	return "", ""
+}
+
 func mkHeader(k, v string) *envoy_config_core_v3.HeaderValueOption {
 	return &envoy_config_core_v3.HeaderValueOption{
 		Header: &envoy_config_core_v3.HeaderValue{
@@ -308,6 +467,47 @@ func (a *Authorize) userInfoEndpointURL(in *envoy_service_auth_v3.CheckRequest)
 	return urlutil.NewSignedURL(a.state.Load().sharedKey, debugEndpoint).Sign(), nil
 }
 
+// isGRPCRequest returns true if the request is a gRPC or gRPC-Web request.
+func isGRPCRequest(in *envoy_service_auth_v3.CheckRequest) bool {
+	contentType := in.GetAttributes().GetRequest().GetHttp().GetHeaders()["content-type"]
+	return strings.HasPrefix(contentType, "application/grpc")
+}
+
+// grpcCodeForHTTPStatus returns the gRPC status code for a denied request's
+// http status code. It follows the gRPC http to gRPC status code mapping, and
+// any other client error is treated as a permission error.
+func grpcCodeForHTTPStatus(code int) codes.Code {
+	switch code {
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusNotFound:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return codes.Unavailable
+	}
+	if code >= http.StatusInternalServerError {
+		return codes.Unknown
+	}
+	return codes.PermissionDenied
+}
+
+// encodeGRPCMessage percent encodes a message for the grpc-message header.
+func encodeGRPCMessage(msg string) string {
+	var sb strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
 func (a *Authorize) shouldRedirect(in *envoy_service_auth_v3.CheckRequest) bool {
 	requestHeaders := in.GetAttributes().GetRequest().GetHttp().GetHeaders()
 	if requestHeaders == nil {
@@ -326,6 +526,7 @@ func (a *Authorize) shouldRedirect(in *envoy_service_auth_v3.CheckRequest) bool
 	mediaType, ok := accept.MostAcceptable([]string{
 		"text/html",
 		"application/json",
+		"application/problem+json",
 		"text/plain",
 		"application/grpc-web-text",
 		"application/grpc-web+proto",
@@ -2,6 +2,8 @@ package authorize
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -20,7 +22,11 @@ import (
 	"github.com/pomerium/pomerium/authorize/internal/store"
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/testutil"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/contextutil"
+	"github.com/pomerium/pomerium/pkg/hpke"
 	hpke_handlers "github.com/pomerium/pomerium/pkg/hpke/handlers"
 	"github.com/pomerium/pomerium/pkg/policy/criteria"
 )
@@ -89,6 +95,199 @@ func TestAuthorize_handleResult(t *testing.T) {
 			assert.NotNil(t, res.GetOkResponse())
 		})
 	})
+	t.Run("max-auth-age-exceeded", func(t *testing.T) {
+		res, err := a.handleResult(context.Background(),
+			&envoy_service_auth_v3.CheckRequest{},
+			&evaluator.Request{},
+			&evaluator.Result{
+				Allow: evaluator.NewRuleResult(false, criteria.ReasonMaxAuthAgeExceeded),
+			})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusFound, int(res.GetDeniedResponse().GetStatus().GetCode()))
+
+		res, err = a.handleResult(context.Background(),
+			&envoy_service_auth_v3.CheckRequest{},
+			&evaluator.Request{},
+			&evaluator.Result{
+				Deny: evaluator.NewRuleResult(true, criteria.ReasonMaxAuthAgeExceeded),
+			})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusFound, int(res.GetDeniedResponse().GetStatus().GetCode()))
+
+		t.Run("deny not matched", func(t *testing.T) {
+			res, err := a.handleResult(context.Background(),
+				&envoy_service_auth_v3.CheckRequest{},
+				&evaluator.Request{},
+				&evaluator.Result{
+					Allow: evaluator.NewRuleResult(true, criteria.ReasonUserOK),
+					Deny:  evaluator.NewRuleResult(false, criteria.ReasonMaxAuthAgeExceeded),
+				})
+			assert.NoError(t, err)
+			assert.NotNil(t, res.GetOkResponse(), "should not require a login for a deny rule which didn't match")
+
+			res, err = a.handleResult(context.Background(),
+				&envoy_service_auth_v3.CheckRequest{},
+				&evaluator.Request{},
+				&evaluator.Result{
+					Allow: evaluator.NewRuleResult(false, criteria.ReasonUserUnauthorized),
+					Deny:  evaluator.NewRuleResult(false, criteria.ReasonMaxAuthAgeExceeded),
+				})
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusForbidden, int(res.GetDeniedResponse().GetStatus().GetCode()))
+		})
+	})
+	t.Run("acr-unauthorized", func(t *testing.T) {
+		res, err := a.handleResult(context.Background(),
+			&envoy_service_auth_v3.CheckRequest{},
+			&evaluator.Request{},
+			&evaluator.Result{
+				Allow: evaluator.NewRuleResult(false, criteria.ReasonACRUnauthorized),
+			})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusFound, int(res.GetDeniedResponse().GetStatus().GetCode()))
+
+		t.Run("deny not matched", func(t *testing.T) {
+			// deny: { and: [acr: low, ...] } for a user with a high acr
+			res, err := a.handleResult(context.Background(),
+				&envoy_service_auth_v3.CheckRequest{},
+				&evaluator.Request{},
+				&evaluator.Result{
+					Allow: evaluator.NewRuleResult(true, criteria.ReasonUserOK),
+					Deny:  evaluator.NewRuleResult(false, criteria.ReasonACRUnauthorized),
+				})
+			assert.NoError(t, err)
+			assert.NotNil(t, res.GetOkResponse(), "should not require a login for a deny rule which didn't match")
+
+			res, err = a.handleResult(context.Background(),
+				&envoy_service_auth_v3.CheckRequest{},
+				&evaluator.Request{},
+				&evaluator.Result{
+					Allow: evaluator.NewRuleResult(false, criteria.ReasonUserUnauthorized),
+					Deny:  evaluator.NewRuleResult(false, criteria.ReasonACRUnauthorized),
+				})
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusForbidden, int(res.GetDeniedResponse().GetStatus().GetCode()))
+		})
+	})
+	t.Run("rate-limited", func(t *testing.T) {
+		result := &evaluator.Result{
+			Allow: evaluator.NewRuleResult(true, criteria.ReasonUserOK),
+			Deny:  evaluator.NewRuleResult(true, criteria.ReasonRateLimited),
+		}
+		result.Deny.AdditionalData["retry_after"] = 30
+		res, err := a.handleResult(context.Background(),
+			&envoy_service_auth_v3.CheckRequest{},
+			&evaluator.Request{},
+			result)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusTooManyRequests, int(res.GetDeniedResponse().GetStatus().GetCode()))
+		assert.Contains(t, res.GetDeniedResponse().GetHeaders(), mkHeader("Retry-After", "30"))
+	})
+	t.Run("token-exchange-failed", func(t *testing.T) {
+		res, err := a.handleResult(context.Background(),
+			&envoy_service_auth_v3.CheckRequest{},
+			&evaluator.Request{},
+			&evaluator.Result{
+				Allow: evaluator.NewRuleResult(true, criteria.ReasonUserOK),
+				Deny:  evaluator.NewRuleResult(true, criteria.ReasonTokenExchangeFailed),
+			})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadGateway, int(res.GetDeniedResponse().GetStatus().GetCode()))
+	})
+}
+
+func TestAuthorize_grpcDeniedResponse(t *testing.T) {
+	a := &Authorize{currentOptions: config.NewAtomicOptions(), state: atomicutil.NewValue(new(authorizeState))}
+
+	checkRequest := func(contentType string) *envoy_service_auth_v3.CheckRequest {
+		return &envoy_service_auth_v3.CheckRequest{
+			Attributes: &envoy_service_auth_v3.AttributeContext{
+				Request: &envoy_service_auth_v3.AttributeContext_Request{
+					Http: &envoy_service_auth_v3.AttributeContext_HttpRequest{
+						Method:  http.MethodPost,
+						Scheme:  "https",
+						Host:    "example.com",
+						Path:    "/example.v1.Service/Method",
+						Headers: map[string]string{"content-type": contentType},
+					},
+				},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		result      *evaluator.Result
+		code        codes.Code
+		message     string
+		headers     []*envoy_config_core_v3.HeaderValueOption
+	}{
+		{
+			name:        "permission denied",
+			contentType: "application/grpc",
+			result: &evaluator.Result{
+				Allow: evaluator.NewRuleResult(false, criteria.ReasonEmailUnauthorized),
+				Deny:  evaluator.NewRuleResult(false),
+			},
+			code:    codes.PermissionDenied,
+			message: "Forbidden",
+		},
+		{
+			name:        "grpc-web",
+			contentType: "application/grpc-web-text",
+			result: &evaluator.Result{
+				Allow: evaluator.NewRuleResult(false, criteria.ReasonEmailUnauthorized),
+				Deny:  evaluator.NewRuleResult(false),
+			},
+			code:    codes.PermissionDenied,
+			message: "Forbidden",
+		},
+		{
+			name:        "rate limited",
+			contentType: "application/grpc+proto",
+			result: func() *evaluator.Result {
+				result := &evaluator.Result{
+					Allow: evaluator.NewRuleResult(true, criteria.ReasonUserOK),
+					Deny:  evaluator.NewRuleResult(true, criteria.ReasonRateLimited),
+				}
+				result.Deny.AdditionalData["retry_after"] = 30
+				return result
+			}(),
+			code:    codes.Unavailable,
+			message: "Too Many Requests",
+			headers: []*envoy_config_core_v3.HeaderValueOption{mkHeader("retry-after", "30")},
+		},
+		{
+			name:        "route not found",
+			contentType: "application/grpc",
+			result: &evaluator.Result{
+				Deny: evaluator.NewRuleResult(true, criteria.ReasonRouteNotFound),
+			},
+			code:    codes.Unimplemented,
+			message: "Not Found",
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := a.handleResult(context.Background(), checkRequest(tc.contentType), &evaluator.Request{}, tc.result)
+			require.NoError(t, err)
+			assert.Equal(t, int32(tc.code), res.GetStatus().GetCode())
+			assert.Equal(t, http.StatusOK, int(res.GetDeniedResponse().GetStatus().GetCode()),
+				"gRPC errors should be trailers-only responses")
+			assert.Empty(t, res.GetDeniedResponse().GetBody())
+			assert.Equal(t, append([]*envoy_config_core_v3.HeaderValueOption{
+				mkHeader("content-type", tc.contentType),
+				mkHeader("grpc-status", fmt.Sprint(int(tc.code))),
+				mkHeader("grpc-message", tc.message),
+			}, tc.headers...), res.GetDeniedResponse().GetHeaders())
+		})
+	}
+}
+
+func TestEncodeGRPCMessage(t *testing.T) {
+	assert.Equal(t, "Forbidden", encodeGRPCMessage("Forbidden"))
+	assert.Equal(t, "100%25 denied%0A%C3%A9", encodeGRPCMessage("100% denied\né"))
 }
 
 func TestAuthorize_okResponse(t *testing.T) {
@@ -106,7 +305,7 @@ func TestAuthorize_okResponse(t *testing.T) {
 	a := &Authorize{currentOptions: config.NewAtomicOptions(), state: atomicutil.NewValue(new(authorizeState))}
 	a.currentOptions.Store(opt)
 	a.store = store.New()
-	pe, err := newPolicyEvaluator(opt, a.store)
+	pe, err := newPolicyEvaluator(opt, a.store, nil)
 	require.NoError(t, err)
 	a.state.Load().evaluator = pe
 
@@ -211,6 +410,81 @@ func TestAuthorize_deniedResponse(t *testing.T) {
 	}
 }
 
+func TestAuthorize_deniedResponseDetails(t *testing.T) {
+	policy := config.Policy{
+		From:         "https://example.com",
+		To:           mustParseWeightedURLs(t, "https://to.example.com"),
+		DenyTemplate: `<p>{{.Status}} {{range .Reasons}}{{.}}{{end}} {{.Explanation}} {{.Remediation}}</p>`,
+	}
+	require.NoError(t, policy.Validate())
+
+	a := &Authorize{currentOptions: config.NewAtomicOptions(), state: atomicutil.NewValue(new(authorizeState))}
+	a.currentOptions.Store(&config.Options{Policies: []config.Policy{policy}})
+
+	checkRequest := func(accept string) *envoy_service_auth_v3.CheckRequest {
+		return &envoy_service_auth_v3.CheckRequest{
+			Attributes: &envoy_service_auth_v3.AttributeContext{
+				Request: &envoy_service_auth_v3.AttributeContext_Request{
+					Http: &envoy_service_auth_v3.AttributeContext_HttpRequest{
+						Method:  http.MethodGet,
+						Scheme:  "https",
+						Host:    "example.com",
+						Path:    "/",
+						Headers: map[string]string{"accept": accept},
+					},
+				},
+			},
+		}
+	}
+	result := &evaluator.Result{
+		Allow: evaluator.NewRuleResult(false, criteria.ReasonEmailUnauthorized),
+		Deny:  evaluator.NewRuleResult(false),
+		Traces: []contextutil.PolicyEvaluationTrace{
+			{ID: "p1", Allow: false, Explanation: "admins only", Remediation: "ask an admin"},
+		},
+	}
+	detailsPolicy := policy
+	detailsPolicy.ShowErrorDetails = true
+	request := &evaluator.Request{Policy: &detailsPolicy}
+
+	t.Run("template", func(t *testing.T) {
+		res, err := a.handleResult(context.Background(), checkRequest("text/html"), request, result)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, int(res.GetDeniedResponse().GetStatus().GetCode()))
+		assert.Equal(t, "<p>403 email-unauthorized admins only ask an admin</p>", res.GetDeniedResponse().GetBody())
+	})
+	t.Run("problem json", func(t *testing.T) {
+		res, err := a.handleResult(context.Background(), checkRequest("application/problem+json"), request, result)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, int(res.GetDeniedResponse().GetStatus().GetCode()))
+		assert.Contains(t, res.GetDeniedResponse().GetHeaders(), mkHeader("Content-Type", "application/problem+json"))
+		assert.JSONEq(t, `{
+			"title": "Forbidden",
+			"status": 403,
+			"reasons": ["email-unauthorized"],
+			"explanation": "admins only",
+			"remediation": "ask an admin"
+		}`, res.GetDeniedResponse().GetBody())
+	})
+	t.Run("hidden without show error details", func(t *testing.T) {
+		request := &evaluator.Request{Policy: &policy}
+
+		res, err := a.handleResult(context.Background(), checkRequest("text/html"), request, result)
+		require.NoError(t, err)
+		assert.Equal(t, "<p>403   </p>", res.GetDeniedResponse().GetBody())
+
+		res, err = a.handleResult(context.Background(), checkRequest("application/problem+json"), request, result)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+			"title": "Forbidden",
+			"status": 403
+		}`, res.GetDeniedResponse().GetBody())
+	})
+	t.Run("unauthenticated api client", func(t *testing.T) {
+		assert.False(t, a.shouldRedirect(checkRequest("application/problem+json")))
+	})
+}
+
 func mustParseWeightedURLs(t *testing.T, urls ...string) []config.WeightedURL {
 	wu, err := config.ParseWeightedUrls(urls...)
 	require.NoError(t, err)
@@ -238,7 +512,8 @@ func TestRequireLogin(t *testing.T) {
 	t.Run("accept empty", func(t *testing.T) {
 		res, err := a.requireLoginResponse(context.Background(),
 			&envoy_service_auth_v3.CheckRequest{},
-			&evaluator.Request{})
+			&evaluator.Request{},
+			&evaluator.Result{})
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusFound, int(res.GetDeniedResponse().GetStatus().GetCode()))
 	})
@@ -255,7 +530,8 @@ func TestRequireLogin(t *testing.T) {
 					},
 				},
 			},
-			&evaluator.Request{})
+			&evaluator.Request{},
+			&evaluator.Result{})
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusFound, int(res.GetDeniedResponse().GetStatus().GetCode()))
 	})
@@ -272,8 +548,68 @@ func TestRequireLogin(t *testing.T) {
 					},
 				},
 			},
-			&evaluator.Request{})
+			&evaluator.Request{},
+			&evaluator.Result{})
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusUnauthorized, int(res.GetDeniedResponse().GetStatus().GetCode()))
 	})
+	t.Run("grpc", func(t *testing.T) {
+		res, err := a.requireLoginResponse(context.Background(),
+			&envoy_service_auth_v3.CheckRequest{
+				Attributes: &envoy_service_auth_v3.AttributeContext{
+					Request: &envoy_service_auth_v3.AttributeContext_Request{
+						Http: &envoy_service_auth_v3.AttributeContext_HttpRequest{
+							Headers: map[string]string{
+								"content-type": "application/grpc",
+							},
+						},
+					},
+				},
+			},
+			&evaluator.Request{},
+			&evaluator.Result{})
+		require.NoError(t, err)
+		assert.Equal(t, int32(codes.Unauthenticated), res.GetStatus().GetCode())
+		assert.Equal(t, http.StatusOK, int(res.GetDeniedResponse().GetStatus().GetCode()))
+
+		var signInURL string
+		for _, h := range res.GetDeniedResponse().GetHeaders() {
+			assert.NotEqual(t, "Location", h.GetHeader().GetKey(), "should not redirect")
+			if h.GetHeader().GetKey() == httputil.HeaderPomeriumSignInURL {
+				signInURL = h.GetHeader().GetValue()
+			}
+		}
+		assert.Contains(t, signInURL, "/.pomerium/sign_in", "should return the sign in url")
+	})
+	t.Run("step up", func(t *testing.T) {
+		result := &evaluator.Result{
+			Allow: evaluator.NewRuleResult(false, criteria.ReasonMaxAuthAgeExceeded, criteria.ReasonACRUnauthorized),
+			Deny:  evaluator.NewRuleResult(false),
+		}
+		result.Allow.AdditionalData["max_age"] = json.Number("900")
+		result.Allow.AdditionalData["acr_values"] = "phrh phr"
+		// a deny rule which didn't match doesn't decide the step-up parameters
+		result.Deny.AdditionalData["max_age"] = json.Number("60")
+		result.Deny.AdditionalData["acr_values"] = "low"
+
+		res, err := a.requireLoginResponse(context.Background(),
+			&envoy_service_auth_v3.CheckRequest{},
+			&evaluator.Request{},
+			result)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusFound, int(res.GetDeniedResponse().GetStatus().GetCode()))
+
+		var location string
+		for _, h := range res.GetDeniedResponse().GetHeaders() {
+			if h.GetHeader().GetKey() == "Location" {
+				location = h.GetHeader().GetValue()
+			}
+		}
+		u, err := url.Parse(location)
+		require.NoError(t, err)
+		_, q, err := hpke.DecryptURLValues(hpkePrivateKey, u.Query())
+		require.NoError(t, err)
+		assert.Equal(t, "900", q.Get(urlutil.QueryMaxAge))
+		assert.Equal(t, "phrh phr", q.Get(urlutil.QueryACRValues))
+	})
 }
@@ -0,0 +1,63 @@
+package authorize
+
+import (
+	"context"
+	"time"
+
+	"github.com/pomerium/datasource/pkg/directory"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/device"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+const (
+	decisionCacheSize = 10_000
+	decisionCacheTTL  = 30 * time.Second
+)
+
+// decisionCacheRecordTypes are the types of the databroker records read by
+// policies. Only these types are synced, so decisions which depend on records
+// of other types aren't cached.
+var decisionCacheRecordTypes = []string{
+	grpcutil.GetTypeURL(new(session.Session)),
+	grpcutil.GetTypeURL(new(user.User)),
+	grpcutil.GetTypeURL(new(user.ServiceAccount)),
+	grpcutil.GetTypeURL(new(device.Credential)),
+	grpcutil.GetTypeURL(new(device.Enrollment)),
+	directory.UserRecordType,
+	directory.GroupRecordType,
+}
+
+// newDecisionCacheSyncers creates a syncer for each of the record types read
+// by policies.
+func newDecisionCacheSyncers(a *Authorize) []*databroker.Syncer {
+	var syncers []*databroker.Syncer
+	for _, recordType := range decisionCacheRecordTypes {
+		syncers = append(syncers, databroker.NewSyncer("authorize_decision_cache",
+			&decisionCacheInvalidator{a}, databroker.WithTypeURL(recordType)))
+	}
+	return syncers
+}
+
+// A decisionCacheInvalidator removes cached decisions when the databroker
+// records they depend on change.
+type decisionCacheInvalidator struct {
+	a *Authorize
+}
+
+func (i *decisionCacheInvalidator) GetDataBrokerServiceClient() databroker.DataBrokerServiceClient {
+	return i.a.GetDataBrokerServiceClient()
+}
+
+func (i *decisionCacheInvalidator) ClearRecords(_ context.Context) {
+	i.a.decisionCache.Clear()
+}
+
+func (i *decisionCacheInvalidator) UpdateRecords(_ context.Context, _ uint64, records []*databroker.Record) {
+	for _, record := range records {
+		i.a.decisionCache.Invalidate(record.GetType(), record.GetId())
+	}
+}
@@ -0,0 +1,167 @@
+package authorize
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+)
+
+const (
+	denialTrackerWindow     = time.Hour
+	denialTrackerResolution = time.Minute
+	// denialTrackerMaxKeys limits the number of users and routes counted in
+	// each bucket, so a flood of distinct keys can't exhaust memory
+	denialTrackerMaxKeys = 10_000
+	denialsDefaultLimit  = 10
+)
+
+// A DenialTracker counts denied requests by user and route over a rolling
+// window.
+type DenialTracker struct {
+	window     time.Duration
+	resolution time.Duration
+
+	mu      sync.Mutex
+	buckets []denialBucket
+}
+
+type denialBucket struct {
+	start  time.Time
+	users  map[string]uint64
+	routes map[string]uint64
+}
+
+// A DenialCount is the number of denied requests for a user or route.
+type DenialCount struct {
+	Key   string `json:"key"`
+	Count uint64 `json:"count"`
+}
+
+// A DenialReport lists the users and routes with the most denied requests.
+type DenialReport struct {
+	Window string        `json:"window"`
+	Users  []DenialCount `json:"users"`
+	Routes []DenialCount `json:"routes"`
+}
+
+// NewDenialTracker creates a new DenialTracker. Denials are counted in buckets
+// of the resolution, so the window moves forward in steps of the resolution.
+func NewDenialTracker(window, resolution time.Duration) *DenialTracker {
+	return &DenialTracker{
+		window:     window,
+		resolution: resolution,
+	}
+}
+
+// Record records a denied request. The user is empty for requests without a
+// user.
+func (t *DenialTracker) Record(now time.Time, route, userID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expire(now)
+
+	start := now.Truncate(t.resolution)
+	if len(t.buckets) == 0 || !t.buckets[len(t.buckets)-1].start.Equal(start) {
+		t.buckets = append(t.buckets, denialBucket{
+			start:  start,
+			users:  make(map[string]uint64),
+			routes: make(map[string]uint64),
+		})
+	}
+	b := &t.buckets[len(t.buckets)-1]
+
+	if userID != "" {
+		incrementDenialCount(b.users, userID)
+	}
+	incrementDenialCount(b.routes, route)
+}
+
+// Report returns the limit users and routes with the most denied requests in
+// the window.
+func (t *DenialTracker) Report(now time.Time, limit int) *DenialReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expire(now)
+
+	users := make(map[string]uint64)
+	routes := make(map[string]uint64)
+	for _, b := range t.buckets {
+		for k, v := range b.users {
+			users[k] += v
+		}
+		for k, v := range b.routes {
+			routes[k] += v
+		}
+	}
+
+	return &DenialReport{
+		Window: t.window.String(),
+		Users:  topDenialCounts(users, limit),
+		Routes: topDenialCounts(routes, limit),
+	}
+}
+
+// Handler returns an http handler which renders the report as JSON. The
+// number of users and routes can be set with the limit query parameter.
+func (t *DenialTracker) Handler() http.Handler {
+	return httputil.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		limit := denialsDefaultLimit
+		if raw := r.FormValue("limit"); raw != "" {
+			var err error
+			limit, err = strconv.Atoi(raw)
+			if err != nil || limit <= 0 {
+				return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid limit: %q", raw))
+			}
+		}
+
+		httputil.RenderJSON(w, http.StatusOK, t.Report(time.Now(), limit))
+		return nil
+	})
+}
+
+// DenialsHandler returns an http handler which lists the users and routes with
+// the most denied requests in the last hour.
+func (a *Authorize) DenialsHandler() http.Handler {
+	return a.denialTracker.Handler()
+}
+
+// expire removes the buckets that are no longer in the window.
+func (t *DenialTracker) expire(now time.Time) {
+	cutoff := now.Add(-t.window)
+	i := 0
+	for i < len(t.buckets) && !t.buckets[i].start.Add(t.resolution).After(cutoff) {
+		i++
+	}
+	t.buckets = t.buckets[i:]
+}
+
+func incrementDenialCount(counts map[string]uint64, key string) {
+	if _, ok := counts[key]; !ok && len(counts) >= denialTrackerMaxKeys {
+		return
+	}
+	counts[key]++
+}
+
+func topDenialCounts(counts map[string]uint64, limit int) []DenialCount {
+	top := make([]DenialCount, 0, len(counts))
+	for k, v := range counts {
+		top = append(top, DenialCount{Key: k, Count: v})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Key < top[j].Key
+	})
+	if len(top) > limit {
+		top = top[:limit]
+	}
+	return top
+}
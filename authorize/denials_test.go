@@ -0,0 +1,65 @@
+package authorize
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDenialTracker(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := NewDenialTracker(time.Hour, time.Minute)
+	tracker.Record(start, "https://a.example.com", "u1")
+	tracker.Record(start.Add(time.Minute), "https://a.example.com", "u1")
+	tracker.Record(start.Add(2*time.Minute), "https://b.example.com", "u2")
+	tracker.Record(start.Add(2*time.Minute), "https://b.example.com", "")
+	tracker.Record(start.Add(3*time.Minute), "https://b.example.com", "")
+
+	assert.Equal(t, &DenialReport{
+		Window: "1h0m0s",
+		Users: []DenialCount{
+			{Key: "u1", Count: 2},
+			{Key: "u2", Count: 1},
+		},
+		Routes: []DenialCount{
+			{Key: "https://b.example.com", Count: 3},
+			{Key: "https://a.example.com", Count: 2},
+		},
+	}, tracker.Report(start.Add(3*time.Minute), 10))
+
+	assert.Equal(t, &DenialReport{
+		Window: "1h0m0s",
+		Users:  []DenialCount{{Key: "u1", Count: 2}},
+		Routes: []DenialCount{{Key: "https://b.example.com", Count: 3}},
+	}, tracker.Report(start.Add(3*time.Minute), 1), "should limit the results")
+
+	assert.Equal(t, &DenialReport{
+		Window: "1h0m0s",
+		Users:  []DenialCount{{Key: "u2", Count: 1}},
+		Routes: []DenialCount{{Key: "https://b.example.com", Count: 3}},
+	}, tracker.Report(start.Add(62*time.Minute), 10), "should drop denials outside the window")
+
+	t.Run("handler", func(t *testing.T) {
+		tracker := NewDenialTracker(time.Hour, time.Minute)
+		tracker.Record(time.Now(), "https://a.example.com", "u1")
+
+		w := httptest.NewRecorder()
+		tracker.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?limit=5", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var report DenialReport
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Equal(t, []DenialCount{{Key: "u1", Count: 1}}, report.Users)
+
+		w = httptest.NewRecorder()
+		tracker.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?limit=x", nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,264 @@
+package authorize
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/contextutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// A DryRunRequest is a synthetic request to evaluate policy against.
+type DryRunRequest struct {
+	Method            string            `json:"method"`
+	URL               string            `json:"url"`
+	Headers           map[string]string `json:"headers"`
+	IP                string            `json:"ip"`
+	ClientCertificate string            `json:"client_certificate"`
+
+	// SessionID is the id of an existing session or service account.
+	SessionID string `json:"session_id"`
+	// UserID is used to create a temporary session for the user when no session
+	// id is given.
+	UserID string `json:"user_id"`
+}
+
+// A DryRunResponse is the result of evaluating a DryRunRequest.
+type DryRunResponse struct {
+	Allow DryRunRuleResult `json:"allow"`
+	Deny  DryRunRuleResult `json:"deny"`
+	Route *DryRunRoute     `json:"route,omitempty"`
+	// Headers are the headers which would be sent upstream, with credentials
+	// redacted.
+	Headers http.Header `json:"headers"`
+	// Assertion is the payload of the JWT assertion header. The signed JWT
+	// isn't returned, so it can't be used to make requests.
+	Assertion map[string]interface{}              `json:"assertion,omitempty"`
+	Traces    []contextutil.PolicyEvaluationTrace `json:"traces,omitempty"`
+	Shadow    *DryRunShadowResult                 `json:"shadow,omitempty"`
+}
+
+// dryRunRedactedHeaders are the headers whose values are credentials.
+var dryRunRedactedHeaders = []string{
+	httputil.HeaderAuthorization,
+	httputil.HeaderPomeriumAuthorization,
+	"Proxy-Authorization",
+}
+
+const dryRunRedacted = "REDACTED"
+
+// A DryRunShadowResult is the result of evaluating a route's shadow policy.
+type DryRunShadowResult struct {
+	Allow DryRunRuleResult `json:"allow"`
+	Deny  DryRunRuleResult `json:"deny"`
+}
+
+// A DryRunRuleResult is the result of evaluating an allow or deny rule.
+type DryRunRuleResult struct {
+	Value   bool     `json:"value"`
+	Reasons []string `json:"reasons"`
+}
+
+// A DryRunRoute is the route matched by a DryRunRequest.
+type DryRunRoute struct {
+	ID   uint64 `json:"id,string"`
+	From string `json:"from"`
+}
+
+// DryRun evaluates policy for a synthetic request. Unlike Check, it does not track
+// session access or write to the authorize log.
+func (a *Authorize) DryRun(ctx context.Context, in *DryRunRequest) (*DryRunResponse, error) {
+	ctx, span := trace.StartSpan(ctx, "authorize.DryRun")
+	defer span.End()
+
+	requestURL, err := urlutil.ParseAndValidateURL(in.URL)
+	if err != nil {
+		return nil, httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid url: %w", err))
+	}
+
+	state := a.state.Load()
+
+	var querier storage.Querier = storage.NewCachingQuerier(
+		storage.NewQuerier(state.dataBrokerClient),
+		a.globalCache,
+	)
+
+	sessionID := in.SessionID
+	if sessionID == "" && in.UserID != "" {
+		// the session only exists for the duration of this evaluation
+		s := newDryRunSession(in.UserID)
+		sessionID = s.GetId()
+		querier = dryRunQuerier{storage.NewStaticQuerier(s), querier}
+	}
+	ctx = storage.WithQuerier(ctx, querier)
+
+	headers := make(map[string]string, len(in.Headers))
+	for k, v := range in.Headers {
+		headers[http.CanonicalHeaderKey(k)] = v
+	}
+
+	method := in.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req := &evaluator.Request{
+		HTTP: evaluator.NewRequestHTTP(
+			method,
+			*requestURL,
+			headers,
+			in.ClientCertificate,
+			in.IP,
+		),
+		Session: evaluator.RequestSession{
+			ID: sessionID,
+		},
+		Policy: a.getMatchingPolicy(*requestURL),
+		// a dry run shouldn't affect the decisions of real requests
+		SkipDecisionCache: true,
+	}
+
+	a.stateLock.RLock()
+	res, err := state.evaluator.Evaluate(ctx, req)
+	a.stateLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	redactedHeaders, assertion, err := redactDryRunHeaders(res.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &DryRunResponse{
+		Allow:     newDryRunRuleResult(res.Allow),
+		Deny:      newDryRunRuleResult(res.Deny),
+		Headers:   redactedHeaders,
+		Assertion: assertion,
+		Traces:    res.Traces,
+	}
+	if res.Shadow != nil {
+		out.Shadow = &DryRunShadowResult{
+			Allow: newDryRunRuleResult(res.Shadow.Allow),
+			Deny:  newDryRunRuleResult(res.Shadow.Deny),
+		}
+	}
+	if req.Policy != nil {
+		id, err := req.Policy.RouteID()
+		if err != nil {
+			return nil, err
+		}
+		out.Route = &DryRunRoute{
+			ID:   id,
+			From: req.Policy.From,
+		}
+	}
+	return out, nil
+}
+
+// DryRunHandler returns an http handler for DryRun. The handler accepts a JSON
+// DryRunRequest and returns a JSON DryRunResponse.
+func (a *Authorize) DryRunHandler() http.Handler {
+	return httputil.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if r.Method != http.MethodPost {
+			return httputil.NewError(http.StatusMethodNotAllowed, fmt.Errorf("unsupported method: %s", r.Method))
+		}
+
+		var in DryRunRequest
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid dry run request: %w", err))
+		}
+
+		out, err := a.DryRun(r.Context(), &in)
+		if err != nil {
+			return err
+		}
+
+		httputil.RenderJSON(w, http.StatusOK, out)
+		return nil
+	})
+}
+
+func newDryRunRuleResult(r evaluator.RuleResult) DryRunRuleResult {
+	reasons := r.Reasons.Strings()
+	if reasons == nil {
+		reasons = []string{}
+	}
+	return DryRunRuleResult{
+		Value:   r.Value,
+		Reasons: reasons,
+	}
+}
+
+// redactDryRunHeaders removes the credentials from the headers. The payload of
+// the JWT assertion is returned without its signature.
+func redactDryRunHeaders(src http.Header) (http.Header, map[string]interface{}, error) {
+	dst := src.Clone()
+	if dst == nil {
+		dst = make(http.Header)
+	}
+
+	var assertion map[string]interface{}
+	if rawJWT := dst.Get(httputil.HeaderPomeriumJWTAssertion); rawJWT != "" {
+		tok, err := jwt.ParseSigned(rawJWT)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid jwt assertion: %w", err)
+		}
+		// the assertion was just signed by authorize, so there's no need
+		// to verify it
+		if err := tok.UnsafeClaimsWithoutVerification(&assertion); err != nil {
+			return nil, nil, fmt.Errorf("invalid jwt assertion: %w", err)
+		}
+	}
+	dst.Del(httputil.HeaderPomeriumJWTAssertion)
+	dst.Del(httputil.HeaderPomeriumJWTAssertionFor)
+
+	for _, k := range dryRunRedactedHeaders {
+		if _, ok := dst[http.CanonicalHeaderKey(k)]; ok {
+			dst.Set(k, dryRunRedacted)
+		}
+	}
+	return dst, assertion, nil
+}
+
+func newDryRunSession(userID string) *session.Session {
+	now := time.Now()
+	return &session.Session{
+		Id:         "dry-run-" + uuid.New().String(),
+		UserId:     userID,
+		IssuedAt:   timestamppb.New(now),
+		AccessedAt: timestamppb.New(now),
+		ExpiresAt:  timestamppb.New(now.Add(time.Hour)),
+	}
+}
+
+// dryRunQuerier returns records from the first querier that has them.
+type dryRunQuerier [2]storage.Querier
+
+func (q dryRunQuerier) InvalidateCache(ctx context.Context, in *databroker.QueryRequest) {
+	for _, qq := range q {
+		qq.InvalidateCache(ctx, in)
+	}
+}
+
+func (q dryRunQuerier) Query(ctx context.Context, in *databroker.QueryRequest, opts ...grpc.CallOption) (*databroker.QueryResponse, error) {
+	res, err := q[0].Query(ctx, in, opts...)
+	if err == nil && len(res.GetRecords()) > 0 {
+		return res, nil
+	}
+	return q[1].Query(ctx, in, opts...)
+}
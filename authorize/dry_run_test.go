@@ -0,0 +1,96 @@
+package authorize
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/policy/criteria"
+)
+
+func TestAuthorize_DryRun(t *testing.T) {
+	t.Parallel()
+
+	opt := config.NewDefaultOptions()
+	opt.AuthenticateURLString = "https://authenticate.example.com"
+	opt.DataBrokerURLString = "https://databroker.example.com"
+	opt.SharedKey = "E8wWIMnihUx+AUfRegAQDNs8eRb3UrB5G3zlJW9XJDM="
+	opt.Policies = []config.Policy{{
+		From:         "https://from.example.com",
+		To:           mustParseWeightedURLs(t, "https://to.example.com"),
+		AllowedUsers: []string{"user-1"},
+
+		KubernetesServiceAccountToken: "KUBERNETES_TOKEN",
+	}}
+	require.NoError(t, opt.Validate())
+
+	a, err := New(&config.Config{Options: opt})
+	require.NoError(t, err)
+	a.OnConfigChange(context.Background(), &config.Config{Options: opt})
+
+	t.Run("allowed", func(t *testing.T) {
+		res, err := a.DryRun(context.Background(), &DryRunRequest{
+			URL:    "https://from.example.com/path",
+			UserID: "user-1",
+		})
+		require.NoError(t, err)
+		assert.True(t, res.Allow.Value)
+		assert.Contains(t, res.Allow.Reasons, string(criteria.ReasonUserOK))
+		assert.False(t, res.Deny.Value)
+		routeID, err := opt.Policies[0].RouteID()
+		require.NoError(t, err)
+		assert.Equal(t, &DryRunRoute{ID: routeID, From: "https://from.example.com"}, res.Route)
+	})
+	t.Run("credentials", func(t *testing.T) {
+		res, err := a.DryRun(context.Background(), &DryRunRequest{
+			URL:    "https://from.example.com/path",
+			UserID: "user-1",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "REDACTED", res.Headers.Get("Authorization"))
+		assert.Empty(t, res.Headers.Get("X-Pomerium-Jwt-Assertion"))
+		assert.Equal(t, "user-1", res.Assertion["sub"])
+	})
+	t.Run("denied", func(t *testing.T) {
+		res, err := a.DryRun(context.Background(), &DryRunRequest{
+			URL:    "https://from.example.com/path",
+			UserID: "user-2",
+		})
+		require.NoError(t, err)
+		assert.False(t, res.Allow.Value)
+		assert.Contains(t, res.Allow.Reasons, string(criteria.ReasonUserUnauthorized))
+	})
+	t.Run("route not found", func(t *testing.T) {
+		res, err := a.DryRun(context.Background(), &DryRunRequest{
+			URL: "https://unknown.example.com",
+		})
+		require.NoError(t, err)
+		assert.True(t, res.Deny.Value)
+		assert.Equal(t, []string{string(criteria.ReasonRouteNotFound)}, res.Deny.Reasons)
+		assert.Nil(t, res.Route)
+	})
+	t.Run("handler", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/debug/authorize/dry-run",
+			strings.NewReader(`{"url":"https://from.example.com","user_id":"user-1"}`))
+		a.DryRunHandler().ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var res DryRunResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.True(t, res.Allow.Value)
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodPost, "/debug/authorize/dry-run",
+			strings.NewReader(`{"url":"not a url"}`))
+		a.DryRunHandler().ServeHTTP(w, r)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -11,6 +11,7 @@ type evaluatorConfig struct {
 	authenticateURL                                   string
 	googleCloudServerlessAuthenticationServiceAccount string
 	jwtClaimsHeaders                                  config.JWTClaimHeaders
+	decisionCache                                     *DecisionCache
 }
 
 // An Option customizes the evaluator config.
@@ -66,3 +67,11 @@ func WithJWTClaimsHeaders(headers config.JWTClaimHeaders) Option {
 		cfg.jwtClaimsHeaders = headers
 	}
 }
+
+// WithDecisionCache sets the decision cache used to cache the results of
+// policy evaluation in the config.
+func WithDecisionCache(decisionCache *DecisionCache) Option {
+	return func(cfg *evaluatorConfig) {
+		cfg.decisionCache = decisionCache
+	}
+}
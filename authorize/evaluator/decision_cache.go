@@ -0,0 +1,432 @@
+package evaluator
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+	"github.com/open-policy-agent/opa/ast"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// A DecisionCache caches the results of policy evaluation. Entries expire
+// after the TTL, and are removed when one of the databroker records they
+// were computed from changes. Only changes to records of the cache's record
+// types are seen, so results which depend on records of other types aren't
+// cached.
+type DecisionCache struct {
+	ttl         time.Duration
+	recordTypes map[string]struct{}
+
+	mu      sync.Mutex
+	entries *simplelru.LRU[uint64, *decisionCacheEntry]
+	// dependents maps a record dependency to the keys of the entries which
+	// depend on it
+	dependents map[string]map[uint64]struct{}
+	// evaluations are the policy evaluations in progress
+	evaluations map[*decisionCacheEvaluation]struct{}
+}
+
+type decisionCacheEntry struct {
+	res          *PolicyResponse
+	expiry       time.Time
+	dependencies []string
+}
+
+// A decisionCacheEvaluation records the dependencies invalidated while a policy
+// is evaluated, so that results which may already be stale aren't stored.
+type decisionCacheEvaluation struct {
+	cleared     bool
+	invalidated map[string]struct{}
+}
+
+// NewDecisionCache creates a new DecisionCache which holds at most size
+// entries. The record types are the types of the databroker records whose
+// changes are passed to Invalidate.
+func NewDecisionCache(size int, ttl time.Duration, recordTypes []string) *DecisionCache {
+	c := &DecisionCache{
+		ttl:         ttl,
+		recordTypes: make(map[string]struct{}, len(recordTypes)),
+		dependents:  make(map[string]map[uint64]struct{}),
+		evaluations: make(map[*decisionCacheEvaluation]struct{}),
+	}
+	for _, recordType := range recordTypes {
+		c.recordTypes[recordType] = struct{}{}
+	}
+	var err error
+	c.entries, err = simplelru.NewLRU(size, c.onEvict)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Invalidate removes any entries which depend on the given record.
+func (c *DecisionCache) Invalidate(recordType, recordID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, dependency := range []string{recordType, recordType + "/" + recordID} {
+		for key := range c.dependents[dependency] {
+			c.entries.Remove(key)
+		}
+		for evaluation := range c.evaluations {
+			evaluation.invalidated[dependency] = struct{}{}
+		}
+	}
+}
+
+// Clear removes all the entries.
+func (c *DecisionCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries.Purge()
+	c.dependents = make(map[string]map[uint64]struct{})
+	for evaluation := range c.evaluations {
+		evaluation.cleared = true
+	}
+}
+
+func (c *DecisionCache) get(key uint64, now time.Time) (*PolicyResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries.Get(key)
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(entry.expiry) {
+		c.entries.Remove(key)
+		return nil, false
+	}
+	return entry.res.clone(), true
+}
+
+// begin starts tracking the invalidations during a policy evaluation. Either
+// set or end must be called once the evaluation is done.
+func (c *DecisionCache) begin() *decisionCacheEvaluation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	evaluation := &decisionCacheEvaluation{invalidated: make(map[string]struct{})}
+	c.evaluations[evaluation] = struct{}{}
+	return evaluation
+}
+
+// end stops tracking the invalidations during a policy evaluation.
+func (c *DecisionCache) end(evaluation *decisionCacheEvaluation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.evaluations, evaluation)
+}
+
+func (c *DecisionCache) set(
+	key uint64,
+	evaluation *decisionCacheEvaluation,
+	res *PolicyResponse,
+	dependencies []string,
+	recordTypes []string,
+	now time.Time,
+) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.evaluations, evaluation)
+
+	// the result may already be stale if a record it depends on changed during
+	// evaluation
+	if evaluation.cleared {
+		return
+	}
+	for _, dependency := range dependencies {
+		if _, ok := evaluation.invalidated[dependency]; ok {
+			return
+		}
+	}
+	// changes to records of other types aren't seen, so the result can't be
+	// invalidated
+	for _, recordType := range recordTypes {
+		if _, ok := c.recordTypes[recordType]; !ok {
+			return
+		}
+	}
+
+	c.entries.Remove(key)
+	c.entries.Add(key, &decisionCacheEntry{
+		res:          res.clone(),
+		expiry:       now.Add(c.ttl),
+		dependencies: dependencies,
+	})
+	for _, dependency := range dependencies {
+		keys, ok := c.dependents[dependency]
+		if !ok {
+			keys = make(map[uint64]struct{})
+			c.dependents[dependency] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+func (c *DecisionCache) onEvict(key uint64, entry *decisionCacheEntry) {
+	for _, dependency := range entry.dependencies {
+		delete(c.dependents[dependency], key)
+		if len(c.dependents[dependency]) == 0 {
+			delete(c.dependents, dependency)
+		}
+	}
+}
+
+// evaluatePolicy evaluates the policy, using the decision cache if the policy
+// can be cached.
+func (e *Evaluator) evaluatePolicy(ctx context.Context, policyEvaluator *PolicyEvaluator, req *PolicyRequest) (*PolicyResponse, error) {
+	if e.decisionCache == nil || !policyEvaluator.cacheable {
+		return policyEvaluator.Evaluate(ctx, req)
+	}
+
+	key, err := policyEvaluator.cacheKey(req)
+	if err != nil {
+		return policyEvaluator.Evaluate(ctx, req)
+	}
+	key ^= e.cacheSalt
+	if res, ok := e.decisionCache.get(key, time.Now()); ok {
+		return res, nil
+	}
+
+	evaluation := e.decisionCache.begin()
+	recorder := newDependencyRecorder(storage.GetQuerier(ctx))
+	res, err := policyEvaluator.Evaluate(storage.WithQuerier(ctx, recorder), req)
+	if err != nil {
+		e.decisionCache.end(evaluation)
+		return nil, err
+	}
+	e.decisionCache.set(key, evaluation, res, recorder.getDependencies(), recorder.getRecordTypes(), time.Now())
+	return res, nil
+}
+
+// A dependencyRecorder records the databroker records queried during policy
+// evaluation. Records are identified by type and id, or by type alone if a
+// query could match any record of the type.
+type dependencyRecorder struct {
+	storage.Querier
+
+	mu           sync.Mutex
+	dependencies map[string]struct{}
+	recordTypes  map[string]struct{}
+}
+
+func newDependencyRecorder(querier storage.Querier) *dependencyRecorder {
+	return &dependencyRecorder{
+		Querier:      querier,
+		dependencies: make(map[string]struct{}),
+		recordTypes:  make(map[string]struct{}),
+	}
+}
+
+func (r *dependencyRecorder) Query(
+	ctx context.Context,
+	in *databroker.QueryRequest,
+	opts ...grpc.CallOption,
+) (*databroker.QueryResponse, error) {
+	res, err := r.Querier.Query(ctx, in, opts...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.recordTypes[in.GetType()] = struct{}{}
+	if ids, ok := getQueryRecordIDs(in); ok {
+		for _, id := range ids {
+			r.dependencies[in.GetType()+"/"+id] = struct{}{}
+		}
+	} else {
+		r.dependencies[in.GetType()] = struct{}{}
+	}
+	for _, record := range res.GetRecords() {
+		r.recordTypes[record.GetType()] = struct{}{}
+		r.dependencies[record.GetType()+"/"+record.GetId()] = struct{}{}
+	}
+
+	return res, err
+}
+
+func (r *dependencyRecorder) getDependencies() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dependencies := make([]string, 0, len(r.dependencies))
+	for dependency := range r.dependencies {
+		dependencies = append(dependencies, dependency)
+	}
+	return dependencies
+}
+
+func (r *dependencyRecorder) getRecordTypes() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	recordTypes := make([]string, 0, len(r.recordTypes))
+	for recordType := range r.recordTypes {
+		recordTypes = append(recordTypes, recordType)
+	}
+	return recordTypes
+}
+
+// getQueryRecordIDs returns the ids of the records a query can match. Index
+// values are treated as ids, so a record added later under a different id
+// with a matching index is only seen once the entry expires. If the query
+// could match records by anything else, false is returned.
+func getQueryRecordIDs(in *databroker.QueryRequest) ([]string, bool) {
+	if in.GetQuery() != "" || in.GetFilter() == nil {
+		return nil, false
+	}
+	return getFilterRecordIDs(in.GetFilter())
+}
+
+func getFilterRecordIDs(filter *structpb.Struct) ([]string, bool) {
+	var ids []string
+	for k, v := range filter.GetFields() {
+		switch k {
+		case "id", "$index":
+			id, ok := v.GetKind().(*structpb.Value_StringValue)
+			if !ok {
+				return nil, false
+			}
+			ids = append(ids, id.StringValue)
+		case "$or":
+			for _, vv := range v.GetListValue().GetValues() {
+				s := vv.GetStructValue()
+				if s == nil {
+					return nil, false
+				}
+				subIDs, ok := getFilterRecordIDs(s)
+				if !ok {
+					return nil, false
+				}
+				ids = append(ids, subIDs...)
+			}
+		default:
+			return nil, false
+		}
+	}
+	return ids, len(ids) > 0
+}
+
+// uncacheableFunctions are functions which aren't built in to rego, but whose
+// results can change between evaluations.
+var uncacheableFunctions = map[string]struct{}{
+	"http_callout": {},
+}
+
+// policyInputs are the fields of a PolicyRequest which are used by a policy.
+// Fields are named by their path in the rego input, i.e. "http.headers".
+type policyInputs map[string]struct{}
+
+// getPolicyInputs returns the inputs used by the rego scripts. If the result
+// of the scripts may change even though the inputs and the databroker records
+// remain the same, false is returned.
+func getPolicyInputs(scripts ...string) (policyInputs, bool) {
+	inputs := make(policyInputs)
+	cacheable := true
+	for _, script := range scripts {
+		module, err := ast.ParseModule("pomerium.policy", script)
+		if err != nil && strings.Contains(err.Error(), "package expected") {
+			module, err = ast.ParseModule("pomerium.policy", "package pomerium.policy\n\n"+script)
+		}
+		if err != nil {
+			return nil, false
+		}
+
+		ast.WalkRefs(module, func(ref ast.Ref) bool {
+			name := ref.String()
+			if builtin, ok := ast.BuiltinMap[name]; ok && builtin.Nondeterministic {
+				cacheable = false
+			} else if _, ok := uncacheableFunctions[name]; ok {
+				cacheable = false
+			}
+			if ref.HasPrefix(ast.InputRootRef) {
+				inputs.add(ref)
+			}
+			return false
+		})
+	}
+	return inputs, cacheable
+}
+
+// add adds the input field referenced. References to the whole input, or to
+// fields which can't be determined, add every field.
+func (inputs policyInputs) add(ref ast.Ref) {
+	var path []string
+	for _, term := range ref[1:] {
+		s, ok := term.Value.(ast.String)
+		if !ok {
+			break
+		}
+		path = append(path, string(s))
+		if len(path) == 2 {
+			break
+		}
+	}
+
+	switch {
+	case len(path) == 0:
+		inputs["*"] = struct{}{}
+	case len(path) == 1:
+		inputs[path[0]+".*"] = struct{}{}
+	default:
+		inputs[strings.Join(path, ".")] = struct{}{}
+	}
+}
+
+func (inputs policyInputs) has(path string) bool {
+	for _, p := range []string{"*", strings.SplitN(path, ".", 2)[0] + ".*", path} {
+		if _, ok := inputs[p]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns a copy of the request with only the fields used by the
+// policy.
+func (inputs policyInputs) filter(req *PolicyRequest) *PolicyRequest {
+	if inputs.has("*") {
+		return req
+	}
+
+	filtered := &PolicyRequest{Route: req.Route}
+	if inputs.has("http.method") {
+		filtered.HTTP.Method = req.HTTP.Method
+	}
+	if inputs.has("http.path") {
+		filtered.HTTP.Path = req.HTTP.Path
+	}
+	if inputs.has("http.url") {
+		filtered.HTTP.URL = req.HTTP.URL
+	}
+	if inputs.has("http.query") {
+		filtered.HTTP.Query = req.HTTP.Query
+	}
+	if inputs.has("http.headers") {
+		filtered.HTTP.Headers = req.HTTP.Headers
+	}
+	if inputs.has("http.client_certificate") {
+		filtered.HTTP.ClientCertificate = req.HTTP.ClientCertificate
+	}
+	if inputs.has("http.ip") {
+		filtered.HTTP.IP = req.HTTP.IP
+	}
+	if inputs.has("session.id") {
+		filtered.Session = req.Session
+	}
+	if inputs.has("is_valid_client_certificate") {
+		filtered.IsValidClientCertificate = req.IsValidClientCertificate
+	}
+	return filtered
+}
@@ -0,0 +1,205 @@
+package evaluator
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/pomerium/pomerium/authorize/internal/store"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+type countingQuerier struct {
+	storage.Querier
+	calls int64
+}
+
+func (q *countingQuerier) Query(ctx context.Context, in *databroker.QueryRequest, opts ...grpc.CallOption) (*databroker.QueryResponse, error) {
+	atomic.AddInt64(&q.calls, 1)
+	return q.Querier.Query(ctx, in, opts...)
+}
+
+func TestDecisionCache(t *testing.T) {
+	t.Parallel()
+
+	policies := []config.Policy{
+		{
+			From:         "https://from.example.com",
+			To:           config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+			AllowedUsers: []string{"a@example.com"},
+		},
+		{
+			From:         "https://time.example.com",
+			To:           config.WeightedURLs{{URL: *mustParseURL("https://to-time.example.com")}},
+			AllowedUsers: []string{"a@example.com"},
+			SubPolicies: []config.SubPolicy{{
+				Rego: []string{"allow { time.now_ns() > 0 }"},
+			}},
+		},
+	}
+
+	querier := &countingQuerier{Querier: storage.NewStaticQuerier(
+		&session.Session{Id: "s1", UserId: "u1"},
+		&user.User{Id: "u1", Email: "a@example.com"},
+	)}
+	ctx := storage.WithQuerier(context.Background(), querier)
+
+	cache := NewDecisionCache(10, time.Minute, []string{
+		"type.googleapis.com/session.Session",
+		"type.googleapis.com/user.User",
+		"type.googleapis.com/user.ServiceAccount",
+	})
+	e, err := New(ctx, store.New(), WithPolicies(policies), WithDecisionCache(cache))
+	require.NoError(t, err)
+
+	// eval returns the number of databroker queries made, which includes the
+	// queries of the headers evaluator
+	eval := func(policy *config.Policy, path string) int64 {
+		before := atomic.LoadInt64(&querier.calls)
+		res, err := e.Evaluate(ctx, &Request{
+			Policy:  policy,
+			HTTP:    RequestHTTP{Method: "GET", Path: path},
+			Session: RequestSession{ID: "s1"},
+		})
+		require.NoError(t, err)
+		assert.True(t, res.Allow.Value)
+		return atomic.LoadInt64(&querier.calls) - before
+	}
+
+	uncached := eval(&policies[0], "/a")
+	cached := eval(&policies[0], "/b")
+	assert.Less(t, cached, uncached,
+		"should use the cached decision for inputs the policy doesn't use")
+
+	cache.Invalidate("type.googleapis.com/user.User", "u2")
+	assert.Equal(t, cached, eval(&policies[0], "/a"),
+		"should keep decisions which don't depend on the record")
+
+	cache.Invalidate("type.googleapis.com/user.User", "u1")
+	assert.Equal(t, uncached, eval(&policies[0], "/a"),
+		"should evaluate the policy again when a record changes")
+
+	cache.Clear()
+	assert.Equal(t, uncached, eval(&policies[0], "/a"),
+		"should evaluate the policy again when the cache is cleared")
+
+	res, err := e.Evaluate(ctx, &Request{
+		Policy:            &policies[0],
+		HTTP:              RequestHTTP{Method: "GET", Path: "/a"},
+		Session:           RequestSession{ID: "s2"},
+		SkipDecisionCache: true,
+	})
+	require.NoError(t, err)
+	assert.False(t, res.Allow.Value)
+	assert.Equal(t, 1, cache.entries.Len(),
+		"should not store decisions when skipping the cache")
+
+	uncached = eval(&policies[1], "/a")
+	assert.Equal(t, uncached, eval(&policies[1], "/a"),
+		"should not cache time dependent policies")
+}
+
+func TestDecisionCacheExpiry(t *testing.T) {
+	t.Parallel()
+
+	cache := NewDecisionCache(1, time.Minute, []string{"type", "other"})
+	now := time.Now()
+	cache.set(1, cache.begin(), NewPolicyResponse(), []string{"type/1"}, []string{"type"}, now)
+
+	_, ok := cache.get(1, now.Add(time.Second))
+	assert.True(t, ok)
+	_, ok = cache.get(1, now.Add(time.Minute))
+	assert.False(t, ok, "should expire entries after the ttl")
+
+	evaluation := cache.begin()
+	cache.Invalidate("type", "1")
+	cache.set(1, evaluation, NewPolicyResponse(), []string{"type/1"}, []string{"type"}, now)
+	_, ok = cache.get(1, now)
+	assert.False(t, ok, "should not store results whose dependencies changed during evaluation")
+
+	evaluation = cache.begin()
+	cache.Invalidate("type", "2")
+	cache.Invalidate("other", "1")
+	cache.set(1, evaluation, NewPolicyResponse(), []string{"type/1"}, []string{"type"}, now)
+	_, ok = cache.get(1, now)
+	assert.True(t, ok, "should store results when other records changed during evaluation")
+
+	evaluation = cache.begin()
+	cache.Clear()
+	cache.set(1, evaluation, NewPolicyResponse(), []string{"type/1"}, []string{"type"}, now)
+	_, ok = cache.get(1, now)
+	assert.False(t, ok, "should not store results computed while the cache was cleared")
+
+	cache.set(1, cache.begin(), NewPolicyResponse(), []string{"unknown/1"}, []string{"unknown"}, now)
+	_, ok = cache.get(1, now)
+	assert.False(t, ok, "should not store results which depend on records of other types")
+	assert.Empty(t, cache.evaluations)
+
+	cache.set(1, cache.begin(), NewPolicyResponse(), []string{"type/1"}, []string{"type"}, now)
+	cache.set(2, cache.begin(), NewPolicyResponse(), []string{"type/2"}, []string{"type"}, now)
+	_, ok = cache.get(1, now)
+	assert.False(t, ok, "should evict the least recently used entries")
+	assert.Equal(t, map[string]map[uint64]struct{}{"type/2": {2: {}}}, cache.dependents)
+}
+
+func TestGetPolicyInputs(t *testing.T) {
+	t.Parallel()
+
+	inputs, cacheable := getPolicyInputs(`
+allow {
+	input.http.headers["X-Example"] == "1"
+	get_databroker_record("type", input.session.id)
+}`)
+	assert.True(t, cacheable)
+	assert.Equal(t, policyInputs{"http.headers": {}, "session.id": {}}, inputs)
+	assert.Equal(t, &PolicyRequest{
+		HTTP:    RequestHTTP{Headers: map[string]string{"X-Example": "1"}},
+		Session: RequestSession{ID: "s1"},
+		Route:   RequestRoute{ID: "1"},
+	}, inputs.filter(&PolicyRequest{
+		HTTP:    RequestHTTP{Method: "GET", Path: "/", Headers: map[string]string{"X-Example": "1"}},
+		Session: RequestSession{ID: "s1"},
+		Route:   RequestRoute{ID: "1"},
+	}))
+
+	inputs, _ = getPolicyInputs(`allow { object.get(input.http, "method", "") == "GET" }`)
+	assert.True(t, inputs.has("http.path"), "should include every field of a referenced object")
+
+	inputs, _ = getPolicyInputs(`allow { x := input; x.http.method == "GET" }`)
+	assert.True(t, inputs.has("is_valid_client_certificate"), "should include every field for the whole input")
+
+	_, cacheable = getPolicyInputs(`allow { time.now_ns() > 0 }`)
+	assert.False(t, cacheable, "should not cache nondeterministic builtins")
+
+	_, cacheable = getPolicyInputs(`allow { http_callout({}) }`)
+	assert.False(t, cacheable, "should not cache http callouts")
+
+	_, cacheable = getPolicyInputs(`allow {`)
+	assert.False(t, cacheable, "should not cache invalid policies")
+}
+
+func TestGetQueryRecordIDs(t *testing.T) {
+	t.Parallel()
+
+	req := &databroker.QueryRequest{Type: "type"}
+	_, ok := getQueryRecordIDs(req)
+	assert.False(t, ok)
+
+	req.SetFilterByIDOrIndex("1")
+	ids, ok := getQueryRecordIDs(req)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"1", "1"}, ids)
+
+	req.Query = "search"
+	_, ok = getQueryRecordIDs(req)
+	assert.False(t, ok)
+}
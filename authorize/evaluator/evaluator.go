@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 
 	"github.com/go-jose/go-jose/v3"
 	"github.com/open-policy-agent/opa/rego"
@@ -33,16 +34,29 @@ type Request struct {
 	Policy  *config.Policy
 	HTTP    RequestHTTP
 	Session RequestSession
+
+	// SkipDecisionCache evaluates the policy without reading or storing
+	// cached decisions.
+	SkipDecisionCache bool
 }
 
 // RequestHTTP is the HTTP field in the request.
 type RequestHTTP struct {
-	Method            string            `json:"method"`
-	Path              string            `json:"path"`
-	URL               string            `json:"url"`
-	Headers           map[string]string `json:"headers"`
-	ClientCertificate string            `json:"client_certificate"`
-	IP                string            `json:"ip"`
+	Method            string              `json:"method"`
+	Path              string              `json:"path"`
+	URL               string              `json:"url"`
+	Query             map[string][]string `json:"query"`
+	Headers           map[string]string   `json:"headers"`
+	ClientCertificate string              `json:"client_certificate"`
+	IP                string              `json:"ip"`
+}
+
+// parseQuery parses a raw query string the same way as net/http. Malformed
+// pairs, including pairs containing a semicolon, are skipped so that the
+// remaining parameters can still be matched by policies.
+func parseQuery(rawQuery string) map[string][]string {
+	query, _ := url.ParseQuery(rawQuery)
+	return query
 }
 
 // NewRequestHTTP creates a new RequestHTTP.
@@ -57,6 +71,7 @@ func NewRequestHTTP(
 		Method:            method,
 		Path:              requestURL.Path,
 		URL:               requestURL.String(),
+		Query:             parseQuery(requestURL.RawQuery),
 		Headers:           headers,
 		ClientCertificate: rawClientCertificate,
 		IP:                ip,
@@ -74,6 +89,7 @@ type Result struct {
 	Deny    RuleResult
 	Headers http.Header
 	Traces  []contextutil.PolicyEvaluationTrace
+	Shadow  *ShadowResult
 }
 
 // An Evaluator evaluates policies.
@@ -82,6 +98,11 @@ type Evaluator struct {
 	policyEvaluators  map[uint64]*PolicyEvaluator
 	headersEvaluators *HeadersEvaluator
 	clientCA          []byte
+
+	decisionCache *DecisionCache
+	// cacheSalt is added to the decision cache keys so that entries from
+	// previous evaluators aren't used
+	cacheSalt uint64
 }
 
 // New creates a new Evaluator.
@@ -90,12 +111,14 @@ func New(ctx context.Context, store *store.Store, options ...Option) (*Evaluator
 
 	cfg := getConfig(options...)
 
-	err := e.updateStore(cfg)
+	e.updateStore(cfg)
+
+	jwks, err := getJWKs(cfg)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("authorize: couldn't create signer: %w", err)
 	}
 
-	e.headersEvaluators, err = NewHeadersEvaluator(ctx, store)
+	e.headersEvaluators, err = NewHeadersEvaluator(ctx, store, jwks)
 	if err != nil {
 		return nil, err
 	}
@@ -106,6 +129,14 @@ func New(ctx context.Context, store *store.Store, options ...Option) (*Evaluator
 		if err != nil {
 			return nil, fmt.Errorf("authorize: error computing policy route id: %w", err)
 		}
+		// a route selecting a signing algorithm without a signing key would
+		// fail every request, so it's rejected with the rest of the config
+		if a := configPolicy.JWTAssertion; a != nil && a.SigningAlgorithm != "" {
+			if _, err := e.headersEvaluators.getSigner(jose.SignatureAlgorithm(a.SigningAlgorithm)); err != nil {
+				return nil, fmt.Errorf("authorize: route %s: no %s signing key for jwt_assertion",
+					configPolicy.From, a.SigningAlgorithm)
+			}
+		}
 		policyEvaluator, err := NewPolicyEvaluator(ctx, store, &configPolicy) //nolint
 		if err != nil {
 			return nil, err
@@ -114,6 +145,8 @@ func New(ctx context.Context, store *store.Store, options ...Option) (*Evaluator
 	}
 
 	e.clientCA = cfg.clientCA
+	e.decisionCache = cfg.decisionCache
+	e.cacheSalt = cryptutil.NewRandomUInt64()
 
 	return e, nil
 }
@@ -151,12 +184,21 @@ func (e *Evaluator) Evaluate(ctx context.Context, req *Request) (*Result, error)
 
 	var policyOutput *PolicyResponse
 	eg.Go(func() error {
-		var err error
-		policyOutput, err = policyEvaluator.Evaluate(ectx, &PolicyRequest{
-			HTTP:                     req.HTTP,
-			Session:                  req.Session,
+		policyReq := &PolicyRequest{
+			HTTP:    req.HTTP,
+			Session: req.Session,
+			Route: RequestRoute{
+				ID:   strconv.FormatUint(id, 10),
+				From: req.Policy.From,
+			},
 			IsValidClientCertificate: isValidClientCertificate,
-		})
+		}
+		var err error
+		if req.SkipDecisionCache {
+			policyOutput, err = policyEvaluator.Evaluate(ectx, policyReq)
+		} else {
+			policyOutput, err = e.evaluatePolicy(ectx, policyEvaluator, policyReq)
+		}
 		return err
 	})
 
@@ -181,7 +223,9 @@ func (e *Evaluator) Evaluate(ctx context.Context, req *Request) (*Result, error)
 		Deny:    policyOutput.Deny,
 		Headers: headersOutput.Headers,
 		Traces:  policyOutput.Traces,
+		Shadow:  policyOutput.Shadow,
 	}
+	applyDeactivatedUser(ctx, req, res)
 	return res, nil
 }
 
@@ -197,23 +241,18 @@ func (e *Evaluator) getClientCA(policy *config.Policy) (string, error) {
 	return string(e.clientCA), nil
 }
 
-func (e *Evaluator) updateStore(cfg *evaluatorConfig) error {
-	jwk, err := getJWK(cfg)
-	if err != nil {
-		return fmt.Errorf("authorize: couldn't create signer: %w", err)
-	}
-
+func (e *Evaluator) updateStore(cfg *evaluatorConfig) {
 	e.store.UpdateGoogleCloudServerlessAuthenticationServiceAccount(
 		cfg.googleCloudServerlessAuthenticationServiceAccount,
 	)
 	e.store.UpdateJWTClaimHeaders(cfg.jwtClaimsHeaders)
 	e.store.UpdateRoutePolicies(cfg.policies)
-	e.store.UpdateSigningKey(jwk)
-
-	return nil
 }
 
-func getJWK(cfg *evaluatorConfig) (*jose.JSONWebKey, error) {
+// getJWKs returns the signing keys. If there are several keys, the first is
+// used by default and the others can be selected by routes or used to rotate
+// keys.
+func getJWKs(cfg *evaluatorConfig) ([]*jose.JSONWebKey, error) {
 	var decodedCert []byte
 	// if we don't have a signing key, generate one
 	if len(cfg.signingKey) == 0 {
@@ -229,16 +268,20 @@ func getJWK(cfg *evaluatorConfig) (*jose.JSONWebKey, error) {
 		decodedCert = cfg.signingKey
 	}
 
-	jwk, err := cryptutil.PrivateJWKFromBytes(decodedCert)
+	jwks, err := cryptutil.PrivateJWKsFromBytes(decodedCert)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't generate signing key: %w", err)
+	} else if len(jwks) == 0 {
+		return nil, fmt.Errorf("couldn't generate signing key: invalid pem data")
+	}
+	for _, jwk := range jwks {
+		log.Info(context.TODO()).Str("Algorithm", jwk.Algorithm).
+			Str("KeyID", jwk.KeyID).
+			Interface("Public Key", jwk.Public()).
+			Msg("authorize: signing key")
 	}
-	log.Info(context.TODO()).Str("Algorithm", jwk.Algorithm).
-		Str("KeyID", jwk.KeyID).
-		Interface("Public Key", jwk.Public()).
-		Msg("authorize: signing key")
 
-	return jwk, nil
+	return jwks, nil
 }
 
 func safeEval(ctx context.Context, q rego.PreparedEvalQuery, options ...rego.EvalOption) (resultSet rego.ResultSet, err error) {
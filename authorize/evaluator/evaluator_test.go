@@ -2,6 +2,10 @@ package evaluator
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"net/http"
 	"net/url"
 	"testing"
@@ -9,6 +13,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/pomerium/pomerium/authorize/internal/store"
 	"github.com/pomerium/pomerium/config"
@@ -26,16 +31,13 @@ func TestEvaluator(t *testing.T) {
 	require.NoError(t, err)
 	encodedSigningKey, err := cryptutil.EncodePrivateKey(signingKey)
 	require.NoError(t, err)
-	privateJWK, err := cryptutil.PrivateJWKFromBytes(encodedSigningKey)
-	require.NoError(t, err)
 
 	eval := func(t *testing.T, options []Option, data []proto.Message, req *Request) (*Result, error) {
 		ctx := context.Background()
 		ctx = storage.WithQuerier(ctx, storage.NewStaticQuerier(data...))
 		store := store.New()
 		store.UpdateJWTClaimHeaders(config.NewJWTClaimHeaders("email", "groups", "user", "CUSTOM_KEY"))
-		store.UpdateSigningKey(privateJWK)
-		e, err := New(ctx, store, options...)
+		e, err := New(ctx, store, append([]Option{WithSigningKey(encodedSigningKey)}, options...)...)
 		require.NoError(t, err)
 		return e.Evaluate(ctx, req)
 	}
@@ -392,6 +394,42 @@ func TestEvaluator(t *testing.T) {
 		require.NoError(t, err)
 		assert.True(t, res.Allow.Value)
 	})
+	t.Run("deactivated user", func(t *testing.T) {
+		newUser := func(active bool) *user.User {
+			return &user.User{Id: "user1", Claims: map[string]*structpb.ListValue{
+				"scim_active": {Values: []*structpb.Value{structpb.NewBoolValue(active)}},
+			}}
+		}
+		check := func(t *testing.T, data ...proto.Message) *Result {
+			res, err := eval(t, options, data, &Request{
+				Policy: &policies[8],
+				Session: RequestSession{
+					ID: "session1",
+				},
+				HTTP: RequestHTTP{
+					Method:            "GET",
+					URL:               "https://from.example.com",
+					ClientCertificate: testValidCert,
+				},
+			})
+			require.NoError(t, err)
+			return res
+		}
+
+		res := check(t, &session.Session{Id: "session1", UserId: "user1"}, newUser(false))
+		assert.Equal(t, NewRuleResult(true, criteria.ReasonUserDeactivated), res.Deny)
+
+		res = check(t, &user.ServiceAccount{Id: "session1", UserId: "user1"}, newUser(false))
+		assert.Equal(t, NewRuleResult(true, criteria.ReasonUserDeactivated), res.Deny,
+			"service accounts of deactivated users should be denied")
+
+		res = check(t, &session.Session{Id: "session1", UserId: "user1"}, newUser(true))
+		assert.False(t, res.Deny.Value)
+		assert.True(t, res.Allow.Value)
+
+		res = check(t, &session.Session{Id: "session1", UserId: "user1"}, &user.User{Id: "user1"})
+		assert.False(t, res.Deny.Value, "users which weren't provisioned should be allowed")
+	})
 	t.Run("carry over assertion header", func(t *testing.T) {
 		tcs := []struct {
 			src             map[string]string
@@ -462,6 +500,29 @@ func TestEvaluator(t *testing.T) {
 	})
 }
 
+func TestNew_JWTAssertionSigningAlgorithm(t *testing.T) {
+	_, edSigningKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	derEdSigningKey, err := x509.MarshalPKCS8PrivateKey(edSigningKey)
+	require.NoError(t, err)
+	encodedEdSigningKey := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: derEdSigningKey})
+
+	newEvaluator := func(signingAlgorithm string) error {
+		_, err := New(context.Background(), store.New(),
+			WithSigningKey(encodedEdSigningKey),
+			WithPolicies([]config.Policy{{
+				From:         "https://from.example.com",
+				To:           config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+				JWTAssertion: &config.PolicyJWTAssertion{SigningAlgorithm: signingAlgorithm},
+			}}))
+		return err
+	}
+
+	assert.NoError(t, newEvaluator("EdDSA"))
+	assert.NoError(t, newEvaluator(""))
+	assert.Error(t, newEvaluator("ES256"), "should reject a signing algorithm without a signing key")
+}
+
 func mustParseURL(str string) *url.URL {
 	u, err := url.Parse(str)
 	if err != nil {
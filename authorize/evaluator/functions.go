@@ -1,14 +1,26 @@
 package evaluator
 
 import (
+	"bytes"
 	"context"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/types"
+	"golang.org/x/sync/singleflight"
 
+	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
 )
 
 var isValidClientCertificateCache, _ = lru.New2Q[[2]string, bool](100)
@@ -64,3 +76,267 @@ func parseCertificate(pemStr string) (*x509.Certificate, error) {
 	}
 	return x509.ParseCertificate(block.Bytes)
 }
+
+// HTTPCalloutMaxBodySize is the maximum size of an http callout response body.
+var HTTPCalloutMaxBodySize int64 = 1024 * 1024
+
+var (
+	httpCalloutCache, _     = lru.New2Q[string, httpCalloutCacheEntry](1000)
+	httpCalloutSingleflight singleflight.Group
+	httpCalloutClient       = httputil.NewLoggingClient(http.DefaultClient, "http_callout")
+
+	httpCalloutRegoOption = rego.Function2(&rego.Function{
+		Name: "http_callout",
+		Decl: types.NewFunction(
+			types.Args(types.A, types.A),
+			types.NewObject(nil, types.NewDynamicProperty(types.S, types.A)),
+		),
+	}, func(bctx rego.BuiltinContext, op1 *ast.Term, op2 *ast.Term) (*ast.Term, error) {
+		var cfg httpCalloutConfig
+		if err := ast.As(op1.Value, &cfg); err != nil {
+			return nil, fmt.Errorf("invalid http callout config: %w", err)
+		}
+
+		document, err := ast.JSON(op2.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid http callout document: %w", err)
+		}
+
+		// a callout which already failed during this evaluation isn't retried
+		failures := getHTTPCalloutFailures(bctx.Context)
+		failureKey := op1.String() + op2.String()
+		if answer, ok := failures.get(failureKey); ok {
+			return httpCalloutResultTerm(answer), nil
+		}
+
+		allow, err := httpCallout(bctx.Context, &cfg, document)
+		if err != nil {
+			log.Error(bctx.Context).Err(err).
+				Str("url", cfg.URL).
+				Bool("fail-open", cfg.FailOpen).
+				Msg("authorize: http callout failed")
+			allow = failures.add(failureKey, cfg.FailOpen)
+		}
+
+		return httpCalloutResultTerm(allow), nil
+	})
+)
+
+func httpCalloutResultTerm(allow bool) *ast.Term {
+	return ast.ObjectTerm(
+		[2]*ast.Term{ast.StringTerm("allow"), ast.BooleanTerm(allow)},
+	)
+}
+
+type httpCalloutFailuresKey struct{}
+
+// httpCalloutFailures records the http callouts which failed while evaluating
+// a policy query. A failed callout doesn't decide the criterion on its own,
+// as whether a false criterion allows or denies a request depends on where it
+// is used in the policy. Instead fail_open is applied to the final decision:
+//
+//   - if a callout fails closed, the request is denied
+//   - if a callout fails open, the query is evaluated with failed callouts
+//     answering both ways, and the answer which grants access is used
+type httpCalloutFailures struct {
+	mu         sync.Mutex
+	answer     bool
+	byKey      map[string]bool
+	failOpen   bool
+	failClosed bool
+}
+
+func withHTTPCalloutFailures(ctx context.Context, failures *httpCalloutFailures) context.Context {
+	return context.WithValue(ctx, httpCalloutFailuresKey{}, failures)
+}
+
+func getHTTPCalloutFailures(ctx context.Context) *httpCalloutFailures {
+	failures, _ := ctx.Value(httpCalloutFailuresKey{}).(*httpCalloutFailures)
+	return failures
+}
+
+// add records a failed callout and returns the answer to use for it.
+func (failures *httpCalloutFailures) add(key string, failOpen bool) bool {
+	if failures == nil {
+		return false
+	}
+
+	failures.mu.Lock()
+	defer failures.mu.Unlock()
+
+	if failures.byKey == nil {
+		failures.byKey = make(map[string]bool)
+	}
+	failures.byKey[key] = failOpen
+	if failOpen {
+		failures.failOpen = true
+	} else {
+		failures.failClosed = true
+	}
+	return failOpen && failures.answer
+}
+
+// get returns the answer to use for a callout which already failed.
+func (failures *httpCalloutFailures) get(key string) (answer, ok bool) {
+	if failures == nil {
+		return false, false
+	}
+
+	failures.mu.Lock()
+	defer failures.mu.Unlock()
+
+	failOpen, ok := failures.byKey[key]
+	if !ok {
+		return false, false
+	}
+	return failOpen && failures.answer, true
+}
+
+func (failures *httpCalloutFailures) setAnswer(answer bool) {
+	failures.mu.Lock()
+	failures.answer = answer
+	failures.mu.Unlock()
+}
+
+func (failures *httpCalloutFailures) failed() (failOpen, failClosed bool) {
+	failures.mu.Lock()
+	defer failures.mu.Unlock()
+
+	return failures.failOpen, failures.failClosed
+}
+
+type httpCalloutConfig struct {
+	URL            string            `json:"url"`
+	Headers        map[string]string `json:"headers"`
+	ForwardHeaders []string          `json:"forward_headers"`
+	Timeout        string            `json:"timeout"`
+	CacheTTL       string            `json:"cache_ttl"`
+	FailOpen       bool              `json:"fail_open"`
+}
+
+// httpCalloutCacheKey are the fields of an http callout document which
+// identify a decision. Every request field sent to the callout url is part of
+// the key, so that a decision is only reused for the same request of the same
+// session on the same route.
+type httpCalloutCacheKey struct {
+	Request struct {
+		Method  string                 `json:"method"`
+		URL     string                 `json:"url"`
+		Headers map[string]interface{} `json:"headers"`
+		IP      string                 `json:"ip"`
+	} `json:"request"`
+	Route struct {
+		ID string `json:"id"`
+	} `json:"route"`
+	Session struct {
+		ID string `json:"id"`
+	} `json:"session"`
+}
+
+type httpCalloutCacheEntry struct {
+	allow   bool
+	expires time.Time
+}
+
+// httpCallout POSTs the document to the configured url as JSON. The response
+// is expected to be a JSON object with an "allow" boolean. Successful responses
+// are cached for the cache TTL.
+func httpCallout(ctx context.Context, cfg *httpCalloutConfig, document interface{}) (bool, error) {
+	timeout, err := time.ParseDuration(cfg.Timeout)
+	if err != nil {
+		return false, fmt.Errorf("invalid timeout: %w", err)
+	}
+	cacheTTL, err := time.ParseDuration(cfg.CacheTTL)
+	if err != nil {
+		return false, fmt.Errorf("invalid cache ttl: %w", err)
+	}
+
+	body, err := json.Marshal(document)
+	if err != nil {
+		return false, err
+	}
+
+	var key httpCalloutCacheKey
+	if err := json.Unmarshal(body, &key); err != nil {
+		return false, err
+	}
+	rawCacheKey, err := json.Marshal([]interface{}{cfg, key})
+	if err != nil {
+		return false, err
+	}
+	cacheKey := fmt.Sprintf("%x", cryptutil.Hash("http_callout", rawCacheKey))
+
+	if entry, ok := httpCalloutCache.Get(cacheKey); ok && time.Now().Before(entry.expires) {
+		return entry.allow, nil
+	}
+
+	res, err, _ := httpCalloutSingleflight.Do(cacheKey, func() (interface{}, error) {
+		// the callout is shared with the other callers waiting for it, so it
+		// isn't canceled along with the first caller's request
+		ctx, cancel := context.WithTimeout(withoutCancel(ctx), timeout)
+		defer cancel()
+
+		allow, err := doHTTPCallout(ctx, cfg, body)
+		if err != nil {
+			return false, err
+		}
+
+		if cacheTTL > 0 {
+			httpCalloutCache.Add(cacheKey, httpCalloutCacheEntry{
+				allow:   allow,
+				expires: time.Now().Add(cacheTTL),
+			})
+		}
+		return allow, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return res.(bool), nil
+}
+
+func doHTTPCallout(ctx context.Context, cfg *httpCalloutConfig, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := httpCalloutClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return false, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	var response struct {
+		Allow bool `json:"allow"`
+	}
+	err = json.NewDecoder(io.LimitReader(res.Body, HTTPCalloutMaxBodySize)).Decode(&response)
+	if err != nil {
+		return false, fmt.Errorf("invalid response: %w", err)
+	}
+	return response.Allow, nil
+}
+
+// withoutCancel returns a context with the values of the parent which is never
+// canceled.
+func withoutCancel(parent context.Context) context.Context {
+	return detachedContext{parent}
+}
+
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
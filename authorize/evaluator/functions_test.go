@@ -1,7 +1,13 @@
 package evaluator
 
 import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -120,3 +126,89 @@ func Test_isValidClientCertificate(t *testing.T) {
 		assert.False(t, valid, "should return false")
 	})
 }
+
+func Test_httpCallout(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		switch r.URL.Path {
+		case "/allow":
+			_, _ = io.WriteString(w, `{"allow":true}`)
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+			_, _ = io.WriteString(w, `{"allow":true}`)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Run("cached", func(t *testing.T) {
+		cfg := &httpCalloutConfig{URL: srv.URL + "/allow", Timeout: "1s", CacheTTL: "1m"}
+		for i := 0; i < 3; i++ {
+			allow, err := httpCallout(context.Background(), cfg, map[string]interface{}{"user": "u1"})
+			assert.NoError(t, err)
+			assert.True(t, allow)
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+	t.Run("cache key", func(t *testing.T) {
+		atomic.StoreInt32(&calls, 0)
+		cfg := &httpCalloutConfig{URL: srv.URL + "/allow", Timeout: "1s", CacheTTL: "1m"}
+		document := func(sessionID, method, url, ip string) map[string]interface{} {
+			return map[string]interface{}{
+				"request": map[string]interface{}{
+					"method":  method,
+					"url":     url,
+					"headers": map[string]interface{}{},
+					"ip":      ip,
+				},
+				"route":   map[string]interface{}{"id": "r1"},
+				"session": map[string]interface{}{"id": sessionID},
+			}
+		}
+		callout := func(document map[string]interface{}) {
+			allow, err := httpCallout(context.Background(), cfg, document)
+			assert.NoError(t, err)
+			assert.True(t, allow)
+		}
+
+		for i := 0; i < 3; i++ {
+			callout(document("s1", "GET", "https://from.example.com/public", "10.0.0.1"))
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls),
+			"should cache decisions for the same request")
+
+		for i, doc := range []map[string]interface{}{
+			document("s1", "GET", "https://from.example.com/admin", "10.0.0.1"),
+			document("s1", "DELETE", "https://from.example.com/public", "10.0.0.1"),
+			document("s1", "GET", "https://from.example.com/public?admin=true", "10.0.0.1"),
+			document("s1", "GET", "https://from.example.com/public", "10.0.0.2"),
+			document("s2", "GET", "https://from.example.com/public", "10.0.0.1"),
+		} {
+			callout(doc)
+			assert.Equal(t, int32(i+2), atomic.LoadInt32(&calls),
+				"should not reuse the decision of another request: %v", doc)
+		}
+	})
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		cfg := &httpCalloutConfig{URL: srv.URL + "/allow", Timeout: "1s", CacheTTL: "0s"}
+		allow, err := httpCallout(ctx, cfg, map[string]interface{}{"user": "u3"})
+		assert.NoError(t, err, "should not cancel the callout shared with other callers")
+		assert.True(t, allow)
+	})
+	t.Run("timeout", func(t *testing.T) {
+		cfg := &httpCalloutConfig{URL: srv.URL + "/slow", Timeout: "10ms", CacheTTL: "1m"}
+		allow, err := httpCallout(context.Background(), cfg, map[string]interface{}{"user": "u1"})
+		assert.Error(t, err)
+		assert.False(t, allow)
+	})
+	t.Run("status code", func(t *testing.T) {
+		cfg := &httpCalloutConfig{URL: srv.URL + "/missing", Timeout: "1s", CacheTTL: "1m"}
+		allow, err := httpCallout(context.Background(), cfg, map[string]interface{}{"user": "u1"})
+		assert.Error(t, err)
+		assert.False(t, allow)
+	})
+}
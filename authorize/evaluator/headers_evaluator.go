@@ -2,15 +2,20 @@ package evaluator
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	envoy_config_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	"github.com/go-jose/go-jose/v3"
 	"github.com/open-policy-agent/opa/rego"
 
 	"github.com/pomerium/pomerium/authorize/evaluator/opa"
 	"github.com/pomerium/pomerium/authorize/internal/store"
 	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/internal/urlutil"
 	configpb "github.com/pomerium/pomerium/pkg/grpc/config"
@@ -18,14 +23,20 @@ import (
 
 // HeadersRequest is the input to the headers.rego script.
 type HeadersRequest struct {
-	EnableGoogleCloudServerlessAuthentication bool           `json:"enable_google_cloud_serverless_authentication"`
-	EnableRoutingKey                          bool           `json:"enable_routing_key"`
-	Issuer                                    string         `json:"issuer"`
-	KubernetesServiceAccountToken             string         `json:"kubernetes_service_account_token"`
-	ToAudience                                string         `json:"to_audience"`
-	Session                                   RequestSession `json:"session"`
-	PassAccessToken                           bool           `json:"pass_access_token"`
-	PassIDToken                               bool           `json:"pass_id_token"`
+	EnableGoogleCloudServerlessAuthentication bool              `json:"enable_google_cloud_serverless_authentication"`
+	EnableRoutingKey                          bool              `json:"enable_routing_key"`
+	Issuer                                    string            `json:"issuer"`
+	JWTAudience                               []string          `json:"jwt_audience,omitempty"`
+	JWTClaims                                 map[string]string `json:"jwt_claims,omitempty"`
+	JWTLifetime                               float64           `json:"jwt_lifetime,omitempty"`
+	KubernetesServiceAccountToken             string            `json:"kubernetes_service_account_token"`
+	ToAudience                                string            `json:"to_audience"`
+	Session                                   RequestSession    `json:"session"`
+	PassAccessToken                           bool              `json:"pass_access_token"`
+	PassIDToken                               bool              `json:"pass_id_token"`
+
+	// JWTAssertion is applied to the payload after evaluating headers.rego.
+	JWTAssertion *config.PolicyJWTAssertion `json:"-"`
 }
 
 // NewHeadersRequestFromPolicy creates a new HeadersRequest from a policy.
@@ -43,6 +54,12 @@ func NewHeadersRequestFromPolicy(policy *config.Policy) *HeadersRequest {
 	}
 	input.PassAccessToken = policy.GetSetAuthorizationHeader() == configpb.Route_ACCESS_TOKEN
 	input.PassIDToken = policy.GetSetAuthorizationHeader() == configpb.Route_ID_TOKEN
+	if a := policy.JWTAssertion; a != nil {
+		input.JWTAudience = a.Audience
+		input.JWTClaims = a.Claims
+		input.JWTLifetime = a.GetLifetime().Seconds()
+		input.JWTAssertion = a
+	}
 	return input
 }
 
@@ -53,11 +70,19 @@ type HeadersResponse struct {
 
 // A HeadersEvaluator evaluates the headers.rego script.
 type HeadersEvaluator struct {
-	q rego.PreparedEvalQuery
+	q       rego.PreparedEvalQuery
+	signers []headersSigner
+}
+
+type headersSigner struct {
+	algorithm jose.SignatureAlgorithm
+	signer    jose.Signer
 }
 
-// NewHeadersEvaluator creates a new HeadersEvaluator.
-func NewHeadersEvaluator(ctx context.Context, store *store.Store) (*HeadersEvaluator, error) {
+// NewHeadersEvaluator creates a new HeadersEvaluator. The JWT assertion is
+// signed with the first of the signing keys, unless the route selects another
+// signing algorithm.
+func NewHeadersEvaluator(ctx context.Context, store *store.Store, signingKeys []*jose.JSONWebKey) (*HeadersEvaluator, error) {
 	r := rego.New(
 		rego.Store(store),
 		rego.Module("pomerium.headers", opa.HeadersRego),
@@ -71,15 +96,31 @@ func NewHeadersEvaluator(ctx context.Context, store *store.Store) (*HeadersEvalu
 		return nil, err
 	}
 
-	return &HeadersEvaluator{
+	e := &HeadersEvaluator{
 		q: q,
-	}, nil
+	}
+	for _, jwk := range signingKeys {
+		algorithm := jose.SignatureAlgorithm(jwk.Algorithm)
+		signer, err := jose.NewSigner(
+			jose.SigningKey{Algorithm: algorithm, Key: jwk},
+			(&jose.SignerOptions{}).WithType("JWT"))
+		if err != nil {
+			return nil, fmt.Errorf("authorize: error creating signer: %w", err)
+		}
+		e.signers = append(e.signers, headersSigner{algorithm: algorithm, signer: signer})
+	}
+	return e, nil
 }
 
 // Evaluate evaluates the headers.rego script.
 func (e *HeadersEvaluator) Evaluate(ctx context.Context, req *HeadersRequest) (*HeadersResponse, error) {
 	ctx, span := trace.StartSpan(ctx, "authorize.HeadersEvaluator.Evaluate")
 	defer span.End()
+
+	start := time.Now()
+	defer func() {
+		metrics.RecordAuthorizeHeadersEvaluation(ctx, time.Since(start))
+	}()
 	rs, err := safeEval(ctx, e.q, rego.EvalInput(req))
 	if err != nil {
 		return nil, fmt.Errorf("authorize: error evaluating headers.rego: %w", err)
@@ -89,11 +130,74 @@ func (e *HeadersEvaluator) Evaluate(ctx context.Context, req *HeadersRequest) (*
 		return nil, fmt.Errorf("authorize: unexpected empty result from evaluating headers.rego")
 	}
 
+	h := e.getHeader(rs[0].Bindings)
+
+	assertion, err := e.getJWTAssertion(rs[0].Bindings, req.JWTAssertion)
+	if err != nil {
+		return nil, err
+	}
+	h.Set("X-Pomerium-Jwt-Assertion", assertion)
+
 	return &HeadersResponse{
-		Headers: e.getHeader(rs[0].Bindings),
+		Headers: h,
 	}, nil
 }
 
+func (e *HeadersEvaluator) getJWTAssertion(vars rego.Vars, a *config.PolicyJWTAssertion) (string, error) {
+	payload := make(map[string]interface{})
+	if m, ok := vars["result"].(map[string]interface{}); ok {
+		if p, ok := m["jwt_payload"].(map[string]interface{}); ok {
+			payload = p
+		}
+	}
+
+	var algorithm jose.SignatureAlgorithm
+	if a != nil {
+		for from, to := range a.RenameClaims {
+			if v, ok := payload[from]; ok {
+				delete(payload, from)
+				payload[to] = v
+			}
+		}
+		for k, v := range a.StaticClaims {
+			payload[k] = v
+		}
+		algorithm = jose.SignatureAlgorithm(a.SigningAlgorithm)
+	}
+
+	signer, err := e.getSigner(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	// rego returns numbers as json.Number, which go-jose would encode as
+	// strings, so the payload is encoded with encoding/json
+	bs, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("authorize: error encoding jwt assertion: %w", err)
+	}
+
+	jws, err := signer.Sign(bs)
+	if err != nil {
+		return "", fmt.Errorf("authorize: error signing jwt assertion: %w", err)
+	}
+	return jws.CompactSerialize()
+}
+
+// getSigner returns the signer for the first signing key using the algorithm,
+// or the first signer if no algorithm is given.
+func (e *HeadersEvaluator) getSigner(algorithm jose.SignatureAlgorithm) (jose.Signer, error) {
+	for _, s := range e.signers {
+		if algorithm == "" || s.algorithm == algorithm {
+			return s.signer, nil
+		}
+	}
+	if algorithm == "" {
+		return nil, errors.New("authorize: no signing key")
+	}
+	return nil, fmt.Errorf("authorize: no %s signing key", algorithm)
+}
+
 func (e *HeadersEvaluator) getHeader(vars rego.Vars) http.Header {
 	h := make(http.Header)
 
@@ -2,10 +2,15 @@ package evaluator
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"math"
 	"testing"
 	"time"
 
+	"github.com/go-jose/go-jose/v3"
 	"github.com/go-jose/go-jose/v3/jwt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -34,6 +39,25 @@ func TestNewHeadersRequestFromPolicy(t *testing.T) {
 		Issuer:     "from.example.com",
 		ToAudience: "https://to.example.com",
 	}, req)
+
+	t.Run("jwt assertion", func(t *testing.T) {
+		a := &config.PolicyJWTAssertion{
+			Claims:   map[string]string{"dept": "department"},
+			Lifetime: time.Minute,
+			Audience: []string{"api"},
+		}
+		req := NewHeadersRequestFromPolicy(&config.Policy{
+			From:         "https://from.example.com",
+			JWTAssertion: a,
+		})
+		assert.Equal(t, &HeadersRequest{
+			Issuer:       "from.example.com",
+			JWTAudience:  []string{"api"},
+			JWTClaims:    map[string]string{"dept": "department"},
+			JWTLifetime:  60,
+			JWTAssertion: a,
+		}, req)
+	})
 }
 
 func TestHeadersEvaluator(t *testing.T) {
@@ -49,13 +73,22 @@ func TestHeadersEvaluator(t *testing.T) {
 	publicJWK, err := cryptutil.PublicJWKFromBytes(encodedSigningKey)
 	require.NoError(t, err)
 
+	_, edSigningKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	derEdSigningKey, err := x509.MarshalPKCS8PrivateKey(edSigningKey)
+	require.NoError(t, err)
+	encodedEdSigningKey := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: derEdSigningKey})
+	privateEdJWK, err := cryptutil.PrivateJWKFromBytes(encodedEdSigningKey)
+	require.NoError(t, err)
+	publicEdJWK, err := cryptutil.PublicJWKFromBytes(encodedEdSigningKey)
+	require.NoError(t, err)
+
 	eval := func(t *testing.T, data []proto.Message, input *HeadersRequest) (*HeadersResponse, error) {
 		ctx := context.Background()
 		ctx = storage.WithQuerier(ctx, storage.NewStaticQuerier(data...))
 		store := store.New()
 		store.UpdateJWTClaimHeaders(config.NewJWTClaimHeaders("email", "groups", "user", "CUSTOM_KEY"))
-		store.UpdateSigningKey(privateJWK)
-		e, err := NewHeadersEvaluator(ctx, store)
+		e, err := NewHeadersEvaluator(ctx, store, []*jose.JSONWebKey{privateJWK, privateEdJWK})
 		require.NoError(t, err)
 		return e.Evaluate(ctx, input)
 	}
@@ -97,6 +130,51 @@ func TestHeadersEvaluator(t *testing.T) {
 		assert.Equal(t, "n1", claims["name"], "should set name")
 	})
 
+	t.Run("jwt assertion", func(t *testing.T) {
+		output, err := eval(t,
+			[]proto.Message{
+				&session.Session{Id: "s1", UserId: "u1", Claims: map[string]*structpb.ListValue{
+					"department": {Values: []*structpb.Value{
+						structpb.NewStringValue("engineering"),
+					}},
+				}},
+			},
+			&HeadersRequest{
+				Issuer:      "from.example.com",
+				ToAudience:  "to.example.com",
+				Session:     RequestSession{ID: "s1"},
+				JWTAudience: []string{"a1", "a2"},
+				JWTClaims:   map[string]string{"dept": "department", "missing": "missing"},
+				JWTLifetime: 60,
+				JWTAssertion: &config.PolicyJWTAssertion{
+					RenameClaims:     map[string]string{"sub": "subject"},
+					StaticClaims:     map[string]interface{}{"tenant": "t1", "name": "static"},
+					SigningAlgorithm: "EdDSA",
+				},
+			})
+		require.NoError(t, err)
+
+		rawJWT, err := jwt.ParseSigned(output.Headers.Get("X-Pomerium-Jwt-Assertion"))
+		require.NoError(t, err)
+		require.Len(t, rawJWT.Headers, 1)
+		assert.Equal(t, "EdDSA", rawJWT.Headers[0].Algorithm)
+		assert.Equal(t, privateEdJWK.KeyID, rawJWT.Headers[0].KeyID)
+
+		var claims M
+		err = rawJWT.Claims(publicEdJWK, &claims)
+		require.NoError(t, err)
+
+		assert.Equal(t, A{"a1", "a2"}, claims["aud"])
+		assert.Equal(t, "engineering", claims["dept"], "should map session claims")
+		assert.NotContains(t, claims, "missing", "should omit missing claims")
+		assert.NotContains(t, claims, "sub", "should rename claims")
+		assert.Equal(t, "u1", claims["subject"], "should rename claims")
+		assert.Equal(t, "t1", claims["tenant"], "should add static claims")
+		assert.Equal(t, "static", claims["name"], "should replace claims with static claims")
+		assert.LessOrEqual(t, claims["exp"], float64(time.Now().Add(time.Minute*2).Unix()),
+			"JWT should expire within 1 minute, but got: %v", claims["exp"])
+	})
+
 	t.Run("access token", func(t *testing.T) {
 		output, err := eval(t,
 			[]proto.Message{
@@ -4,6 +4,9 @@ package pomerium.headers
 #   enable_google_cloud_serverless_authentication: boolean
 #   enable_routing_key: boolean
 #   issuer: string
+#   jwt_audience: []string
+#   jwt_claims: map[string]string
+#   jwt_lifetime: number
 #   kubernetes_service_account_token: string
 #   session:
 #     id: string
@@ -13,9 +16,6 @@ package pomerium.headers
 #
 # data:
 #   jwt_claim_headers: map[string]string
-#   signing_key:
-#     alg: string
-#     kid: string
 #
 # functions:
 #   get_databroker_record
@@ -24,9 +24,18 @@ package pomerium.headers
 #
 # output:
 #   identity_headers: map[string][]string
+#   jwt_payload: map[string]any
 
-# 5 minutes from now in seconds
-five_minutes := round((time.now_ns() / 1e9) + (60 * 5))
+# the jwt lifetime in seconds, defaulting to 5 minutes
+jwt_lifetime = v {
+	v := input.jwt_lifetime
+	v > 0
+} else = 300 {
+	true
+}
+
+# the jwt expiry in seconds
+jwt_expiry := round((time.now_ns() / 1e9) + jwt_lifetime)
 
 # get the session
 session = v {
@@ -73,13 +82,13 @@ group_ids = gs {
 
 groups := array.concat(group_ids, array.concat(get_databroker_group_names(group_ids), get_databroker_group_emails(group_ids)))
 
-jwt_headers = {
-	"typ": "JWT",
-	"alg": data.signing_key.alg,
-	"kid": data.signing_key.kid,
-}
-
 jwt_payload_aud = v {
+	count(input.jwt_audience) == 1
+	v := input.jwt_audience[0]
+} else = v {
+	count(input.jwt_audience) > 1
+	v := input.jwt_audience
+} else = v {
 	v := input.issuer
 } else = "" {
 	true
@@ -98,9 +107,9 @@ jwt_payload_jti = v {
 }
 
 jwt_payload_exp = v {
-	v = min([five_minutes, round(session.expires_at.seconds)])
+	v = min([jwt_expiry, round(session.expires_at.seconds)])
 } else = v {
-	v = five_minutes
+	v = jwt_expiry
 } else = null {
 	true
 }
@@ -187,7 +196,23 @@ additional_jwt_claims := [[k, v] |
 	v := get_header_string_value(claim_value)
 ]
 
-jwt_claims := array.concat(base_jwt_claims, additional_jwt_claims)
+# claims mapped from session or user claims by the route's jwt_assertion
+route_jwt_claims := [[k, v] |
+	some k
+	claim_key := input.jwt_claims[k]
+
+	# the claim value can come from session claims or user claims
+	claim_value := object.get(session, ["claims", claim_key], object.get(user, ["claims", claim_key], null))
+	claim_value != null
+
+	v := get_claim_value(claim_value)
+]
+
+# route claims replace any other claims with the same name
+jwt_claims := array.concat([[k, v] |
+	[k, v] := array.concat(base_jwt_claims, additional_jwt_claims)[_]
+	object.get(input, ["jwt_claims", k], null) == null
+], route_jwt_claims)
 
 jwt_payload = {key: value |
 	# use a comprehension over an array to remove nil values
@@ -195,8 +220,6 @@ jwt_payload = {key: value |
 	value != null
 }
 
-signed_jwt = io.jwt.encode_sign(jwt_headers, jwt_payload, data.signing_key)
-
 kubernetes_headers = h {
 	input.kubernetes_service_account_token != ""
 	h := [
@@ -243,8 +266,7 @@ pass_id_token_headers = h {
 }
 
 identity_headers := {key: values |
-	h1 := [["x-pomerium-jwt-assertion", signed_jwt]]
-	h2 := [[header_name, header_value] |
+	h1 := [[header_name, header_value] |
 		some header_name
 		k := data.jwt_claim_headers[header_name]
 		raw_header_value := array.concat(
@@ -258,13 +280,13 @@ identity_headers := {key: values |
 		header_value := get_header_string_value(raw_header_value)
 	]
 
-	h3 := kubernetes_headers
-	h4 := [[k, v] | v := google_cloud_serverless_headers[k]]
-	h5 := routing_key_headers
-	h6 := pass_access_token_headers
-	h7 := pass_id_token_headers
+	h2 := kubernetes_headers
+	h3 := [[k, v] | v := google_cloud_serverless_headers[k]]
+	h4 := routing_key_headers
+	h5 := pass_access_token_headers
+	h6 := pass_id_token_headers
 
-	h := array.concat(array.concat(array.concat(array.concat(array.concat(array.concat(h1, h2), h3), h4), h5), h6), h7)
+	h := array.concat(array.concat(array.concat(array.concat(array.concat(h1, h2), h3), h4), h5), h6)
 
 	some i
 	[key, v1] := h[i]
@@ -283,6 +305,15 @@ get_databroker_group_emails(ids) = gs {
 	gs := [email | id := ids[i]; group := get_databroker_record("pomerium.io/DirectoryGroup", id); email := group.email]
 }
 
+# session and user claims are lists, so unwrap single values
+get_claim_value(obj) = v {
+	is_array(obj)
+	count(obj) == 1
+	v := obj[0]
+} else = obj {
+	true
+}
+
 get_header_string_value(obj) = s {
 	is_array(obj)
 	s := concat(",", obj)
@@ -4,13 +4,16 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/open-policy-agent/opa/rego"
 	octrace "go.opencensus.io/trace"
 
 	"github.com/pomerium/pomerium/authorize/internal/store"
 	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/hashutil"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/pkg/contextutil"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
@@ -22,13 +25,27 @@ import (
 type PolicyRequest struct {
 	HTTP                     RequestHTTP    `json:"http"`
 	Session                  RequestSession `json:"session"`
+	Route                    RequestRoute   `json:"route"`
 	IsValidClientCertificate bool           `json:"is_valid_client_certificate"`
 }
 
+// RequestRoute is the route field in the policy request.
+type RequestRoute struct {
+	ID   string `json:"id"`
+	From string `json:"from"`
+}
+
 // PolicyResponse is the result of evaluating a policy.
 type PolicyResponse struct {
 	Allow, Deny RuleResult
 	Traces      []contextutil.PolicyEvaluationTrace
+	// Shadow is the result of evaluating the shadow policy, if there is one.
+	Shadow *ShadowResult
+}
+
+// A ShadowResult is the result of evaluating a shadow policy.
+type ShadowResult struct {
+	Allow, Deny RuleResult
 }
 
 // NewPolicyResponse creates a new PolicyResponse.
@@ -39,6 +56,21 @@ func NewPolicyResponse() *PolicyResponse {
 	}
 }
 
+func (res *PolicyResponse) clone() *PolicyResponse {
+	cloned := &PolicyResponse{
+		Allow:  res.Allow.clone(),
+		Deny:   res.Deny.clone(),
+		Traces: append([]contextutil.PolicyEvaluationTrace(nil), res.Traces...),
+	}
+	if res.Shadow != nil {
+		cloned.Shadow = &ShadowResult{
+			Allow: res.Shadow.Allow.clone(),
+			Deny:  res.Shadow.Deny.clone(),
+		}
+	}
+	return cloned
+}
+
 // A RuleResult is the result of evaluating a rule.
 type RuleResult struct {
 	Value          bool
@@ -55,6 +87,19 @@ func NewRuleResult(value bool, reasons ...criteria.Reason) RuleResult {
 	}
 }
 
+func (result RuleResult) clone() RuleResult {
+	cloned := RuleResult{
+		Value:          result.Value,
+		Reasons:        criteria.NewReasons(),
+		AdditionalData: make(map[string]interface{}, len(result.AdditionalData)),
+	}
+	cloned.Reasons = cloned.Reasons.Union(result.Reasons)
+	for k, v := range result.AdditionalData {
+		cloned.AdditionalData[k] = v
+	}
+	return cloned
+}
+
 // MergeRuleResultsWithOr merges all the results using `or`.
 func MergeRuleResultsWithOr(results ...RuleResult) RuleResult {
 	merged := NewRuleResult(false)
@@ -103,7 +148,13 @@ func (q policyQuery) checksum() string {
 
 // A PolicyEvaluator evaluates policies.
 type PolicyEvaluator struct {
-	queries []policyQuery
+	queries     []policyQuery
+	shadowQuery *policyQuery
+
+	// inputs are the request fields used by the policy, and cacheable is
+	// whether the decision cache can be used for the policy
+	inputs    policyInputs
+	cacheable bool
 }
 
 // NewPolicyEvaluator creates a new PolicyEvaluator.
@@ -145,38 +196,80 @@ func NewPolicyEvaluator(ctx context.Context, store *store.Store, configPolicy *c
 			Interface("to", configPolicy.To).
 			Msg("authorize: rego script for policy evaluation")
 
-		r := rego.New(
-			rego.Store(store),
-			rego.Module("pomerium.policy", e.queries[i].script),
-			rego.Query("result = data.pomerium.policy"),
-			getGoogleCloudServerlessHeadersRegoOption,
-			store.GetDataBrokerRecordOption(),
-		)
+		e.queries[i].PreparedEvalQuery, err = prepareQuery(ctx, store, e.queries[i].script)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		q, err := r.PrepareForEval(ctx)
-		// if no package is in the src, add it
-		if err != nil && strings.Contains(err.Error(), "package expected") {
-			r := rego.New(
-				rego.Store(store),
-				rego.Module("pomerium.policy", "package pomerium.policy\n\n"+e.queries[i].script),
-				rego.Query("result = data.pomerium.policy"),
-				getGoogleCloudServerlessHeadersRegoOption,
-				store.GetDataBrokerRecordOption(),
-			)
-			q, err = r.PrepareForEval(ctx)
+	// the shadow policy is evaluated separately so it doesn't affect the result
+	if shadow := configPolicy.ToShadowPPL(); shadow != nil {
+		script, err := policy.GenerateRegoFromPolicy(shadow)
+		if err != nil {
+			return nil, fmt.Errorf("authorize: error generating shadow policy: %w", err)
 		}
+
+		log.Debug(ctx).
+			Str("script", script).
+			Str("from", configPolicy.From).
+			Interface("to", configPolicy.To).
+			Msg("authorize: rego script for shadow policy evaluation")
+
+		q, err := prepareQuery(ctx, store, script)
 		if err != nil {
 			return nil, err
 		}
+		e.shadowQuery = &policyQuery{
+			PreparedEvalQuery: q,
+			script:            script,
+		}
+	}
 
-		e.queries[i].PreparedEvalQuery = q
+	var scripts []string
+	for _, q := range e.queries {
+		scripts = append(scripts, q.script)
+	}
+	if e.shadowQuery != nil {
+		scripts = append(scripts, e.shadowQuery.script)
 	}
+	e.inputs, e.cacheable = getPolicyInputs(scripts...)
 
 	return e, nil
 }
 
+func prepareQuery(ctx context.Context, store *store.Store, script string) (rego.PreparedEvalQuery, error) {
+	r := rego.New(
+		rego.Store(store),
+		rego.Module("pomerium.policy", script),
+		rego.Query("result = data.pomerium.policy"),
+		getGoogleCloudServerlessHeadersRegoOption,
+		httpCalloutRegoOption,
+		store.GetDataBrokerRecordOption(),
+	)
+
+	q, err := r.PrepareForEval(ctx)
+	// if no package is in the src, add it
+	if err != nil && strings.Contains(err.Error(), "package expected") {
+		r := rego.New(
+			rego.Store(store),
+			rego.Module("pomerium.policy", "package pomerium.policy\n\n"+script),
+			rego.Query("result = data.pomerium.policy"),
+			getGoogleCloudServerlessHeadersRegoOption,
+			httpCalloutRegoOption,
+			store.GetDataBrokerRecordOption(),
+		)
+		q, err = r.PrepareForEval(ctx)
+	}
+	return q, err
+}
+
 // Evaluate evaluates the policy rego scripts.
 func (e *PolicyEvaluator) Evaluate(ctx context.Context, req *PolicyRequest) (*PolicyResponse, error) {
+	start := time.Now()
+	defer func() {
+		metrics.RecordAuthorizePolicyEvaluation(ctx, req.Route.From, time.Since(start))
+	}()
+
 	res := NewPolicyResponse()
 	// run each query and merge the results
 	for _, query := range e.queries {
@@ -194,14 +287,62 @@ func (e *PolicyEvaluator) Evaluate(ctx context.Context, req *PolicyRequest) (*Po
 			Deny:        o.Deny.Value,
 		})
 	}
+
+	if e.shadowQuery != nil {
+		o, err := e.evaluateQuery(ctx, req, *e.shadowQuery)
+		if err != nil {
+			// the shadow policy is never enforced, so errors are only logged
+			log.Warn(ctx).Err(err).Msg("authorize: error evaluating shadow policy")
+		} else {
+			res.Shadow = &ShadowResult{Allow: o.Allow, Deny: o.Deny}
+		}
+	}
 	return res, nil
 }
 
+// cacheKey returns the decision cache key for the request. Only the fields
+// used by the policy are part of the key.
+func (e *PolicyEvaluator) cacheKey(req *PolicyRequest) (uint64, error) {
+	return hashutil.Hash(e.inputs.filter(req))
+}
+
 func (e *PolicyEvaluator) evaluateQuery(ctx context.Context, req *PolicyRequest, query policyQuery) (*PolicyResponse, error) {
 	ctx, span := trace.StartSpan(ctx, "authorize.PolicyEvaluator.evaluateQuery")
 	defer span.End()
 	span.AddAttributes(octrace.StringAttribute("script_checksum", query.checksum()))
 
+	failures := new(httpCalloutFailures)
+	ctx = withHTTPCalloutFailures(ctx, failures)
+
+	res, err := e.evaluateQueryOnce(ctx, req, query)
+	if err != nil {
+		return nil, err
+	}
+
+	failOpen, failClosed := failures.failed()
+	if failOpen && !isAccessGranted(res) {
+		failures.setAnswer(true)
+		retry, err := e.evaluateQueryOnce(ctx, req, query)
+		if err != nil {
+			return nil, err
+		}
+		if isAccessGranted(retry) {
+			res = retry
+		}
+		_, failClosed = failures.failed()
+	}
+	if failClosed {
+		res.Deny = MergeRuleResultsWithOr(res.Deny, NewRuleResult(true, criteria.ReasonHTTPCalloutError))
+	}
+
+	return res, nil
+}
+
+func isAccessGranted(res *PolicyResponse) bool {
+	return res.Allow.Value && !res.Deny.Value
+}
+
+func (e *PolicyEvaluator) evaluateQueryOnce(ctx context.Context, req *PolicyRequest, query policyQuery) (*PolicyResponse, error) {
 	rs, err := safeEval(ctx, query.PreparedEvalQuery, rego.EvalInput(req))
 	if err != nil {
 		return nil, fmt.Errorf("authorize: error evaluating policy.rego: %w", err)
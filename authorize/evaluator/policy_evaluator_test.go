@@ -2,6 +2,9 @@ package evaluator
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -15,28 +18,20 @@ import (
 	"github.com/pomerium/pomerium/authorize/internal/store"
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/pkg/contextutil"
-	"github.com/pomerium/pomerium/pkg/cryptutil"
 	"github.com/pomerium/pomerium/pkg/grpc/session"
 	"github.com/pomerium/pomerium/pkg/grpc/user"
 	"github.com/pomerium/pomerium/pkg/policy"
 	"github.com/pomerium/pomerium/pkg/policy/criteria"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
 	"github.com/pomerium/pomerium/pkg/storage"
 )
 
 func TestPolicyEvaluator(t *testing.T) {
-	signingKey, err := cryptutil.NewSigningKey()
-	require.NoError(t, err)
-	encodedSigningKey, err := cryptutil.EncodePrivateKey(signingKey)
-	require.NoError(t, err)
-	privateJWK, err := cryptutil.PrivateJWKFromBytes(encodedSigningKey)
-	require.NoError(t, err)
-
 	eval := func(t *testing.T, policy *config.Policy, data []proto.Message, input *PolicyRequest) (*PolicyResponse, error) {
 		ctx := context.Background()
 		ctx = storage.WithQuerier(ctx, storage.NewStaticQuerier(data...))
 		store := store.New()
 		store.UpdateJWTClaimHeaders(config.NewJWTClaimHeaders("email", "groups", "user", "CUSTOM_KEY"))
-		store.UpdateSigningKey(privateJWK)
 		e, err := NewPolicyEvaluator(ctx, store, policy)
 		require.NoError(t, err)
 		return e.Evaluate(ctx, input)
@@ -293,4 +288,265 @@ func TestPolicyEvaluator(t *testing.T) {
 			Traces: []contextutil.PolicyEvaluationTrace{{Allow: false}},
 		}, output)
 	})
+	t.Run("shadow", func(t *testing.T) {
+		ppl, err := parser.ParseYAML(strings.NewReader(`
+allow:
+  and:
+    - email:
+        is: u1@example.com
+`))
+		require.NoError(t, err)
+		shadowPPL, err := parser.ParseYAML(strings.NewReader(`
+allow:
+  and:
+    - email:
+        is: u2@example.com
+`))
+		require.NoError(t, err)
+		p := &config.Policy{
+			From:         "https://from.example.com",
+			To:           config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+			Policy:       &config.PPLPolicy{Policy: ppl},
+			ShadowPolicy: &config.PPLPolicy{Policy: shadowPPL},
+		}
+		output, err := eval(t,
+			p,
+			[]proto.Message{s1, u1, s2, u2},
+			&PolicyRequest{
+				HTTP:    RequestHTTP{Method: "GET", URL: "https://from.example.com/path"},
+				Session: RequestSession{ID: "s1"},
+
+				IsValidClientCertificate: true,
+			})
+		require.NoError(t, err)
+		assert.Equal(t, &PolicyResponse{
+			Allow:  NewRuleResult(true, criteria.ReasonEmailOK),
+			Deny:   NewRuleResult(false, criteria.ReasonValidClientCertificateOrNoneRequired),
+			Traces: []contextutil.PolicyEvaluationTrace{{Allow: true}},
+			Shadow: &ShadowResult{
+				Allow: NewRuleResult(false, criteria.ReasonEmailUnauthorized, criteria.ReasonNonPomeriumRoute),
+				Deny:  NewRuleResult(false, criteria.ReasonValidClientCertificateOrNoneRequired),
+			},
+		}, output)
+	})
+	t.Run("http query", func(t *testing.T) {
+		ppl, err := parser.ParseYAML(strings.NewReader(`
+allow:
+  and:
+    - accept: 1
+deny:
+  and:
+    - http_query/debug:
+        is: "1"
+`))
+		require.NoError(t, err)
+		p := &config.Policy{
+			From:   "https://from.example.com",
+			To:     config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+			Policy: &config.PPLPolicy{Policy: ppl},
+		}
+
+		for _, tc := range []struct {
+			url  string
+			deny bool
+		}{
+			{"https://from.example.com/path?debug=1", true},
+			{"https://from.example.com/path?debug=1&x=%zz", true},
+			{"https://from.example.com/path?x=%zz&debug=1", true},
+			{"https://from.example.com/path?debug=0&debug=1", true},
+			{"https://from.example.com/path?debug=1&debug=0", true},
+			{"https://from.example.com/path?debug=%zz", false},
+			{"https://from.example.com/path?debug=0&x=%zz", false},
+			// semicolons aren't separators, as for net/http
+			{"https://from.example.com/path?debug=1;x", false},
+		} {
+			output, err := eval(t,
+				p,
+				[]proto.Message{s1, u1, s2, u2},
+				&PolicyRequest{
+					HTTP:    NewRequestHTTP("GET", *mustParseURL(tc.url), nil, "", ""),
+					Session: RequestSession{ID: "s1"},
+
+					IsValidClientCertificate: true,
+				})
+			require.NoError(t, err)
+			assert.Equal(t, tc.deny, output.Deny.Value, tc.url)
+		}
+
+		ppl, err = parser.ParseYAML(strings.NewReader(`
+allow:
+  and:
+    - http_query/tenant:
+        is: mine
+`))
+		require.NoError(t, err)
+		p = &config.Policy{
+			From:   "https://from.example.com",
+			To:     config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+			Policy: &config.PPLPolicy{Policy: ppl},
+		}
+
+		for _, tc := range []struct {
+			url   string
+			allow bool
+		}{
+			{"https://from.example.com/path?tenant=mine", true},
+			{"https://from.example.com/path?tenant=mine&tenant=mine", true},
+			{"https://from.example.com/path?tenant=mine&x=%zz", true},
+			{"https://from.example.com/path", false},
+			{"https://from.example.com/path?tenant=evil", false},
+			// the upstream may read any of the values of a repeated parameter
+			{"https://from.example.com/path?tenant=evil&tenant=mine", false},
+			{"https://from.example.com/path?tenant=mine&tenant=evil", false},
+			// semicolons aren't separators, as for net/http
+			{"https://from.example.com/path?x=1;tenant=mine", false},
+			{"https://from.example.com/path?tenant=mine;tenant=evil", false},
+		} {
+			output, err := eval(t,
+				p,
+				[]proto.Message{s1, u1, s2, u2},
+				&PolicyRequest{
+					HTTP:    NewRequestHTTP("GET", *mustParseURL(tc.url), nil, "", ""),
+					Session: RequestSession{ID: "s1"},
+
+					IsValidClientCertificate: true,
+				})
+			require.NoError(t, err)
+			assert.Equal(t, tc.allow, output.Allow.Value, tc.url)
+		}
+	})
+	t.Run("http callout", func(t *testing.T) {
+		var document map[string]interface{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "KEY", r.Header.Get("X-API-Key"))
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&document))
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"allow": document["user"].(map[string]interface{})["email"] == "u1@example.com",
+			})
+		}))
+		t.Cleanup(srv.Close)
+
+		ppl, err := parser.ParseYAML(strings.NewReader(`
+allow:
+  and:
+    - http_callout:
+        url: ` + srv.URL + `
+        headers:
+          X-API-Key: KEY
+        forward_headers: [user-agent]
+        cache_ttl: 0s
+`))
+		require.NoError(t, err)
+		p := &config.Policy{
+			From:   "https://from.example.com",
+			To:     config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+			Policy: &config.PPLPolicy{Policy: ppl},
+		}
+
+		output, err := eval(t,
+			p,
+			[]proto.Message{s1, u1, s2, u2},
+			&PolicyRequest{
+				HTTP: RequestHTTP{Method: "GET", URL: "https://from.example.com/path", Headers: map[string]string{
+					"Authorization": "SECRET",
+					"Cookie":        "SECRET",
+					"User-Agent":    "test",
+				}},
+				Session: RequestSession{ID: "s1"},
+				Route:   RequestRoute{ID: "1234", From: "https://from.example.com"},
+
+				IsValidClientCertificate: true,
+			})
+		require.NoError(t, err)
+		assert.Equal(t, NewRuleResult(true, criteria.ReasonHTTPCalloutOK), output.Allow)
+		assert.Equal(t, map[string]interface{}{"User-Agent": "test"},
+			document["request"].(map[string]interface{})["headers"])
+		assert.Equal(t, map[string]interface{}{"id": "1234", "from": "https://from.example.com"}, document["route"])
+
+		output, err = eval(t,
+			p,
+			[]proto.Message{s1, u1, s2, u2},
+			&PolicyRequest{
+				HTTP:    RequestHTTP{Method: "GET", URL: "https://from.example.com/path"},
+				Session: RequestSession{ID: "s2"},
+
+				IsValidClientCertificate: true,
+			})
+		require.NoError(t, err)
+		assert.Equal(t, NewRuleResult(false, criteria.ReasonHTTPCalloutUnauthorized, criteria.ReasonNonPomeriumRoute), output.Allow)
+	})
+	t.Run("http callout failure", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		unreachableURL := srv.URL
+		srv.Close()
+
+		for _, tc := range []struct {
+			name  string
+			ppl   string
+			allow bool
+			deny  bool
+		}{
+			{"deny fail closed", `
+allow:
+  and:
+    - accept: 1
+deny:
+  and:
+    - http_callout:
+        url: ` + unreachableURL + `
+        timeout: 1s
+`, true, true},
+			{"deny fail open", `
+allow:
+  and:
+    - accept: 1
+deny:
+  and:
+    - http_callout:
+        url: ` + unreachableURL + `
+        timeout: 1s
+        fail_open: true
+`, true, false},
+			{"not fail closed", `
+allow:
+  not:
+    - http_callout:
+        url: ` + unreachableURL + `
+        timeout: 1s
+`, true, true},
+			{"allow fail open", `
+allow:
+  and:
+    - http_callout:
+        url: ` + unreachableURL + `
+        timeout: 1s
+        fail_open: true
+`, true, false},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				ppl, err := parser.ParseYAML(strings.NewReader(tc.ppl))
+				require.NoError(t, err)
+				p := &config.Policy{
+					From:   "https://from.example.com",
+					To:     config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+					Policy: &config.PPLPolicy{Policy: ppl},
+				}
+				output, err := eval(t,
+					p,
+					[]proto.Message{s1, u1, s2, u2},
+					&PolicyRequest{
+						HTTP:    RequestHTTP{Method: "GET", URL: "https://from.example.com/path"},
+						Session: RequestSession{ID: "s1"},
+
+						IsValidClientCertificate: true,
+					})
+				require.NoError(t, err)
+				assert.Equal(t, tc.allow, output.Allow.Value, "allow")
+				assert.Equal(t, tc.deny, output.Deny.Value, "deny")
+				if tc.deny {
+					assert.True(t, output.Deny.Reasons.Has(criteria.ReasonHTTPCalloutError))
+				}
+			})
+		}
+	})
 }
@@ -0,0 +1,87 @@
+package evaluator
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/scim"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+	"github.com/pomerium/pomerium/pkg/policy/criteria"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// applyDeactivatedUser denies the requests of users deactivated by the SCIM
+// client. Their sessions are revoked when they're deactivated, but they can
+// still sign in again with the identity provider. Pomerium routes stay
+// available so that they can see why they're denied and sign out.
+func applyDeactivatedUser(ctx context.Context, req *Request, res *Result) {
+	if !res.Allow.Value || res.Deny.Value || res.Allow.Reasons.Has(criteria.ReasonPomeriumRoute) {
+		return
+	}
+
+	// like get_databroker_record, errors are treated as a missing record
+	u, err := getSessionUser(ctx, req.Session.ID)
+	if err != nil {
+		log.Error(ctx).Err(err).Msg("authorize: error retrieving session user")
+		return
+	}
+	if !scim.IsUserDeactivated(u) {
+		return
+	}
+	res.Deny = NewRuleResult(true, criteria.ReasonUserDeactivated)
+}
+
+// getSessionUser returns the user of a session or service account. If there
+// is no session, service account or user, nil is returned.
+func getSessionUser(ctx context.Context, sessionID string) (*user.User, error) {
+	if sessionID == "" {
+		return nil, nil
+	}
+
+	msg, err := getDataBrokerMessage(ctx, grpcutil.GetTypeURL(new(session.Session)), sessionID)
+	if storage.IsNotFound(err) {
+		msg, err = getDataBrokerMessage(ctx, grpcutil.GetTypeURL(new(user.ServiceAccount)), sessionID)
+	}
+	if storage.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	s, ok := msg.(interface{ GetUserId() string })
+	if !ok {
+		return nil, nil
+	}
+
+	msg, err = getDataBrokerMessage(ctx, grpcutil.GetTypeURL(new(user.User)), s.GetUserId())
+	if storage.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	u, _ := msg.(*user.User)
+	return u, nil
+}
+
+func getDataBrokerMessage(ctx context.Context, recordType, recordID string) (proto.Message, error) {
+	req := &databroker.QueryRequest{
+		Type:  recordType,
+		Limit: 1,
+	}
+	req.SetFilterByIDOrIndex(recordID)
+
+	res, err := storage.GetQuerier(ctx).Query(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.GetRecords()) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	return res.GetRecords()[0].GetData().UnmarshalNew()
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
 
@@ -13,11 +14,13 @@ import (
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/internal/telemetry/requestid"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/internal/urlutil"
 	"github.com/pomerium/pomerium/pkg/contextutil"
 	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/policy/criteria"
 	"github.com/pomerium/pomerium/pkg/storage"
 )
 
@@ -74,6 +77,16 @@ func (a *Authorize) Check(ctx context.Context, in *envoy_service_auth_v3.CheckRe
 		return nil, err
 	}
 
+	a.applyRateLimit(ctx, req, res, s)
+	a.applyTokenExchange(ctx, req, res, s)
+	a.recordDecision(ctx, req, res, s)
+	a.trackRouteAccess(req, res, s)
+
+	if res.Shadow != nil && isAllowed(res.Allow, res.Deny) != isAllowed(res.Shadow.Allow, res.Shadow.Deny) {
+		metrics.RecordAuthorizeShadowPolicyMismatch(ctx, req.Policy.From,
+			isAllowed(res.Allow, res.Deny), isAllowed(res.Shadow.Allow, res.Shadow.Deny))
+	}
+
 	// if show error details is enabled, attach the policy evaluation traces
 	if req.Policy != nil && req.Policy.ShowErrorDetails {
 		ctx = contextutil.WithPolicyEvaluationTraces(ctx, res.Traces)
@@ -87,10 +100,47 @@ func (a *Authorize) Check(ctx context.Context, in *envoy_service_auth_v3.CheckRe
 	return resp, err
 }
 
+// isAllowed returns true if the allow and deny rule results would allow a request.
+func isAllowed(allow, deny evaluator.RuleResult) bool {
+	return allow.Value && !deny.Value
+}
+
+// recordDecision records the reasons for the decision and tracks the user and
+// route of denied requests.
+func (a *Authorize) recordDecision(
+	ctx context.Context,
+	req *evaluator.Request,
+	res *evaluator.Result,
+	s sessionOrServiceAccount,
+) {
+	var route string
+	if req.Policy != nil {
+		route = req.Policy.From
+	}
+
+	allowed := isAllowed(res.Allow, res.Deny)
+	reasons := res.Allow.Reasons
+	if res.Deny.Value {
+		reasons = res.Deny.Reasons
+	}
+	metrics.RecordAuthorizeDecision(ctx, route, allowed, reasons.Strings())
+
+	// unauthenticated users are redirected to log in rather than denied
+	if allowed || reasons.Has(criteria.ReasonUserUnauthenticated) {
+		return
+	}
+	var userID string
+	if s != nil {
+		userID = s.GetUserId()
+	}
+	a.denialTracker.Record(time.Now(), route, userID)
+}
+
 func (a *Authorize) getEvaluatorRequestFromCheckRequest(
 	in *envoy_service_auth_v3.CheckRequest,
 	sessionState *sessions.State,
 ) (*evaluator.Request, error) {
+	options := a.currentOptions.Load()
 	requestURL := getCheckRequestURL(in)
 	req := &evaluator.Request{
 		HTTP: evaluator.NewRequestHTTP(
@@ -98,7 +148,7 @@ func (a *Authorize) getEvaluatorRequestFromCheckRequest(
 			requestURL,
 			getCheckRequestHeaders(in),
 			getPeerCertificate(in),
-			in.GetAttributes().GetSource().GetAddress().GetSocketAddress().GetAddress(),
+			getClientIP(in, options.XffNumTrustedHops, options.SkipXffAppend),
 		),
 	}
 	if sessionState != nil {
@@ -172,3 +222,33 @@ func getPeerCertificate(in *envoy_service_auth_v3.CheckRequest) string {
 	cert, _ := url.QueryUnescape(in.GetAttributes().GetSource().GetCertificate())
 	return cert
 }
+
+// getClientIP gets the downstream client IP address from the check request. Envoy
+// reports the address of the peer connection, so when there are trusted proxies in
+// front of envoy the client address is taken from the X-Forwarded-For header, the
+// same way envoy determines the trusted client address.
+//
+// See https://www.envoyproxy.io/docs/envoy/latest/configuration/http/http_conn_man/headers#x-forwarded-for
+func getClientIP(in *envoy_service_auth_v3.CheckRequest, xffNumTrustedHops uint32, skipXffAppend bool) string {
+	peerIP := in.GetAttributes().GetSource().GetAddress().GetSocketAddress().GetAddress()
+	if xffNumTrustedHops == 0 {
+		return peerIP
+	}
+
+	var xff []string
+	for _, ip := range strings.Split(in.GetAttributes().GetRequest().GetHttp().GetHeaders()["x-forwarded-for"], ",") {
+		if ip = strings.TrimSpace(ip); ip != "" {
+			xff = append(xff, ip)
+		}
+	}
+	// envoy appends the peer address before calling authorize, unless skip_xff_append is set
+	if skipXffAppend || len(xff) == 0 {
+		xff = append(xff, peerIP)
+	}
+
+	idx := len(xff) - 1 - int(xffNumTrustedHops)
+	if idx < 0 {
+		return peerIP
+	}
+	return xff[idx]
+}
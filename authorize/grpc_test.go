@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"testing"
 
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -170,3 +171,51 @@ func mustParseURL(rawURL string) url.URL {
 	}
 	return *u
 }
+
+func Test_getClientIP(t *testing.T) {
+	mkCheckRequest := func(peerIP, xff string) *envoy_service_auth_v3.CheckRequest {
+		in := &envoy_service_auth_v3.CheckRequest{
+			Attributes: &envoy_service_auth_v3.AttributeContext{
+				Source: &envoy_service_auth_v3.AttributeContext_Peer{
+					Address: &envoy_config_core_v3.Address{
+						Address: &envoy_config_core_v3.Address_SocketAddress{
+							SocketAddress: &envoy_config_core_v3.SocketAddress{
+								Address: peerIP,
+							},
+						},
+					},
+				},
+				Request: &envoy_service_auth_v3.AttributeContext_Request{
+					Http: &envoy_service_auth_v3.AttributeContext_HttpRequest{
+						Headers: map[string]string{},
+					},
+				},
+			},
+		}
+		if xff != "" {
+			in.Attributes.Request.Http.Headers["x-forwarded-for"] = xff
+		}
+		return in
+	}
+
+	for _, tc := range []struct {
+		name              string
+		peerIP            string
+		xff               string
+		xffNumTrustedHops uint32
+		skipXffAppend     bool
+		expect            string
+	}{
+		{"no trusted hops", "192.0.2.5", "203.0.113.128, 192.0.2.1, 192.0.2.5", 0, false, "192.0.2.5"},
+		{"one trusted hop", "192.0.2.5", "203.0.113.128, 192.0.2.1, 192.0.2.5", 1, false, "192.0.2.1"},
+		{"two trusted hops", "192.0.2.5", "203.0.113.128, 192.0.2.1, 192.0.2.5", 2, false, "203.0.113.128"},
+		{"too many trusted hops", "192.0.2.5", "192.0.2.1, 192.0.2.5", 2, false, "192.0.2.5"},
+		{"skip xff append", "192.0.2.5", "203.0.113.128, 192.0.2.1", 1, true, "192.0.2.1"},
+		{"missing xff", "192.0.2.5", "", 1, false, "192.0.2.5"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, getClientIP(mkCheckRequest(tc.peerIP, tc.xff), tc.xffNumTrustedHops, tc.skipXffAppend))
+		})
+	}
+}
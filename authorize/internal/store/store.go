@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/go-jose/go-jose/v3"
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/rego"
 	opastorage "github.com/open-policy-agent/opa/storage"
@@ -52,12 +51,6 @@ func (s *Store) UpdateRoutePolicies(routePolicies []config.Policy) {
 	s.write("/route_policies", routePolicies)
 }
 
-// UpdateSigningKey updates the signing key stored in the database. Signing operations
-// in rego use JWKs, so we take in that format.
-func (s *Store) UpdateSigningKey(signingKey *jose.JSONWebKey) {
-	s.write("/signing_key", signingKey)
-}
-
 func (s *Store) write(rawPath string, value interface{}) {
 	ctx := context.TODO()
 	err := opastorage.Txn(ctx, s.Store, opastorage.WriteParams, func(txn opastorage.Transaction) error {
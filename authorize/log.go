@@ -3,15 +3,17 @@ package authorize
 import (
 	"context"
 	"strings"
+	"time"
 
 	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
 	"github.com/rs/zerolog"
 
 	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/internal/audit"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/telemetry/requestid"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
-	"github.com/pomerium/pomerium/pkg/grpc/audit"
+	auditpb "github.com/pomerium/pomerium/pkg/grpc/audit"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 	"github.com/pomerium/pomerium/pkg/grpc/session"
 	"github.com/pomerium/pomerium/pkg/grpc/user"
@@ -61,6 +63,21 @@ func (a *Authorize) logAuthorizeCheck(
 		} else {
 			evt = evt.Strs("deny-why-false", res.Deny.Reasons.Strings())
 		}
+		if res.Shadow != nil {
+			evt = evt.Bool("shadow-allow", res.Shadow.Allow.Value)
+			if res.Shadow.Allow.Value {
+				evt = evt.Strs("shadow-allow-why-true", res.Shadow.Allow.Reasons.Strings())
+			} else {
+				evt = evt.Strs("shadow-allow-why-false", res.Shadow.Allow.Reasons.Strings())
+			}
+			evt = evt.Bool("shadow-deny", res.Shadow.Deny.Value)
+			if res.Shadow.Deny.Value {
+				evt = evt.Strs("shadow-deny-why-true", res.Shadow.Deny.Reasons.Strings())
+			} else {
+				evt = evt.Strs("shadow-deny-why-false", res.Shadow.Deny.Reasons.Strings())
+			}
+			evt = evt.Bool("shadow-mismatch", isAllowed(res.Allow, res.Deny) != isAllowed(res.Shadow.Allow, res.Shadow.Deny))
+		}
 		evt = evt.Str("user", u.GetId())
 		evt = evt.Str("email", u.GetEmail())
 	}
@@ -72,11 +89,12 @@ func (a *Authorize) logAuthorizeCheck(
 
 	evt.Msg("authorize check")
 
-	if enc := a.state.Load().auditEncryptor; enc != nil {
+	state := a.state.Load()
+	if enc := state.auditEncryptor; enc != nil {
 		ctx, span := trace.StartSpan(ctx, "authorize.grpc.AuditAuthorizeCheck")
 		defer span.End()
 
-		record := &audit.Record{
+		record := &auditpb.Record{
 			Request:  in,
 			Response: out,
 		}
@@ -85,10 +103,26 @@ func (a *Authorize) logAuthorizeCheck(
 			log.Warn(ctx).Err(err).Msg("authorize: error encrypting audit record")
 			return
 		}
-		log.Info(ctx).
-			Str("request-id", requestid.FromContext(ctx)).
-			EmbedObject(sealed).
-			Msg("audit log")
+
+		entry := &audit.Entry{
+			Time:      time.Now(),
+			RequestID: requestid.FromContext(ctx),
+			Record:    sealed,
+		}
+		// the entry is still written if signing fails, so the chain doesn't have a gap
+		err = a.auditChain.Append(entry, state.auditSigner, func(entry *audit.Entry) {
+			// without any sinks the entry is written to the log
+			if len(state.auditSinks) == 0 {
+				log.Info(ctx).EmbedObject(entry).Msg("audit log")
+				return
+			}
+			for _, sink := range state.auditSinks {
+				sink.Add(ctx, entry)
+			}
+		})
+		if err != nil {
+			log.Warn(ctx).Err(err).Msg("authorize: error signing audit record")
+		}
 	}
 }
 
@@ -0,0 +1,298 @@
+// Package policytest evaluates authorization policy against test cases without
+// connecting to the databroker or an identity provider.
+package policytest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/authorize/internal/store"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/grpc/device"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/policy/criteria"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// A File contains the fixtures and test cases to evaluate.
+type File struct {
+	Sessions          []Fixture `yaml:"sessions"`
+	Users             []Fixture `yaml:"users"`
+	ServiceAccounts   []Fixture `yaml:"service_accounts"`
+	DeviceCredentials []Fixture `yaml:"device_credentials"`
+	DeviceEnrollments []Fixture `yaml:"device_enrollments"`
+	DeviceTypes       []Fixture `yaml:"device_types"`
+
+	Cases []Case `yaml:"cases"`
+}
+
+// A Fixture is a databroker record in its protobuf JSON form.
+type Fixture map[string]interface{}
+
+// A Case is a single test case.
+type Case struct {
+	Name    string  `yaml:"name"`
+	Request Request `yaml:"request"`
+	Expect  Expect  `yaml:"expect"`
+}
+
+// A Request is the request to evaluate.
+type Request struct {
+	Method            string            `yaml:"method"`
+	URL               string            `yaml:"url"`
+	Headers           map[string]string `yaml:"headers"`
+	IP                string            `yaml:"ip"`
+	ClientCertificate string            `yaml:"client_certificate"`
+	SessionID         string            `yaml:"session_id"`
+}
+
+// Expect is the expected result of evaluating a request. Fields which aren't set
+// aren't checked.
+type Expect struct {
+	Allow *bool `yaml:"allow"`
+	Deny  *bool `yaml:"deny"`
+	// Reasons must all be found in either the allow or deny reasons.
+	Reasons []string `yaml:"reasons"`
+}
+
+// A Result is the result of running a test case.
+type Result struct {
+	Name     string
+	Failures []string
+}
+
+// Passed returns true if the test case passed.
+func (r Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// A Report contains the results of running all the test cases.
+type Report struct {
+	Results []Result
+}
+
+// Failed returns the number of failed test cases.
+func (r *Report) Failed() int {
+	cnt := 0
+	for _, res := range r.Results {
+		if !res.Passed() {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// WriteTo writes a human readable report to w.
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	write := func(format string, args ...interface{}) error {
+		nn, err := fmt.Fprintf(w, format, args...)
+		n += int64(nn)
+		return err
+	}
+
+	for _, res := range r.Results {
+		if res.Passed() {
+			if err := write("PASS %s\n", res.Name); err != nil {
+				return n, err
+			}
+			continue
+		}
+		if err := write("FAIL %s\n", res.Name); err != nil {
+			return n, err
+		}
+		for _, failure := range res.Failures {
+			if err := write("    %s\n", failure); err != nil {
+				return n, err
+			}
+		}
+	}
+	err := write("%d passed, %d failed\n", len(r.Results)-r.Failed(), r.Failed())
+	return n, err
+}
+
+// ReadFile reads a test case file.
+func ReadFile(name string) (*File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Read(f)
+}
+
+// Read reads test cases from r.
+func Read(r io.Reader) (*File, error) {
+	var f File
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("policytest: invalid test file: %w", err)
+	}
+	for i, c := range f.Cases {
+		if c.Name == "" {
+			f.Cases[i].Name = fmt.Sprintf("case %d", i+1)
+		}
+	}
+	return &f, nil
+}
+
+// Run evaluates the test cases against the policies in the options.
+func Run(ctx context.Context, options *config.Options, f *File) (*Report, error) {
+	records, err := f.records()
+	if err != nil {
+		return nil, err
+	}
+	ctx = storage.WithQuerier(ctx, storage.NewStaticQuerier(records...))
+
+	e, err := newEvaluator(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	report := new(Report)
+	for _, c := range f.Cases {
+		res, err := runCase(ctx, options, e, c)
+		if err != nil {
+			return nil, fmt.Errorf("policytest: %s: %w", c.Name, err)
+		}
+		report.Results = append(report.Results, *res)
+	}
+	return report, nil
+}
+
+func runCase(ctx context.Context, options *config.Options, e *evaluator.Evaluator, c Case) (*Result, error) {
+	requestURL, err := urlutil.ParseAndValidateURL(c.Request.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+
+	headers := make(map[string]string, len(c.Request.Headers))
+	for k, v := range c.Request.Headers {
+		headers[http.CanonicalHeaderKey(k)] = v
+	}
+
+	method := c.Request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req := &evaluator.Request{
+		HTTP: evaluator.NewRequestHTTP(
+			method,
+			*requestURL,
+			headers,
+			c.Request.ClientCertificate,
+			c.Request.IP,
+		),
+		Session: evaluator.RequestSession{
+			ID: c.Request.SessionID,
+		},
+	}
+	for _, p := range options.GetAllPolicies() {
+		if p.Matches(*requestURL) {
+			p := p
+			req.Policy = &p
+			break
+		}
+	}
+
+	out, err := e.Evaluate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{Name: c.Name}
+	if c.Expect.Allow != nil && *c.Expect.Allow != out.Allow.Value {
+		res.Failures = append(res.Failures, fmt.Sprintf("expected allow=%t, got allow=%t (reasons: %v)",
+			*c.Expect.Allow, out.Allow.Value, out.Allow.Reasons.Strings()))
+	}
+	if c.Expect.Deny != nil && *c.Expect.Deny != out.Deny.Value {
+		res.Failures = append(res.Failures, fmt.Sprintf("expected deny=%t, got deny=%t (reasons: %v)",
+			*c.Expect.Deny, out.Deny.Value, out.Deny.Reasons.Strings()))
+	}
+	reasons := out.Allow.Reasons.Union(out.Deny.Reasons)
+	var missing []string
+	for _, r := range c.Expect.Reasons {
+		if !reasons.Has(criteria.Reason(r)) {
+			missing = append(missing, r)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		res.Failures = append(res.Failures, fmt.Sprintf("missing reasons %v, got %v", missing, reasons.Strings()))
+	}
+	return res, nil
+}
+
+func newEvaluator(ctx context.Context, options *config.Options) (*evaluator.Evaluator, error) {
+	clientCA, err := options.GetClientCA()
+	if err != nil {
+		return nil, fmt.Errorf("policytest: invalid client CA: %w", err)
+	}
+
+	authenticateURL, err := options.GetInternalAuthenticateURL()
+	if err != nil {
+		return nil, fmt.Errorf("policytest: invalid authenticate url: %w", err)
+	}
+
+	signingKey, err := options.GetSigningKey()
+	if err != nil {
+		return nil, fmt.Errorf("policytest: invalid signing key: %w", err)
+	}
+
+	return evaluator.New(ctx, store.New(),
+		evaluator.WithPolicies(options.GetAllPolicies()),
+		evaluator.WithClientCA(clientCA),
+		evaluator.WithSigningKey(signingKey),
+		evaluator.WithAuthenticateURL(authenticateURL.String()),
+		evaluator.WithGoogleCloudServerlessAuthenticationServiceAccount(options.GetGoogleCloudServerlessAuthenticationServiceAccount()),
+		evaluator.WithJWTClaimsHeaders(options.JWTClaimsHeaders),
+	)
+}
+
+func (f *File) records() ([]proto.Message, error) {
+	var msgs []proto.Message
+	for _, fixtures := range []struct {
+		name string
+		list []Fixture
+		new  func() proto.Message
+	}{
+		{"sessions", f.Sessions, func() proto.Message { return new(session.Session) }},
+		{"users", f.Users, func() proto.Message { return new(user.User) }},
+		{"service_accounts", f.ServiceAccounts, func() proto.Message { return new(user.ServiceAccount) }},
+		{"device_credentials", f.DeviceCredentials, func() proto.Message { return new(device.Credential) }},
+		{"device_enrollments", f.DeviceEnrollments, func() proto.Message { return new(device.Enrollment) }},
+		{"device_types", f.DeviceTypes, func() proto.Message { return new(device.Type) }},
+	} {
+		for i, fixture := range fixtures.list {
+			msg := fixtures.new()
+			if err := fixture.unmarshalTo(msg); err != nil {
+				return nil, fmt.Errorf("policytest: invalid %s fixture %d: %w", fixtures.name, i+1, err)
+			}
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, nil
+}
+
+func (f Fixture) unmarshalTo(msg proto.Message) error {
+	bs, err := json.Marshal(map[string]interface{}(f))
+	if err != nil {
+		return err
+	}
+	return protojson.Unmarshal(bs, msg)
+}
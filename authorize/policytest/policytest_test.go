@@ -0,0 +1,136 @@
+package policytest
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	ppl, err := parser.ParseYAML(strings.NewReader(`
+allow:
+  and:
+    - claim/groups: admin
+`))
+	require.NoError(t, err)
+
+	options := config.NewDefaultOptions()
+	options.AuthenticateURLString = "https://authenticate.example.com"
+	options.Policies = []config.Policy{{
+		From:         "https://from.example.com",
+		To:           config.WeightedURLs{{URL: *mustParseURL(t, "https://to.example.com")}},
+		AllowedUsers: []string{"user-1", "user-3"},
+	}, {
+		From:   "https://admin.example.com",
+		To:     config.WeightedURLs{{URL: *mustParseURL(t, "https://to.example.com")}},
+		Policy: &config.PPLPolicy{Policy: ppl},
+	}}
+
+	for i := range options.Policies {
+		require.NoError(t, options.Policies[i].Validate())
+	}
+
+	f, err := Read(strings.NewReader(`
+sessions:
+  - id: session-1
+    user_id: user-1
+    claims:
+      groups: [admin]
+  - id: session-2
+    user_id: user-2
+  - id: session-3
+    user_id: user-3
+users:
+  - id: user-1
+    email: user1@example.com
+  - id: user-3
+    claims:
+      scim_active: [false]
+cases:
+  - name: allowed user
+    request:
+      url: https://from.example.com/
+      session_id: session-1
+    expect:
+      allow: true
+      reasons: [user-ok]
+  - name: unknown user
+    request:
+      url: https://from.example.com/
+      session_id: session-2
+    expect:
+      allow: true
+  - request:
+      url: https://admin.example.com/
+      session_id: session-1
+    expect:
+      allow: true
+      deny: false
+  - name: missing route
+    request:
+      url: https://unknown.example.com/
+    expect:
+      deny: true
+      reasons: [route-not-found, user-ok]
+  - name: deactivated user
+    request:
+      url: https://from.example.com/
+      session_id: session-3
+    expect:
+      deny: true
+      reasons: [user-deactivated]
+`))
+	require.NoError(t, err)
+
+	report, err := Run(context.Background(), options, f)
+	require.NoError(t, err)
+	require.Len(t, report.Results, 5)
+	assert.True(t, report.Results[0].Passed(), report.Results[0].Failures)
+	assert.False(t, report.Results[1].Passed())
+	assert.Equal(t, "case 3", report.Results[2].Name)
+	assert.True(t, report.Results[2].Passed(), report.Results[2].Failures)
+	assert.Equal(t, []string{"missing reasons [user-ok], got [route-not-found]"}, report.Results[3].Failures)
+	assert.True(t, report.Results[4].Passed(), report.Results[4].Failures)
+	assert.Equal(t, 2, report.Failed())
+
+	var buf bytes.Buffer
+	_, err = report.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, `PASS allowed user
+FAIL unknown user
+    expected allow=true, got allow=false (reasons: [email-unauthorized non-pomerium-route user-unauthorized])
+PASS case 3
+FAIL missing route
+    missing reasons [user-ok], got [route-not-found]
+PASS deactivated user
+3 passed, 2 failed
+`, buf.String())
+}
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+
+	_, err := Read(strings.NewReader(`
+cases:
+  - name: unknown field
+    request:
+      uri: https://from.example.com
+`))
+	assert.Error(t, err)
+}
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	return u
+}
@@ -0,0 +1,71 @@
+package authorize
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/ratelimit"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/policy/criteria"
+)
+
+// applyRateLimit counts an allowed request against the rate limit of its route.
+// If the limit is exceeded the request is denied with the time to wait before
+// retrying.
+func (a *Authorize) applyRateLimit(
+	ctx context.Context,
+	req *evaluator.Request,
+	res *evaluator.Result,
+	s sessionOrServiceAccount,
+) {
+	if req.Policy == nil || req.Policy.RateLimit == nil || !isAllowed(res.Allow, res.Deny) {
+		return
+	}
+	rl := req.Policy.RateLimit
+
+	routeID, err := req.Policy.RouteID()
+	if err != nil {
+		log.Error(ctx).Err(err).Msg("authorize: error computing route id for rate limit")
+		return
+	}
+
+	var counter ratelimit.Counter = a.rateLimitCounter
+	if rl.Shared {
+		counter = a.sharedRateLimitCounter
+	}
+
+	key := fmt.Sprintf("%d/%s", routeID, getRateLimitKey(rl.GetKey(), req, s))
+	limit := ratelimit.Limit{Requests: rl.Requests, Period: rl.GetPeriod()}
+	allowed, retryAfter := ratelimit.Allow(counter, key, limit, time.Now())
+	if allowed {
+		return
+	}
+
+	res.Deny = evaluator.NewRuleResult(true, criteria.ReasonRateLimited)
+	res.Deny.AdditionalData["retry_after"] = int64(math.Ceil(retryAfter.Seconds()))
+}
+
+// getRateLimitKey returns what a request is counted by. Requests without a
+// user, session or service account are counted by the client ip.
+func getRateLimitKey(key string, req *evaluator.Request, s sessionOrServiceAccount) string {
+	switch key {
+	case config.RateLimitKeyUser:
+		if s != nil && s.GetUserId() != "" {
+			return "user/" + s.GetUserId()
+		}
+	case config.RateLimitKeySession:
+		if req.Session.ID != "" {
+			return "session/" + req.Session.ID
+		}
+	case config.RateLimitKeyServiceAccount:
+		if sa, ok := s.(*user.ServiceAccount); ok {
+			return "service_account/" + sa.GetId()
+		}
+	}
+	return "ip/" + req.HTTP.IP
+}
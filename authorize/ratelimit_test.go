@@ -0,0 +1,86 @@
+package authorize
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/ratelimit"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/policy/criteria"
+)
+
+func TestAuthorize_applyRateLimit(t *testing.T) {
+	t.Parallel()
+
+	a := &Authorize{rateLimitCounter: ratelimit.NewMemoryCounter()}
+	policy := &config.Policy{
+		From:      "https://from.example.com",
+		To:        mustParseWeightedURLs(t, "https://to.example.com"),
+		RateLimit: &config.PolicyRateLimit{Requests: 2, Period: time.Hour},
+	}
+	require.NoError(t, policy.Validate())
+
+	check := func(userID string) *evaluator.Result {
+		req := &evaluator.Request{Policy: policy}
+		req.HTTP.IP = "127.0.0.1"
+		res := &evaluator.Result{
+			Allow: evaluator.NewRuleResult(true, criteria.ReasonUserOK),
+			Deny:  evaluator.NewRuleResult(false),
+		}
+		a.applyRateLimit(context.Background(), req, res, &session.Session{UserId: userID})
+		return res
+	}
+
+	assert.False(t, check("u1").Deny.Value)
+	assert.False(t, check("u1").Deny.Value)
+	res := check("u1")
+	assert.True(t, res.Deny.Value)
+	assert.True(t, res.Deny.Reasons.Has(criteria.ReasonRateLimited))
+	assert.Greater(t, res.Deny.AdditionalData["retry_after"], int64(0))
+
+	assert.False(t, check("u2").Deny.Value, "users should be counted separately")
+
+	t.Run("denied requests are not counted", func(t *testing.T) {
+		req := &evaluator.Request{Policy: policy}
+		res := &evaluator.Result{
+			Allow: evaluator.NewRuleResult(false, criteria.ReasonUserUnauthorized),
+			Deny:  evaluator.NewRuleResult(false),
+		}
+		a.applyRateLimit(context.Background(), req, res, nil)
+		assert.False(t, res.Deny.Value)
+	})
+}
+
+func TestGetRateLimitKey(t *testing.T) {
+	t.Parallel()
+
+	req := &evaluator.Request{Session: evaluator.RequestSession{ID: "s1"}}
+	req.HTTP.IP = "127.0.0.1"
+	sess := &session.Session{Id: "s1", UserId: "u1"}
+	sa := &user.ServiceAccount{Id: "sa1", UserId: "u2"}
+
+	for _, tc := range []struct {
+		key  string
+		req  *evaluator.Request
+		s    sessionOrServiceAccount
+		want string
+	}{
+		{config.RateLimitKeyUser, req, sess, "user/u1"},
+		{config.RateLimitKeyUser, req, sa, "user/u2"},
+		{config.RateLimitKeyUser, req, nil, "ip/127.0.0.1"},
+		{config.RateLimitKeySession, req, sess, "session/s1"},
+		{config.RateLimitKeySession, &evaluator.Request{HTTP: req.HTTP}, nil, "ip/127.0.0.1"},
+		{config.RateLimitKeyServiceAccount, req, sa, "service_account/sa1"},
+		{config.RateLimitKeyServiceAccount, req, sess, "ip/127.0.0.1"},
+		{config.RateLimitKeyIP, req, sess, "ip/127.0.0.1"},
+	} {
+		assert.Equal(t, tc.want, getRateLimitKey(tc.key, tc.req, tc.s), "key=%s", tc.key)
+	}
+}
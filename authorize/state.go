@@ -3,12 +3,17 @@ package authorize
 import (
 	"context"
 	"fmt"
+	"reflect"
 
+	"github.com/go-jose/go-jose/v3"
 	googlegrpc "google.golang.org/grpc"
 
 	"github.com/pomerium/pomerium/authorize/evaluator"
 	"github.com/pomerium/pomerium/authorize/internal/store"
 	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/audit"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
 	"github.com/pomerium/pomerium/pkg/grpc"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 	"github.com/pomerium/pomerium/pkg/hpke"
@@ -23,12 +28,19 @@ type authorizeState struct {
 	dataBrokerClientConnection *googlegrpc.ClientConn
 	dataBrokerClient           databroker.DataBrokerServiceClient
 	auditEncryptor             *protoutil.Encryptor
+	auditSigner                jose.Signer
+	auditSinks                 []*auditSink
 	sessionStore               *config.SessionStore
 	hpkePrivateKey             *hpke.PrivateKey
 	authenticateKeyFetcher     hpke.KeyFetcher
 }
 
-func newAuthorizeStateFromConfig(cfg *config.Config, store *store.Store) (*authorizeState, error) {
+func newAuthorizeStateFromConfig(
+	cfg *config.Config,
+	store *store.Store,
+	decisionCache *evaluator.DecisionCache,
+	previous *authorizeState,
+) (*authorizeState, error) {
 	if err := validateOptions(cfg.Options); err != nil {
 		return nil, fmt.Errorf("authorize: bad options: %w", err)
 	}
@@ -37,7 +49,7 @@ func newAuthorizeStateFromConfig(cfg *config.Config, store *store.Store) (*autho
 
 	var err error
 
-	state.evaluator, err = newPolicyEvaluator(cfg.Options, store)
+	state.evaluator, err = newPolicyEvaluator(cfg.Options, store, decisionCache)
 	if err != nil {
 		return nil, fmt.Errorf("authorize: failed to update policy with options: %w", err)
 	}
@@ -70,6 +82,10 @@ func newAuthorizeStateFromConfig(cfg *config.Config, store *store.Store) (*autho
 	}
 	if auditKey != nil {
 		state.auditEncryptor = protoutil.NewEncryptor(auditKey)
+		state.auditSigner, err = newAuditSigner(cfg.Options)
+		if err != nil {
+			return nil, fmt.Errorf("authorize: invalid signing key for audit records: %w", err)
+		}
 	}
 
 	state.sessionStore, err = config.NewSessionStore(cfg.Options)
@@ -83,5 +99,164 @@ func newAuthorizeStateFromConfig(cfg *config.Config, store *store.Store) (*autho
 		return nil, fmt.Errorf("authorize: get authenticate JWKS key fetcher: %w", err)
 	}
 
+	// the sinks are created last since they need to be closed if anything fails
+	state.auditSinks, err = newAuditSinks(cfg.Options, state.dataBrokerClientConnection, previous)
+	if err != nil {
+		return nil, fmt.Errorf("authorize: invalid audit sinks: %w", err)
+	}
+
 	return state, nil
 }
+
+// close closes the audit sinks, writing any queued audit records. Sinks which
+// were kept by the next state are not closed.
+func (s *authorizeState) close(next *authorizeState) {
+	for _, sink := range s.auditSinks {
+		if next != nil && next.hasAuditSink(sink) {
+			continue
+		}
+		if err := sink.Close(); err != nil {
+			log.Error(context.Background()).Err(err).Msg("authorize: error closing audit sink")
+		}
+	}
+}
+
+func (s *authorizeState) hasAuditSink(sink *auditSink) bool {
+	return containsAuditSink(s.auditSinks, sink)
+}
+
+// newAuditSigner returns a signer for audit records using the signing key. If
+// no signing key is configured, audit records are not signed.
+func newAuditSigner(options *config.Options) (jose.Signer, error) {
+	signingKey, err := options.GetSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(signingKey) == 0 {
+		return nil, nil
+	}
+
+	jwk, err := cryptutil.PrivateJWKFromBytes(signingKey)
+	if err != nil {
+		return nil, err
+	}
+	return audit.NewSigner(jwk)
+}
+
+// An auditSink is a batcher along with the options it was created from.
+type auditSink struct {
+	*audit.Batcher
+	options config.AuditSinkOptions
+	// dataBrokerClientConnection is the connection used by databroker sinks.
+	dataBrokerClientConnection *googlegrpc.ClientConn
+}
+
+// newAuditSinks creates the audit sinks. Sinks of the previous state whose
+// options are unchanged are kept, so that in-flight requests using the previous
+// state don't lose audit records and each file is only written by one sink.
+func newAuditSinks(
+	options *config.Options,
+	cc *googlegrpc.ClientConn,
+	previous *authorizeState,
+) ([]*auditSink, error) {
+	var previousSinks []*auditSink
+	if previous != nil {
+		previousSinks = previous.auditSinks
+	}
+
+	var sinks []*auditSink
+	closeCreated := func() {
+		for _, sink := range sinks {
+			if previous == nil || !previous.hasAuditSink(sink) {
+				_ = sink.Close()
+			}
+		}
+	}
+	for _, o := range options.AuditSinks {
+		var sinkCC *googlegrpc.ClientConn
+		if o.Type == config.AuditSinkTypeDataBroker {
+			sinkCC = cc
+		}
+
+		if sink := findAuditSink(previousSinks, o, sinkCC); sink != nil {
+			sinks = append(sinks, sink)
+			continue
+		}
+
+		sink, err := newAuditSink(o, sinkCC)
+		if err != nil {
+			closeCreated()
+			return nil, err
+		}
+
+		var batcherOptions []audit.BatcherOption
+		if o.QueueSize > 0 {
+			batcherOptions = append(batcherOptions, audit.WithQueueSize(o.QueueSize))
+		}
+		if o.BatchSize > 0 {
+			batcherOptions = append(batcherOptions, audit.WithBatchSize(o.BatchSize))
+		}
+		if o.FlushInterval > 0 {
+			batcherOptions = append(batcherOptions, audit.WithFlushInterval(o.FlushInterval))
+		}
+		batcherOptions = append(batcherOptions,
+			audit.WithBlockWhenFull(o.Backpressure == config.AuditSinkBackpressureBlock))
+
+		sinks = append(sinks, &auditSink{
+			Batcher:                    audit.NewBatcher(sink, batcherOptions...),
+			options:                    o,
+			dataBrokerClientConnection: sinkCC,
+		})
+	}
+
+	// a file sink whose options changed must finish writing before the file is
+	// written to again, otherwise records could be written out of order. This
+	// is only done once every sink was created, so a failed config change
+	// leaves the previous sinks open. The new file sinks open the file on their
+	// first write.
+	for _, previousSink := range previousSinks {
+		if previousSink.options.Type != config.AuditSinkTypeFile || containsAuditSink(sinks, previousSink) {
+			continue
+		}
+		for _, sink := range sinks {
+			if sink.options.Type == config.AuditSinkTypeFile && sink.options.Path == previousSink.options.Path {
+				if err := previousSink.Close(); err != nil {
+					log.Error(context.Background()).Err(err).Msg("authorize: error closing audit sink")
+				}
+				break
+			}
+		}
+	}
+
+	return sinks, nil
+}
+
+func findAuditSink(sinks []*auditSink, o config.AuditSinkOptions, cc *googlegrpc.ClientConn) *auditSink {
+	for _, sink := range sinks {
+		if reflect.DeepEqual(sink.options, o) && sink.dataBrokerClientConnection == cc {
+			return sink
+		}
+	}
+	return nil
+}
+
+func containsAuditSink(sinks []*auditSink, sink *auditSink) bool {
+	for _, other := range sinks {
+		if other == sink {
+			return true
+		}
+	}
+	return false
+}
+
+func newAuditSink(o config.AuditSinkOptions, cc *googlegrpc.ClientConn) (audit.Sink, error) {
+	switch o.Type {
+	case config.AuditSinkTypeFile:
+		return audit.NewFileSink(o.Path, o.MaxSize, o.MaxBackups)
+	case config.AuditSinkTypeHTTP:
+		return audit.NewHTTPSink(o.URL, o.Headers), nil
+	case config.AuditSinkTypeDataBroker:
+		return audit.NewDataBrokerSink(databroker.NewDataBrokerServiceClient(cc), o.MaxRecords), nil
+	}
+	return nil, fmt.Errorf("unknown audit sink type: %s", o.Type)
+}
@@ -0,0 +1,125 @@
+package authorize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/tokenexchange"
+	"github.com/pomerium/pomerium/pkg/grpc/identity"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/policy/criteria"
+)
+
+// tokenExchangeTimeout bounds token exchanges, which block the request being
+// authorized, so that they finish well within envoy's ext_authz timeout.
+const tokenExchangeTimeout = 5 * time.Second
+
+func newTokenExchangeCache() *tokenexchange.Cache {
+	return tokenexchange.NewCache(httputil.NewLoggingClient(&http.Client{
+		Timeout: tokenExchangeTimeout,
+	}, "token_exchange"))
+}
+
+// applyTokenExchange exchanges the session's token for a token for the route's
+// upstream and passes it in the Authorization header. If the token can't be
+// exchanged the request is denied.
+func (a *Authorize) applyTokenExchange(
+	ctx context.Context,
+	req *evaluator.Request,
+	res *evaluator.Result,
+	s sessionOrServiceAccount,
+) {
+	if req.Policy == nil || req.Policy.TokenExchange == nil || !isAllowed(res.Allow, res.Deny) {
+		return
+	}
+
+	// only user sessions have a token to exchange
+	sess, ok := s.(*session.Session)
+	if !ok {
+		return
+	}
+
+	token, err := a.exchangeToken(ctx, req.Policy, sess)
+	if err != nil {
+		log.Error(ctx).Err(err).
+			Str("session-id", sess.GetId()).
+			Msg("authorize: error exchanging token")
+		res.Deny = evaluator.NewRuleResult(true, criteria.ReasonTokenExchangeFailed)
+		return
+	}
+
+	res.Headers.Set("Authorization", "Bearer "+token.AccessToken)
+}
+
+func (a *Authorize) exchangeToken(
+	ctx context.Context,
+	policy *config.Policy,
+	sess *session.Session,
+) (*tokenexchange.Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, tokenExchangeTimeout)
+	defer cancel()
+
+	options := a.currentOptions.Load()
+	te := policy.TokenExchange
+
+	// the token is exchanged with the client the user signed in with
+	idp, err := getIdentityProviderForSession(options, policy, sess)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &tokenexchange.Request{
+		TokenURL:     te.TokenURL,
+		ClientID:     idp.GetClientId(),
+		ClientSecret: idp.GetClientSecret(),
+		Audience:     te.Audience,
+		Resource:     te.Resource,
+		Scopes:       te.Scopes,
+	}
+	switch te.GetSubjectTokenType() {
+	case config.TokenExchangeSubjectTokenTypeIDToken:
+		req.SubjectToken = sess.GetIdToken().GetRaw()
+		req.SubjectTokenType = tokenexchange.TokenTypeIDToken
+	default:
+		req.SubjectToken = sess.GetOauthToken().GetAccessToken()
+		req.SubjectTokenType = tokenexchange.TokenTypeAccessToken
+	}
+	if req.SubjectToken == "" {
+		return nil, errors.New("session has no token to exchange")
+	}
+
+	if req.TokenURL == "" {
+		req.TokenURL, err = a.tokenExchangeCache.TokenURL(ctx, idp.GetUrl())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	routeID, err := policy.RouteID()
+	if err != nil {
+		return nil, err
+	}
+
+	return a.tokenExchangeCache.Exchange(ctx, fmt.Sprintf("%s/%d", sess.GetId(), routeID), req)
+}
+
+// getIdentityProviderForSession gets the identity provider the session was
+// created with, the same way authenticate does. Sessions without an identity
+// provider id use the route's identity provider.
+func getIdentityProviderForSession(
+	options *config.Options,
+	policy *config.Policy,
+	sess *session.Session,
+) (*identity.Provider, error) {
+	if idpID := sess.GetIdentityProviderID(); idpID != "" {
+		return options.GetIdentityProviderForID(idpID)
+	}
+	return options.GetIdentityProviderForPolicy(policy)
+}
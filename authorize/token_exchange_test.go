@@ -0,0 +1,110 @@
+package authorize
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/atomicutil"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/policy/criteria"
+)
+
+func TestAuthorize_applyTokenExchange(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("subject_token") != "ACCESS_TOKEN" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		clientID, _, _ := r.BasicAuth()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":      "EXCHANGED_FOR_" + r.FormValue("audience") + "_BY_" + clientID,
+			"issued_token_type": "urn:ietf:params:oauth:token-type:access_token",
+			"token_type":        "Bearer",
+			"expires_in":        300,
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	opts := config.NewDefaultOptions()
+	opts.ClientID = "CLIENT_ID"
+	opts.ClientSecret = "CLIENT_SECRET"
+	opts.IdentityProviders = []config.IdentityProviderOptions{{
+		ID:           "corp",
+		Provider:     "oidc",
+		ClientID:     "CORP_CLIENT_ID",
+		ClientSecret: "CORP_CLIENT_SECRET",
+	}}
+	a := &Authorize{
+		currentOptions:     atomicutil.NewValue(opts),
+		tokenExchangeCache: newTokenExchangeCache(),
+	}
+	policy := &config.Policy{
+		From: "https://from.example.com",
+		To:   mustParseWeightedURLs(t, "https://to.example.com"),
+		TokenExchange: &config.PolicyTokenExchange{
+			TokenURL: srv.URL,
+			Audience: "orders",
+		},
+	}
+	require.NoError(t, policy.Validate())
+
+	routePolicy := &config.Policy{
+		From:            "https://route.example.com",
+		To:              mustParseWeightedURLs(t, "https://to.example.com"),
+		IDPClientID:     "ROUTE_CLIENT_ID",
+		IDPClientSecret: "ROUTE_CLIENT_SECRET",
+		TokenExchange:   policy.TokenExchange,
+	}
+	require.NoError(t, routePolicy.Validate())
+
+	checkPolicy := func(policy *config.Policy, s sessionOrServiceAccount) *evaluator.Result {
+		res := &evaluator.Result{
+			Allow:   evaluator.NewRuleResult(true, criteria.ReasonUserOK),
+			Deny:    evaluator.NewRuleResult(false),
+			Headers: make(http.Header),
+		}
+		a.applyTokenExchange(context.Background(), &evaluator.Request{Policy: policy}, res, s)
+		return res
+	}
+	check := func(s sessionOrServiceAccount) *evaluator.Result {
+		return checkPolicy(policy, s)
+	}
+
+	res := check(&session.Session{Id: "s1", OauthToken: &session.OAuthToken{AccessToken: "ACCESS_TOKEN"}})
+	assert.False(t, res.Deny.Value)
+	assert.Equal(t, "Bearer EXCHANGED_FOR_orders_BY_CLIENT_ID", res.Headers.Get("Authorization"))
+
+	res = checkPolicy(routePolicy, &session.Session{Id: "s1", OauthToken: &session.OAuthToken{AccessToken: "ACCESS_TOKEN"}})
+	assert.False(t, res.Deny.Value)
+	assert.Equal(t, "Bearer EXCHANGED_FOR_orders_BY_ROUTE_CLIENT_ID", res.Headers.Get("Authorization"),
+		"should use the route's identity provider client")
+
+	s3 := &session.Session{Id: "s3", OauthToken: &session.OAuthToken{AccessToken: "ACCESS_TOKEN"}}
+	s3.SetIdentityProviderID("corp")
+	res = check(s3)
+	assert.False(t, res.Deny.Value)
+	assert.Equal(t, "Bearer EXCHANGED_FOR_orders_BY_CORP_CLIENT_ID", res.Headers.Get("Authorization"),
+		"should use the client of the identity provider the user signed in with")
+
+	res = check(&session.Session{Id: "s2", OauthToken: &session.OAuthToken{AccessToken: "REVOKED"}})
+	assert.True(t, res.Deny.Value)
+	assert.True(t, res.Deny.Reasons.Has(criteria.ReasonTokenExchangeFailed))
+	assert.Empty(t, res.Headers.Get("Authorization"))
+
+	res = check(&user.ServiceAccount{Id: "sa1"})
+	assert.False(t, res.Deny.Value, "service accounts should not be exchanged")
+	assert.Empty(t, res.Headers.Get("Authorization"))
+}
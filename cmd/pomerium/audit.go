@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/pomerium/pomerium/internal/audit"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	auditpb "github.com/pomerium/pomerium/pkg/grpc/audit"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+const auditUsage = `usage: pomerium audit decrypt|verify [OPTIONS] [FILE...]
+
+Commands:
+  decrypt  decrypt and print audit records
+  verify   verify the hash chains of audit records
+`
+
+const auditDecryptUsage = `usage: pomerium audit decrypt (-key KEY | -key-file FILE) [FILTER...] [-json] [FILE...]
+
+Decrypts the sealed audit records in each FILE, or standard input if no files
+are given, and prints the requests and decisions. Both audit sink files and
+pomerium logs containing "audit log" messages can be read.
+
+KEY is the base64-encoded private key corresponding to the audit_key.
+
+Filters:
+  -decision allow|deny  only print allowed or denied requests
+  -host HOST            only print requests for HOST
+  -method METHOD        only print requests with the given HTTP method
+  -path PREFIX          only print requests whose path starts with PREFIX
+  -request-id ID        only print the request with the given request id
+  -since TIME           only print requests at or after TIME (RFC 3339)
+  -until TIME           only print requests before TIME (RFC 3339)
+`
+
+// runAudit runs the audit subcommands and returns the exit code.
+func runAudit(_ context.Context, args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "decrypt":
+			return runAuditDecrypt(args[1:])
+		case "verify":
+			return runAuditVerify(args[1:])
+		}
+	}
+	fmt.Fprint(os.Stderr, auditUsage)
+	return 2
+}
+
+func runAuditDecrypt(args []string) int {
+	fs := flag.NewFlagSet("audit decrypt", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), auditDecryptUsage) }
+	key := fs.String("key", "", "")
+	keyFile := fs.String("key-file", "", "")
+	printJSON := fs.Bool("json", false, "")
+	var filter auditFilter
+	fs.StringVar(&filter.decision, "decision", "", "")
+	fs.StringVar(&filter.host, "host", "", "")
+	fs.StringVar(&filter.method, "method", "", "")
+	fs.StringVar(&filter.pathPrefix, "path", "", "")
+	fs.StringVar(&filter.requestID, "request-id", "", "")
+	since := fs.String("since", "", "")
+	until := fs.String("until", "", "")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var err error
+	if filter.since, err = parseAuditTime(*since); err != nil {
+		fmt.Fprintln(os.Stderr, "error: invalid since:", err)
+		return 2
+	}
+	if filter.until, err = parseAuditTime(*until); err != nil {
+		fmt.Fprintln(os.Stderr, "error: invalid until:", err)
+		return 2
+	}
+	switch filter.decision {
+	case "", "allow", "deny":
+	default:
+		fmt.Fprintln(os.Stderr, "error: invalid decision:", filter.decision)
+		return 2
+	}
+
+	kek, err := readAuditPrivateKey(*key, *keyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 2
+	}
+
+	// the key id in the sealed records is the id from the audit_key option,
+	// which may not match the id derived from the private key
+	dec := protoutil.NewDecryptor(cryptutil.KeyEncryptionKeySourceFunc(func(_ string) (*cryptutil.PrivateKeyEncryptionKey, error) {
+		return kek, nil
+	}))
+	p := &auditPrinter{
+		w:         os.Stdout,
+		decryptor: dec,
+		filter:    filter,
+		json:      *printJSON,
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, name := range files {
+		if err := p.printFile(name); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+	}
+	if p.failed > 0 {
+		fmt.Fprintf(os.Stderr, "error: failed to decrypt %d records\n", p.failed)
+		return 1
+	}
+	return 0
+}
+
+func readAuditPrivateKey(key, keyFile string) (*cryptutil.PrivateKeyEncryptionKey, error) {
+	switch {
+	case key != "" && keyFile != "":
+		return nil, errors.New("only one of -key or -key-file may be specified")
+	case keyFile != "":
+		bs, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		key = strings.TrimSpace(string(bs))
+	case key == "":
+		return nil, errors.New("-key or -key-file is required")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	return cryptutil.NewPrivateKeyEncryptionKey(raw)
+}
+
+func parseAuditTime(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+type auditFilter struct {
+	decision   string
+	host       string
+	method     string
+	pathPrefix string
+	requestID  string
+	since      time.Time
+	until      time.Time
+}
+
+func (f auditFilter) match(entry *audit.Entry, record *auditpb.Record) bool {
+	hattrs := record.GetRequest().GetAttributes().GetRequest().GetHttp()
+	switch {
+	case f.decision != "" && f.decision != auditDecision(record.GetResponse()):
+		return false
+	case f.host != "" && !strings.EqualFold(f.host, hattrs.GetHost()):
+		return false
+	case f.method != "" && !strings.EqualFold(f.method, hattrs.GetMethod()):
+		return false
+	case f.pathPrefix != "" && !strings.HasPrefix(hattrs.GetPath(), f.pathPrefix):
+		return false
+	case f.requestID != "" && f.requestID != entry.RequestID:
+		return false
+	}
+
+	t := auditTime(entry, record)
+	if !f.since.IsZero() && t.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !t.Before(f.until) {
+		return false
+	}
+	return true
+}
+
+type auditPrinter struct {
+	w         io.Writer
+	decryptor *protoutil.Decryptor
+	filter    auditFilter
+	json      bool
+
+	failed int
+}
+
+func (p *auditPrinter) printFile(name string) error {
+	r, err := openAuditFile(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	err = audit.ReadEntries(r, func(line int, entry *audit.Entry) error {
+		msg, err := p.decryptor.Decrypt(entry.Record)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: error decrypting audit record: %v\n", name, line, err)
+			p.failed++
+			return nil
+		}
+		record, ok := msg.(*auditpb.Record)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "%s:%d: unexpected message type: %s\n", name, line, entry.Record.GetMessageType())
+			p.failed++
+			return nil
+		}
+
+		if !p.filter.match(entry, record) {
+			return nil
+		}
+		return p.print(entry, record)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func (p *auditPrinter) print(entry *audit.Entry, record *auditpb.Record) error {
+	if p.json {
+		bs, err := protojson.Marshal(record)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(p.w, "%s\n", bs)
+		return err
+	}
+
+	in := record.GetRequest()
+	hattrs := in.GetAttributes().GetRequest().GetHttp()
+	var status string
+	if code := record.GetResponse().GetDeniedResponse().GetStatus().GetCode(); code != 0 {
+		status = fmt.Sprint(int32(code))
+	} else {
+		status = "-"
+	}
+	_, err := fmt.Fprintf(p.w, "%s %-5s %s %s %s://%s%s ip=%s request-id=%s\n",
+		auditTime(entry, record).UTC().Format(time.RFC3339),
+		auditDecision(record.GetResponse()),
+		status,
+		hattrs.GetMethod(),
+		hattrs.GetScheme(),
+		hattrs.GetHost(),
+		hattrs.GetPath(),
+		in.GetAttributes().GetSource().GetAddress().GetSocketAddress().GetAddress(),
+		entry.RequestID)
+	return err
+}
+
+// openAuditFile opens the named file, or standard input for "-".
+func openAuditFile(name string) (io.ReadCloser, error) {
+	if name == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(name)
+}
+
+// auditDecision returns "allow" or "deny" for a check response.
+func auditDecision(res *envoy_service_auth_v3.CheckResponse) string {
+	if codes.Code(res.GetStatus().GetCode()) == codes.OK {
+		return "allow"
+	}
+	return "deny"
+}
+
+// auditTime returns the time of the request, falling back to the time the
+// entry was written.
+func auditTime(entry *audit.Entry, record *auditpb.Record) time.Time {
+	if t := record.GetRequest().GetAttributes().GetRequest().GetTime(); t != nil {
+		return t.AsTime()
+	}
+	return entry.Time
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"os"
 
 	"github.com/rs/zerolog"
 
@@ -30,6 +31,13 @@ func main() {
 	}
 
 	ctx := context.Background()
+	if flag.Arg(0) == "policy" {
+		os.Exit(runPolicy(ctx, flag.Args()[1:]))
+	}
+	if flag.Arg(0) == "audit" {
+		os.Exit(runAudit(ctx, flag.Args()[1:]))
+	}
+
 	if err := run(ctx); !errors.Is(err, context.Canceled) {
 		log.Fatal().Err(err).Msg("cmd/pomerium")
 	}
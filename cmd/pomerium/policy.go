@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pomerium/pomerium/authorize/policytest"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+const policyUsage = `usage: pomerium [-config FILE] policy test [-config FILE] TEST_FILE...
+
+Evaluates the policies in the configuration file against the test cases in
+each TEST_FILE and reports any test cases that fail.
+`
+
+// runPolicy runs the policy subcommands and returns the exit code.
+func runPolicy(ctx context.Context, args []string) int {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Fprint(os.Stderr, policyUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("policy test", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), policyUsage) }
+	testConfigFile := fs.String("config", *configFile, "Specify configuration file location")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	failed, err := runPolicyTest(ctx, *testConfigFile, fs.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func runPolicyTest(ctx context.Context, configFile string, testFiles []string) (failed bool, err error) {
+	// only errors are logged so they don't get mixed up with the report
+	log.SetLevel("error")
+
+	src, err := config.NewFileOrEnvironmentSource(configFile, "")
+	if err != nil {
+		return false, err
+	}
+	options := src.GetConfig().Options
+
+	for _, name := range testFiles {
+		f, err := policytest.ReadFile(name)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", name, err)
+		}
+
+		report, err := policytest.Run(ctx, options, f)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", name, err)
+		}
+
+		fmt.Printf("=== %s\n", name)
+		if _, err := report.WriteTo(os.Stdout); err != nil {
+			return false, err
+		}
+		if report.Failed() > 0 {
+			failed = true
+		}
+	}
+	return failed, nil
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// AuditSinkTypes
+const (
+	AuditSinkTypeFile       = "file"
+	AuditSinkTypeHTTP       = "http"
+	AuditSinkTypeDataBroker = "databroker"
+)
+
+// AuditSinkBackpressures
+const (
+	AuditSinkBackpressureDrop  = "drop"
+	AuditSinkBackpressureBlock = "block"
+)
+
+// AuditSinkOptions are the options for a destination of sealed audit records.
+type AuditSinkOptions struct {
+	// Type is one of "file", "http" or "databroker".
+	Type string `mapstructure:"type" yaml:"type" json:"type"`
+
+	// Path is the path of the JSONL file for the "file" sink.
+	Path string `mapstructure:"path" yaml:"path,omitempty" json:"path,omitempty"`
+	// MaxSize is the size in bytes at which the file is rotated.
+	MaxSize int64 `mapstructure:"max_size" yaml:"max_size,omitempty" json:"max_size,omitempty"`
+	// MaxBackups is the number of rotated files to keep.
+	MaxBackups int `mapstructure:"max_backups" yaml:"max_backups,omitempty" json:"max_backups,omitempty"`
+
+	// URL is the webhook url for the "http" sink.
+	URL string `mapstructure:"url" yaml:"url,omitempty" json:"url,omitempty"`
+	// Headers are additional headers sent to the webhook.
+	Headers map[string]string `mapstructure:"headers" yaml:"headers,omitempty" json:"headers,omitempty"`
+
+	// MaxRecords is the number of records kept by the "databroker" sink.
+	MaxRecords uint64 `mapstructure:"max_records" yaml:"max_records,omitempty" json:"max_records,omitempty"`
+
+	// QueueSize is the maximum number of records waiting to be written.
+	QueueSize int `mapstructure:"queue_size" yaml:"queue_size,omitempty" json:"queue_size,omitempty"`
+	// BatchSize is the maximum number of records written at once.
+	BatchSize int `mapstructure:"batch_size" yaml:"batch_size,omitempty" json:"batch_size,omitempty"`
+	// FlushInterval is the maximum amount of time a record waits before being written.
+	FlushInterval time.Duration `mapstructure:"flush_interval" yaml:"flush_interval,omitempty" json:"flush_interval,omitempty"`
+	// Backpressure is either "drop" (the default), to drop records when the
+	// queue is full, or "block", to wait for room in the queue.
+	Backpressure string `mapstructure:"backpressure" yaml:"backpressure,omitempty" json:"backpressure,omitempty"`
+}
+
+// Validate validates the audit sink options.
+func (o *AuditSinkOptions) Validate() error {
+	switch o.Type {
+	case AuditSinkTypeFile:
+		if o.Path == "" {
+			return errors.New("path is required for file sinks")
+		}
+		if o.MaxSize < 0 {
+			return errors.New("max_size must not be negative")
+		}
+		if o.MaxBackups < 0 {
+			return errors.New("max_backups must not be negative")
+		}
+	case AuditSinkTypeHTTP:
+		u, err := url.Parse(o.URL)
+		if err != nil {
+			return fmt.Errorf("invalid url: %w", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid url: %s", o.URL)
+		}
+	case AuditSinkTypeDataBroker:
+	default:
+		return fmt.Errorf("unknown type: %q", o.Type)
+	}
+
+	switch o.Backpressure {
+	case "", AuditSinkBackpressureDrop, AuditSinkBackpressureBlock:
+	default:
+		return fmt.Errorf("unknown backpressure: %q", o.Backpressure)
+	}
+
+	if o.QueueSize < 0 {
+		return errors.New("queue_size must not be negative")
+	}
+	if o.BatchSize < 0 {
+		return errors.New("batch_size must not be negative")
+	}
+	if o.FlushInterval < 0 {
+		return errors.New("flush_interval must not be negative")
+	}
+	return nil
+}
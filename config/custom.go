@@ -350,9 +350,10 @@ func (ppl *PPLPolicy) UnmarshalJSON(data []byte) error {
 }
 
 // UnmarshalYAML parses YAML into a PPL policy.
-func (ppl *PPLPolicy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+func (ppl *PPLPolicy) UnmarshalYAML(value *yaml.Node) error {
+	parser.UntagTimestamps(value)
 	var i interface{}
-	err := unmarshal(&i)
+	err := value.Decode(&i)
 	if err != nil {
 		return err
 	}
@@ -402,8 +403,14 @@ func DecodePolicyBase64Hook() mapstructure.DecodeHookFunc {
 			return nil, fmt.Errorf("base64 decoding policy data: %w", err)
 		}
 
+		var node yaml.Node
+		if err = yaml.Unmarshal(bytes, &node); err != nil {
+			return nil, fmt.Errorf("parsing base64-encoded policy data as yaml: %w", err)
+		}
+		parser.UntagTimestamps(&node)
+
 		var out []map[interface{}]interface{}
-		if err = yaml.Unmarshal(bytes, &out); err != nil {
+		if err = node.Decode(&out); err != nil {
 			return nil, fmt.Errorf("parsing base64-encoded policy data as yaml: %w", err)
 		}
 
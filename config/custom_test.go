@@ -146,6 +146,22 @@ func TestSerializable(t *testing.T) {
 	require.NoError(t, err, "json marshal")
 }
 
+func TestPPLPolicy_UnmarshalYAML(t *testing.T) {
+	var ppl PPLPolicy
+	err := yaml.Unmarshal([]byte(`
+allow:
+  and:
+    - date:
+        after: 2021-01-01
+        before: 2022-01-01T00:00:00Z
+`), &ppl)
+	require.NoError(t, err)
+	assert.Equal(t, parser.Object{
+		"after":  parser.String("2021-01-01"),
+		"before": parser.String("2022-01-01T00:00:00Z"),
+	}, ppl.Rules[0].And[0].Data)
+}
+
 func TestDecodePPLPolicyHookFunc(t *testing.T) {
 	var withPolicy struct {
 		Policy *PPLPolicy `mapstructure:"policy"`
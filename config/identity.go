@@ -1,6 +1,8 @@
 package config
 
 import (
+	"fmt"
+
 	"github.com/pomerium/pomerium/internal/urlutil"
 	"github.com/pomerium/pomerium/pkg/grpc/identity"
 )
@@ -8,6 +10,10 @@ import (
 // GetIdentityProviderForID returns the identity provider associated with the given IDP id.
 // If none is found the default provider is returned.
 func (o *Options) GetIdentityProviderForID(idpID string) (*identity.Provider, error) {
+	if idp, ok := o.GetIdentityProviderOptions(idpID); ok {
+		return idp.newIdentityProvider()
+	}
+
 	for _, p := range o.GetAllPolicies() {
 		p := p
 		idp, err := o.GetIdentityProviderForPolicy(&p)
@@ -50,6 +56,58 @@ func (o *Options) GetIdentityProviderForPolicy(policy *Policy) (*identity.Provid
 	return idp, nil
 }
 
+// GetIdentityProvidersForPolicy gets the identity providers users may sign in
+// with for the given policy: the named identity providers the policy allows, or
+// else the default provider followed by all the named identity providers.
+func (o *Options) GetIdentityProvidersForPolicy(policy *Policy) ([]*identity.Provider, error) {
+	var idps []*identity.Provider
+	if policy != nil && len(policy.AllowedIdentityProviders) > 0 {
+		for _, idpID := range policy.AllowedIdentityProviders {
+			idpOptions, ok := o.GetIdentityProviderOptions(idpID)
+			if !ok {
+				return nil, fmt.Errorf("unknown identity provider: %s", idpID)
+			}
+			idp, err := idpOptions.newIdentityProvider()
+			if err != nil {
+				return nil, err
+			}
+			idps = append(idps, idp)
+		}
+		return idps, nil
+	}
+
+	// the default provider is only optional when there are named identity providers
+	if o.Provider != "" || len(o.IdentityProviders) == 0 {
+		idp, err := o.GetIdentityProviderForPolicy(policy)
+		if err != nil {
+			return nil, err
+		}
+		idps = append(idps, idp)
+	}
+	for i := range o.IdentityProviders {
+		idp, err := o.IdentityProviders[i].newIdentityProvider()
+		if err != nil {
+			return nil, err
+		}
+		idps = append(idps, idp)
+	}
+	return idps, nil
+}
+
+// GetSignInIdentityProviderIDForPolicy gets the id of the identity provider
+// users sign in with for the given policy. It is empty if users choose one of
+// several identity providers.
+func (o *Options) GetSignInIdentityProviderIDForPolicy(policy *Policy) (string, error) {
+	idps, err := o.GetIdentityProvidersForPolicy(policy)
+	if err != nil {
+		return "", err
+	}
+	if len(idps) != 1 {
+		return "", nil
+	}
+	return idps[0].GetId(), nil
+}
+
 // GetIdentityProviderForRequestURL gets the identity provider associated with the given request URL.
 func (o *Options) GetIdentityProviderForRequestURL(requestURL string) (*identity.Provider, error) {
 	u, err := urlutil.ParseAndValidateURL(requestURL)
@@ -65,3 +123,20 @@ func (o *Options) GetIdentityProviderForRequestURL(requestURL string) (*identity
 	}
 	return o.GetIdentityProviderForPolicy(nil)
 }
+
+// GetIdentityProvidersForRequestURL gets the identity providers users may sign
+// in with for the given request URL.
+func (o *Options) GetIdentityProvidersForRequestURL(requestURL string) ([]*identity.Provider, error) {
+	u, err := urlutil.ParseAndValidateURL(requestURL)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range o.GetAllPolicies() {
+		p := p
+		if p.Matches(*u) {
+			return o.GetIdentityProvidersForPolicy(&p)
+		}
+	}
+	return o.GetIdentityProvidersForPolicy(nil)
+}
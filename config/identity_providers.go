@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+	"github.com/pomerium/pomerium/pkg/grpc/identity"
+)
+
+// IdentityProviderOptions are the options for a named identity provider. Users
+// choose one of the named identity providers a route allows when signing in.
+type IdentityProviderOptions struct {
+	// ID identifies the identity provider in routes, sessions and policies.
+	ID string `mapstructure:"id" yaml:"id" json:"id"`
+	// Name is the name of the identity provider shown to users.
+	Name string `mapstructure:"name" yaml:"name,omitempty" json:"name,omitempty"`
+
+	ClientID         string            `mapstructure:"idp_client_id" yaml:"idp_client_id,omitempty" json:"idp_client_id,omitempty"`
+	ClientSecret     string            `mapstructure:"idp_client_secret" yaml:"idp_client_secret,omitempty" json:"idp_client_secret,omitempty"`
+	ClientSecretFile string            `mapstructure:"idp_client_secret_file" yaml:"idp_client_secret_file,omitempty" json:"idp_client_secret_file,omitempty"`
+	Provider         string            `mapstructure:"idp_provider" yaml:"idp_provider" json:"idp_provider"`
+	ProviderURL      string            `mapstructure:"idp_provider_url" yaml:"idp_provider_url,omitempty" json:"idp_provider_url,omitempty"`
+	Scopes           []string          `mapstructure:"idp_scopes" yaml:"idp_scopes,omitempty" json:"idp_scopes,omitempty"`
+	RequestParams    map[string]string `mapstructure:"idp_request_params" yaml:"idp_request_params,omitempty" json:"idp_request_params,omitempty"`
+	DisablePKCE      bool              `mapstructure:"idp_disable_pkce" yaml:"idp_disable_pkce,omitempty" json:"idp_disable_pkce,omitempty"`
+
+	// Domains are the email domains of the users of the identity provider. A
+	// user whose login hint has one of the domains skips choosing an identity
+	// provider.
+	Domains []string `mapstructure:"domains" yaml:"domains,omitempty" json:"domains,omitempty"`
+}
+
+// Validate validates the identity provider options.
+func (o *IdentityProviderOptions) Validate() error {
+	if o.ID == "" {
+		return errors.New("id is required")
+	}
+	if o.Provider == "" {
+		return errors.New("idp_provider is required")
+	}
+	if o.ClientSecret != "" && o.ClientSecretFile != "" {
+		return errors.New("only one of idp_client_secret or idp_client_secret_file may be set")
+	}
+	return nil
+}
+
+// GetName gets the name of the identity provider shown to users.
+func (o *IdentityProviderOptions) GetName() string {
+	if o.Name != "" {
+		return o.Name
+	}
+	return o.ID
+}
+
+// HasDomain returns true if the identity provider is used for the given email domain.
+func (o *IdentityProviderOptions) HasDomain(domain string) bool {
+	for _, d := range o.Domains {
+		if strings.EqualFold(d, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *IdentityProviderOptions) newIdentityProvider() (*identity.Provider, error) {
+	clientSecret := o.ClientSecret
+	if o.ClientSecretFile != "" {
+		bs, err := os.ReadFile(o.ClientSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		clientSecret = string(bs)
+	}
+
+	return &identity.Provider{
+		Id:            o.ID,
+		ClientId:      o.ClientID,
+		ClientSecret:  clientSecret,
+		Type:          o.Provider,
+		Scopes:        o.Scopes,
+		Url:           o.ProviderURL,
+		RequestParams: o.RequestParams,
+	}, nil
+}
+
+// GetIdentityProviderOptions gets the options of the named identity provider
+// with the given id.
+func (o *Options) GetIdentityProviderOptions(idpID string) (*IdentityProviderOptions, bool) {
+	for i := range o.IdentityProviders {
+		if o.IdentityProviders[i].ID == idpID {
+			return &o.IdentityProviders[i], true
+		}
+	}
+	return nil, false
+}
+
+// GetOauthOptionsForIdentityProvider gets the oauth.Options for the named identity provider.
+func (o *Options) GetOauthOptionsForIdentityProvider(idpOptions *IdentityProviderOptions) (oauth.Options, error) {
+	oauthOptions, err := o.GetOauthOptions()
+	if err != nil {
+		return oauth.Options{}, err
+	}
+	idp, err := idpOptions.newIdentityProvider()
+	if err != nil {
+		return oauth.Options{}, err
+	}
+	oauthOptions.ProviderName = idp.GetType()
+	oauthOptions.ProviderURL = idp.GetUrl()
+	oauthOptions.ClientID = idp.GetClientId()
+	oauthOptions.ClientSecret = idp.GetClientSecret()
+	oauthOptions.Scopes = idp.GetScopes()
+	oauthOptions.DisablePKCE = idpOptions.DisablePKCE
+	return oauthOptions, nil
+}
+
+// IsPKCEDisabledForID returns true if PKCE is disabled for the identity
+// provider with the given id.
+func (o *Options) IsPKCEDisabledForID(idpID string) bool {
+	if idpOptions, ok := o.GetIdentityProviderOptions(idpID); ok {
+		return idpOptions.DisablePKCE
+	}
+	return o.DisablePKCE
+}
+
+func (o *Options) validateIdentityProviders() error {
+	seen := make(map[string]struct{}, len(o.IdentityProviders))
+	for i := range o.IdentityProviders {
+		idp := &o.IdentityProviders[i]
+		if err := idp.Validate(); err != nil {
+			return fmt.Errorf("config: invalid identity provider: %w", err)
+		}
+		if _, ok := seen[idp.ID]; ok {
+			return fmt.Errorf("config: duplicate identity provider id: %s", idp.ID)
+		}
+		seen[idp.ID] = struct{}{}
+	}
+
+	for _, p := range o.GetAllPolicies() {
+		for _, idpID := range p.AllowedIdentityProviders {
+			if _, ok := seen[idpID]; !ok {
+				return fmt.Errorf("config: policy %s allows unknown identity provider: %s", p.From, idpID)
+			}
+		}
+	}
+	return nil
+}
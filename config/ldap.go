@@ -0,0 +1,106 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// LDAPOptions are the options for enriching users with the groups they are a
+// member of in an LDAP or Active Directory server. The groups are merged into
+// the groups claim of the user, so policies match them with claim/groups, for
+// example:
+//
+//	allow:
+//	  and:
+//	    - claim/groups: admins
+type LDAPOptions struct {
+	// URL is the url of the server, either ldap:// or ldaps://.
+	URL string `mapstructure:"url" yaml:"url" json:"url"`
+	// StartTLS upgrades ldap:// connections to TLS.
+	StartTLS bool `mapstructure:"start_tls" yaml:"start_tls,omitempty" json:"start_tls,omitempty"`
+	// CA is a base64 encoded PEM certificate authority used to verify the server.
+	CA string `mapstructure:"certificate_authority" yaml:"certificate_authority,omitempty" json:"certificate_authority,omitempty"`
+	// InsecureSkipVerify disables verification of the server certificate.
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify" yaml:"insecure_skip_verify,omitempty" json:"insecure_skip_verify,omitempty"`
+
+	// BindDN is the distinguished name used to bind to the server.
+	BindDN string `mapstructure:"bind_dn" yaml:"bind_dn,omitempty" json:"bind_dn,omitempty"`
+	// BindPassword is the password used to bind to the server.
+	BindPassword string `mapstructure:"bind_password" yaml:"bind_password,omitempty" json:"bind_password,omitempty"`
+	// BindPasswordFile is a file containing the password used to bind to the server.
+	BindPasswordFile string `mapstructure:"bind_password_file" yaml:"bind_password_file,omitempty" json:"bind_password_file,omitempty"`
+
+	// UserSearchBase is the distinguished name under which users are searched.
+	UserSearchBase string `mapstructure:"user_search_base" yaml:"user_search_base" json:"user_search_base"`
+	// UserFilter finds the entry of a user. {email}, {id} and {name} are
+	// replaced with the escaped attributes of the user.
+	UserFilter string `mapstructure:"user_filter" yaml:"user_filter,omitempty" json:"user_filter,omitempty"`
+
+	// GroupSearchBase is the distinguished name under which groups are
+	// searched. It defaults to the user search base.
+	GroupSearchBase string `mapstructure:"group_search_base" yaml:"group_search_base,omitempty" json:"group_search_base,omitempty"`
+	// GroupFilter finds the groups a user or group is a direct member of.
+	// {dn} is replaced with the escaped distinguished name of the member.
+	GroupFilter string `mapstructure:"group_filter" yaml:"group_filter,omitempty" json:"group_filter,omitempty"`
+	// GroupNameAttribute is the attribute of a group added to the groups
+	// claim of the user.
+	GroupNameAttribute string `mapstructure:"group_name_attribute" yaml:"group_name_attribute,omitempty" json:"group_name_attribute,omitempty"`
+	// NestedGroups expands the groups a user is a member of to the groups
+	// those groups are members of.
+	NestedGroups bool `mapstructure:"nested_groups" yaml:"nested_groups,omitempty" json:"nested_groups,omitempty"`
+
+	// Timeout is the maximum amount of time to wait for the server.
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// Validate validates the LDAP options.
+func (o *LDAPOptions) Validate() error {
+	u, err := url.Parse(o.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return fmt.Errorf("invalid url: %s", o.URL)
+	}
+	if o.StartTLS && u.Scheme == "ldaps" {
+		return errors.New("start_tls is not supported with ldaps urls")
+	}
+	if o.CA != "" {
+		if _, err := base64.StdEncoding.DecodeString(o.CA); err != nil {
+			return fmt.Errorf("invalid certificate_authority: %w", err)
+		}
+	}
+	if o.BindPassword != "" && o.BindPasswordFile != "" {
+		return errors.New("only one of bind_password or bind_password_file may be set")
+	}
+	if o.UserSearchBase == "" {
+		return errors.New("user_search_base is required")
+	}
+	if o.UserFilter != "" && !strings.Contains(o.UserFilter, "{") {
+		return fmt.Errorf("user_filter does not reference the user: %s", o.UserFilter)
+	}
+	if o.GroupFilter != "" && !strings.Contains(o.GroupFilter, "{dn}") {
+		return fmt.Errorf("group_filter does not reference the member {dn}: %s", o.GroupFilter)
+	}
+	if o.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	return nil
+}
+
+// GetBindPassword gets the bind password.
+func (o *LDAPOptions) GetBindPassword() (string, error) {
+	if o.BindPasswordFile != "" {
+		bs, err := os.ReadFile(o.BindPasswordFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(bs)), nil
+	}
+	return o.BindPassword, nil
+}
@@ -15,11 +15,13 @@ import (
 	"time"
 
 	envoy_http_connection_manager "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/go-jose/go-jose/v3"
 	"github.com/mitchellh/mapstructure"
 	"github.com/rs/zerolog"
 	"github.com/spf13/viper"
 	"github.com/volatiletech/null/v9"
 	"google.golang.org/protobuf/types/known/durationpb"
+	"gopkg.in/yaml.v3"
 
 	"github.com/pomerium/pomerium/internal/atomicutil"
 	"github.com/pomerium/pomerium/internal/hashutil"
@@ -34,6 +36,7 @@ import (
 	"github.com/pomerium/pomerium/pkg/grpc/config"
 	"github.com/pomerium/pomerium/pkg/grpc/crypt"
 	"github.com/pomerium/pomerium/pkg/hpke"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
 )
 
 // DisableHeaderKey is the key used to check whether to disable setting header
@@ -152,6 +155,19 @@ type Options struct {
 	// https://openid.net/specs/openid-connect-basic-1_0.html#RequestParameters
 	RequestParams map[string]string `mapstructure:"idp_request_params" yaml:"idp_request_params,omitempty"`
 
+	// SAMLAllowSHA1 allows SAML identity providers to sign responses with
+	// SHA-1, which is insecure.
+	SAMLAllowSHA1 bool `mapstructure:"idp_saml_allow_sha1" yaml:"idp_saml_allow_sha1,omitempty"`
+
+	// DisablePKCE stops sending PKCE code challenges to the identity provider.
+	// PKCE is used by default, it should only be disabled for identity
+	// providers which reject it.
+	DisablePKCE bool `mapstructure:"idp_disable_pkce" yaml:"idp_disable_pkce,omitempty"`
+
+	// IdentityProviders are named identity providers users may choose from
+	// when signing in, in addition to the default identity provider.
+	IdentityProviders []IdentityProviderOptions `mapstructure:"identity_providers" yaml:"identity_providers,omitempty" json:"identity_providers,omitempty"`
+
 	// AuthorizeURLString is the routable destination of the authorize service's
 	// gRPC endpoint. NOTE: As many load balancers do not support
 	// externally routed gRPC so this may be an internal location.
@@ -169,6 +185,9 @@ type Options struct {
 	DeriveInternalDomainCert *string `mapstructure:"tls_derive" yaml:"tls_derive,omitempty"`
 
 	// SigningKey is the private key used to add a JWT-signature to upstream requests.
+	// It may contain several PEM encoded keys, which are all published in the
+	// JWKS to allow key rotation. The first key is used unless a route selects
+	// another signing algorithm.
 	// https://www.pomerium.com/docs/topics/getting-users-identity.html
 	SigningKey     string `mapstructure:"signing_key" yaml:"signing_key,omitempty"`
 	SigningKeyFile string `mapstructure:"signing_key_file" yaml:"signing_key_file,omitempty"`
@@ -284,6 +303,17 @@ type Options struct {
 	CodecType CodecType `mapstructure:"codec_type" yaml:"codec_type"`
 
 	AuditKey *PublicKeyEncryptionKeyOptions `mapstructure:"audit_key"`
+	// AuditSinks are where sealed audit records are written. If no sinks are
+	// configured the records are written to the log.
+	AuditSinks []AuditSinkOptions `mapstructure:"audit_sinks" yaml:"audit_sinks,omitempty" json:"audit_sinks,omitempty"`
+
+	// LDAP enriches users with the groups they are a member of in an LDAP or
+	// Active Directory server.
+	LDAP *LDAPOptions `mapstructure:"ldap" yaml:"ldap,omitempty" json:"ldap,omitempty"`
+
+	// SCIM enables the SCIM 2.0 server, which identity providers use to
+	// provision users and groups.
+	SCIM *SCIMOptions `mapstructure:"scim" yaml:"scim,omitempty" json:"scim,omitempty"`
 
 	BrandingOptions httputil.BrandingOptions
 }
@@ -366,7 +396,7 @@ func optionsFromViper(configFile string) (*Options, error) {
 
 	if configFile != "" {
 		v.SetConfigFile(configFile)
-		if err := v.ReadInConfig(); err != nil {
+		if err := readInConfig(v, configFile); err != nil {
 			return nil, fmt.Errorf("failed to read config: %w", err)
 		}
 	}
@@ -388,6 +418,79 @@ func optionsFromViper(configFile string) (*Options, error) {
 	return o, nil
 }
 
+// readInConfig reads the config file into viper. YAML timestamps in the PPL
+// policies of routes are kept as they were written, so that policies can tell
+// dates from date times.
+func readInConfig(v *viper.Viper, configFile string) error {
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(configFile)) {
+	case ".yaml", ".yml":
+	default:
+		return nil
+	}
+
+	bs, err := os.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(bs, &node); err != nil {
+		return err
+	}
+	if node.Kind != yaml.DocumentNode || len(node.Content) == 0 || node.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+
+	// only the routes are read again, with the timestamps in their PPL
+	// policies untagged as PPLPolicy.UnmarshalYAML does
+	routes := make(map[string]any)
+	root := node.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := strings.ToLower(root.Content[i].Value), root.Content[i+1]
+		if (key != "policy" && key != "routes") || value.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, route := range value.Content {
+			if ppl := getYAMLMappingValue(route, "policy"); ppl != nil {
+				parser.UntagTimestamps(ppl)
+			}
+		}
+		var decoded []any
+		if err := value.Decode(&decoded); err != nil {
+			return err
+		}
+		routes[key] = decoded
+	}
+	if len(routes) == 0 {
+		return nil
+	}
+	return v.MergeConfigMap(routes)
+}
+
+// getYAMLMappingValue returns the value of the key in a YAML mapping, or nil
+// if the node isn't a mapping or doesn't have the key.
+func getYAMLMappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if strings.EqualFold(node.Content[i].Value, key) {
+			value := node.Content[i+1]
+			if value.Kind == yaml.AliasNode {
+				value = value.Alias
+			}
+			return value
+		}
+	}
+	return nil
+}
+
 func checkConfigKeysErrors(configFile string, unused []string) error {
 	checks := CheckUnknownConfigFields(unused)
 	ctx := context.Background()
@@ -725,6 +828,35 @@ func (o *Options) Validate() error {
 		}
 	}
 
+	if len(o.AuditSinks) > 0 && o.AuditKey == nil {
+		return errors.New("config: audit_sinks requires an audit_key")
+	}
+	for i := range o.AuditSinks {
+		if err := o.AuditSinks[i].Validate(); err != nil {
+			return fmt.Errorf("config: invalid audit sink: %w", err)
+		}
+	}
+
+	if err := o.validateIdentityProviders(); err != nil {
+		return err
+	}
+
+	if o.LDAP != nil {
+		if err := o.LDAP.Validate(); err != nil {
+			return fmt.Errorf("config: invalid ldap: %w", err)
+		}
+	}
+
+	if o.SCIM != nil {
+		if err := o.SCIM.Validate(); err != nil {
+			return fmt.Errorf("config: invalid scim: %w", err)
+		}
+	}
+
+	if err := o.validateJWTAssertionSigningAlgorithms(); err != nil {
+		return err
+	}
+
 	// validate the Autocert options
 	err = o.AutocertOptions.Validate()
 	if err != nil {
@@ -884,6 +1016,7 @@ func (o *Options) GetOauthOptions() (oauth.Options, error) {
 		ClientID:     o.ClientID,
 		ClientSecret: clientSecret,
 		Scopes:       o.Scopes,
+		DisablePKCE:  o.DisablePKCE,
 	}, nil
 }
 
@@ -1222,6 +1355,47 @@ func (o *Options) GetCookieSecret() ([]byte, error) {
 	return base64.StdEncoding.DecodeString(cookieSecret)
 }
 
+// validateJWTAssertionSigningAlgorithms checks that there's a signing key for
+// every route's JWT assertion signing algorithm.
+func (o *Options) validateJWTAssertionSigningAlgorithms() error {
+	var policies []Policy
+	for _, p := range o.GetAllPolicies() {
+		if p.JWTAssertion != nil && p.JWTAssertion.SigningAlgorithm != "" {
+			policies = append(policies, p)
+		}
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+
+	signingKey, err := o.GetSigningKey()
+	if err != nil {
+		return fmt.Errorf("config: invalid signing key: %w", err)
+	}
+
+	algorithms := make(map[string]bool)
+	if len(signingKey) == 0 {
+		// if no signing key is set, an ES256 key is generated
+		algorithms[string(jose.ES256)] = true
+	} else {
+		jwks, err := cryptutil.PrivateJWKsFromBytes(signingKey)
+		if err != nil {
+			return fmt.Errorf("config: invalid signing key: %w", err)
+		}
+		for _, jwk := range jwks {
+			algorithms[jwk.Algorithm] = true
+		}
+	}
+
+	for _, p := range policies {
+		if !algorithms[p.JWTAssertion.SigningAlgorithm] {
+			return fmt.Errorf("config: route %s: no %s signing key for jwt_assertion",
+				p.From, p.JWTAssertion.SigningAlgorithm)
+		}
+	}
+	return nil
+}
+
 // GetSigningKey gets the signing key.
 func (o *Options) GetSigningKey() ([]byte, error) {
 	if o == nil {
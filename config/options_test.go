@@ -2,7 +2,10 @@ package config
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
 	"fmt"
@@ -21,6 +24,7 @@ import (
 
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 	"github.com/pomerium/pomerium/pkg/grpc/config"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
 )
 
 var cmpOptIgnoreUnexported = cmpopts.IgnoreUnexported(Options{}, Policy{})
@@ -53,6 +57,50 @@ func Test_Validate(t *testing.T) {
 	missingStorageDSN.DataBrokerStorageType = "redis"
 	badSignoutRedirectURL := testOptions()
 	badSignoutRedirectURL.SignOutRedirectURLString = "--"
+	goodAuditSinks := testOptions()
+	goodAuditSinks.AuditKey = &PublicKeyEncryptionKeyOptions{ID: "key", Data: "AAAA"}
+	goodAuditSinks.AuditSinks = []AuditSinkOptions{
+		{Type: AuditSinkTypeFile, Path: "/var/log/pomerium/audit.jsonl"},
+		{Type: AuditSinkTypeHTTP, URL: "https://audit.example.com", Backpressure: AuditSinkBackpressureBlock},
+		{Type: AuditSinkTypeDataBroker},
+	}
+	missingAuditKey := testOptions()
+	missingAuditKey.AuditSinks = []AuditSinkOptions{{Type: AuditSinkTypeDataBroker}}
+	badAuditSink := testOptions()
+	badAuditSink.AuditKey = &PublicKeyEncryptionKeyOptions{ID: "key", Data: "AAAA"}
+	badAuditSink.AuditSinks = []AuditSinkOptions{{Type: AuditSinkTypeHTTP, URL: "audit.example.com"}}
+	goodJWTSigningAlgorithm := testOptions()
+	goodJWTSigningAlgorithm.Policies = []Policy{{From: "https://from.example.com", To: mustParseWeightedURLs(t, "https://to.example.com"), JWTAssertion: &PolicyJWTAssertion{SigningAlgorithm: "ES256"}}}
+	missingJWTSigningKey := testOptions()
+	missingJWTSigningKey.Policies = []Policy{{From: "https://from.example.com", To: mustParseWeightedURLs(t, "https://to.example.com"), JWTAssertion: &PolicyJWTAssertion{SigningAlgorithm: "EdDSA"}}}
+	_, edSigningKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	derEdSigningKey, err := x509.MarshalPKCS8PrivateKey(edSigningKey)
+	require.NoError(t, err)
+	wrongJWTSigningKey := testOptions()
+	wrongJWTSigningKey.SigningKey = base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: derEdSigningKey}))
+	wrongJWTSigningKey.Policies = []Policy{{From: "https://from.example.com", To: mustParseWeightedURLs(t, "https://to.example.com"), JWTAssertion: &PolicyJWTAssertion{SigningAlgorithm: "ES256"}}}
+	goodLDAP := testOptions()
+	goodLDAP.LDAP = &LDAPOptions{URL: "ldaps://ldap.example.com", UserSearchBase: "ou=users,dc=example,dc=com", NestedGroups: true}
+	badLDAP := testOptions()
+	badLDAP.LDAP = &LDAPOptions{URL: "ldaps://ldap.example.com", UserSearchBase: "ou=users,dc=example,dc=com", StartTLS: true}
+	missingLDAPSearchBase := testOptions()
+	missingLDAPSearchBase.LDAP = &LDAPOptions{URL: "ldap://ldap.example.com"}
+	goodSCIM := testOptions()
+	goodSCIM.SCIM = &SCIMOptions{BearerToken: "TOKEN"}
+	missingSCIMBearerToken := testOptions()
+	missingSCIMBearerToken.SCIM = &SCIMOptions{}
+	goodIdentityProviders := testOptions()
+	goodIdentityProviders.IdentityProviders = []IdentityProviderOptions{
+		{ID: "okta", Provider: "okta", ProviderURL: "https://example.okta.com", Domains: []string{"example.com"}},
+		{ID: "azure", Provider: "azure", ProviderURL: "https://login.microsoftonline.com/TENANT/v2.0"},
+	}
+	goodIdentityProviders.Policies = []Policy{{From: "https://from.example.com", To: mustParseWeightedURLs(t, "https://to.example.com"), AllowedIdentityProviders: []string{"azure"}}}
+	duplicateIdentityProvider := testOptions()
+	duplicateIdentityProvider.IdentityProviders = []IdentityProviderOptions{{ID: "okta", Provider: "okta"}, {ID: "okta", Provider: "azure"}}
+	unknownAllowedIdentityProvider := testOptions()
+	unknownAllowedIdentityProvider.IdentityProviders = []IdentityProviderOptions{{ID: "okta", Provider: "okta"}}
+	unknownAllowedIdentityProvider.Policies = []Policy{{From: "https://from.example.com", To: mustParseWeightedURLs(t, "https://to.example.com"), AllowedIdentityProviders: []string{"azure"}}}
 
 	tests := []struct {
 		name     string
@@ -67,6 +115,20 @@ func Test_Validate(t *testing.T) {
 		{"invalid databroker storage type", invalidStorageType, true},
 		{"missing databroker storage dsn", missingStorageDSN, true},
 		{"invalid signout redirect url", badSignoutRedirectURL, true},
+		{"good audit sinks", goodAuditSinks, false},
+		{"audit sinks without audit key", missingAuditKey, true},
+		{"invalid audit sink", badAuditSink, true},
+		{"jwt assertion signing algorithm of generated key", goodJWTSigningAlgorithm, false},
+		{"jwt assertion signing algorithm without signing key", missingJWTSigningKey, true},
+		{"jwt assertion signing algorithm of another signing key", wrongJWTSigningKey, true},
+		{"good ldap", goodLDAP, false},
+		{"ldap start tls with ldaps", badLDAP, true},
+		{"ldap without user search base", missingLDAPSearchBase, true},
+		{"good scim", goodSCIM, false},
+		{"scim without bearer token", missingSCIMBearerToken, true},
+		{"good identity providers", goodIdentityProviders, false},
+		{"duplicate identity provider id", duplicateIdentityProvider, true},
+		{"unknown allowed identity provider", unknownAllowedIdentityProvider, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -228,6 +290,22 @@ func Test_parsePolicyFile(t *testing.T) {
 			}},
 			false,
 		},
+		{
+			"rate limit",
+			[]byte(fmt.Sprintf(`{"policy":[{"from": "%s","to":"%s","rate_limit":{"requests":100,"period":"30s","key":"ip","shared":true}}]}`, source, to.URL.String())),
+			[]Policy{{
+				From:   source,
+				To:     []WeightedURL{*to},
+				Source: &StringURL{sourceURL},
+				RateLimit: &PolicyRateLimit{
+					Requests: 100,
+					Period:   30 * time.Second,
+					Key:      RateLimitKeyIP,
+					Shared:   true,
+				},
+			}},
+			false,
+		},
 		{"bad from", []byte(`{"policy":[{"from": "%","to":"httpbin.org"}]}`), nil, true},
 		{"bad to", []byte(`{"policy":[{"from": "pomerium.io","to":"%"}]}`), nil, true},
 	}
@@ -323,6 +401,27 @@ func TestOptionsFromViper(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"good audit sinks",
+			[]byte(`{"autocert_dir":"","insecure_server":true,"audit_key":{"id":"key","data":"AAAA"},"audit_sinks":[{"type":"file","path":"audit.jsonl","flush_interval":"5s"},{"type":"http","url":"https://audit.example.com","headers":{"Authorization":"Bearer TOKEN"}}],"policy":[{"from": "https://from.example","to":"https://to.example"}]}`),
+			&Options{
+				Policies:                 []Policy{{From: "https://from.example", To: mustParseWeightedURLs(t, "https://to.example")}},
+				CookieName:               "_pomerium",
+				AuthenticateCallbackPath: "/oauth2/callback",
+				CookieSecure:             true,
+				CookieHTTPOnly:           true,
+				InsecureServer:           true,
+				DataBrokerStorageType:    "memory",
+				EnvoyAdminAccessLogPath:  os.DevNull,
+				EnvoyAdminProfilePath:    os.DevNull,
+				AuditKey:                 &PublicKeyEncryptionKeyOptions{ID: "key", Data: "AAAA"},
+				AuditSinks: []AuditSinkOptions{
+					{Type: "file", Path: "audit.jsonl", FlushInterval: 5 * time.Second},
+					{Type: "http", URL: "https://audit.example.com", Headers: map[string]string{"authorization": "Bearer TOKEN"}},
+				},
+			},
+			false,
+		},
 		{"bad url", []byte(`{"policy":[{"from": "https://","to":"https://to.example"}]}`), nil, true},
 		{"bad policy", []byte(`{"policy":[{"allow_public_unauthenticated_access": "dog","to":"https://to.example"}]}`), nil, true},
 		{"bad file", []byte(`{''''}`), nil, true},
@@ -345,6 +444,42 @@ func TestOptionsFromViper(t *testing.T) {
 	}
 }
 
+func TestOptionsFromViper_YAMLDates(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.WriteString(`
+insecure_server: true
+policy:
+  - from: https://from.example
+    to: https://to.example
+    policy: &ppl
+      allow:
+        and:
+          - date:
+              after: 2021-01-01
+              before: 2022-01-01T00:00:00Z
+routes:
+  - from: https://from2.example
+    to: https://to.example
+    policy: *ppl
+`)
+	require.NoError(t, err)
+	require.NoError(t, tempFile.Close())
+
+	o, err := optionsFromViper(tempFile.Name())
+	require.NoError(t, err)
+	require.Len(t, o.Policies, 1)
+	require.Len(t, o.Routes, 1)
+	for _, p := range []Policy{o.Policies[0], o.Routes[0]} {
+		assert.Equal(t, parser.Object{
+			"after":  parser.String("2021-01-01"),
+			"before": parser.String("2022-01-01T00:00:00Z"),
+		}, p.Policy.Rules[0].And[0].Data)
+	}
+	assert.True(t, o.InsecureServer)
+}
+
 func Test_NewOptionsFromConfigEnvVar(t *testing.T) {
 	tests := []struct {
 		name        string
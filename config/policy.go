@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"net/url"
 	"os"
 	"regexp"
@@ -175,11 +176,34 @@ type Policy struct {
 	IDPClientID string `mapstructure:"idp_client_id" yaml:"idp_client_id,omitempty"`
 	// IDPClientSecret is the client secret used for the identity provider.
 	IDPClientSecret string `mapstructure:"idp_client_secret" yaml:"idp_client_secret,omitempty"`
+	// AllowedIdentityProviders are the ids of the named identity providers
+	// users may sign in with for the route.
+	AllowedIdentityProviders []string `mapstructure:"allowed_identity_providers" yaml:"allowed_identity_providers,omitempty" json:"allowed_identity_providers,omitempty"`
 
 	// ShowErrorDetails indicates whether or not additional error details should be displayed.
 	ShowErrorDetails bool `mapstructure:"show_error_details" yaml:"show_error_details" json:"show_error_details"`
 
+	// DenyTemplate is a Go html/template used to render the page shown when a
+	// request to the route is denied, instead of the built-in error page.
+	DenyTemplate string `mapstructure:"deny_template" yaml:"deny_template,omitempty" json:"deny_template,omitempty"`
+	// DenyTemplateFile is a file containing the deny template.
+	DenyTemplateFile     string `mapstructure:"deny_template_file" yaml:"deny_template_file,omitempty" json:"deny_template_file,omitempty"`
+	compiledDenyTemplate *template.Template
+
 	Policy *PPLPolicy `mapstructure:"policy" yaml:"policy,omitempty" json:"policy,omitempty"`
+
+	// ShadowPolicy is evaluated alongside the route's policy, but only logged. It
+	// can be used to try out a new policy before enforcing it.
+	ShadowPolicy *PPLPolicy `mapstructure:"shadow_policy" yaml:"shadow_policy,omitempty" json:"shadow_policy,omitempty"`
+
+	// RateLimit limits the number of requests made to the route.
+	RateLimit *PolicyRateLimit `mapstructure:"rate_limit" yaml:"rate_limit,omitempty" json:"rate_limit,omitempty"`
+
+	// JWTAssertion customizes the JWT assertion header sent to the upstream.
+	JWTAssertion *PolicyJWTAssertion `mapstructure:"jwt_assertion" yaml:"jwt_assertion,omitempty" json:"jwt_assertion,omitempty"`
+
+	// TokenExchange exchanges the user's token for a token for the upstream.
+	TokenExchange *PolicyTokenExchange `mapstructure:"token_exchange" yaml:"token_exchange,omitempty" json:"token_exchange,omitempty"`
 }
 
 // RewriteHeader is a policy configuration option to rewrite an HTTP header.
@@ -547,9 +571,57 @@ func (p *Policy) Validate() error {
 		return fmt.Errorf("config: invalid policy set_authorization_header: %v", p.SetAuthorizationHeader)
 	}
 
+	if p.DenyTemplateFile != "" {
+		if p.DenyTemplate != "" {
+			return fmt.Errorf("config: specified both `deny_template_file` and `deny_template`")
+		}
+
+		bs, err := os.ReadFile(p.DenyTemplateFile)
+		if err != nil {
+			return fmt.Errorf("config: couldn't load deny template: %w", err)
+		}
+		p.DenyTemplate = string(bs)
+	}
+
+	if p.DenyTemplate != "" {
+		p.compiledDenyTemplate, err = template.New("deny").Parse(p.DenyTemplate)
+		if err != nil {
+			return fmt.Errorf("config: invalid deny template: %w", err)
+		}
+	}
+
+	if p.RateLimit != nil {
+		if err := p.RateLimit.Validate(); err != nil {
+			return fmt.Errorf("config: invalid policy rate_limit: %w", err)
+		}
+	}
+
+	if p.JWTAssertion != nil {
+		if err := p.JWTAssertion.Validate(); err != nil {
+			return fmt.Errorf("config: invalid policy jwt_assertion: %w", err)
+		}
+	}
+
+	if p.TokenExchange != nil {
+		switch p.GetSetAuthorizationHeader() {
+		case configpb.Route_ACCESS_TOKEN, configpb.Route_ID_TOKEN:
+			return fmt.Errorf("config: token_exchange cannot be used with set_authorization_header %s",
+				p.SetAuthorizationHeader)
+		}
+		if err := p.TokenExchange.Validate(); err != nil {
+			return fmt.Errorf("config: invalid policy token_exchange: %w", err)
+		}
+	}
+
 	return nil
 }
 
+// GetDenyTemplate returns the compiled deny template, or nil if the route
+// doesn't have one.
+func (p *Policy) GetDenyTemplate() *template.Template {
+	return p.compiledDenyTemplate
+}
+
 // Checksum returns the xxhash hash for the policy.
 func (p *Policy) Checksum() uint64 {
 	return hashutil.MustHash(p)
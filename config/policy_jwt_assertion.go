@@ -0,0 +1,61 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+)
+
+const defaultJWTAssertionLifetime = 5 * time.Minute
+
+// PolicyJWTAssertion customizes the X-Pomerium-Jwt-Assertion header sent to a
+// route's upstream.
+type PolicyJWTAssertion struct {
+	// Claims maps assertion claims to the session or user claims they are
+	// taken from. Claims with no value are omitted.
+	Claims map[string]string `mapstructure:"claims" yaml:"claims,omitempty" json:"claims,omitempty"`
+	// RenameClaims renames assertion claims. It is applied after Claims.
+	RenameClaims map[string]string `mapstructure:"rename_claims" yaml:"rename_claims,omitempty" json:"rename_claims,omitempty"`
+	// StaticClaims are added to the assertion as-is, replacing any other
+	// claims with the same name.
+	StaticClaims map[string]interface{} `mapstructure:"static_claims" yaml:"static_claims,omitempty" json:"static_claims,omitempty"`
+	// Lifetime is how long the assertion is valid for. It defaults to five
+	// minutes.
+	Lifetime time.Duration `mapstructure:"lifetime" yaml:"lifetime,omitempty" json:"lifetime,omitempty"`
+	// Audience replaces the default audience, the route's hostname.
+	Audience []string `mapstructure:"audience" yaml:"audience,omitempty" json:"audience,omitempty"`
+	// SigningAlgorithm selects the signing key by algorithm. It is one of
+	// "EdDSA", "RS256" or "ES256". If empty the first signing key is used.
+	SigningAlgorithm string `mapstructure:"signing_algorithm" yaml:"signing_algorithm,omitempty" json:"signing_algorithm,omitempty"`
+}
+
+// GetLifetime returns the assertion lifetime.
+func (a *PolicyJWTAssertion) GetLifetime() time.Duration {
+	if a == nil || a.Lifetime == 0 {
+		return defaultJWTAssertionLifetime
+	}
+	return a.Lifetime
+}
+
+// Validate validates the JWT assertion options.
+func (a *PolicyJWTAssertion) Validate() error {
+	if a.Lifetime < 0 {
+		return errors.New("lifetime must not be negative")
+	}
+	if a.Lifetime != 0 && a.Lifetime < time.Second {
+		return errors.New("lifetime must be at least 1s")
+	}
+	for from, to := range a.RenameClaims {
+		if to == "" {
+			return fmt.Errorf("claim %q cannot be renamed to an empty name", from)
+		}
+	}
+	switch jose.SignatureAlgorithm(a.SigningAlgorithm) {
+	case "", jose.EdDSA, jose.RS256, jose.ES256:
+	default:
+		return fmt.Errorf("unsupported signing_algorithm: %q", a.SigningAlgorithm)
+	}
+	return nil
+}
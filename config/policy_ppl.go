@@ -97,3 +97,15 @@ func (p *Policy) ToPPL() *parser.Policy {
 
 	return ppl
 }
+
+// ToShadowPPL converts the shadow policy into Pomerium Policy Language. The shadow
+// policy replaces the route's policy, the route's other access settings still
+// apply. If there is no shadow policy, nil is returned.
+func (p *Policy) ToShadowPPL() *parser.Policy {
+	if p.ShadowPolicy == nil || p.ShadowPolicy.Policy == nil {
+		return nil
+	}
+	shadow := *p
+	shadow.Policy = p.ShadowPolicy
+	return shadow.ToPPL()
+}
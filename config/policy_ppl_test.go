@@ -568,3 +568,42 @@ else = value {
 }
 `, str)
 }
+
+func TestPolicy_ToShadowPPL(t *testing.T) {
+	assert.Nil(t, (&Policy{AllowedUsers: []string{"user1"}}).ToShadowPPL())
+
+	ppl := (&Policy{
+		AllowAnyAuthenticatedUser: true,
+		Policy: &PPLPolicy{
+			Policy: &parser.Policy{
+				Rules: []parser.Rule{{
+					Action: parser.ActionAllow,
+					Or: []parser.Criterion{{
+						Name: "user",
+						Data: parser.Object{"is": parser.String("user1")},
+					}},
+				}},
+			},
+		},
+		ShadowPolicy: &PPLPolicy{
+			Policy: &parser.Policy{
+				Rules: []parser.Rule{{
+					Action: parser.ActionAllow,
+					Or: []parser.Criterion{{
+						Name: "user",
+						Data: parser.Object{"is": parser.String("user2")},
+					}},
+				}},
+			},
+		},
+	}).ToShadowPPL()
+	require.NotNil(t, ppl)
+	assert.Equal(t, []parser.Rule{
+		{Action: parser.ActionAllow, Or: []parser.Criterion{
+			{Name: "pomerium_routes"},
+			{Name: "authenticated_user", Data: parser.Boolean(true)},
+		}},
+		{Action: parser.ActionDeny, Or: []parser.Criterion{{Name: "invalid_client_certificate"}}},
+		{Action: parser.ActionAllow, Or: []parser.Criterion{{Name: "user", Data: parser.Object{"is": parser.String("user2")}}}},
+	}, ppl.Rules)
+}
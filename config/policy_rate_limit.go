@@ -0,0 +1,66 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RateLimitKeys
+const (
+	RateLimitKeyUser           = "user"
+	RateLimitKeySession        = "session"
+	RateLimitKeyServiceAccount = "service_account"
+	RateLimitKeyIP             = "ip"
+)
+
+const defaultRateLimitPeriod = time.Minute
+
+// PolicyRateLimit limits the number of requests made to a route.
+type PolicyRateLimit struct {
+	// Requests is the number of requests allowed in each period.
+	Requests uint64 `mapstructure:"requests" yaml:"requests" json:"requests"`
+	// Period is the length of the window requests are counted in. It defaults
+	// to one minute.
+	Period time.Duration `mapstructure:"period" yaml:"period,omitempty" json:"period,omitempty"`
+	// Key is what requests are counted by. It is one of "user" (the default),
+	// "session", "service_account" or "ip". Requests without a user, session or
+	// service account are counted by the client ip.
+	Key string `mapstructure:"key" yaml:"key,omitempty" json:"key,omitempty"`
+	// Shared stores the counters in the databroker, so the limit holds across
+	// all the authorize replicas. Otherwise each replica counts requests on its
+	// own.
+	Shared bool `mapstructure:"shared" yaml:"shared,omitempty" json:"shared,omitempty"`
+}
+
+// GetPeriod returns the rate limit period.
+func (rl *PolicyRateLimit) GetPeriod() time.Duration {
+	if rl.Period == 0 {
+		return defaultRateLimitPeriod
+	}
+	return rl.Period
+}
+
+// GetKey returns the rate limit key.
+func (rl *PolicyRateLimit) GetKey() string {
+	if rl.Key == "" {
+		return RateLimitKeyUser
+	}
+	return rl.Key
+}
+
+// Validate validates the rate limit.
+func (rl *PolicyRateLimit) Validate() error {
+	if rl.Requests == 0 {
+		return errors.New("requests must be greater than 0")
+	}
+	if rl.Period != 0 && rl.Period < time.Second {
+		return errors.New("period must be at least 1s")
+	}
+	switch rl.Key {
+	case "", RateLimitKeyUser, RateLimitKeySession, RateLimitKeyServiceAccount, RateLimitKeyIP:
+	default:
+		return fmt.Errorf("unknown key: %q", rl.Key)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/pomerium/pomerium/internal/urlutil"
+)
+
+// TokenExchangeSubjectTokenTypes
+const (
+	TokenExchangeSubjectTokenTypeAccessToken = "access_token"
+	TokenExchangeSubjectTokenTypeIDToken     = "id_token"
+)
+
+// PolicyTokenExchange exchanges the user's identity provider token for a token
+// meant for the route's upstream (RFC 8693). The exchanged token is passed to
+// the upstream in the Authorization header.
+type PolicyTokenExchange struct {
+	// TokenURL is the token endpoint to call. It defaults to the token endpoint
+	// of the identity provider the user signed in with, found with OpenID
+	// Connect discovery. Tokens are exchanged with that identity provider's
+	// client credentials.
+	TokenURL string `mapstructure:"token_url" yaml:"token_url,omitempty" json:"token_url,omitempty"`
+	// Audience is the logical name of the upstream the token is for.
+	Audience string `mapstructure:"audience" yaml:"audience,omitempty" json:"audience,omitempty"`
+	// Resource is the URI of the upstream the token is for.
+	Resource string `mapstructure:"resource" yaml:"resource,omitempty" json:"resource,omitempty"`
+	// Scopes are the scopes requested for the token.
+	Scopes []string `mapstructure:"scopes" yaml:"scopes,omitempty" json:"scopes,omitempty"`
+	// SubjectTokenType is the session token that is exchanged. It is one of
+	// "access_token" (the default) or "id_token".
+	SubjectTokenType string `mapstructure:"subject_token_type" yaml:"subject_token_type,omitempty" json:"subject_token_type,omitempty"`
+}
+
+// GetSubjectTokenType returns the subject token type.
+func (te *PolicyTokenExchange) GetSubjectTokenType() string {
+	if te.SubjectTokenType == "" {
+		return TokenExchangeSubjectTokenTypeAccessToken
+	}
+	return te.SubjectTokenType
+}
+
+// Validate validates the token exchange options.
+func (te *PolicyTokenExchange) Validate() error {
+	if te.TokenURL != "" {
+		if _, err := urlutil.ParseAndValidateURL(te.TokenURL); err != nil {
+			return fmt.Errorf("invalid token_url: %w", err)
+		}
+	}
+	if te.Resource != "" {
+		if _, err := urlutil.ParseAndValidateURL(te.Resource); err != nil {
+			return fmt.Errorf("invalid resource: %w", err)
+		}
+	}
+	switch te.SubjectTokenType {
+	case "", TokenExchangeSubjectTokenTypeAccessToken, TokenExchangeSubjectTokenTypeIDToken:
+	default:
+		return fmt.Errorf("unknown subject_token_type: %q", te.SubjectTokenType)
+	}
+	return nil
+}
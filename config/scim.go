@@ -0,0 +1,39 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// SCIMOptions are the options for the SCIM 2.0 server used by identity
+// providers to provision users and groups.
+type SCIMOptions struct {
+	// BearerToken authenticates the identity provider to the server.
+	BearerToken string `mapstructure:"bearer_token" yaml:"bearer_token,omitempty" json:"bearer_token,omitempty"`
+	// BearerTokenFile is a file containing the bearer token.
+	BearerTokenFile string `mapstructure:"bearer_token_file" yaml:"bearer_token_file,omitempty" json:"bearer_token_file,omitempty"`
+}
+
+// Validate validates the SCIM options.
+func (o *SCIMOptions) Validate() error {
+	if o.BearerToken != "" && o.BearerTokenFile != "" {
+		return errors.New("only one of bearer_token or bearer_token_file may be set")
+	}
+	if o.BearerToken == "" && o.BearerTokenFile == "" {
+		return errors.New("bearer_token or bearer_token_file is required")
+	}
+	return nil
+}
+
+// GetBearerToken gets the bearer token.
+func (o *SCIMOptions) GetBearerToken() (string, error) {
+	if o.BearerTokenFile != "" {
+		bs, err := os.ReadFile(o.BearerTokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(bs)), nil
+	}
+	return o.BearerToken, nil
+}
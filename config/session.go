@@ -68,16 +68,21 @@ func (store *SessionStore) LoadSessionState(r *http.Request) (*sessions.State, e
 		return nil, err
 	}
 
-	// confirm that the identity provider id matches the state
+	// confirm that the identity provider id is one of the identity providers
+	// allowed for the request
 	if state.IdentityProviderID != "" {
-		idp, err := store.options.GetIdentityProviderForRequestURL(urlutil.GetAbsoluteURL(r).String())
+		idps, err := store.options.GetIdentityProvidersForRequestURL(urlutil.GetAbsoluteURL(r).String())
 		if err != nil {
 			return nil, err
 		}
 
-		if idp.GetId() != state.IdentityProviderID {
-			return nil, fmt.Errorf("unexpected session state identity provider id: %s != %s",
-				idp.GetId(), state.IdentityProviderID)
+		found := false
+		for _, idp := range idps {
+			found = found || idp.GetId() == state.IdentityProviderID
+		}
+		if !found {
+			return nil, fmt.Errorf("unexpected session state identity provider id: %s",
+				state.IdentityProviderID)
 		}
 	}
 
@@ -39,7 +39,16 @@ func TestSessionStore_LoadSessionState(t *testing.T) {
 			To:              mustParseWeightedURLs(t, "https://p2"),
 			IDPClientID:     "client_id_2",
 			IDPClientSecret: "client_secret_2",
+		},
+		Policy{
+			From:                     "https://p3.example.com",
+			To:                       mustParseWeightedURLs(t, "https://p3"),
+			AllowedIdentityProviders: []string{"azure"},
 		})
+	options.IdentityProviders = []IdentityProviderOptions{
+		{ID: "okta", Provider: "okta", ProviderURL: "https://okta.example.com"},
+		{ID: "azure", Provider: "azure", ProviderURL: "https://azure.example.com"},
+	}
 	require.NoError(t, options.Validate())
 
 	store, err := NewSessionStore(options)
@@ -141,4 +150,34 @@ func TestSessionStore_LoadSessionState(t *testing.T) {
 			ID:     "example",
 		}, s))
 	})
+	t.Run("named idp", func(t *testing.T) {
+		rawJWS := makeJWS(t, &sessions.State{
+			Issuer:             "authenticate.example.com",
+			ID:                 "example",
+			IdentityProviderID: "azure",
+		})
+
+		r, err := http.NewRequest(http.MethodGet, "https://p3.example.com", nil)
+		require.NoError(t, err)
+		r.Header.Set(httputil.HeaderPomeriumAuthorization, rawJWS)
+		s, err := store.LoadSessionState(r)
+		assert.NoError(t, err)
+		if assert.NotNil(t, s) {
+			assert.Equal(t, "azure", s.IdentityProviderID)
+		}
+	})
+	t.Run("named idp not allowed", func(t *testing.T) {
+		rawJWS := makeJWS(t, &sessions.State{
+			Issuer:             "authenticate.example.com",
+			ID:                 "example",
+			IdentityProviderID: "okta",
+		})
+
+		r, err := http.NewRequest(http.MethodGet, "https://p3.example.com", nil)
+		require.NoError(t, err)
+		r.Header.Set(httputil.HeaderPomeriumAuthorization, rawJWS)
+		s, err := store.LoadSessionState(r)
+		assert.Error(t, err)
+		assert.Nil(t, s)
+	})
 }
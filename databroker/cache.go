@@ -5,6 +5,7 @@ package databroker
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 
@@ -17,6 +18,7 @@ import (
 	"github.com/pomerium/pomerium/internal/atomicutil"
 	"github.com/pomerium/pomerium/internal/events"
 	"github.com/pomerium/pomerium/internal/identity"
+	"github.com/pomerium/pomerium/internal/identity/directory"
 	"github.com/pomerium/pomerium/internal/identity/manager"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/telemetry"
@@ -173,6 +175,25 @@ func (c *DataBroker) update(ctx context.Context, cfg *config.Config) error {
 		}
 	}
 
+	for i := range cfg.Options.IdentityProviders {
+		idp := &cfg.Options.IdentityProviders[i]
+		authenticator, err := newIdentityProviderAuthenticator(cfg.Options, idp)
+		if err != nil {
+			log.Error(ctx).Err(err).Str("idp_id", idp.ID).Msg("databroker: failed to create identity provider authenticator")
+		} else {
+			options = append(options, manager.WithIdentityProviderAuthenticator(idp.ID, authenticator))
+		}
+	}
+
+	if cfg.Options.LDAP != nil {
+		directory, err := newLDAPDirectory(cfg.Options.LDAP)
+		if err != nil {
+			log.Error(ctx).Err(err).Msg("databroker: failed to create ldap directory")
+		} else {
+			options = append(options, manager.WithDirectory(directory))
+		}
+	}
+
 	if c.manager == nil {
 		c.manager = manager.New(options...)
 	} else {
@@ -182,6 +203,43 @@ func (c *DataBroker) update(ctx context.Context, cfg *config.Config) error {
 	return nil
 }
 
+func newIdentityProviderAuthenticator(options *config.Options, idp *config.IdentityProviderOptions) (identity.Authenticator, error) {
+	oauthOptions, err := options.GetOauthOptionsForIdentityProvider(idp)
+	if err != nil {
+		return nil, err
+	}
+	return identity.NewAuthenticator(oauthOptions)
+}
+
+func newLDAPDirectory(o *config.LDAPOptions) (*directory.LDAP, error) {
+	rootCAs, err := cryptutil.GetCertPool(o.CA, "")
+	if err != nil {
+		return nil, err
+	}
+	bindPassword, err := o.GetBindPassword()
+	if err != nil {
+		return nil, fmt.Errorf("invalid bind password: %w", err)
+	}
+	return directory.NewLDAP(directory.LDAPOptions{
+		URL:      o.URL,
+		StartTLS: o.StartTLS,
+		TLSConfig: &tls.Config{
+			RootCAs:            rootCAs,
+			InsecureSkipVerify: o.InsecureSkipVerify,
+			MinVersion:         tls.VersionTLS12,
+		},
+		BindDN:             o.BindDN,
+		BindPassword:       bindPassword,
+		UserSearchBase:     o.UserSearchBase,
+		UserFilter:         o.UserFilter,
+		GroupSearchBase:    o.GroupSearchBase,
+		GroupFilter:        o.GroupFilter,
+		GroupNameAttribute: o.GroupNameAttribute,
+		NestedGroups:       o.NestedGroups,
+		Timeout:            o.Timeout,
+	}), nil
+}
+
 // validate checks that proper configuration settings are set to create
 // a databroker instance
 func validate(o *config.Options) error {
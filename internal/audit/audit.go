@@ -0,0 +1,147 @@
+// Package audit contains sinks and tamper-evident chains for sealed audit
+// records.
+package audit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	cryptpb "github.com/pomerium/pomerium/pkg/grpc/crypt"
+)
+
+const sealedMessageType = "type.googleapis.com/pomerium.crypt.SealedMessage"
+
+// An Entry is a sealed audit record along with some unencrypted metadata.
+type Entry struct {
+	Time      time.Time
+	RequestID string
+	Record    *cryptpb.SealedMessage
+
+	// the chain fields are set when the entry is appended to a Chain
+	ChainID   string
+	Sequence  uint64
+	PrevHash  []byte
+	Signature string
+}
+
+// entryJSON is the JSON representation of an entry. It uses the same field
+// names as the "audit log" messages written to the regular log, so the same
+// tools can read both.
+type entryJSON struct {
+	Time              time.Time `json:"time"`
+	RequestID         string    `json:"request-id,omitempty"`
+	Type              string    `json:"@type"`
+	KeyID             string    `json:"key_id"`
+	DataEncryptionKey []byte    `json:"data_encryption_key"`
+	MessageType       string    `json:"message_type"`
+	EncryptedMessage  []byte    `json:"encrypted_message"`
+	ChainID           string    `json:"chain_id,omitempty"`
+	Sequence          uint64    `json:"sequence,omitempty"`
+	PrevHash          []byte    `json:"prev_hash,omitempty"`
+	Signature         string    `json:"signature,omitempty"`
+}
+
+// MarshalJSON marshals the entry as JSON.
+func (e *Entry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(entryJSON{
+		Time:              e.Time,
+		RequestID:         e.RequestID,
+		Type:              sealedMessageType,
+		KeyID:             e.Record.GetKeyId(),
+		DataEncryptionKey: e.Record.GetDataEncryptionKey(),
+		MessageType:       e.Record.GetMessageType(),
+		EncryptedMessage:  e.Record.GetEncryptedMessage(),
+		ChainID:           e.ChainID,
+		Sequence:          e.Sequence,
+		PrevHash:          e.PrevHash,
+		Signature:         e.Signature,
+	})
+}
+
+// UnmarshalJSON unmarshals the entry from JSON. Both entries written by a sink
+// and "audit log" messages from the regular log are supported.
+func (e *Entry) UnmarshalJSON(raw []byte) error {
+	var v struct {
+		Time      string `json:"time"`
+		RequestID string `json:"request-id"`
+		ChainID   string `json:"chain_id"`
+		Sequence  uint64 `json:"sequence"`
+		PrevHash  []byte `json:"prev_hash"`
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return err
+	}
+
+	record := new(cryptpb.SealedMessage)
+	if err := record.UnmarshalFromRawZerolog(raw); err != nil {
+		return err
+	}
+
+	// log messages may use a different time format, in which case the time
+	// is left empty
+	e.Time, _ = time.Parse(time.RFC3339Nano, v.Time)
+	e.RequestID = v.RequestID
+	e.Record = record
+	e.ChainID = v.ChainID
+	e.Sequence = v.Sequence
+	e.PrevHash = v.PrevHash
+	e.Signature = v.Signature
+	return nil
+}
+
+// MarshalZerologObject fills the zerolog event fields. The time is set by the
+// logger.
+func (e *Entry) MarshalZerologObject(evt *zerolog.Event) {
+	evt.Str("request-id", e.RequestID).EmbedObject(e.Record)
+	if e.ChainID != "" {
+		evt.Str("chain_id", e.ChainID).
+			Uint64("sequence", e.Sequence).
+			Str("prev_hash", base64.StdEncoding.EncodeToString(e.PrevHash))
+	}
+	if e.Signature != "" {
+		evt.Str("signature", e.Signature)
+	}
+}
+
+// IsEntry returns true if the raw JSON object looks like an entry.
+func IsEntry(raw []byte) bool {
+	var v struct {
+		Type string `json:"@type"`
+	}
+	return json.Unmarshal(raw, &v) == nil && v.Type == sealedMessageType
+}
+
+// A Sink writes batches of entries somewhere.
+type Sink interface {
+	// Write writes a batch of entries. If an error is returned the batch may
+	// be retried. Sinks which can write only some of the entries return a
+	// PartialWriteError, so that only the rest are retried.
+	Write(ctx context.Context, entries []*Entry) error
+	// Close closes the sink.
+	Close() error
+}
+
+// A PartialWriteError is returned by a sink when only some of the entries were
+// written.
+type PartialWriteError struct {
+	// Written is the number of entries, from the start of the batch, which
+	// were written.
+	Written int
+	Err     error
+}
+
+// Error implements the error interface.
+func (err *PartialWriteError) Error() string {
+	return fmt.Sprintf("%s (%d entries written)", err.Err.Error(), err.Written)
+}
+
+// Unwrap returns the underlying error.
+func (err *PartialWriteError) Unwrap() error {
+	return err.Err
+}
@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	cryptpb "github.com/pomerium/pomerium/pkg/grpc/crypt"
+)
+
+func newTestEntry(requestID string) *Entry {
+	return &Entry{
+		Time:      time.Date(2023, 4, 5, 6, 7, 8, 9, time.UTC),
+		RequestID: requestID,
+		Record: &cryptpb.SealedMessage{
+			KeyId:             "KEY_ID",
+			DataEncryptionKey: []byte("DATA_ENCRYPTION_KEY"),
+			MessageType:       "MESSAGE_TYPE",
+			EncryptedMessage:  []byte("ENCRYPTED_MESSAGE"),
+		},
+	}
+}
+
+func TestEntry(t *testing.T) {
+	t.Parallel()
+
+	t.Run("round trip", func(t *testing.T) {
+		t.Parallel()
+
+		expect := newTestEntry("REQUEST_ID")
+		raw, err := json.Marshal(expect)
+		require.NoError(t, err)
+		assert.True(t, IsEntry(raw))
+
+		actual := new(Entry)
+		require.NoError(t, json.Unmarshal(raw, actual))
+		assert.Equal(t, expect.Time, actual.Time)
+		assert.Equal(t, expect.RequestID, actual.RequestID)
+		assert.True(t, proto.Equal(expect.Record, actual.Record))
+	})
+	t.Run("log message", func(t *testing.T) {
+		t.Parallel()
+
+		expect := newTestEntry("REQUEST_ID")
+		require.NoError(t, NewChain().Append(expect, nil, nil))
+		var buf bytes.Buffer
+		log := zerolog.New(&buf)
+		log.Info().EmbedObject(expect).Msg("audit log")
+		assert.True(t, IsEntry(buf.Bytes()))
+
+		actual := new(Entry)
+		require.NoError(t, json.Unmarshal(buf.Bytes(), actual))
+		assert.Equal(t, expect.RequestID, actual.RequestID)
+		assert.True(t, proto.Equal(expect.Record, actual.Record))
+		assert.Equal(t, expect.Hash(), actual.Hash())
+	})
+	t.Run("other message", func(t *testing.T) {
+		t.Parallel()
+
+		assert.False(t, IsEntry([]byte(`{"level":"info","message":"authorize check"}`)))
+		assert.False(t, IsEntry([]byte(`not json`)))
+	})
+}
+
+func TestReadEntries(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	for _, id := range []string{"r1", "r2"} {
+		raw, err := json.Marshal(newTestEntry(id))
+		require.NoError(t, err)
+		buf.Write(raw)
+		buf.WriteString("\n")
+		buf.WriteString(`{"level":"info","message":"authorize check"}` + "\n\n")
+	}
+
+	var lines []int
+	var ids []string
+	err := ReadEntries(&buf, func(line int, entry *Entry) error {
+		lines = append(lines, line)
+		ids = append(ids, entry.RequestID)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 4}, lines)
+	assert.Equal(t, []string{"r1", "r2"}, ids)
+}
@@ -0,0 +1,232 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+const (
+	defaultBatcherQueueSize     = 10_000
+	defaultBatcherBatchSize     = 100
+	defaultBatcherFlushInterval = time.Second
+	defaultBatcherWriteTimeout  = 10 * time.Second
+	defaultBatcherMaxRetryTime  = 30 * time.Second
+)
+
+type batcherConfig struct {
+	queueSize     int
+	batchSize     int
+	flushInterval time.Duration
+	writeTimeout  time.Duration
+	maxRetryTime  time.Duration
+	block         bool
+}
+
+// A BatcherOption customizes a Batcher.
+type BatcherOption func(cfg *batcherConfig)
+
+// WithQueueSize sets the maximum number of entries waiting to be written.
+func WithQueueSize(queueSize int) BatcherOption {
+	return func(cfg *batcherConfig) {
+		cfg.queueSize = queueSize
+	}
+}
+
+// WithBatchSize sets the maximum number of entries written to the sink at once.
+func WithBatchSize(batchSize int) BatcherOption {
+	return func(cfg *batcherConfig) {
+		cfg.batchSize = batchSize
+	}
+}
+
+// WithFlushInterval sets the maximum amount of time an entry waits before
+// being written to the sink.
+func WithFlushInterval(flushInterval time.Duration) BatcherOption {
+	return func(cfg *batcherConfig) {
+		cfg.flushInterval = flushInterval
+	}
+}
+
+// WithWriteTimeout sets the timeout for a single write to the sink.
+func WithWriteTimeout(writeTimeout time.Duration) BatcherOption {
+	return func(cfg *batcherConfig) {
+		cfg.writeTimeout = writeTimeout
+	}
+}
+
+// WithMaxRetryTime sets the maximum amount of time spent retrying a failed
+// write before the batch is dropped.
+func WithMaxRetryTime(maxRetryTime time.Duration) BatcherOption {
+	return func(cfg *batcherConfig) {
+		cfg.maxRetryTime = maxRetryTime
+	}
+}
+
+// WithBlockWhenFull sets whether adding an entry to a full queue blocks until
+// there is room, instead of dropping the entry.
+func WithBlockWhenFull(block bool) BatcherOption {
+	return func(cfg *batcherConfig) {
+		cfg.block = block
+	}
+}
+
+// A Batcher queues entries and writes them to a sink in batches.
+//
+// The queue is bounded. When the sink can't keep up entries are either dropped
+// or the caller is blocked, depending on the WithBlockWhenFull option.
+type Batcher struct {
+	cfg  *batcherConfig
+	sink Sink
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan *Entry
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	dropped int64
+}
+
+// NewBatcher creates a new Batcher.
+func NewBatcher(sink Sink, options ...BatcherOption) *Batcher {
+	cfg := new(batcherConfig)
+	WithQueueSize(defaultBatcherQueueSize)(cfg)
+	WithBatchSize(defaultBatcherBatchSize)(cfg)
+	WithFlushInterval(defaultBatcherFlushInterval)(cfg)
+	WithWriteTimeout(defaultBatcherWriteTimeout)(cfg)
+	WithMaxRetryTime(defaultBatcherMaxRetryTime)(cfg)
+	for _, option := range options {
+		option(cfg)
+	}
+
+	b := &Batcher{
+		cfg:   cfg,
+		sink:  sink,
+		queue: make(chan *Entry, cfg.queueSize),
+		done:  make(chan struct{}),
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	go b.run()
+	return b
+}
+
+// Add adds an entry to the queue. It returns false if the entry was dropped.
+func (b *Batcher) Add(ctx context.Context, entry *Entry) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if !b.closed {
+		if b.cfg.block {
+			select {
+			case b.queue <- entry:
+				return true
+			case <-ctx.Done():
+			}
+		} else {
+			select {
+			case b.queue <- entry:
+				return true
+			default:
+			}
+		}
+	}
+
+	atomic.AddInt64(&b.dropped, 1)
+	return false
+}
+
+// Close writes any queued entries and closes the sink. Failed writes are no
+// longer retried once Close has been called.
+func (b *Batcher) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.queue)
+	b.mu.Unlock()
+
+	b.cancel()
+	<-b.done
+	b.logDropped()
+	return b.sink.Close()
+}
+
+func (b *Batcher) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.cfg.flushInterval)
+	defer ticker.Stop()
+
+	// entries are only taken off the queue when there's room in the batch, so
+	// a slow sink causes the queue to fill up
+	var batch []*Entry
+	flush := func() {
+		b.logDropped()
+		if len(batch) > 0 {
+			b.write(batch)
+			batch = nil
+		}
+	}
+
+	for {
+		select {
+		case entry, ok := <-b.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= b.cfg.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (b *Batcher) write(batch []*Entry) {
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxElapsedTime = b.cfg.maxRetryTime
+	err := backoff.Retry(func() error {
+		// the write isn't tied to b.ctx so that queued entries are still
+		// written when the batcher is closed
+		ctx, clearTimeout := context.WithTimeout(context.Background(), b.cfg.writeTimeout)
+		defer clearTimeout()
+
+		err := b.sink.Write(ctx, batch)
+		// only retry the entries which weren't written
+		var partial *PartialWriteError
+		if errors.As(err, &partial) && partial.Written > 0 {
+			batch = batch[partial.Written:]
+			if len(batch) == 0 {
+				return nil
+			}
+		}
+		return err
+	}, backoff.WithContext(bo, b.ctx))
+	if err != nil {
+		log.Error(b.ctx).Err(err).
+			Int("dropped", len(batch)).
+			Msg("audit: error writing entries to sink")
+	}
+}
+
+func (b *Batcher) logDropped() {
+	if dropped := atomic.SwapInt64(&b.dropped, 0); dropped > 0 {
+		log.Error(b.ctx).
+			Int64("dropped", dropped).
+			Msg("audit: dropped entries because the queue was full")
+	}
+}
@@ -0,0 +1,180 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSink struct {
+	mu      sync.Mutex
+	write   func(entries []*Entry) error
+	entries []*Entry
+	closed  bool
+}
+
+func (sink *testSink) Write(_ context.Context, entries []*Entry) error {
+	if sink.write != nil {
+		if err := sink.write(entries); err != nil {
+			return err
+		}
+	}
+	sink.mu.Lock()
+	sink.entries = append(sink.entries, entries...)
+	sink.mu.Unlock()
+	return nil
+}
+
+func (sink *testSink) Close() error {
+	sink.mu.Lock()
+	sink.closed = true
+	sink.mu.Unlock()
+	return nil
+}
+
+func (sink *testSink) requestIDs() []string {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	var ids []string
+	for _, entry := range sink.entries {
+		ids = append(ids, entry.RequestID)
+	}
+	return ids
+}
+
+func TestBatcher(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("batches", func(t *testing.T) {
+		t.Parallel()
+
+		var batchSizes []int
+		sink := &testSink{write: func(entries []*Entry) error {
+			batchSizes = append(batchSizes, len(entries))
+			return nil
+		}}
+		b := NewBatcher(sink, WithBatchSize(2), WithFlushInterval(time.Hour))
+		for _, id := range []string{"r1", "r2", "r3"} {
+			assert.True(t, b.Add(ctx, newTestEntry(id)))
+		}
+		require.NoError(t, b.Close())
+
+		assert.Equal(t, []string{"r1", "r2", "r3"}, sink.requestIDs())
+		assert.Equal(t, []int{2, 1}, batchSizes)
+		assert.True(t, sink.closed)
+		assert.False(t, b.Add(ctx, newTestEntry("r4")), "should drop entries after close")
+	})
+	t.Run("flush interval", func(t *testing.T) {
+		t.Parallel()
+
+		sink := &testSink{}
+		b := NewBatcher(sink, WithFlushInterval(time.Millisecond))
+		defer b.Close()
+
+		b.Add(ctx, newTestEntry("r1"))
+		assert.Eventually(t, func() bool {
+			return len(sink.requestIDs()) == 1
+		}, time.Second, time.Millisecond)
+	})
+	t.Run("retry", func(t *testing.T) {
+		t.Parallel()
+
+		attempts := 0
+		sink := &testSink{write: func(entries []*Entry) error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("ERROR")
+			}
+			return nil
+		}}
+		b := NewBatcher(sink, WithFlushInterval(time.Millisecond))
+		defer b.Close()
+
+		b.Add(ctx, newTestEntry("r1"))
+		assert.Eventually(t, func() bool {
+			return len(sink.requestIDs()) == 1
+		}, 5*time.Second, time.Millisecond)
+	})
+	t.Run("partial write", func(t *testing.T) {
+		t.Parallel()
+
+		sink := &testSink{}
+		attempts := 0
+		sink.write = func(entries []*Entry) error {
+			attempts++
+			if attempts == 1 {
+				// only write the first entry
+				sink.mu.Lock()
+				sink.entries = append(sink.entries, entries[0])
+				sink.mu.Unlock()
+				return &PartialWriteError{Written: 1, Err: errors.New("ERROR")}
+			}
+			return nil
+		}
+		b := NewBatcher(sink, WithBatchSize(3), WithFlushInterval(time.Hour))
+		defer b.Close()
+
+		for _, id := range []string{"r1", "r2", "r3"} {
+			assert.True(t, b.Add(ctx, newTestEntry(id)))
+		}
+		assert.Eventually(t, func() bool {
+			return len(sink.requestIDs()) == 3
+		}, 5*time.Second, time.Millisecond)
+		assert.Equal(t, []string{"r1", "r2", "r3"}, sink.requestIDs())
+	})
+	t.Run("drop when full", func(t *testing.T) {
+		t.Parallel()
+
+		unblock := make(chan struct{})
+		sink := &testSink{write: func(entries []*Entry) error {
+			<-unblock
+			return nil
+		}}
+		b := NewBatcher(sink, WithQueueSize(1), WithBatchSize(1), WithFlushInterval(time.Millisecond))
+
+		var added int
+		for i := 0; i < 100; i++ {
+			if b.Add(ctx, newTestEntry("r")) {
+				added++
+			}
+		}
+		assert.Less(t, added, 100)
+
+		close(unblock)
+		require.NoError(t, b.Close())
+		assert.Len(t, sink.requestIDs(), added)
+	})
+	t.Run("block when full", func(t *testing.T) {
+		t.Parallel()
+
+		unblock := make(chan struct{})
+		sink := &testSink{write: func(entries []*Entry) error {
+			<-unblock
+			return nil
+		}}
+		b := NewBatcher(sink, WithQueueSize(1), WithBatchSize(1), WithFlushInterval(time.Millisecond),
+			WithBlockWhenFull(true))
+
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		var added int
+		for i := 0; i < 100; i++ {
+			if b.Add(ctx, newTestEntry("r")) {
+				added++
+			}
+		}
+		assert.Less(t, added, 100, "should stop blocking once the context is done")
+
+		close(unblock)
+		require.NoError(t, b.Close())
+		assert.Len(t, sink.requestIDs(), added)
+	})
+}
@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/google/uuid"
+)
+
+// A Chain makes entries tamper-evident. Each entry is given the next sequence
+// number in the chain and the hash of the previous entry, and is then signed.
+// Removing or modifying entries breaks the chain, which can be detected with a
+// Verifier.
+//
+// Removing entries from the end of a chain does not break it, so truncating
+// the log can't be detected from the log alone.
+type Chain struct {
+	id string
+
+	mu       sync.Mutex
+	sequence uint64
+	prevHash []byte
+
+	// entries are written in sequence order, so that reordered entries in the
+	// log can be detected
+	writeMu   sync.Mutex
+	writeCond *sync.Cond
+	written   uint64
+}
+
+// NewChain creates a new Chain with a random id.
+func NewChain() *Chain {
+	c := &Chain{id: uuid.NewString()}
+	c.writeCond = sync.NewCond(&c.writeMu)
+	return c
+}
+
+// Append adds an entry to the chain and passes it to write. Only the sequence
+// number and the previous hash are assigned while holding the chain's lock,
+// the entry is signed afterwards, so concurrent appends don't wait for each
+// other's signatures. write is then called with the entries in sequence order.
+// If signer is nil the entry is not signed.
+//
+// If signing fails the entry is still part of the chain, and is still written
+// so that the chain doesn't have a gap.
+func (c *Chain) Append(entry *Entry, signer jose.Signer, write func(*Entry)) error {
+	entry.ChainID = c.id
+	entry.Signature = ""
+
+	c.mu.Lock()
+	entry.Sequence = c.sequence + 1
+	entry.PrevHash = c.prevHash
+	hash := entry.Hash()
+	c.sequence = entry.Sequence
+	c.prevHash = hash
+	c.mu.Unlock()
+
+	err := sign(entry, hash, signer)
+
+	c.writeMu.Lock()
+	for c.written != entry.Sequence-1 {
+		c.writeCond.Wait()
+	}
+	if write != nil {
+		write(entry)
+	}
+	c.written = entry.Sequence
+	c.writeCond.Broadcast()
+	c.writeMu.Unlock()
+
+	return err
+}
+
+func sign(entry *Entry, hash []byte, signer jose.Signer) error {
+	if signer == nil {
+		return nil
+	}
+	jws, err := signer.Sign(hash)
+	if err != nil {
+		return fmt.Errorf("audit: error signing entry: %w", err)
+	}
+	entry.Signature, err = jws.DetachedCompactSerialize()
+	if err != nil {
+		return fmt.Errorf("audit: error signing entry: %w", err)
+	}
+	return nil
+}
+
+// Hash returns the SHA-256 hash of the entry. The hash covers the chain fields
+// and the sealed record, but not the time, since the time of log messages is
+// set by the logger.
+func (e *Entry) Hash() []byte {
+	h := sha256.New()
+	writeField := func(bs []byte) {
+		_ = binary.Write(h, binary.BigEndian, uint64(len(bs)))
+		_, _ = h.Write(bs)
+	}
+	writeField([]byte("pomerium-audit-v1"))
+	writeField([]byte(e.ChainID))
+	_ = binary.Write(h, binary.BigEndian, e.Sequence)
+	writeField(e.PrevHash)
+	writeField([]byte(e.RequestID))
+	writeField([]byte(e.Record.GetKeyId()))
+	writeField(e.Record.GetDataEncryptionKey())
+	writeField([]byte(e.Record.GetMessageType()))
+	writeField(e.Record.GetEncryptedMessage())
+	return h.Sum(nil)
+}
+
+// NewSigner creates a signer for entries from a JSON web key.
+func NewSigner(jwk *jose.JSONWebKey) (jose.Signer, error) {
+	return jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.SignatureAlgorithm(jwk.Algorithm),
+		Key:       jwk,
+	}, nil)
+}
@@ -0,0 +1,67 @@
+package audit
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+func newTestSigner(t *testing.T) (jose.Signer, *jose.JSONWebKeySet) {
+	t.Helper()
+
+	key, err := cryptutil.NewSigningKey()
+	require.NoError(t, err)
+	raw, err := cryptutil.EncodePrivateKey(key)
+	require.NoError(t, err)
+	jwk, err := cryptutil.PrivateJWKFromBytes(raw)
+	require.NoError(t, err)
+	signer, err := NewSigner(jwk)
+	require.NoError(t, err)
+	return signer, &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}}
+}
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+
+	signer, keys := newTestSigner(t)
+	c := NewChain()
+
+	var mu sync.Mutex
+	var entries []*Entry
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry := newTestEntry("r")
+			assert.NoError(t, c.Append(entry, signer, func(entry *Entry) {
+				mu.Lock()
+				entries = append(entries, entry)
+				mu.Unlock()
+			}))
+		}()
+	}
+	wg.Wait()
+
+	// entries are written in sequence order
+	require.Len(t, entries, 10)
+	for i, entry := range entries {
+		assert.Equal(t, c.id, entry.ChainID)
+		assert.Equal(t, uint64(i+1), entry.Sequence)
+		if i == 0 {
+			assert.Empty(t, entry.PrevHash)
+		} else {
+			assert.Equal(t, entries[i-1].Hash(), entry.PrevHash)
+		}
+
+		jws, err := jose.ParseDetached(entry.Signature, entry.Hash())
+		require.NoError(t, err)
+		_, err = jws.Verify(keys.Keys[0])
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+
+	databrokerpb "github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+const defaultDataBrokerSinkMaxRecords = 10_000
+
+// A DataBrokerSink stores entries as sealed message records in the databroker.
+// Once the maximum number of records is reached the oldest records are
+// removed. Only the sealed record is stored, so the chain of the entries can't
+// be verified.
+type DataBrokerSink struct {
+	client     databrokerpb.DataBrokerServiceClient
+	maxRecords uint64
+
+	mu             sync.Mutex
+	hasSetCapacity bool
+}
+
+// NewDataBrokerSink creates a new DataBrokerSink. If maxRecords is 0 a default
+// is used.
+func NewDataBrokerSink(client databrokerpb.DataBrokerServiceClient, maxRecords uint64) *DataBrokerSink {
+	if maxRecords == 0 {
+		maxRecords = defaultDataBrokerSinkMaxRecords
+	}
+	return &DataBrokerSink{
+		client:     client,
+		maxRecords: maxRecords,
+	}
+}
+
+// Write writes entries to the databroker.
+func (sink *DataBrokerSink) Write(ctx context.Context, entries []*Entry) error {
+	if err := sink.setCapacity(ctx); err != nil {
+		return err
+	}
+
+	records := make([]*databrokerpb.Record, 0, len(entries))
+	for _, entry := range entries {
+		records = append(records, &databrokerpb.Record{
+			Type: sealedMessageType,
+			Id:   uuid.NewString(),
+			Data: protoutil.NewAny(entry.Record),
+		})
+	}
+
+	_, err := sink.client.Put(ctx, &databrokerpb.PutRequest{
+		Records: records,
+	})
+	if err != nil {
+		return fmt.Errorf("audit: error storing entries in databroker: %w", err)
+	}
+	return nil
+}
+
+// Close closes the sink.
+func (sink *DataBrokerSink) Close() error {
+	return nil
+}
+
+func (sink *DataBrokerSink) setCapacity(ctx context.Context) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if sink.hasSetCapacity {
+		return nil
+	}
+
+	_, err := sink.client.SetOptions(ctx, &databrokerpb.SetOptionsRequest{
+		Type: sealedMessageType,
+		Options: &databrokerpb.Options{
+			Capacity: proto.Uint64(sink.maxRecords),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("audit: error setting databroker capacity: %w", err)
+	}
+	sink.hasSetCapacity = true
+	return nil
+}
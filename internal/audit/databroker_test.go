@@ -0,0 +1,56 @@
+package audit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	cryptpb "github.com/pomerium/pomerium/pkg/grpc/crypt"
+	databrokerpb "github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type testDataBrokerClient struct {
+	databrokerpb.DataBrokerServiceClient
+
+	options []*databrokerpb.SetOptionsRequest
+	records []*databrokerpb.Record
+}
+
+func (client *testDataBrokerClient) Put(_ context.Context, in *databrokerpb.PutRequest, _ ...grpc.CallOption) (*databrokerpb.PutResponse, error) {
+	client.records = append(client.records, in.GetRecords()...)
+	return &databrokerpb.PutResponse{Records: in.GetRecords()}, nil
+}
+
+func (client *testDataBrokerClient) SetOptions(_ context.Context, in *databrokerpb.SetOptionsRequest, _ ...grpc.CallOption) (*databrokerpb.SetOptionsResponse, error) {
+	client.options = append(client.options, in)
+	return &databrokerpb.SetOptionsResponse{Options: in.GetOptions()}, nil
+}
+
+func TestDataBrokerSink(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := new(testDataBrokerClient)
+	sink := NewDataBrokerSink(client, 5)
+	defer sink.Close()
+
+	require.NoError(t, sink.Write(ctx, []*Entry{newTestEntry("r1"), newTestEntry("r2")}))
+	require.NoError(t, sink.Write(ctx, []*Entry{newTestEntry("r3")}))
+
+	if assert.Len(t, client.options, 1, "should only set the capacity once") {
+		assert.Equal(t, "type.googleapis.com/pomerium.crypt.SealedMessage", client.options[0].GetType())
+		assert.Equal(t, uint64(5), client.options[0].GetOptions().GetCapacity())
+	}
+	if assert.Len(t, client.records, 3) {
+		assert.Equal(t, "type.googleapis.com/pomerium.crypt.SealedMessage", client.records[0].GetType())
+		assert.NotEqual(t, client.records[0].GetId(), client.records[1].GetId())
+
+		var record cryptpb.SealedMessage
+		require.NoError(t, client.records[0].GetData().UnmarshalTo(&record))
+		assert.True(t, proto.Equal(newTestEntry("r1").Record, &record))
+	}
+}
@@ -0,0 +1,180 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	defaultFileSinkMaxSize    = 100 << 20
+	defaultFileSinkMaxBackups = 10
+)
+
+// A FileSink writes entries to a file as JSON lines. When the file exceeds its
+// maximum size it is rotated: audit.jsonl is renamed to audit.jsonl.1,
+// audit.jsonl.1 to audit.jsonl.2 and so on, up to the maximum number of
+// backups.
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu     sync.Mutex
+	closed bool
+	f      *os.File
+	size   int64
+}
+
+// NewFileSink creates a new FileSink. If maxSize or maxBackups are 0 defaults
+// are used. The file is opened on the first write, so that a FileSink replacing
+// another one for the same path can be created before the other one is closed.
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	if maxSize <= 0 {
+		maxSize = defaultFileSinkMaxSize
+	}
+	if maxBackups <= 0 {
+		maxBackups = defaultFileSinkMaxBackups
+	}
+
+	fi, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("audit: invalid file path %s: %w", path, err)
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("audit: invalid file path %s: %s is not a directory", path, filepath.Dir(path))
+	}
+
+	return &FileSink{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}, nil
+}
+
+// Write writes entries to the file. If only some of the entries are written a
+// PartialWriteError is returned, and the file only contains whole entries.
+func (sink *FileSink) Write(_ context.Context, entries []*Entry) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if sink.closed {
+		return errors.New("audit: file sink is closed")
+	}
+	// the file is opened on the first write, or again if a previous rotation
+	// failed
+	if sink.f == nil {
+		if err := sink.open(); err != nil {
+			return err
+		}
+	}
+
+	// lines are buffered so that they're written to the file at once, the
+	// length of each line is kept to know which entries were written
+	var buf []byte
+	var lineLengths []int
+	written := 0
+	flush := func() error {
+		n, err := sink.f.Write(buf)
+		sink.size += int64(n)
+		for len(lineLengths) > 0 && n >= lineLengths[0] {
+			n -= lineLengths[0]
+			lineLengths = lineLengths[1:]
+			written++
+		}
+		if err != nil {
+			// remove the partially written line
+			if n > 0 && sink.f.Truncate(sink.size-int64(n)) == nil {
+				sink.size -= int64(n)
+			}
+			return fmt.Errorf("audit: error writing to %s: %w", sink.path, err)
+		}
+		buf, lineLengths = buf[:0], lineLengths[:0]
+		return nil
+	}
+
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return &PartialWriteError{Written: written, Err: fmt.Errorf("audit: error marshaling entry: %w", err)}
+		}
+		line = append(line, '\n')
+
+		if sink.size+int64(len(buf)) > 0 && sink.size+int64(len(buf)+len(line)) > sink.maxSize {
+			if err := flush(); err != nil {
+				return &PartialWriteError{Written: written, Err: err}
+			}
+			if err := sink.rotate(); err != nil {
+				return &PartialWriteError{Written: written, Err: err}
+			}
+		}
+
+		buf = append(buf, line...)
+		lineLengths = append(lineLengths, len(line))
+	}
+	if err := flush(); err != nil {
+		return &PartialWriteError{Written: written, Err: err}
+	}
+	if err := sink.f.Sync(); err != nil {
+		// the entries were written, so they shouldn't be written again
+		return &PartialWriteError{Written: written, Err: fmt.Errorf("audit: error syncing %s: %w", sink.path, err)}
+	}
+	return nil
+}
+
+// Close closes the file.
+func (sink *FileSink) Close() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	sink.closed = true
+	if sink.f == nil {
+		return nil
+	}
+	err := sink.f.Close()
+	sink.f = nil
+	return err
+}
+
+func (sink *FileSink) open() error {
+	f, err := os.OpenFile(sink.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("audit: error opening %s: %w", sink.path, err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("audit: error opening %s: %w", sink.path, err)
+	}
+	sink.f = f
+	sink.size = fi.Size()
+	return nil
+}
+
+func (sink *FileSink) rotate() error {
+	if err := sink.f.Close(); err != nil {
+		return fmt.Errorf("audit: error closing %s: %w", sink.path, err)
+	}
+	sink.f = nil
+
+	// the oldest backup is removed by being overwritten
+	for i := sink.maxBackups - 1; i >= 1; i-- {
+		err := os.Rename(sink.backupPath(i), sink.backupPath(i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("audit: error rotating %s: %w", sink.path, err)
+		}
+	}
+	if err := os.Rename(sink.path, sink.backupPath(1)); err != nil {
+		return fmt.Errorf("audit: error rotating %s: %w", sink.path, err)
+	}
+
+	return sink.open()
+}
+
+func (sink *FileSink) backupPath(i int) string {
+	return fmt.Sprintf("%s.%d", sink.path, i)
+}
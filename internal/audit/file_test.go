@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readTestEntries(t *testing.T, name string) []string {
+	t.Helper()
+
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var ids []string
+	require.NoError(t, ReadEntries(f, func(_ int, entry *Entry) error {
+		ids = append(ids, entry.RequestID)
+		return nil
+	}))
+	return ids
+}
+
+func TestFileSink(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("append", func(t *testing.T) {
+		t.Parallel()
+
+		name := filepath.Join(t.TempDir(), "audit.jsonl")
+		sink, err := NewFileSink(name, 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, sink.Write(ctx, []*Entry{newTestEntry("r1"), newTestEntry("r2")}))
+		require.NoError(t, sink.Close())
+
+		// re-opening the file appends to it
+		sink, err = NewFileSink(name, 0, 0)
+		require.NoError(t, err)
+		require.NoError(t, sink.Write(ctx, []*Entry{newTestEntry("r3")}))
+		require.NoError(t, sink.Close())
+
+		assert.Equal(t, []string{"r1", "r2", "r3"}, readTestEntries(t, name))
+		assert.Error(t, sink.Write(ctx, []*Entry{newTestEntry("r4")}), "should return an error after close")
+	})
+	t.Run("open", func(t *testing.T) {
+		t.Parallel()
+
+		name := filepath.Join(t.TempDir(), "audit.jsonl")
+		sink, err := NewFileSink(name, 0, 0)
+		require.NoError(t, err)
+		assert.NoFileExists(t, name, "should open the file on the first write")
+		require.NoError(t, sink.Write(ctx, []*Entry{newTestEntry("r1")}))
+		require.NoError(t, sink.Close())
+		assert.Equal(t, []string{"r1"}, readTestEntries(t, name))
+
+		_, err = NewFileSink(filepath.Join(t.TempDir(), "missing", "audit.jsonl"), 0, 0)
+		assert.Error(t, err, "should return an error if the directory doesn't exist")
+	})
+	t.Run("rotate", func(t *testing.T) {
+		t.Parallel()
+
+		name := filepath.Join(t.TempDir(), "audit.jsonl")
+		// each entry is about 250 bytes, so each file holds two entries
+		sink, err := NewFileSink(name, 600, 2)
+		require.NoError(t, err)
+		for _, id := range []string{"r1", "r2", "r3", "r4", "r5", "r6", "r7"} {
+			require.NoError(t, sink.Write(ctx, []*Entry{newTestEntry(id)}))
+		}
+		require.NoError(t, sink.Close())
+
+		assert.Equal(t, []string{"r7"}, readTestEntries(t, name))
+		assert.Equal(t, []string{"r5", "r6"}, readTestEntries(t, name+".1"))
+		assert.Equal(t, []string{"r3", "r4"}, readTestEntries(t, name+".2"))
+		assert.NoFileExists(t, name+".3")
+	})
+}
@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+)
+
+// httpSinkRequestTimeout bounds webhook requests, so that an unresponsive
+// webhook doesn't stall the batcher and fill up its queue.
+const httpSinkRequestTimeout = 10 * time.Second
+
+var httpSinkClient = httputil.NewLoggingClient(&http.Client{
+	Timeout: httpSinkRequestTimeout,
+}, "audit_http_sink")
+
+// An HTTPSink POSTs batches of entries to a webhook as newline-delimited JSON.
+type HTTPSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewHTTPSink creates a new HTTPSink.
+func NewHTTPSink(url string, headers map[string]string) *HTTPSink {
+	return &HTTPSink{
+		url:     url,
+		headers: headers,
+		client:  httpSinkClient,
+	}
+}
+
+// Write writes entries to the webhook.
+func (sink *HTTPSink) Write(ctx context.Context, entries []*Entry) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return fmt.Errorf("audit: error marshaling entry: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.url, &body)
+	if err != nil {
+		return fmt.Errorf("audit: error creating webhook request: %w", err)
+	}
+	for k, v := range sink.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	res, err := sink.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("audit: error sending entries to webhook: %w", err)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("audit: unexpected status code from webhook: %d", res.StatusCode)
+	}
+	return nil
+}
+
+// Close closes the sink.
+func (sink *HTTPSink) Close() error {
+	return nil
+}
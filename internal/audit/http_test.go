@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPSink(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var ids []string
+	var statusCode int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer TOKEN", r.Header.Get("Authorization"))
+		require.NoError(t, ReadEntries(r.Body, func(_ int, entry *Entry) error {
+			ids = append(ids, entry.RequestID)
+			return nil
+		}))
+		w.WriteHeader(statusCode)
+	}))
+	defer srv.Close()
+
+	sink := NewHTTPSink(srv.URL, map[string]string{"authorization": "Bearer TOKEN"})
+	defer sink.Close()
+
+	statusCode = http.StatusNoContent
+	assert.NoError(t, sink.Write(ctx, []*Entry{newTestEntry("r1"), newTestEntry("r2")}))
+	assert.Equal(t, []string{"r1", "r2"}, ids)
+
+	statusCode = http.StatusServiceUnavailable
+	assert.Error(t, sink.Write(ctx, []*Entry{newTestEntry("r3")}))
+}
@@ -0,0 +1,34 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// maxLineSize is the maximum size of a line read by ReadEntries. Audit records
+// contain the full request headers, so they can be quite large.
+const maxLineSize = 16 << 20
+
+// ReadEntries reads JSON lines from r and calls fn for each entry. Lines which
+// aren't entries, like other log messages, are skipped.
+func ReadEntries(r io.Reader, fn func(line int, entry *Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 || !IsEntry(raw) {
+			continue
+		}
+
+		entry := new(Entry)
+		if err := entry.UnmarshalJSON(raw); err != nil {
+			return fmt.Errorf("line %d: invalid audit entry: %w", line, err)
+		}
+		if err := fn(line, entry); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
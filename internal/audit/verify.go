@@ -0,0 +1,226 @@
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/go-jose/go-jose/v3"
+)
+
+// A Problem is an issue with a chain of entries found by a Verifier.
+type Problem struct {
+	File    string
+	Line    int
+	ChainID string
+	Message string
+}
+
+// String returns the problem as a string.
+func (p Problem) String() string {
+	if p.ChainID == "" {
+		return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+	}
+	return fmt.Sprintf("%s:%d: chain %s: %s", p.File, p.Line, p.ChainID, p.Message)
+}
+
+type verifierEntry struct {
+	file     string
+	line     int
+	sequence uint64
+	prevHash []byte
+	hash     []byte
+}
+
+type verifierChain struct {
+	id        string
+	entries   []verifierEntry
+	sequences map[uint64]struct{}
+	last      verifierEntry
+}
+
+// A Verifier checks that chains of entries are complete, in order and have not
+// been modified. Entries missing from the end of a chain are not detected,
+// since nothing in the log records which entry was the last one.
+type Verifier struct {
+	keys *jose.JSONWebKeySet
+
+	files    map[string]int
+	chains   map[string]*verifierChain
+	order    []string
+	problems []Problem
+	count    int
+}
+
+// NewVerifier creates a new Verifier. If keys is nil signatures are not
+// checked.
+func NewVerifier(keys *jose.JSONWebKeySet) *Verifier {
+	return &Verifier{
+		keys:   keys,
+		files:  make(map[string]int),
+		chains: make(map[string]*verifierChain),
+	}
+}
+
+// Add adds an entry to the verifier. Entries must be added in the order they
+// appear in the log.
+func (v *Verifier) Add(file string, line int, entry *Entry) {
+	v.count++
+	if _, ok := v.files[file]; !ok {
+		v.files[file] = len(v.files)
+	}
+
+	if entry.ChainID == "" {
+		v.addProblem(verifierEntry{file: file, line: line}, "", "entry is not part of a chain")
+		return
+	}
+
+	e := verifierEntry{
+		file:     file,
+		line:     line,
+		sequence: entry.Sequence,
+		prevHash: entry.PrevHash,
+		hash:     entry.Hash(),
+	}
+
+	if v.keys != nil {
+		if err := v.verifySignature(entry.Signature, e.hash); err != nil {
+			v.addProblem(e, entry.ChainID, err.Error())
+		}
+	}
+
+	c, ok := v.chains[entry.ChainID]
+	if !ok {
+		c = &verifierChain{id: entry.ChainID, sequences: make(map[uint64]struct{})}
+		v.chains[entry.ChainID] = c
+		v.order = append(v.order, entry.ChainID)
+	}
+
+	if _, ok := c.sequences[e.sequence]; ok {
+		v.addProblem(e, c.id, fmt.Sprintf("duplicate entry with sequence %d", e.sequence))
+		return
+	}
+
+	// a chain's entries are written in sequence order, so an entry with a
+	// lower sequence than the one before it was moved. The links are still
+	// checked in sequence order, so only the reordering is reported.
+	if e.sequence < c.last.sequence {
+		v.addProblem(e, c.id, fmt.Sprintf("entry with sequence %d appears after sequence %d (%s:%d), the entries were reordered",
+			e.sequence, c.last.sequence, c.last.file, c.last.line))
+	} else {
+		c.last = e
+	}
+
+	c.sequences[e.sequence] = struct{}{}
+	c.entries = append(c.entries, e)
+}
+
+// Count returns the number of entries added to the verifier.
+func (v *Verifier) Count() int {
+	return v.count
+}
+
+// Chains returns the number of chains added to the verifier.
+func (v *Verifier) Chains() int {
+	return len(v.chains)
+}
+
+// A Head is the last entry of a chain found by a Verifier.
+type Head struct {
+	ChainID  string
+	Sequence uint64
+}
+
+// Heads returns the last entry of each chain, in the order the chains appear
+// in the log.
+func (v *Verifier) Heads() []Head {
+	var heads []Head
+	for _, id := range v.order {
+		head := Head{ChainID: id}
+		for _, e := range v.chains[id].entries {
+			if e.sequence > head.Sequence {
+				head.Sequence = e.sequence
+			}
+		}
+		heads = append(heads, head)
+	}
+	return heads
+}
+
+// Problems checks the links between entries and returns all the problems found
+// with the chains, in the order they appear in the log.
+func (v *Verifier) Problems() []Problem {
+	problems := append([]Problem{}, v.problems...)
+	for _, id := range v.order {
+		problems = append(problems, v.checkChain(v.chains[id])...)
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			// files are compared by the order they were added
+			return v.files[problems[i].File] < v.files[problems[j].File]
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return problems
+}
+
+func (v *Verifier) checkChain(c *verifierChain) []Problem {
+	var problems []Problem
+	addProblem := func(e verifierEntry, msg string) {
+		problems = append(problems, Problem{File: e.file, Line: e.line, ChainID: c.id, Message: msg})
+	}
+
+	entries := append([]verifierEntry{}, c.entries...)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].sequence < entries[j].sequence
+	})
+
+	first := entries[0]
+	if first.sequence > 1 {
+		addProblem(first, fmt.Sprintf("%d entries are missing before sequence %d",
+			first.sequence-1, first.sequence))
+	} else if len(first.prevHash) > 0 {
+		addProblem(first, "the first entry in the chain has a previous hash, it was modified")
+	}
+
+	for i := 1; i < len(entries); i++ {
+		prev, cur := entries[i-1], entries[i]
+		switch {
+		case cur.sequence != prev.sequence+1:
+			addProblem(cur, fmt.Sprintf("%d entries are missing between sequence %d (%s:%d) and sequence %d",
+				cur.sequence-prev.sequence-1, prev.sequence, prev.file, prev.line, cur.sequence))
+		case !bytes.Equal(cur.prevHash, prev.hash):
+			addProblem(cur, fmt.Sprintf("previous hash does not match sequence %d (%s:%d), one of the entries was modified",
+				prev.sequence, prev.file, prev.line))
+		}
+	}
+	return problems
+}
+
+func (v *Verifier) verifySignature(signature string, hash []byte) error {
+	if signature == "" {
+		return fmt.Errorf("entry is not signed")
+	}
+
+	jws, err := jose.ParseDetached(signature, hash)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	if len(jws.Signatures) != 1 {
+		return fmt.Errorf("invalid signature: expected one signature, got %d", len(jws.Signatures))
+	}
+
+	kid := jws.Signatures[0].Header.KeyID
+	keys := v.keys.Key(kid)
+	if len(keys) == 0 {
+		return fmt.Errorf("entry is signed with an unknown key: %s", kid)
+	}
+	if _, err := jws.Verify(keys[0].Public()); err != nil {
+		return fmt.Errorf("invalid signature, the entry was modified")
+	}
+	return nil
+}
+
+func (v *Verifier) addProblem(e verifierEntry, chainID, msg string) {
+	v.problems = append(v.problems, Problem{File: e.file, Line: e.line, ChainID: chainID, Message: msg})
+}
@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifier(t *testing.T) {
+	t.Parallel()
+
+	signer, keys := newTestSigner(t)
+	newEntries := func(n int) []*Entry {
+		c := NewChain()
+		var entries []*Entry
+		for i := 0; i < n; i++ {
+			entry := newTestEntry("r")
+			_ = c.Append(entry, signer, nil)
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+	verify := func(entries []*Entry) []string {
+		v := NewVerifier(keys)
+		for i, entry := range entries {
+			v.Add("audit.jsonl", i+1, entry)
+		}
+		var problems []string
+		for _, p := range v.Problems() {
+			p.ChainID = ""
+			problems = append(problems, p.String())
+		}
+		return problems
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		t.Parallel()
+
+		entries := append(newEntries(3), newEntries(2)...)
+		assert.Empty(t, verify(entries))
+	})
+	t.Run("gap", func(t *testing.T) {
+		t.Parallel()
+
+		entries := newEntries(5)
+		entries = append(entries[:1], entries[3:]...)
+		assert.Equal(t, []string{
+			"audit.jsonl:2: 2 entries are missing between sequence 1 (audit.jsonl:1) and sequence 4",
+		}, verify(entries))
+	})
+	t.Run("truncated start", func(t *testing.T) {
+		t.Parallel()
+
+		entries := newEntries(3)
+		assert.Equal(t, []string{
+			"audit.jsonl:1: 1 entries are missing before sequence 2",
+		}, verify(entries[1:]))
+	})
+	t.Run("reordered", func(t *testing.T) {
+		t.Parallel()
+
+		entries := newEntries(4)
+		entries[1], entries[2] = entries[2], entries[1]
+		assert.Equal(t, []string{
+			"audit.jsonl:3: entry with sequence 2 appears after sequence 3 (audit.jsonl:2), the entries were reordered",
+		}, verify(entries))
+	})
+	t.Run("duplicate", func(t *testing.T) {
+		t.Parallel()
+
+		entries := newEntries(2)
+		entries = append(entries, entries[1])
+		assert.Equal(t, []string{
+			"audit.jsonl:3: duplicate entry with sequence 2",
+		}, verify(entries))
+	})
+	t.Run("modified", func(t *testing.T) {
+		t.Parallel()
+
+		entries := newEntries(3)
+		entries[1].Record.EncryptedMessage = []byte("MODIFIED")
+		assert.Equal(t, []string{
+			"audit.jsonl:2: invalid signature, the entry was modified",
+			"audit.jsonl:3: previous hash does not match sequence 2 (audit.jsonl:2), one of the entries was modified",
+		}, verify(entries))
+	})
+	t.Run("unsigned", func(t *testing.T) {
+		t.Parallel()
+
+		entries := newEntries(1)
+		entries[0].Signature = ""
+		assert.Equal(t, []string{
+			"audit.jsonl:1: entry is not signed",
+		}, verify(entries))
+	})
+	t.Run("unchained", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Equal(t, []string{
+			"audit.jsonl:1: entry is not part of a chain",
+		}, verify([]*Entry{newTestEntry("r")}))
+	})
+	t.Run("heads", func(t *testing.T) {
+		t.Parallel()
+
+		c1, c2 := newEntries(3), newEntries(2)
+		v := NewVerifier(keys)
+		for i, entry := range append(c1, c2[1], c2[0]) {
+			v.Add("audit.jsonl", i+1, entry)
+		}
+		assert.Equal(t, []Head{
+			{ChainID: c1[0].ChainID, Sequence: 3},
+			{ChainID: c2[0].ChainID, Sequence: 2},
+		}, v.Heads())
+	})
+}
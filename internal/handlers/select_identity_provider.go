@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/ui"
+)
+
+// SelectIdentityProviderData is the data for the SelectIdentityProvider page.
+type SelectIdentityProviderData struct {
+	IdentityProviders []SelectIdentityProviderOption
+	// URL is the sign in url, used to sign in with a login hint.
+	URL string
+
+	BrandingOptions httputil.BrandingOptions
+}
+
+// A SelectIdentityProviderOption is an identity provider users can choose.
+type SelectIdentityProviderOption struct {
+	ID   string
+	Name string
+	// URL is the url to sign in with the identity provider.
+	URL string
+}
+
+// ToJSON converts the data into a JSON map.
+func (data SelectIdentityProviderData) ToJSON() map[string]interface{} {
+	idps := make([]map[string]interface{}, 0, len(data.IdentityProviders))
+	for _, idp := range data.IdentityProviders {
+		idps = append(idps, map[string]interface{}{
+			"id":   idp.ID,
+			"name": idp.Name,
+			"url":  idp.URL,
+		})
+	}
+	m := map[string]interface{}{
+		"identityProviders": idps,
+		"url":               data.URL,
+	}
+	httputil.AddBrandingOptionsToMap(m, data.BrandingOptions)
+	return m
+}
+
+// SelectIdentityProvider returns a handler that renders the page used to
+// choose the identity provider to sign in with.
+func SelectIdentityProvider(data SelectIdentityProviderData) http.Handler {
+	return httputil.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return ui.ServePage(w, r, "SelectIdentityProvider", data.ToJSON())
+	})
+}
@@ -1,7 +1,9 @@
 package httputil
 
 import (
+	"bytes"
 	"context"
+	"html/template"
 	"net/http"
 	"net/url"
 
@@ -23,9 +25,31 @@ type HTTPError struct {
 	// The request ID.
 	RequestID string
 
+	// Reasons are the policy reasons the request was denied. They are only
+	// set when the route has show_error_details enabled.
+	Reasons []string
+	// Explanation is why the request was denied and Remediation is what the
+	// user can do to gain access. They are only set when the route has
+	// show_error_details enabled.
+	Explanation string
+	Remediation string
+	// Template, if set, is used to render the error page instead of the
+	// built-in one. It is executed with an ErrorTemplateData.
+	Template *template.Template
+
 	BrandingOptions BrandingOptions
 }
 
+// ErrorTemplateData is the data custom error page templates are executed with.
+type ErrorTemplateData struct {
+	Status      int
+	StatusText  string
+	RequestID   string
+	Reasons     []string
+	Explanation string
+	Remediation string
+}
+
 // NewError returns an error that contains a HTTP status and error.
 func NewError(status int, err error) *HTTPError {
 	return &HTTPError{Status: status, Err: err}
@@ -81,11 +105,24 @@ func (e *HTTPError) ErrorResponse(ctx context.Context, w http.ResponseWriter, r
 			Msg("httputil: error")
 	}
 
+	if e.Status >= 400 && acceptsProblemJSON(r) {
+		renderProblemJSON(w, e.problem(reqID))
+		return
+	}
+
 	if r.Header.Get("Accept") == "application/json" {
 		RenderJSON(w, e.Status, response)
 		return
 	}
 
+	if e.Status >= 400 && e.Template != nil {
+		err := e.renderTemplate(w, reqID)
+		if err == nil {
+			return
+		}
+		log.Error(ctx).Err(err).Msg("httputil: error executing custom error template")
+	}
+
 	m := map[string]any{
 		"canDebug":               response.CanDebug,
 		"description":            response.Description,
@@ -111,3 +148,41 @@ func (e *HTTPError) WithDescription(description string) *HTTPError {
 	e.Description = description
 	return e
 }
+
+func (e *HTTPError) problem(reqID string) *Problem {
+	problem := &Problem{
+		Title:       StatusText(e.Status),
+		Status:      e.Status,
+		Detail:      e.Description,
+		RequestID:   reqID,
+		Reasons:     e.Reasons,
+		Explanation: e.Explanation,
+		Remediation: e.Remediation,
+	}
+	if problem.Detail == "" && e.Err != nil && e.Err.Error() != problem.Title {
+		problem.Detail = e.Err.Error()
+	}
+	return problem
+}
+
+func (e *HTTPError) renderTemplate(w http.ResponseWriter, reqID string) error {
+	// execute the template before writing anything, so the built-in page can
+	// be used if it fails
+	var buf bytes.Buffer
+	err := e.Template.Execute(&buf, ErrorTemplateData{
+		Status:      e.Status,
+		StatusText:  StatusText(e.Status),
+		RequestID:   reqID,
+		Reasons:     e.Reasons,
+		Explanation: e.Explanation,
+		Remediation: e.Remediation,
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.WriteHeader(e.Status)
+	_, err = buf.WriteTo(w)
+	return err
+}
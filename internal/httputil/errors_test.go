@@ -2,11 +2,13 @@ package httputil
 
 import (
 	"errors"
+	"html/template"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestHTTPError_ErrorResponse(t *testing.T) {
@@ -50,6 +52,72 @@ func TestHTTPError_ErrorResponse(t *testing.T) {
 	}
 }
 
+func TestHTTPError_ErrorResponseProblemJSON(t *testing.T) {
+	e := &HTTPError{
+		Status:      http.StatusForbidden,
+		Err:         errors.New("not allowed"),
+		RequestID:   "REQUEST-ID",
+		Reasons:     []string{"email-unauthorized"},
+		Explanation: "only admins can access this route",
+	}
+
+	for _, tc := range []struct {
+		accept  string
+		problem bool
+	}{
+		{"application/problem+json", true},
+		{"application/problem+json, text/html;q=0.5", true},
+		{"text/html, application/problem+json;q=0.5", false},
+		{"application/json", false},
+		{"", false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", tc.accept)
+		w := httptest.NewRecorder()
+		e.ErrorResponse(r.Context(), w, r)
+		assert.Equal(t, tc.problem, w.Header().Get("Content-Type") == ProblemJSONContentType, "accept=%s", tc.accept)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "application/problem+json")
+	w := httptest.NewRecorder()
+	e.ErrorResponse(r.Context(), w, r)
+	assert.JSONEq(t, `{
+		"title": "Forbidden",
+		"status": 403,
+		"detail": "not allowed",
+		"request_id": "REQUEST-ID",
+		"reasons": ["email-unauthorized"],
+		"explanation": "only admins can access this route"
+	}`, w.Body.String())
+}
+
+func TestHTTPError_ErrorResponseTemplate(t *testing.T) {
+	e := &HTTPError{
+		Status:      http.StatusForbidden,
+		RequestID:   "REQUEST-ID",
+		Reasons:     []string{"email-unauthorized"},
+		Remediation: "<ask an admin>",
+		Template: template.Must(template.New("").Parse(
+			`{{.Status}} {{.StatusText}} {{.RequestID}} {{range .Reasons}}{{.}}{{end}} {{.Remediation}}`)),
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	e.ErrorResponse(r.Context(), w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "text/html; charset=UTF-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "403 Forbidden REQUEST-ID email-unauthorized &lt;ask an admin&gt;", w.Body.String())
+
+	t.Run("redirects use the built-in page", func(t *testing.T) {
+		e := *e
+		e.Status = http.StatusFound
+		w := httptest.NewRecorder()
+		e.ErrorResponse(r.Context(), w, r)
+		assert.NotContains(t, w.Body.String(), "REQUEST-ID email-unauthorized")
+	})
+}
+
 func TestNewError(t *testing.T) {
 	tests := []struct {
 		name    string
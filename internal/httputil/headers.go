@@ -32,6 +32,9 @@ const (
 	HeaderPomeriumReproxyPolicyHMAC = "x-pomerium-reproxy-policy-hmac"
 	// HeaderPomeriumRoutingKey is a string used for routing user requests to a consistent upstream server.
 	HeaderPomeriumRoutingKey = "x-pomerium-routing-key"
+	// HeaderPomeriumSignInURL is the url to sign in at, returned in the metadata of unauthenticated gRPC
+	// requests which can't be redirected.
+	HeaderPomeriumSignInURL = "x-pomerium-sign-in-url"
 )
 
 // HeadersContentSecurityPolicy are the content security headers added to the service's handlers
@@ -0,0 +1,55 @@
+package httputil
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tniswong/go.rfcx/rfc7231"
+)
+
+// ProblemJSONContentType is the content type of RFC 7807 problem details.
+const ProblemJSONContentType = "application/problem+json"
+
+// A Problem describes an error as RFC 7807 problem details. The type is
+// always omitted, which means "about:blank", so the title is the HTTP status
+// text.
+type Problem struct {
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+
+	// extension members
+	RequestID   string   `json:"request_id,omitempty"`
+	Reasons     []string `json:"reasons,omitempty"`
+	Explanation string   `json:"explanation,omitempty"`
+	Remediation string   `json:"remediation,omitempty"`
+}
+
+func renderProblemJSON(w http.ResponseWriter, problem *Problem) {
+	bs, err := json.Marshal(problem)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ProblemJSONContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	_, _ = w.Write(append(bs, '\n'))
+}
+
+// acceptsProblemJSON returns true if the client prefers problem details to the
+// other error formats.
+func acceptsProblemJSON(r *http.Request) bool {
+	accept, err := rfc7231.ParseAccept(r.Header.Get("Accept"))
+	if err != nil {
+		return false
+	}
+
+	mediaType, ok := accept.MostAcceptable([]string{
+		"text/html",
+		"application/json",
+		ProblemJSONContentType,
+	})
+	return ok && mediaType == ProblemJSONContentType
+}
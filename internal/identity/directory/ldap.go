@@ -0,0 +1,227 @@
+// Package directory enriches users with the groups they are a member of in an
+// external directory.
+package directory
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	go_ldap "github.com/go-ldap/ldap/v3"
+
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+const (
+	defaultLDAPUserFilter         = "(mail={email})"
+	defaultLDAPGroupFilter        = "(|(member={dn})(uniqueMember={dn}))"
+	defaultLDAPGroupNameAttribute = "cn"
+	defaultLDAPTimeout            = 30 * time.Second
+
+	// maxLDAPGroupDepth limits how deep nested groups are expanded.
+	maxLDAPGroupDepth = 10
+)
+
+// ErrAmbiguousUser is returned when the user filter matches more than one
+// entry.
+var ErrAmbiguousUser = errors.New("directory: user filter matched more than one entry")
+
+// LDAPOptions are the options for an LDAP directory.
+type LDAPOptions struct {
+	// URL is the url of the server, either ldap:// or ldaps://.
+	URL string
+	// StartTLS upgrades ldap:// connections to TLS.
+	StartTLS bool
+	// TLSConfig is used for ldaps:// and StartTLS connections.
+	TLSConfig *tls.Config
+
+	// BindDN and BindPassword are used to bind to the server. If no BindDN
+	// is set searches are made anonymously.
+	BindDN       string
+	BindPassword string
+
+	// UserSearchBase is the distinguished name under which users are searched.
+	UserSearchBase string
+	// UserFilter finds the entry of a user. {email}, {id} and {name} are
+	// replaced with the escaped attributes of the user.
+	UserFilter string
+
+	// GroupSearchBase is the distinguished name under which groups are
+	// searched. It defaults to the user search base.
+	GroupSearchBase string
+	// GroupFilter finds the groups a user or group is a direct member of.
+	// {dn} is replaced with the escaped distinguished name of the member.
+	GroupFilter string
+	// GroupNameAttribute is the attribute of a group returned as its name.
+	GroupNameAttribute string
+	// NestedGroups expands the groups a user is a member of to the groups
+	// those groups are members of.
+	NestedGroups bool
+
+	// Timeout is the maximum amount of time to wait for the server.
+	Timeout time.Duration
+}
+
+// An LDAP directory looks up the groups of users in an LDAP or Active
+// Directory server.
+type LDAP struct {
+	options LDAPOptions
+}
+
+// NewLDAP creates a new LDAP directory.
+func NewLDAP(options LDAPOptions) *LDAP {
+	if options.UserFilter == "" {
+		options.UserFilter = defaultLDAPUserFilter
+	}
+	if options.GroupSearchBase == "" {
+		options.GroupSearchBase = options.UserSearchBase
+	}
+	if options.GroupFilter == "" {
+		options.GroupFilter = defaultLDAPGroupFilter
+	}
+	if options.GroupNameAttribute == "" {
+		options.GroupNameAttribute = defaultLDAPGroupNameAttribute
+	}
+	if options.Timeout == 0 {
+		options.Timeout = defaultLDAPTimeout
+	}
+	return &LDAP{options: options}
+}
+
+// GetUserGroups returns the sorted names of the groups the user is a member
+// of. If the user is not found in the directory no groups are returned.
+func (l *LDAP) GetUserGroups(ctx context.Context, u *user.User) ([]string, error) {
+	conn, err := l.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// the connection is closed when the context is canceled, which aborts
+	// any pending request
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	userDN, err := l.findUser(conn, u)
+	if err != nil || userDN == "" {
+		return nil, err
+	}
+
+	seen := map[string]bool{userDN: true}
+	names := map[string]struct{}{}
+	members := []string{userDN}
+	for depth := 0; len(members) > 0 && depth < maxLDAPGroupDepth; depth++ {
+		var next []string
+		for _, member := range members {
+			res, err := conn.Search(l.newSearchRequest(l.options.GroupSearchBase,
+				replaceFilterVars(l.options.GroupFilter, map[string]string{"dn": member}),
+				0, []string{l.options.GroupNameAttribute}))
+			if err != nil {
+				return nil, fmt.Errorf("directory: error searching ldap groups: %w", err)
+			}
+			for _, entry := range res.Entries {
+				if name := entry.GetAttributeValue(l.options.GroupNameAttribute); name != "" {
+					names[name] = struct{}{}
+				}
+				if !seen[entry.DN] {
+					seen[entry.DN] = true
+					next = append(next, entry.DN)
+				}
+			}
+		}
+		if !l.options.NestedGroups {
+			break
+		}
+		members = next
+	}
+
+	groups := make([]string, 0, len(names))
+	for name := range names {
+		groups = append(groups, name)
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+func (l *LDAP) connect(ctx context.Context) (*go_ldap.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	conn, err := go_ldap.DialURL(l.options.URL,
+		go_ldap.DialWithDialer(&net.Dialer{Timeout: l.options.Timeout}),
+		go_ldap.DialWithTLSConfig(l.options.TLSConfig))
+	if err != nil {
+		return nil, fmt.Errorf("directory: error connecting to ldap server: %w", err)
+	}
+	conn.SetTimeout(l.options.Timeout)
+
+	if l.options.StartTLS {
+		if err := conn.StartTLS(l.options.TLSConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("directory: error starting tls: %w", err)
+		}
+	}
+
+	if l.options.BindDN != "" {
+		if err := conn.Bind(l.options.BindDN, l.options.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("directory: error binding to ldap server: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+func (l *LDAP) findUser(conn *go_ldap.Conn, u *user.User) (string, error) {
+	filter := replaceFilterVars(l.options.UserFilter, map[string]string{
+		"email": u.GetEmail(),
+		"id":    u.GetId(),
+		"name":  u.GetName(),
+	})
+	res, err := conn.Search(l.newSearchRequest(l.options.UserSearchBase, filter, 2, []string{"dn"}))
+	if err != nil {
+		if go_ldap.IsErrorWithCode(err, go_ldap.LDAPResultSizeLimitExceeded) {
+			return "", ErrAmbiguousUser
+		}
+		return "", fmt.Errorf("directory: error searching ldap user: %w", err)
+	}
+
+	switch len(res.Entries) {
+	case 0:
+		return "", nil
+	case 1:
+		return res.Entries[0].DN, nil
+	default:
+		return "", ErrAmbiguousUser
+	}
+}
+
+func (l *LDAP) newSearchRequest(baseDN, filter string, sizeLimit int, attributes []string) *go_ldap.SearchRequest {
+	return go_ldap.NewSearchRequest(baseDN,
+		go_ldap.ScopeWholeSubtree, go_ldap.NeverDerefAliases,
+		sizeLimit, int(l.options.Timeout/time.Second), false,
+		filter, attributes, nil)
+}
+
+// replaceFilterVars replaces the {name} variables in an LDAP filter with the
+// escaped values.
+func replaceFilterVars(filter string, vars map[string]string) string {
+	oldnew := make([]string, 0, len(vars)*2)
+	for k, v := range vars {
+		oldnew = append(oldnew, "{"+k+"}", go_ldap.EscapeFilter(v))
+	}
+	return strings.NewReplacer(oldnew...).Replace(filter)
+}
@@ -0,0 +1,189 @@
+package directory
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	go_ldap "github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+type testLDAPEntry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+// testLDAPServer is an in-process stand-in for an LDAP server, which answers
+// searches with the entries registered for the exact search filter.
+type testLDAPServer struct {
+	bindDN       string
+	bindPassword string
+	entries      map[string][]testLDAPEntry
+}
+
+func (srv *testLDAPServer) start(t *testing.T) string {
+	t.Helper()
+
+	li, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = li.Close() })
+
+	go func() {
+		for {
+			conn, err := li.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+
+	return "ldap://" + li.Addr().String()
+}
+
+func (srv *testLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		req, err := ber.ReadPacket(conn)
+		if err != nil || len(req.Children) < 2 {
+			return
+		}
+		id, _ := req.Children[0].Value.(int64)
+		op := req.Children[1]
+
+		switch op.Tag {
+		case go_ldap.ApplicationBindRequest:
+			code := go_ldap.LDAPResultSuccess
+			if op.Children[1].Data.String() != srv.bindDN || op.Children[2].Data.String() != srv.bindPassword {
+				code = go_ldap.LDAPResultInvalidCredentials
+			}
+			_, _ = conn.Write(newTestLDAPMessage(id, newTestLDAPResult(go_ldap.ApplicationBindResponse, code)))
+		case go_ldap.ApplicationSearchRequest:
+			filter, err := go_ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				return
+			}
+			for _, entry := range srv.entries[filter] {
+				_, _ = conn.Write(newTestLDAPMessage(id, newTestLDAPSearchResultEntry(entry)))
+			}
+			_, _ = conn.Write(newTestLDAPMessage(id, newTestLDAPResult(go_ldap.ApplicationSearchResultDone, go_ldap.LDAPResultSuccess)))
+		default:
+			return
+		}
+	}
+}
+
+func newTestLDAPMessage(id int64, op *ber.Packet) []byte {
+	p := ber.NewSequence("LDAP Message")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	p.AppendChild(op)
+	return p.Bytes()
+}
+
+func newTestLDAPResult(tag, code int) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ber.Tag(tag), nil, "Result")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return p
+}
+
+func newTestLDAPSearchResultEntry(entry testLDAPEntry) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, go_ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "DN"))
+	attributes := ber.NewSequence("Attributes")
+	for name, values := range entry.attributes {
+		attribute := ber.NewSequence("Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	p.AppendChild(attributes)
+	return p
+}
+
+func TestLDAP_GetUserGroups(t *testing.T) {
+	t.Parallel()
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	t.Cleanup(clearTimeout)
+
+	const (
+		aliceDN       = "uid=alice,ou=users,dc=example,dc=com"
+		engineeringDN = "cn=engineering,ou=groups,dc=example,dc=com"
+		staffDN       = "cn=staff,ou=groups,dc=example,dc=com"
+	)
+	srv := &testLDAPServer{
+		bindDN:       "cn=pomerium,dc=example,dc=com",
+		bindPassword: "PASSWORD",
+		entries: map[string][]testLDAPEntry{
+			"(mail=alice@example.com)": {{dn: aliceDN}},
+			"(mail=bob@example.com)":   {{dn: "uid=bob,ou=users,dc=example,dc=com"}, {dn: "uid=bob2,ou=users,dc=example,dc=com"}},
+			"(member=" + aliceDN + ")": {
+				{dn: engineeringDN, attributes: map[string][]string{"cn": {"engineering"}}},
+			},
+			"(member=" + engineeringDN + ")": {
+				{dn: staffDN, attributes: map[string][]string{"cn": {"staff"}}},
+			},
+			// a membership cycle must not be followed forever
+			"(member=" + staffDN + ")": {
+				{dn: engineeringDN, attributes: map[string][]string{"cn": {"engineering"}}},
+			},
+		},
+	}
+	url := srv.start(t)
+
+	newLDAP := func(nestedGroups bool, bindPassword string) *LDAP {
+		return NewLDAP(LDAPOptions{
+			URL:            url,
+			BindDN:         "cn=pomerium,dc=example,dc=com",
+			BindPassword:   bindPassword,
+			UserSearchBase: "ou=users,dc=example,dc=com",
+			GroupFilter:    "(member={dn})",
+			NestedGroups:   nestedGroups,
+			Timeout:        5 * time.Second,
+		})
+	}
+
+	t.Run("nested", func(t *testing.T) {
+		groups, err := newLDAP(true, "PASSWORD").GetUserGroups(ctx, &user.User{Id: "u1", Email: "alice@example.com"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"engineering", "staff"}, groups)
+	})
+	t.Run("direct", func(t *testing.T) {
+		groups, err := newLDAP(false, "PASSWORD").GetUserGroups(ctx, &user.User{Id: "u1", Email: "alice@example.com"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"engineering"}, groups)
+	})
+	t.Run("unknown user", func(t *testing.T) {
+		groups, err := newLDAP(true, "PASSWORD").GetUserGroups(ctx, &user.User{Id: "u2", Email: "carol@example.com"})
+		assert.NoError(t, err)
+		assert.Empty(t, groups)
+	})
+	t.Run("ambiguous user", func(t *testing.T) {
+		_, err := newLDAP(true, "PASSWORD").GetUserGroups(ctx, &user.User{Id: "u3", Email: "bob@example.com"})
+		assert.ErrorIs(t, err, ErrAmbiguousUser)
+	})
+	t.Run("invalid credentials", func(t *testing.T) {
+		_, err := newLDAP(true, "WRONG").GetUserGroups(ctx, &user.User{Id: "u1", Email: "alice@example.com"})
+		assert.ErrorContains(t, err, "error binding to ldap server")
+	})
+}
+
+func TestReplaceFilterVars(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, `(&(objectClass=person)(mail=a\2a\28b\29@example.com))`,
+		replaceFilterVars("(&(objectClass=person)(mail={email}))", map[string]string{"email": "a*(b)@example.com"}))
+}
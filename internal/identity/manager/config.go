@@ -5,6 +5,7 @@ import (
 
 	"github.com/pomerium/pomerium/internal/events"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
 )
 
 var (
@@ -14,6 +15,8 @@ var (
 
 type config struct {
 	authenticator                 Authenticator
+	idpAuthenticators             map[string]Authenticator
+	directory                     Directory
 	dataBrokerClient              databroker.DataBrokerServiceClient
 	sessionRefreshGracePeriod     time.Duration
 	sessionRefreshCoolOffDuration time.Duration
@@ -42,6 +45,24 @@ func WithAuthenticator(authenticator Authenticator) Option {
 	}
 }
 
+// WithIdentityProviderAuthenticator sets the authenticator used for the
+// sessions of the named identity provider in the config.
+func WithIdentityProviderAuthenticator(idpID string, authenticator Authenticator) Option {
+	return func(cfg *config) {
+		if cfg.idpAuthenticators == nil {
+			cfg.idpAuthenticators = make(map[string]Authenticator)
+		}
+		cfg.idpAuthenticators[idpID] = authenticator
+	}
+}
+
+// WithDirectory sets the directory used to enrich users with groups in the config.
+func WithDirectory(directory Directory) Option {
+	return func(cfg *config) {
+		cfg.directory = directory
+	}
+}
+
 // WithDataBrokerClient sets the databroker client in the config.
 func WithDataBrokerClient(dataBrokerClient databroker.DataBrokerServiceClient) Option {
 	return func(cfg *config) {
@@ -76,3 +97,12 @@ func WithEventManager(mgr *events.Manager) Option {
 		c.eventMgr = mgr
 	}
 }
+
+// getAuthenticator gets the authenticator for the identity provider the
+// session was created with, falling back to the default authenticator.
+func (cfg *config) getAuthenticator(s *session.Session) Authenticator {
+	if authenticator, ok := cfg.idpAuthenticators[s.GetIdentityProviderID()]; ok {
+		return authenticator
+	}
+	return cfg.authenticator
+}
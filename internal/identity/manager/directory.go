@@ -0,0 +1,155 @@
+package manager
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/slices"
+)
+
+const (
+	groupsClaim = "groups"
+	// directoryGroupsClaim records the groups merged from the directory, so
+	// that they can be removed again when the user leaves them.
+	directoryGroupsClaim = "directory_groups"
+)
+
+// getDirectoryGroups gets the groups of the user from the directory. If no
+// directory is configured, or the lookup fails, false is returned and the
+// user claims are left unchanged.
+func (mgr *Manager) getDirectoryGroups(ctx context.Context, u *user.User) ([]string, bool) {
+	directory := mgr.cfg.Load().directory
+	if directory == nil {
+		return nil, false
+	}
+
+	groups, err := directory.GetUserGroups(ctx, u)
+	if err != nil {
+		log.Error(ctx).Err(err).
+			Str("user_id", u.GetId()).
+			Msg("failed to get user groups from directory")
+		return nil, false
+	}
+	return groups, true
+}
+
+// updateDirectoryGroupsForSignIn enriches the user of a newly signed in
+// session with the groups from the directory, so that they're available right
+// away rather than after the user is next refreshed.
+func (mgr *Manager) updateDirectoryGroupsForSignIn(ctx context.Context, s *session.Session) {
+	cfg := mgr.cfg.Load()
+	if cfg.directory == nil {
+		return
+	}
+
+	u, err := user.Get(ctx, cfg.dataBrokerClient, s.GetUserId())
+	if err != nil {
+		log.Error(ctx).Err(err).
+			Str("user_id", s.GetUserId()).
+			Str("session_id", s.GetId()).
+			Msg("failed to get user for directory groups")
+		return
+	}
+
+	directoryGroups, ok := mgr.getDirectoryGroups(ctx, u)
+	if !ok {
+		return
+	}
+	// the session has the claims supplied by the identity provider on sign
+	// in, so groups it supplied are kept even if they were previously merged
+	// from the directory
+	removeDirectoryGroups(u, getStrings(s.GetClaims()[groupsClaim]))
+	addDirectoryGroups(u, directoryGroups)
+
+	res, err := databroker.Put(ctx, cfg.dataBrokerClient, u)
+	if err != nil {
+		log.Error(ctx).Err(err).
+			Str("user_id", s.GetUserId()).
+			Str("session_id", s.GetId()).
+			Msg("failed to update user")
+		return
+	}
+
+	mgr.onUpdateUser(ctx, res.GetRecords()[0], u)
+}
+
+// removeDirectoryGroups removes the groups previously merged from the
+// directory from the groups claim of the user, except for the groups which
+// are kept because the identity provider also supplied them.
+func removeDirectoryGroups(u *user.User, keep []string) {
+	previous := getClaimStrings(u, directoryGroupsClaim)
+	delete(u.Claims, directoryGroupsClaim)
+	if len(previous) == 0 {
+		return
+	}
+
+	lv, ok := u.GetClaims()[groupsClaim]
+	if !ok {
+		return
+	}
+	var values []*structpb.Value
+	for _, v := range lv.GetValues() {
+		if !slices.Contains(previous, v.GetStringValue()) || slices.Contains(keep, v.GetStringValue()) {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		delete(u.Claims, groupsClaim)
+		return
+	}
+	u.Claims[groupsClaim] = &structpb.ListValue{Values: values}
+}
+
+// addDirectoryGroups merges the groups from the directory into the groups
+// claim of the user. Only the groups which weren't already in the claim are
+// recorded as merged from the directory, so that groups supplied by the
+// identity provider aren't removed again.
+func addDirectoryGroups(u *user.User, directoryGroups []string) {
+	existing := getClaimStrings(u, groupsClaim)
+	var added []string
+	for _, group := range directoryGroups {
+		if !slices.Contains(existing, group) && !slices.Contains(added, group) {
+			added = append(added, group)
+		}
+	}
+	if len(added) == 0 {
+		return
+	}
+
+	if u.Claims == nil {
+		u.Claims = make(map[string]*structpb.ListValue)
+	}
+	lv := &structpb.ListValue{Values: append([]*structpb.Value(nil), u.Claims[groupsClaim].GetValues()...)}
+	for _, group := range added {
+		lv.Values = append(lv.Values, structpb.NewStringValue(group))
+	}
+	u.Claims[groupsClaim] = lv
+	u.Claims[directoryGroupsClaim] = newStringListValue(added)
+}
+
+func getClaimStrings(u *user.User, claim string) []string {
+	return getStrings(u.GetClaims()[claim])
+}
+
+func getStrings(lv *structpb.ListValue) []string {
+	var vs []string
+	for _, v := range lv.GetValues() {
+		if s, ok := v.GetKind().(*structpb.Value_StringValue); ok {
+			vs = append(vs, s.StringValue)
+		}
+	}
+	return vs
+}
+
+func newStringListValue(vs []string) *structpb.ListValue {
+	lv := &structpb.ListValue{Values: make([]*structpb.Value, 0, len(vs))}
+	for _, v := range vs {
+		lv.Values = append(lv.Values, structpb.NewStringValue(v))
+	}
+	return lv
+}
@@ -12,6 +12,7 @@ import (
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/pomerium/pomerium/internal/atomicutil"
@@ -34,6 +35,11 @@ type Authenticator interface {
 	UpdateUserInfo(context.Context, *oauth2.Token, interface{}) error
 }
 
+// A Directory looks up the groups users are a member of in an external directory.
+type Directory interface {
+	GetUserGroups(context.Context, *user.User) ([]string, error)
+}
+
 type (
 	updateRecordsMessage struct {
 		records []*databroker.Record
@@ -49,6 +55,7 @@ type Manager struct {
 
 	sessions sessionCollection
 	users    userCollection
+	resetAt  time.Time
 }
 
 // New creates a new identity manager.
@@ -61,8 +68,8 @@ func New(
 		sessionScheduler: scheduler.New(),
 		userScheduler:    scheduler.New(),
 	}
-	mgr.reset()
 	mgr.UpdateConfig(options...)
+	mgr.reset()
 	return mgr
 }
 
@@ -187,22 +194,22 @@ func (mgr *Manager) refreshSession(ctx context.Context, userID, sessionID string
 		Str("session_id", sessionID).
 		Msg("refreshing session")
 
-	authenticator := mgr.cfg.Load().authenticator
-	if authenticator == nil {
-		log.Info(ctx).
+	s, ok := mgr.sessions.Get(userID, sessionID)
+	if !ok {
+		log.Warn(ctx).
 			Str("user_id", userID).
 			Str("session_id", sessionID).
-			Msg("no authenticator defined, deleting session")
-		mgr.deleteSession(ctx, userID, sessionID)
+			Msg("no session found for refresh")
 		return
 	}
 
-	s, ok := mgr.sessions.Get(userID, sessionID)
-	if !ok {
-		log.Warn(ctx).
+	authenticator := mgr.cfg.Load().getAuthenticator(s.Session)
+	if authenticator == nil {
+		log.Info(ctx).
 			Str("user_id", userID).
 			Str("session_id", sessionID).
-			Msg("no session found for refresh")
+			Msg("no authenticator defined, deleting session")
+		mgr.deleteSession(ctx, userID, sessionID)
 		return
 	}
 
@@ -278,8 +285,7 @@ func (mgr *Manager) refreshUser(ctx context.Context, userID string) {
 		Str("user_id", userID).
 		Msg("refreshing user")
 
-	authenticator := mgr.cfg.Load().authenticator
-	if authenticator == nil {
+	if cfg := mgr.cfg.Load(); cfg.authenticator == nil && len(cfg.idpAuthenticators) == 0 {
 		return
 	}
 
@@ -293,6 +299,8 @@ func (mgr *Manager) refreshUser(ctx context.Context, userID string) {
 	u.lastRefresh = time.Now()
 	mgr.userScheduler.Add(u.NextRefresh(), u.GetId())
 
+	directoryGroups, hasDirectoryGroups := mgr.getDirectoryGroups(ctx, u.User)
+
 	for _, s := range mgr.sessions.GetSessionsForUser(userID) {
 		if s.Session == nil || s.Session.OauthToken == nil {
 			log.Warn(ctx).
@@ -301,6 +309,14 @@ func (mgr *Manager) refreshUser(ctx context.Context, userID string) {
 			continue
 		}
 
+		authenticator := mgr.cfg.Load().getAuthenticator(s.Session)
+		if authenticator == nil {
+			continue
+		}
+
+		if hasDirectoryGroups {
+			removeDirectoryGroups(u.User, nil)
+		}
 		err := authenticator.UpdateUserInfo(ctx, FromOAuthToken(s.OauthToken), &u)
 		metrics.RecordIdentityManagerUserRefresh(ctx, err)
 		mgr.recordLastError(metrics_ids.IdentityManagerLastUserRefreshError, err)
@@ -318,6 +334,9 @@ func (mgr *Manager) refreshUser(ctx context.Context, userID string) {
 			mgr.deleteSession(ctx, userID, s.GetId())
 			continue
 		}
+		if hasDirectoryGroups {
+			addDirectoryGroups(u.User, directoryGroups)
+		}
 
 		res, err := databroker.Put(ctx, mgr.cfg.Load().dataBrokerClient, u.User)
 		if err != nil {
@@ -333,6 +352,7 @@ func (mgr *Manager) refreshUser(ctx context.Context, userID string) {
 }
 
 func (mgr *Manager) onUpdateRecords(ctx context.Context, msg updateRecordsMessage) {
+	var signIns []*session.Session
 	for _, record := range msg.records {
 		switch record.GetType() {
 		case grpcutil.GetTypeURL(new(session.Session)):
@@ -342,6 +362,9 @@ func (mgr *Manager) onUpdateRecords(ctx context.Context, msg updateRecordsMessag
 				log.Warn(ctx).Msgf("error unmarshaling session: %s", err)
 				continue
 			}
+			if record.GetDeletedAt() == nil && mgr.isSignIn(&pbSession) {
+				signIns = append(signIns, &pbSession)
+			}
 			mgr.onUpdateSession(ctx, record, &pbSession)
 		case grpcutil.GetTypeURL(new(user.User)):
 			var pbUser user.User
@@ -353,6 +376,24 @@ func (mgr *Manager) onUpdateRecords(ctx context.Context, msg updateRecordsMessag
 			mgr.onUpdateUser(ctx, record, &pbUser)
 		}
 	}
+
+	// the user is updated after all the records are handled, as the user
+	// record of the sign in may come after the session record
+	for _, s := range signIns {
+		mgr.updateDirectoryGroupsForSignIn(ctx, s)
+	}
+}
+
+// isSignIn returns true if the session was issued since the manager was last
+// reset and hasn't been seen before, which means the user just signed in.
+// Sessions seen when syncing all the records aren't sign ins, so that the
+// users of all the existing sessions aren't updated at once.
+func (mgr *Manager) isSignIn(s *session.Session) bool {
+	if s.GetIssuedAt() == nil || !s.GetIssuedAt().AsTime().After(mgr.resetAt) {
+		return false
+	}
+	previous, ok := mgr.sessions.Get(s.GetUserId(), s.GetId())
+	return !ok || !proto.Equal(previous.GetIssuedAt(), s.GetIssuedAt())
 }
 
 func (mgr *Manager) onUpdateSession(_ context.Context, record *databroker.Record, session *session.Session) {
@@ -422,6 +463,7 @@ func (mgr *Manager) deleteSession(ctx context.Context, userID, sessionID string)
 
 // reset resets all the manager datastructures to their initial state
 func (mgr *Manager) reset() {
+	mgr.resetAt = mgr.cfg.Load().now()
 	mgr.sessions = sessionCollection{BTree: btree.New(8)}
 	mgr.users = userCollection{BTree: btree.New(8)}
 }
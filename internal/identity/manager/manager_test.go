@@ -9,12 +9,14 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/oauth2"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/pomerium/pomerium/internal/events"
+	identityclaims "github.com/pomerium/pomerium/internal/identity"
 	"github.com/pomerium/pomerium/internal/identity/identity"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker/mock_databroker"
@@ -159,6 +161,129 @@ func TestManager_reportErrors(t *testing.T) {
 	expectMsg(metrics_ids.IdentityManagerLastSessionRefreshError, "update session")
 }
 
+type userInfoAuthenticator struct {
+	mockAuthenticator
+}
+
+func (userInfoAuthenticator) UpdateUserInfo(_ context.Context, _ *oauth2.Token, _ any) error {
+	return nil
+}
+
+type mockDirectory map[string][]string
+
+func (mock mockDirectory) GetUserGroups(_ context.Context, u *user.User) ([]string, error) {
+	return mock[u.GetEmail()], nil
+}
+
+func TestManager_refreshUserDirectory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	s := &session.Session{
+		Id:     "session1",
+		UserId: "user1",
+		OauthToken: &session.OAuthToken{
+			ExpiresAt: timestamppb.New(time.Now().Add(time.Hour)),
+		},
+		ExpiresAt: timestamppb.New(time.Now().Add(time.Hour)),
+	}
+	u := &user.User{Id: "user1", Name: "user 1", Email: "user1@example.com"}
+	u.AddClaims(identityclaims.FlattenedClaims{
+		"groups":           {"idp-group", "former-group"},
+		"directory_groups": {"former-group"},
+	})
+
+	var put *user.User
+	client := mock_databroker.NewMockDataBrokerServiceClient(ctrl)
+	client.EXPECT().Put(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, req *databroker.PutRequest, _ ...grpc.CallOption) (*databroker.PutResponse, error) {
+			put = new(user.User)
+			assert.NoError(t, req.GetRecords()[0].GetData().UnmarshalTo(put))
+			return &databroker.PutResponse{Records: req.GetRecords()}, nil
+		})
+	mgr := New(
+		WithDataBrokerClient(client),
+		WithAuthenticator(userInfoAuthenticator{}),
+		WithDirectory(mockDirectory{"user1@example.com": {"engineering", "idp-group"}}),
+	)
+	mgr.onUpdateRecords(ctx, updateRecordsMessage{
+		records: []*databroker.Record{
+			mkRecord(s),
+			mkRecord(u),
+		},
+	})
+
+	mgr.refreshUser(ctx, "user1")
+	if assert.NotNil(t, put) {
+		assert.Equal(t, []any{"idp-group", "engineering"}, put.GetClaim("groups"))
+		assert.Equal(t, []any{"engineering"}, put.GetClaim("directory_groups"),
+			"should only record the groups which the identity provider didn't supply")
+	}
+}
+
+func TestManager_signInDirectory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	s := &session.Session{
+		Id:     "session1",
+		UserId: "user1",
+		OauthToken: &session.OAuthToken{
+			ExpiresAt: timestamppb.New(time.Now().Add(time.Hour)),
+		},
+		IssuedAt:  timestamppb.Now(),
+		ExpiresAt: timestamppb.New(time.Now().Add(time.Hour)),
+	}
+	s.AddClaims(identityclaims.FlattenedClaims{
+		"groups": {"idp-group", "shared-group"},
+	})
+	// the groups claim was replaced on sign in, but the directory groups
+	// claim is left over from before
+	u := &user.User{Id: "user1", Name: "user 1", Email: "user1@example.com"}
+	u.AddClaims(identityclaims.FlattenedClaims{
+		"groups":           {"idp-group", "shared-group"},
+		"directory_groups": {"shared-group", "former-group"},
+	})
+
+	var put *user.User
+	client := mock_databroker.NewMockDataBrokerServiceClient(ctrl)
+	client.EXPECT().Get(gomock.Any(), gomock.Any()).Return(&databroker.GetResponse{Record: mkRecord(u)}, nil)
+	client.EXPECT().Put(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, req *databroker.PutRequest, _ ...grpc.CallOption) (*databroker.PutResponse, error) {
+			put = new(user.User)
+			assert.NoError(t, req.GetRecords()[0].GetData().UnmarshalTo(put))
+			return &databroker.PutResponse{Records: req.GetRecords()}, nil
+		})
+	mgr := New(
+		WithDataBrokerClient(client),
+		WithAuthenticator(userInfoAuthenticator{}),
+		WithDirectory(mockDirectory{"user1@example.com": {"engineering"}}),
+		WithNow(func() time.Time { return s.GetIssuedAt().AsTime().Add(-time.Second) }),
+	)
+	mgr.onUpdateRecords(ctx, updateRecordsMessage{
+		records: []*databroker.Record{
+			mkRecord(s),
+			mkRecord(u),
+		},
+	})
+	if assert.NotNil(t, put) {
+		assert.Equal(t, []any{"idp-group", "shared-group", "engineering"}, put.GetClaim("groups"),
+			"should keep the groups supplied by the identity provider")
+		assert.Equal(t, []any{"engineering"}, put.GetClaim("directory_groups"))
+	}
+
+	// seeing the same session again isn't a sign in
+	mgr.onUpdateRecords(ctx, updateRecordsMessage{
+		records: []*databroker.Record{
+			mkRecord(s),
+		},
+	})
+}
+
 func mkRecord(msg recordable) *databroker.Record {
 	any := protoutil.NewAny(msg)
 	return &databroker.Record{
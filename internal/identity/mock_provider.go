@@ -23,7 +23,7 @@ type MockProvider struct {
 }
 
 // Authenticate is a mocked providers function.
-func (mp MockProvider) Authenticate(context.Context, string, identity.State) (*oauth2.Token, error) {
+func (mp MockProvider) Authenticate(context.Context, string, identity.State, ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
 	return &mp.AuthenticateResponse, mp.AuthenticateError
 }
 
@@ -38,7 +38,9 @@ func (mp MockProvider) Revoke(ctx context.Context, s *oauth2.Token) error {
 }
 
 // GetSignInURL is a mocked providers function.
-func (mp MockProvider) GetSignInURL(s string) (string, error) { return mp.GetSignInURLResponse, nil }
+func (mp MockProvider) GetSignInURL(ctx context.Context, s string, opts ...oauth2.AuthCodeOption) (string, error) {
+	return mp.GetSignInURLResponse, nil
+}
 
 // LogOut is a mocked providers function.
 func (mp MockProvider) LogOut() (*url.URL, error) { return &mp.LogOutResponse, mp.LogOutError }
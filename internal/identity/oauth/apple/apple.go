@@ -93,11 +93,15 @@ func (p *Provider) Name() string {
 // always provide a non-empty string and validate that it matches the
 // the state query parameter on your redirect callback.
 // See http://tools.ietf.org/html/rfc6749#section-10.12 for more info.
-func (p *Provider) GetSignInURL(state string) (string, error) {
+//
+// Any additional options are added to the URL after the configured auth code
+// options.
+func (p *Provider) GetSignInURL(_ context.Context, state string, additionalOpts ...oauth2.AuthCodeOption) (string, error) {
 	opts := []oauth2.AuthCodeOption{}
 	for k, v := range p.authCodeOptions {
 		opts = append(opts, oauth2.SetAuthURLParam(k, v))
 	}
+	opts = append(opts, additionalOpts...)
 	authURL := p.oauth.AuthCodeURL(state, opts...)
 
 	// Apple is very picky here and we need to use %20 instead of +
@@ -107,9 +111,10 @@ func (p *Provider) GetSignInURL(state string) (string, error) {
 }
 
 // Authenticate converts an authorization code returned from the identity
-// provider into a token which is then converted into a user session.
-func (p *Provider) Authenticate(ctx context.Context, code string, v identity.State) (*oauth2.Token, error) {
-	oauth2Token, err := p.oauth.Exchange(ctx, code)
+// provider into a token which is then converted into a user session. Any
+// additional options are added to the token request.
+func (p *Provider) Authenticate(ctx context.Context, code string, v identity.State, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	oauth2Token, err := p.oauth.Exchange(ctx, code, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("identity/apple: token exchange failed: %w", err)
 	}
@@ -89,8 +89,8 @@ func New(ctx context.Context, o *oauth.Options) (*Provider, error) {
 
 // Authenticate creates an identity session with github from a authorization code, and follows up
 // call to the user and user group endpoint with the
-func (p *Provider) Authenticate(ctx context.Context, code string, v identity.State) (*oauth2.Token, error) {
-	oauth2Token, err := p.Oauth.Exchange(ctx, code)
+func (p *Provider) Authenticate(ctx context.Context, code string, v identity.State, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	oauth2Token, err := p.Oauth.Exchange(ctx, code, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("github: token exchange failed %v", err)
 	}
@@ -240,9 +240,10 @@ func (p *Provider) Revoke(ctx context.Context, token *oauth2.Token) error {
 }
 
 // GetSignInURL returns a URL to OAuth 2.0 provider's consent page
-// that asks for permissions for the required scopes explicitly.
-func (p *Provider) GetSignInURL(state string) (string, error) {
-	return p.Oauth.AuthCodeURL(state, oauth2.AccessTypeOffline), nil
+// that asks for permissions for the required scopes explicitly. Any additional
+// options are added to the URL.
+func (p *Provider) GetSignInURL(_ context.Context, state string, opts ...oauth2.AuthCodeOption) (string, error) {
+	return p.Oauth.AuthCodeURL(state, append([]oauth2.AuthCodeOption{oauth2.AccessTypeOffline}, opts...)...), nil
 }
 
 // LogOut is not implemented by github.
@@ -29,4 +29,11 @@ type Options struct {
 	// AuthCodeOptions specifies additional key value pairs query params to add
 	// to the request flow signin url.
 	AuthCodeOptions map[string]string
+
+	// AllowSHA1Signatures allows SAML responses signed with SHA-1.
+	AllowSHA1Signatures bool
+
+	// DisablePKCE stops sending PKCE code challenges, for identity providers
+	// which reject them.
+	DisablePKCE bool
 }
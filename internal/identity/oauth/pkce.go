@@ -0,0 +1,48 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"golang.org/x/oauth2"
+)
+
+// NewCodeVerifier returns a new random PKCE code verifier, made of 32 octets
+// of random data encoded as url safe base64.
+//
+// https://tools.ietf.org/html/rfc7636#section-4.1
+func NewCodeVerifier() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// S256ChallengeOption returns the auth code options to add an S256 PKCE code
+// challenge derived from the verifier to the authorization request.
+//
+// https://tools.ietf.org/html/rfc7636#section-4.3
+func S256ChallengeOption(verifier string) []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+		oauth2.SetAuthURLParam("code_challenge", S256Challenge(verifier)),
+	}
+}
+
+// S256Challenge returns the S256 PKCE code challenge for the verifier.
+//
+// https://tools.ietf.org/html/rfc7636#section-4.2
+func S256Challenge(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// VerifierOption returns the auth code option to send the PKCE code verifier
+// in the token request.
+//
+// https://tools.ietf.org/html/rfc7636#section-4.5
+func VerifierOption(verifier string) oauth2.AuthCodeOption {
+	return oauth2.SetAuthURLParam("code_verifier", verifier)
+}
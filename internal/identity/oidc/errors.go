@@ -26,3 +26,7 @@ var ErrMissingRefreshToken = errors.New("identity/oidc: missing refresh token")
 
 // ErrMissingAccessToken is returned when no access token was found.
 var ErrMissingAccessToken = errors.New("identity/oidc: missing access token")
+
+// ErrMissingRequestURI is returned when a pushed authorization request
+// response does not include a request uri.
+var ErrMissingRequestURI = errors.New("identity/oidc: missing request_uri")
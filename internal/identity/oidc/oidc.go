@@ -44,6 +44,12 @@ type Provider struct {
 	// https://openid.net/specs/openid-connect-frontchannel-1_0.html#RPInitiated
 	EndSessionURL string `json:"end_session_endpoint,omitempty"`
 
+	// PushedAuthorizationRequestURL is the location of the pushed
+	// authorization request endpoint. If set, sign in requests are pushed to
+	// the identity provider rather than sent in the sign in url.
+	// https://tools.ietf.org/html/rfc9126
+	PushedAuthorizationRequestURL string `json:"pushed_authorization_request_endpoint,omitempty"`
+
 	// AuthCodeOptions specifies additional key value pairs query params to add
 	// to the request flow signin url.
 	AuthCodeOptions map[string]string
@@ -103,29 +109,45 @@ func New(ctx context.Context, o *oauth.Options, options ...Option) (*Provider, e
 // always provide a non-empty string and validate that it matches the
 // the state query parameter on your redirect callback.
 // See http://tools.ietf.org/html/rfc6749#section-10.12 for more info.
-func (p *Provider) GetSignInURL(state string) (string, error) {
+//
+// Any additional options, such as the prompt, max_age, acr_values or PKCE code
+// challenge parameters, are added to the URL after the configured auth code
+// options.
+//
+// If the identity provider advertises a pushed authorization request endpoint
+// in its discovery document, the parameters are pushed to it and the returned
+// URL only contains the client id and the request uri.
+func (p *Provider) GetSignInURL(ctx context.Context, state string, additionalOpts ...oauth2.AuthCodeOption) (string, error) {
 	oa, err := p.GetOauthConfig()
 	if err != nil {
 		return "", err
 	}
 
-	opts := defaultAuthCodeOptions
+	opts := append([]oauth2.AuthCodeOption{}, defaultAuthCodeOptions...)
 	for k, v := range p.AuthCodeOptions {
 		opts = append(opts, oauth2.SetAuthURLParam(k, v))
 	}
-	return oa.AuthCodeURL(state, opts...), nil
+	opts = append(opts, additionalOpts...)
+	signInURL := oa.AuthCodeURL(state, opts...)
+	if p.PushedAuthorizationRequestURL == "" {
+		return signInURL, nil
+	}
+	return p.pushAuthorizationRequest(ctx, oa, signInURL)
 }
 
 // Authenticate converts an authorization code returned from the identity
 // provider into a token which is then converted into a user session.
-func (p *Provider) Authenticate(ctx context.Context, code string, v identity.State) (*oauth2.Token, error) {
+//
+// Any additional options, such as the PKCE code verifier, are added to the
+// token request.
+func (p *Provider) Authenticate(ctx context.Context, code string, v identity.State, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
 	oa, err := p.GetOauthConfig()
 	if err != nil {
 		return nil, err
 	}
 
 	// Exchange converts an authorization code into a token.
-	oauth2Token, err := oa.Exchange(ctx, code)
+	oauth2Token, err := oa.Exchange(ctx, code, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("identity/oidc: token exchange failed: %w", err)
 	}
@@ -63,3 +63,240 @@ func TestRevoke(t *testing.T) {
 		AccessToken: "ACCESS_TOKEN",
 	}))
 }
+
+func TestGetSignInURL(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	t.Cleanup(clearTimeout)
+
+	var srv *httptest.Server
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		baseURL, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]any{
+				"issuer": baseURL.String(),
+				"authorization_endpoint": baseURL.ResolveReference(&url.URL{
+					Path: "/authorize",
+				}).String(),
+			})
+
+		default:
+			assert.Failf(t, "unexpected http request", "url: %s", r.URL.String())
+		}
+	})
+	srv = httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	redirectURL, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	p, err := New(ctx, &oauth.Options{
+		ProviderURL:     srv.URL,
+		RedirectURL:     redirectURL,
+		ClientID:        "CLIENT_ID",
+		ClientSecret:    "CLIENT_SECRET",
+		AuthCodeOptions: map[string]string{"prompt": "consent"},
+	})
+	require.NoError(t, err)
+
+	rawSignInURL, err := p.GetSignInURL(ctx, "STATE",
+		oauth2.SetAuthURLParam("prompt", "login"),
+		oauth2.SetAuthURLParam("acr_values", "phrh phr"))
+	require.NoError(t, err)
+
+	signInURL, err := url.Parse(rawSignInURL)
+	require.NoError(t, err)
+	assert.Equal(t, "/authorize", signInURL.Path)
+	assert.Equal(t, "STATE", signInURL.Query().Get("state"))
+	assert.Equal(t, "login", signInURL.Query().Get("prompt"))
+	assert.Equal(t, "phrh phr", signInURL.Query().Get("acr_values"))
+}
+
+func TestGetSignInURLPushedAuthorizationRequest(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	t.Cleanup(clearTimeout)
+
+	var srv *httptest.Server
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		baseURL, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]any{
+				"issuer": baseURL.String(),
+				"authorization_endpoint": baseURL.ResolveReference(&url.URL{
+					Path: "/authorize",
+				}).String(),
+				"pushed_authorization_request_endpoint": baseURL.ResolveReference(&url.URL{
+					Path: "/par",
+				}).String(),
+				"code_challenge_methods_supported": []string{"plain", "S256"},
+			})
+		case "/par":
+			assert.Equal(t, http.MethodPost, r.Method)
+			clientID, clientSecret, ok := r.BasicAuth()
+			if !ok {
+				// only accept the client secret in the header, to test that
+				// the request isn't retried once it succeeds
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]any{"error": "invalid_client"})
+				return
+			}
+			assert.Equal(t, "CLIENT_ID", clientID)
+			assert.Equal(t, "CLIENT_SECRET", clientSecret)
+			assert.Equal(t, "CLIENT_ID", r.FormValue("client_id"))
+			assert.Empty(t, r.FormValue("client_secret"))
+			assert.Equal(t, "STATE", r.FormValue("state"))
+			assert.Equal(t, "code", r.FormValue("response_type"))
+			assert.Equal(t, "S256", r.FormValue("code_challenge_method"))
+			assert.Equal(t, oauth.S256Challenge("VERIFIER"), r.FormValue("code_challenge"))
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{
+				"request_uri": "urn:ietf:params:oauth:request_uri:REQUEST",
+				"expires_in":  60,
+			})
+
+		default:
+			assert.Failf(t, "unexpected http request", "url: %s", r.URL.String())
+		}
+	})
+	srv = httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	redirectURL, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	p, err := New(ctx, &oauth.Options{
+		ProviderURL:  srv.URL,
+		RedirectURL:  redirectURL,
+		ClientID:     "CLIENT_ID",
+		ClientSecret: "CLIENT_SECRET",
+	})
+	require.NoError(t, err)
+
+	rawSignInURL, err := p.GetSignInURL(ctx, "STATE", oauth.S256ChallengeOption("VERIFIER")...)
+	require.NoError(t, err)
+
+	signInURL, err := url.Parse(rawSignInURL)
+	require.NoError(t, err)
+	assert.Equal(t, "/authorize", signInURL.Path)
+	assert.Equal(t, url.Values{
+		"client_id":   {"CLIENT_ID"},
+		"request_uri": {"urn:ietf:params:oauth:request_uri:REQUEST"},
+	}, signInURL.Query())
+}
+
+func TestGetSignInURLPushedAuthorizationRequestInParams(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	t.Cleanup(clearTimeout)
+
+	var requests int
+	var srv *httptest.Server
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		baseURL, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]any{
+				"issuer": baseURL.String(),
+				"authorization_endpoint": baseURL.ResolveReference(&url.URL{
+					Path: "/authorize",
+				}).String(),
+				"pushed_authorization_request_endpoint": baseURL.ResolveReference(&url.URL{
+					Path: "/par",
+				}).String(),
+			})
+		case "/par":
+			requests++
+			if _, _, ok := r.BasicAuth(); ok || r.FormValue("client_secret") != "CLIENT_SECRET" {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]any{"error": "invalid_client"})
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{
+				"request_uri": "urn:ietf:params:oauth:request_uri:REQUEST",
+				"expires_in":  60,
+			})
+
+		default:
+			assert.Failf(t, "unexpected http request", "url: %s", r.URL.String())
+		}
+	})
+	srv = httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	redirectURL, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	p, err := New(ctx, &oauth.Options{
+		ProviderURL:  srv.URL,
+		RedirectURL:  redirectURL,
+		ClientID:     "CLIENT_ID",
+		ClientSecret: "CLIENT_SECRET",
+	})
+	require.NoError(t, err)
+
+	rawSignInURL, err := p.GetSignInURL(ctx, "STATE")
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests, "should fall back to the client secret in the request body")
+
+	signInURL, err := url.Parse(rawSignInURL)
+	require.NoError(t, err)
+	assert.Equal(t, "urn:ietf:params:oauth:request_uri:REQUEST", signInURL.Query().Get("request_uri"))
+}
+
+func TestAuthenticatePKCE(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	t.Cleanup(clearTimeout)
+
+	var srv *httptest.Server
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		baseURL, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]any{
+				"issuer": baseURL.String(),
+				"token_endpoint": baseURL.ResolveReference(&url.URL{
+					Path: "/token",
+				}).String(),
+			})
+		case "/token":
+			assert.Equal(t, "CODE", r.FormValue("code"))
+			assert.Equal(t, "VERIFIER", r.FormValue("code_verifier"))
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error": "invalid_grant",
+			})
+
+		default:
+			assert.Failf(t, "unexpected http request", "url: %s", r.URL.String())
+		}
+	})
+	srv = httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	redirectURL, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	p, err := New(ctx, &oauth.Options{
+		ProviderURL:  srv.URL,
+		RedirectURL:  redirectURL,
+		ClientID:     "CLIENT_ID",
+		ClientSecret: "CLIENT_SECRET",
+	})
+	require.NoError(t, err)
+
+	_, err = p.Authenticate(ctx, "CODE", nil, oauth.VerifierOption("VERIFIER"))
+	assert.ErrorContains(t, err, "token exchange failed")
+}
@@ -0,0 +1,127 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/version"
+)
+
+const (
+	parRequestTimeout  = 30 * time.Second
+	maxPARResponseSize = 1 << 20
+)
+
+var parClient = httputil.NewLoggingClient(&http.Client{
+	Timeout: parRequestTimeout,
+}, "oidc_pushed_authorization_request")
+
+// pushAuthorizationRequest pushes the parameters of the sign in url to the
+// pushed authorization request endpoint, and returns a sign in url referencing
+// them by the returned request uri.
+//
+// https://tools.ietf.org/html/rfc9126#section-2
+func (p *Provider) pushAuthorizationRequest(ctx context.Context, oa *oauth2.Config, signInURL string) (string, error) {
+	u, err := url.Parse(signInURL)
+	if err != nil {
+		return "", fmt.Errorf("identity/oidc: invalid sign in url: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, parRequestTimeout)
+	defer cancel()
+
+	// the client authenticates to the endpoint as it does to the token
+	// endpoint. Like the token exchange, auto detection tries the header first
+	// and falls back to the request body.
+	authStyles := []oauth2.AuthStyle{oa.Endpoint.AuthStyle}
+	if oa.Endpoint.AuthStyle == oauth2.AuthStyleAutoDetect {
+		authStyles = []oauth2.AuthStyle{oauth2.AuthStyleInHeader, oauth2.AuthStyleInParams}
+	}
+	var requestURI string
+	for _, authStyle := range authStyles {
+		requestURI, err = p.doPushedAuthorizationRequest(ctx, oa, u.Query(), authStyle)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	u.RawQuery = url.Values{
+		"client_id":   {oa.ClientID},
+		"request_uri": {requestURI},
+	}.Encode()
+	return u.String(), nil
+}
+
+func (p *Provider) doPushedAuthorizationRequest(
+	ctx context.Context,
+	oa *oauth2.Config,
+	params url.Values,
+	authStyle oauth2.AuthStyle,
+) (string, error) {
+	params.Set("client_id", oa.ClientID)
+	if authStyle == oauth2.AuthStyleInParams {
+		params.Set("client_secret", oa.ClientSecret)
+	} else {
+		params.Del("client_secret")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.PushedAuthorizationRequestURL,
+		strings.NewReader(params.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", version.UserAgent())
+	if authStyle == oauth2.AuthStyleInHeader {
+		req.SetBasicAuth(url.QueryEscape(oa.ClientID), url.QueryEscape(oa.ClientSecret))
+	}
+
+	res, err := parClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("identity/oidc: pushed authorization request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxPARResponseSize))
+	if err != nil {
+		return "", fmt.Errorf("identity/oidc: pushed authorization request failed: %w", err)
+	}
+	// the endpoint responds with 201 Created, but some identity providers
+	// respond with 200 OK
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusOK {
+		var e struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			return "", fmt.Errorf("identity/oidc: pushed authorization request failed: %s: %s",
+				e.Error, e.ErrorDescription)
+		}
+		return "", fmt.Errorf("identity/oidc: pushed authorization request failed: %s", res.Status)
+	}
+
+	var response struct {
+		RequestURI string `json:"request_uri"`
+		ExpiresIn  int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("identity/oidc: invalid pushed authorization response: %w", err)
+	}
+	if response.RequestURI == "" {
+		return "", ErrMissingRequestURI
+	}
+	return response.RequestURI, nil
+}
@@ -21,19 +21,42 @@ import (
 	"github.com/pomerium/pomerium/internal/identity/oidc/okta"
 	"github.com/pomerium/pomerium/internal/identity/oidc/onelogin"
 	"github.com/pomerium/pomerium/internal/identity/oidc/ping"
+	"github.com/pomerium/pomerium/internal/identity/saml"
 )
 
 // Authenticator is an interface representing the ability to authenticate with an identity provider.
 type Authenticator interface {
-	Authenticate(context.Context, string, identity.State) (*oauth2.Token, error)
+	Authenticate(ctx context.Context, code string, v identity.State, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error)
 	Refresh(context.Context, *oauth2.Token, identity.State) (*oauth2.Token, error)
 	Revoke(context.Context, *oauth2.Token) error
-	GetSignInURL(state string) (string, error)
+	GetSignInURL(ctx context.Context, state string, opts ...oauth2.AuthCodeOption) (string, error)
 	Name() string
 	LogOut() (*url.URL, error)
 	UpdateUserInfo(ctx context.Context, t *oauth2.Token, v interface{}) error
 }
 
+// A PKCEAuthenticator is an Authenticator which may not use PKCE.
+type PKCEAuthenticator interface {
+	SupportsPKCE() bool
+}
+
+// SupportsPKCE returns true if S256 PKCE code challenges are sent to the
+// identity provider. PKCE is used unless the authenticator opts out, since
+// servers which don't support PKCE ignore the parameters (RFC 7636 section 5).
+func SupportsPKCE(a Authenticator) bool {
+	pa, ok := a.(PKCEAuthenticator)
+	return !ok || pa.SupportsPKCE()
+}
+
+// withoutPKCE is an Authenticator for an identity provider which rejects PKCE.
+type withoutPKCE struct {
+	Authenticator
+}
+
+func (withoutPKCE) SupportsPKCE() bool {
+	return false
+}
+
 // NewAuthenticator returns a new identity provider based on its name.
 func NewAuthenticator(o oauth.Options) (a Authenticator, err error) {
 	ctx := context.Background()
@@ -58,6 +81,8 @@ func NewAuthenticator(o oauth.Options) (a Authenticator, err error) {
 		a, err = onelogin.New(ctx, &o)
 	case ping.Name:
 		a, err = ping.New(ctx, &o)
+	case saml.Name:
+		a, err = saml.New(ctx, &o)
 	case "":
 		return nil, fmt.Errorf("identity: provider is not defined")
 	default:
@@ -66,5 +91,9 @@ func NewAuthenticator(o oauth.Options) (a Authenticator, err error) {
 	if err != nil {
 		return nil, err
 	}
+	// SAML always uses the PKCE code challenge as the authentication request id
+	if o.DisablePKCE && o.ProviderName != saml.Name {
+		a = withoutPKCE{a}
+	}
 	return a, nil
 }
@@ -0,0 +1,31 @@
+package identity
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+	"github.com/pomerium/pomerium/internal/identity/oauth/github"
+)
+
+func TestSupportsPKCE(t *testing.T) {
+	o := oauth.Options{
+		ProviderName: github.Name,
+		ClientID:     "CLIENT_ID",
+		ClientSecret: "CLIENT_SECRET",
+		RedirectURL:  &url.URL{Scheme: "https", Host: "authenticate.example.com", Path: "/oauth2/callback"},
+	}
+
+	a, err := NewAuthenticator(o)
+	require.NoError(t, err)
+	assert.True(t, SupportsPKCE(a), "should use PKCE by default")
+
+	o.DisablePKCE = true
+	a, err = NewAuthenticator(o)
+	require.NoError(t, err)
+	assert.False(t, SupportsPKCE(a), "should not use PKCE when disabled")
+	assert.Equal(t, github.Name, a.Name())
+}
@@ -0,0 +1,132 @@
+package saml
+
+import (
+	"strings"
+)
+
+const emailAddressNameIDFormat = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+
+// claimAttributes are the names of the attributes commonly used by identity
+// providers for the standard claims. Attributes are matched by name or
+// friendly name.
+var claimAttributes = map[string][]string{
+	"email": {
+		"email",
+		"mail",
+		"emailaddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+	},
+	"name": {
+		"name",
+		"displayName",
+		"cn",
+		"urn:oid:2.16.840.1.113730.3.1.241",
+		"urn:oid:2.5.4.3",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+	},
+	"given_name": {
+		"givenName",
+		"firstName",
+		"urn:oid:2.5.4.42",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname",
+	},
+	"family_name": {
+		"sn",
+		"surname",
+		"lastName",
+		"urn:oid:2.5.4.4",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/surname",
+	},
+	"groups": {
+		"groups",
+		"memberOf",
+		"isMemberOf",
+		"urn:oid:1.3.6.1.4.1.5923.1.5.1.1",
+		"http://schemas.microsoft.com/ws/2008/06/identity/claims/groups",
+		"http://schemas.xmlsoap.org/claims/Group",
+	},
+}
+
+// reservedClaims are the claims used by the session state, which attributes
+// must not overwrite.
+var reservedClaims = map[string]struct{}{
+	"iss": {}, "sub": {}, "aud": {}, "exp": {}, "nbf": {}, "iat": {}, "jti": {},
+	"oid": {}, "idp_id": {}, "databroker_server_version": {}, "databroker_record_version": {},
+}
+
+// claims returns the claims for the assertion. The subject's name id is the
+// sub claim, and the standard claims are taken from the attributes in
+// claimAttributes. Every other attribute is also a claim named after the
+// attribute, so that it can be used in policies and headers.
+func (assertion *xmlAssertion) claims() map[string]any {
+	claims := make(map[string]any)
+
+	var attributes []xmlAttribute
+	for _, statement := range assertion.AttributeStatements {
+		attributes = append(attributes, statement.Attributes...)
+	}
+	for _, attribute := range attributes {
+		if _, ok := reservedClaims[attribute.Name]; ok || attribute.Name == "" {
+			continue
+		}
+		values := append(getStringSlice(claims[attribute.Name]), attribute.Values...)
+		if len(values) == 1 {
+			claims[attribute.Name] = values[0]
+		} else {
+			claims[attribute.Name] = values
+		}
+	}
+
+	for claim, names := range claimAttributes {
+		var values []string
+		for _, attribute := range attributes {
+			if matchesAttributeName(attribute, names) {
+				values = append(values, attribute.Values...)
+			}
+		}
+		switch {
+		case len(values) == 0:
+		case claim == "groups":
+			claims[claim] = values
+		default:
+			claims[claim] = values[0]
+		}
+	}
+
+	nameID := assertion.Subject.NameID
+	if _, ok := claims["email"]; !ok && nameID.Format == emailAddressNameIDFormat {
+		claims["email"] = nameID.Value
+	}
+	claims["sub"] = nameID.Value
+
+	for _, statement := range assertion.AuthnStatements {
+		if !statement.AuthnInstant.IsZero() {
+			claims["auth_time"] = statement.AuthnInstant.Unix()
+		}
+		if statement.AuthnContextClassRef != "" {
+			claims["acr"] = statement.AuthnContextClassRef
+		}
+	}
+
+	return claims
+}
+
+func matchesAttributeName(attribute xmlAttribute, names []string) bool {
+	for _, name := range names {
+		if strings.EqualFold(attribute.Name, name) || strings.EqualFold(attribute.FriendlyName, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func getStringSlice(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package saml
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+const (
+	protocolNamespace        = "urn:oasis:names:tc:SAML:2.0:protocol"
+	assertionNamespace       = "urn:oasis:names:tc:SAML:2.0:assertion"
+	successStatus            = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	bearerConfirmationMethod = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	allowedClockSkew         = 3 * time.Minute
+)
+
+type xmlResponse struct {
+	Destination  string `xml:"Destination,attr"`
+	InResponseTo string `xml:"InResponseTo,attr"`
+	Issuer       string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Status       struct {
+		StatusCode struct {
+			Value      string `xml:"Value,attr"`
+			StatusCode struct {
+				Value string `xml:"Value,attr"`
+			} `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusCode"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusCode"`
+		StatusMessage string `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusMessage"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:protocol Status"`
+}
+
+type xmlAssertion struct {
+	ID      string `xml:"ID,attr"`
+	Issuer  string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Subject struct {
+		NameID struct {
+			Format string `xml:"Format,attr"`
+			Value  string `xml:",chardata"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+		SubjectConfirmations []struct {
+			Method                  string `xml:"Method,attr"`
+			SubjectConfirmationData struct {
+				NotOnOrAfter time.Time `xml:"NotOnOrAfter,attr"`
+				Recipient    string    `xml:"Recipient,attr"`
+				InResponseTo string    `xml:"InResponseTo,attr"`
+			} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmationData"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmation"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Subject"`
+	Conditions struct {
+		NotBefore            time.Time `xml:"NotBefore,attr"`
+		NotOnOrAfter         time.Time `xml:"NotOnOrAfter,attr"`
+		AudienceRestrictions []struct {
+			Audiences []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Audience"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AudienceRestriction"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Conditions"`
+	AuthnStatements []struct {
+		AuthnInstant         time.Time `xml:"AuthnInstant,attr"`
+		SessionNotOnOrAfter  time.Time `xml:"SessionNotOnOrAfter,attr"`
+		AuthnContextClassRef string    `xml:"urn:oasis:names:tc:SAML:2.0:assertion AuthnContext>AuthnContextClassRef"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AuthnStatement"`
+	AttributeStatements []struct {
+		Attributes []xmlAttribute `xml:"urn:oasis:names:tc:SAML:2.0:assertion Attribute"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeStatement"`
+}
+
+type xmlAttribute struct {
+	Name         string   `xml:"Name,attr"`
+	FriendlyName string   `xml:"FriendlyName,attr"`
+	Values       []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeValue"`
+}
+
+// parseResponse parses and validates a SAML response to the authentication
+// request with the given id, and returns its assertion. Either the response or
+// the assertion must be signed by the identity provider.
+func (p *Provider) parseResponse(md *metadata, raw []byte, requestID string, now time.Time) (*xmlAssertion, error) {
+	root, err := parseXML(raw)
+	if err != nil {
+		return nil, fmt.Errorf("identity/saml: invalid response: %w", err)
+	}
+	if root.namespace() != protocolNamespace || root.local != "Response" {
+		return nil, fmt.Errorf("identity/saml: invalid response: unexpected element %s", root.local)
+	}
+
+	// the status is checked first so that errors from the identity provider
+	// are reported even though they usually aren't signed
+	var res xmlResponse
+	if err := xml.Unmarshal(canonicalize(root, nil, nil), &res); err != nil {
+		return nil, fmt.Errorf("identity/saml: invalid response: %w", err)
+	}
+	if code := res.Status.StatusCode.Value; code != successStatus {
+		if subCode := res.Status.StatusCode.StatusCode.Value; subCode != "" {
+			code += " (" + subCode + ")"
+		}
+		return nil, fmt.Errorf("identity/saml: identity provider returned status %s: %s",
+			code, res.Status.StatusMessage)
+	}
+
+	var assertionElement *xmlElement
+	signedResponse, err := verifySignature(root, md.certificates, p.allowSHA1)
+	switch {
+	case err == nil:
+		// the whole response is signed, so only read from the signed bytes
+		if root, err = parseXML(signedResponse); err != nil {
+			return nil, fmt.Errorf("identity/saml: invalid response: %w", err)
+		}
+		res = xmlResponse{}
+		if err := xml.Unmarshal(signedResponse, &res); err != nil {
+			return nil, fmt.Errorf("identity/saml: invalid response: %w", err)
+		}
+		if assertionElement, err = getAssertionElement(root); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, errMissingSignature):
+		if assertionElement, err = getAssertionElement(root); err != nil {
+			return nil, err
+		}
+		signedAssertion, err := verifySignature(assertionElement, md.certificates, p.allowSHA1)
+		if errors.Is(err, errMissingSignature) {
+			return nil, fmt.Errorf("identity/saml: neither the response nor the assertion is signed")
+		} else if err != nil {
+			return nil, err
+		}
+		if assertionElement, err = parseXML(signedAssertion); err != nil {
+			return nil, fmt.Errorf("identity/saml: invalid assertion: %w", err)
+		}
+	default:
+		return nil, err
+	}
+
+	if res.Destination != "" && res.Destination != p.acsURL {
+		return nil, fmt.Errorf("identity/saml: response destination %s does not match %s", res.Destination, p.acsURL)
+	}
+	if res.Issuer != "" && res.Issuer != md.entityID {
+		return nil, fmt.Errorf("identity/saml: response issuer %s does not match %s", res.Issuer, md.entityID)
+	}
+	// unsolicited responses aren't supported, since they can't be tied to the
+	// user's sign in
+	if res.InResponseTo != requestID {
+		return nil, fmt.Errorf("identity/saml: response is not in response to the authentication request")
+	}
+
+	var assertion xmlAssertion
+	if err := xml.Unmarshal(canonicalize(assertionElement, nil, nil), &assertion); err != nil {
+		return nil, fmt.Errorf("identity/saml: invalid assertion: %w", err)
+	}
+	if err := p.validateAssertion(md, &assertion, requestID, now); err != nil {
+		return nil, err
+	}
+	return &assertion, nil
+}
+
+func getAssertionElement(response *xmlElement) (*xmlElement, error) {
+	assertions := response.childElements(assertionNamespace, "Assertion")
+	switch {
+	case len(assertions) == 1:
+		return assertions[0], nil
+	case len(assertions) == 0 && response.child(assertionNamespace, "EncryptedAssertion") != nil:
+		return nil, fmt.Errorf("identity/saml: encrypted assertions are not supported")
+	default:
+		return nil, fmt.Errorf("identity/saml: response must contain exactly one assertion")
+	}
+}
+
+// validateAssertion validates that the assertion was issued by the identity
+// provider for this service provider in response to the authentication
+// request, and that it is currently valid.
+func (p *Provider) validateAssertion(md *metadata, assertion *xmlAssertion, requestID string, now time.Time) error {
+	if assertion.ID == "" {
+		return fmt.Errorf("identity/saml: assertion is missing an id")
+	}
+	if assertion.Issuer != md.entityID {
+		return fmt.Errorf("identity/saml: assertion issuer %s does not match %s", assertion.Issuer, md.entityID)
+	}
+	if assertion.Subject.NameID.Value == "" {
+		return fmt.Errorf("identity/saml: assertion is missing the subject name id")
+	}
+	if len(assertion.AuthnStatements) == 0 {
+		return fmt.Errorf("identity/saml: assertion is missing an authentication statement")
+	}
+
+	conditions := assertion.Conditions
+	if !conditions.NotBefore.IsZero() && now.Add(allowedClockSkew).Before(conditions.NotBefore) {
+		return fmt.Errorf("identity/saml: assertion is not valid until %s", conditions.NotBefore)
+	}
+	if !conditions.NotOnOrAfter.IsZero() && !now.Add(-allowedClockSkew).Before(conditions.NotOnOrAfter) {
+		return fmt.Errorf("identity/saml: assertion expired at %s", conditions.NotOnOrAfter)
+	}
+	for _, restriction := range conditions.AudienceRestrictions {
+		if !slices.Contains(restriction.Audiences, p.entityID) {
+			return fmt.Errorf("identity/saml: assertion audience %v does not include %s",
+				restriction.Audiences, p.entityID)
+		}
+	}
+
+	// bearer assertions must be confirmed for this service provider
+	//
+	// https://docs.oasis-open.org/security/saml/v2.0/saml-profiles-2.0-os.pdf#4.1.4.2
+	expiry := conditions.NotOnOrAfter
+	confirmed := false
+	for _, confirmation := range assertion.Subject.SubjectConfirmations {
+		data := confirmation.SubjectConfirmationData
+		if confirmation.Method == bearerConfirmationMethod &&
+			data.Recipient == p.acsURL &&
+			data.InResponseTo == requestID &&
+			now.Add(-allowedClockSkew).Before(data.NotOnOrAfter) {
+			confirmed = true
+			if data.NotOnOrAfter.After(expiry) {
+				expiry = data.NotOnOrAfter
+			}
+		}
+	}
+	if !confirmed {
+		return fmt.Errorf("identity/saml: assertion has no valid bearer subject confirmation for %s", p.acsURL)
+	}
+
+	if !usedAssertions.add(assertion.ID, expiry.Add(allowedClockSkew), now) {
+		return fmt.Errorf("identity/saml: assertion %s has already been used", assertion.ID)
+	}
+	return nil
+}
+
+// usedAssertions are the ids of the assertions which were used to sign in,
+// so that an assertion can't be replayed while it's valid.
+//
+// The ids are only kept in memory, so with more than one replica of the
+// authenticate service an assertion can be replayed to another replica. Since
+// responses must answer the sign in's authentication request, a replay also
+// needs the state and CSRF cookie of the user who signed in.
+var usedAssertions = &assertionCache{expiries: make(map[string]time.Time)}
+
+type assertionCache struct {
+	mu       sync.Mutex
+	expiries map[string]time.Time
+}
+
+// add adds the assertion id to the cache, and returns false if it was already
+// in the cache.
+func (c *assertionCache) add(id string, expiry, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, e := range c.expiries {
+		if !now.Before(e) {
+			delete(c.expiries, k)
+		}
+	}
+
+	if _, ok := c.expiries[id]; ok {
+		return false
+	}
+	c.expiries[id] = expiry
+	return true
+}
@@ -0,0 +1,344 @@
+// Package saml implements a SAML 2.0 service provider for identity providers
+// which don't support OpenID Connect.
+//
+// The identity provider's metadata is read from the provider url, which is
+// either the url of the metadata or the metadata document itself. The client
+// id is the service provider's entity id, and the client secret, if set, is
+// the PEM encoded RSA private key used to sign authentication requests.
+// Responses signed with SHA-1 are rejected unless AllowSHA1Signatures is set.
+// Authentication requests use the HTTP-Redirect binding, and responses are
+// posted back to the callback url using the HTTP-POST binding.
+//
+// Used assertions are remembered in memory to prevent replays, so replay
+// protection only covers a single replica of the authenticate service.
+//
+// https://docs.oasis-open.org/security/saml/v2.0/saml-core-2.0-os.pdf
+// https://docs.oasis-open.org/security/saml/v2.0/saml-bindings-2.0-os.pdf
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+
+	"github.com/pomerium/pomerium/internal/identity/identity"
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+	"github.com/pomerium/pomerium/internal/identity/oidc"
+)
+
+// Name identifies the SAML identity provider.
+const Name = "saml"
+
+const (
+	// ResponseFormValue is the form value the identity provider posts the
+	// SAML response in.
+	ResponseFormValue = "SAMLResponse"
+	// RelayStateFormValue is the form value the identity provider posts the
+	// state in.
+	RelayStateFormValue = "RelayState"
+)
+
+// Provider is a SAML 2.0 service provider implementation of the
+// Authenticator interface.
+type Provider struct {
+	entityID   string
+	acsURL     string
+	signingKey *rsa.PrivateKey
+	allowSHA1  bool
+
+	getMetadata func() (*metadata, error)
+}
+
+// New creates a new SAML 2.0 service provider.
+func New(ctx context.Context, o *oauth.Options) (*Provider, error) {
+	if o.ProviderURL == "" {
+		return nil, oidc.ErrMissingProviderURL
+	}
+
+	p := &Provider{
+		entityID:  o.ClientID,
+		acsURL:    o.RedirectURL.String(),
+		allowSHA1: o.AllowSHA1Signatures,
+	}
+	if p.entityID == "" {
+		p.entityID = p.acsURL
+	}
+	if o.ClientSecret != "" {
+		var err error
+		p.signingKey, err = parseSigningKey(o.ClientSecret)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var mu sync.Mutex
+	var md *metadata
+	p.getMetadata = func() (*metadata, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if md == nil {
+			var err error
+			md, err = getMetadata(ctx, o.ProviderURL)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return md, nil
+	}
+	return p, nil
+}
+
+// Name returns the provider name.
+func (p *Provider) Name() string {
+	return Name
+}
+
+// SupportsPKCE returns true, as the PKCE code challenge is used as the ID of
+// the authentication request.
+func (p *Provider) SupportsPKCE() bool {
+	return true
+}
+
+type xmlAuthnRequest struct {
+	XMLName                     xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string   `xml:"ID,attr"`
+	Version                     string   `xml:"Version,attr"`
+	IssueInstant                string   `xml:"IssueInstant,attr"`
+	Destination                 string   `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string   `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string   `xml:"ProtocolBinding,attr"`
+	ForceAuthn                  bool     `xml:"ForceAuthn,attr,omitempty"`
+	Issuer                      string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                struct {
+		AllowCreate bool `xml:"AllowCreate,attr"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDPolicy"`
+	RequestedAuthnContext *xmlRequestedAuthnContext `xml:"urn:oasis:names:tc:SAML:2.0:protocol RequestedAuthnContext,omitempty"`
+}
+
+type xmlRequestedAuthnContext struct {
+	Comparison            string   `xml:"Comparison,attr"`
+	AuthnContextClassRefs []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion AuthnContextClassRef"`
+}
+
+// GetSignInURL returns the url of the identity provider's single sign-on
+// service with a new authentication request. The state is sent as the relay
+// state, which the identity provider posts back along with the response.
+//
+// SAML has no PKCE, instead the PKCE code challenge is used as the id of the
+// authentication request. The response must be in response to that id, which
+// ties it to the code verifier kept in the state.
+//
+// The prompt=login and acr_values options are converted to ForceAuthn and a
+// RequestedAuthnContext, so that step-up authentication works as it does with
+// OpenID Connect.
+func (p *Provider) GetSignInURL(_ context.Context, state string, opts ...oauth2.AuthCodeOption) (string, error) {
+	md, err := p.getMetadata()
+	if err != nil {
+		return "", err
+	}
+	if md.wantAuthnRequestsSigned && p.signingKey == nil {
+		return "", fmt.Errorf("identity/saml: identity provider requires signed authentication requests, " +
+			"but no signing key is configured")
+	}
+
+	params := getAuthCodeParams(opts)
+	challenge := params.Get("code_challenge")
+	if challenge == "" || params.Get("code_challenge_method") != "S256" {
+		return "", fmt.Errorf("identity/saml: an S256 code challenge is required for the authentication request id")
+	}
+
+	req := xmlAuthnRequest{
+		ID:                          getRequestID(challenge),
+		Version:                     "2.0",
+		IssueInstant:                time.Now().UTC().Format(time.RFC3339),
+		Destination:                 md.singleSignOnURL,
+		AssertionConsumerServiceURL: p.acsURL,
+		ProtocolBinding:             httpPostBinding,
+		Issuer:                      p.entityID,
+	}
+	req.NameIDPolicy.AllowCreate = true
+	req.ForceAuthn = params.Get("prompt") == "login"
+	if acrValues := strings.Fields(params.Get("acr_values")); len(acrValues) > 0 {
+		req.RequestedAuthnContext = &xmlRequestedAuthnContext{
+			Comparison:            "exact",
+			AuthnContextClassRefs: acrValues,
+		}
+	}
+
+	raw, err := xml.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("identity/saml: error encoding authentication request: %w", err)
+	}
+	var compressed bytes.Buffer
+	w, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	_, _ = w.Write(raw)
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	// the signature covers the query parameters in this order, as they are
+	// encoded in the url
+	query := "SAMLRequest=" + url.QueryEscape(base64.StdEncoding.EncodeToString(compressed.Bytes()))
+	if state != "" {
+		query += "&RelayState=" + url.QueryEscape(state)
+	}
+	if p.signingKey != nil {
+		query += "&SigAlg=" + url.QueryEscape(rsaSHA256SignatureAlgorithm)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, p.signingKey, crypto.SHA256, hash(crypto.SHA256, []byte(query)))
+		if err != nil {
+			return "", fmt.Errorf("identity/saml: error signing authentication request: %w", err)
+		}
+		query += "&Signature=" + url.QueryEscape(base64.StdEncoding.EncodeToString(signature))
+	}
+
+	if strings.Contains(md.singleSignOnURL, "?") {
+		return md.singleSignOnURL + "&" + query, nil
+	}
+	return md.singleSignOnURL + "?" + query, nil
+}
+
+// Authenticate validates the base64 encoded SAML response posted by the
+// identity provider, and fills the state with the claims from its assertion.
+// The response must be in response to the authentication request created for
+// the PKCE code verifier option. Other OAuth 2.0 token request options do not
+// apply and are ignored.
+func (p *Provider) Authenticate(_ context.Context, code string, v identity.State, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	md, err := p.getMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	verifier := getAuthCodeParams(opts).Get("code_verifier")
+	if verifier == "" {
+		return nil, fmt.Errorf("identity/saml: missing code verifier for the authentication request id")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(code)
+	if err != nil {
+		return nil, fmt.Errorf("identity/saml: invalid response encoding: %w", err)
+	}
+	assertion, err := p.parseResponse(md, raw, getRequestID(oauth.S256Challenge(verifier)), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	bs, err := json.Marshal(assertion.claims())
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bs, v); err != nil {
+		return nil, err
+	}
+
+	// SAML has no access token, the token only records when the identity
+	// provider's session ends
+	token := new(oauth2.Token)
+	for _, statement := range assertion.AuthnStatements {
+		if !statement.SessionNotOnOrAfter.IsZero() &&
+			(token.Expiry.IsZero() || statement.SessionNotOnOrAfter.Before(token.Expiry)) {
+			token.Expiry = statement.SessionNotOnOrAfter
+		}
+	}
+	return token, nil
+}
+
+// Refresh is not supported by SAML, so users must sign in again once their
+// session expires.
+func (p *Provider) Refresh(_ context.Context, _ *oauth2.Token, _ identity.State) (*oauth2.Token, error) {
+	return nil, oidc.ErrMissingRefreshToken
+}
+
+// Revoke is not implemented by SAML.
+func (p *Provider) Revoke(_ context.Context, _ *oauth2.Token) error {
+	return oidc.ErrRevokeNotImplemented
+}
+
+// LogOut is not implemented by SAML.
+func (p *Provider) LogOut() (*url.URL, error) {
+	return nil, oidc.ErrSignoutNotImplemented
+}
+
+// UpdateUserInfo is a no-op, because SAML identity providers have no user
+// info endpoint. The claims from the assertion are set when the user signs
+// in.
+func (p *Provider) UpdateUserInfo(_ context.Context, _ *oauth2.Token, _ interface{}) error {
+	return nil
+}
+
+// newID returns a new SAML id. IDs must not start with a digit.
+func newID() string {
+	return "_" + uuid.NewString()
+}
+
+// getRequestID returns the id of the authentication request for the PKCE code
+// challenge.
+func getRequestID(challenge string) string {
+	return "_" + challenge
+}
+
+// getAuthCodeParams returns the query parameters the options add to an
+// OAuth 2.0 sign in url.
+func getAuthCodeParams(opts []oauth2.AuthCodeOption) url.Values {
+	u, err := url.Parse((&oauth2.Config{}).AuthCodeURL("", opts...))
+	if err != nil {
+		return url.Values{}
+	}
+	return u.Query()
+}
+
+// parseSigningKey parses a PEM encoded, optionally base64 encoded, RSA private
+// key.
+func parseSigningKey(raw string) (*rsa.PrivateKey, error) {
+	bs := []byte(raw)
+	if decoded, err := base64.StdEncoding.DecodeString(raw); err == nil {
+		bs = decoded
+	}
+
+	for {
+		var block *pem.Block
+		block, bs = pem.Decode(bs)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("identity/saml: invalid signing key: %w", err)
+			}
+			return key, nil
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("identity/saml: invalid signing key: %w", err)
+			}
+			rsaKey, ok := key.(*rsa.PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("identity/saml: signing key must be an RSA key")
+			}
+			return rsaKey, nil
+		}
+	}
+	return nil, fmt.Errorf("identity/saml: client secret must be a PEM encoded RSA private key")
+}
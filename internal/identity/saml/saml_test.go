@@ -0,0 +1,572 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+)
+
+const (
+	testIdPEntityID = "https://idp.example.com/metadata"
+	testSPEntityID  = "https://authenticate.example.com/saml"
+	testACSURL      = "https://authenticate.example.com/oauth2/callback"
+	testVerifier    = "VERIFIER"
+)
+
+type testIdP struct {
+	key         *rsa.PrivateKey
+	certificate []byte
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	certificate, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+	}, &key.PublicKey, key)
+	require.NoError(t, err)
+	return &testIdP{key: key, certificate: certificate}
+}
+
+func (idp *testIdP) metadata() string {
+	return `<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="` + testIdPEntityID + `">
+  <md:IDPSSODescriptor WantAuthnRequestsSigned="true" protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="encryption">
+      <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:X509Data><ds:X509Certificate>invalid</ds:X509Certificate></ds:X509Data></ds:KeyInfo>
+    </md:KeyDescriptor>
+    <md:KeyDescriptor use="signing">
+      <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+        <ds:X509Data>
+          <ds:X509Certificate>` + base64.StdEncoding.EncodeToString(idp.certificate) + `</ds:X509Certificate>
+        </ds:X509Data>
+      </ds:KeyInfo>
+    </md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://idp.example.com/sso/post"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://idp.example.com/sso/redirect"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`
+}
+
+type testResponse struct {
+	ResponseID   string
+	AssertionID  string
+	InResponseTo string
+	// ConfirmationInResponseTo is the InResponseTo of the subject confirmation.
+	ConfirmationInResponseTo string
+	Issuer                   string
+	Audience                 string
+	Destination              string
+	Recipient                string
+	Status                   string
+	NotBefore                string
+	NotOnOrAfter             string
+	Attributes               string
+}
+
+func newTestResponse(now time.Time) testResponse {
+	return testResponse{
+		ResponseID:               newID(),
+		AssertionID:              newID(),
+		InResponseTo:             getRequestID(oauth.S256Challenge(testVerifier)),
+		ConfirmationInResponseTo: getRequestID(oauth.S256Challenge(testVerifier)),
+		Issuer:                   testIdPEntityID,
+		Audience:                 testSPEntityID,
+		Destination:              testACSURL,
+		Recipient:                testACSURL,
+		Status:                   successStatus,
+		NotBefore:                now.Add(-time.Minute).UTC().Format(time.RFC3339),
+		NotOnOrAfter:             now.Add(5 * time.Minute).UTC().Format(time.RFC3339),
+		Attributes: `<saml:Attribute Name="urn:oid:0.9.2342.19200300.100.1.3" FriendlyName="mail">` +
+			`<saml:AttributeValue>user@example.com</saml:AttributeValue></saml:Attribute>` +
+			`<saml:Attribute Name="displayName"><saml:AttributeValue>User &amp; Co</saml:AttributeValue></saml:Attribute>` +
+			`<saml:Attribute Name="groups"><saml:AttributeValue>admins</saml:AttributeValue>` +
+			`<saml:AttributeValue>users</saml:AttributeValue></saml:Attribute>` +
+			`<saml:Attribute Name="department"><saml:AttributeValue>engineering</saml:AttributeValue></saml:Attribute>` +
+			`<saml:Attribute Name="jti"><saml:AttributeValue>not-a-session-id</saml:AttributeValue></saml:Attribute>`,
+	}
+}
+
+var testResponseTemplate = template.Must(template.New("").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="{{.ResponseID}}" Version="2.0" IssueInstant="{{.NotBefore}}" Destination="{{.Destination}}" InResponseTo="{{.InResponseTo}}">
+  <saml:Issuer>{{.Issuer}}</saml:Issuer>
+  <samlp:Status><samlp:StatusCode Value="{{.Status}}"/></samlp:Status>
+  <saml:Assertion ID="{{.AssertionID}}" Version="2.0" IssueInstant="{{.NotBefore}}">
+    <saml:Issuer>{{.Issuer}}</saml:Issuer>
+    <saml:Subject>
+      <saml:NameID Format="urn:oasis:names:tc:SAML:2.0:nameid-format:persistent">user-1</saml:NameID>
+      <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+        <saml:SubjectConfirmationData NotOnOrAfter="{{.NotOnOrAfter}}" Recipient="{{.Recipient}}" InResponseTo="{{.ConfirmationInResponseTo}}"/>
+      </saml:SubjectConfirmation>
+    </saml:Subject>
+    <saml:Conditions NotBefore="{{.NotBefore}}" NotOnOrAfter="{{.NotOnOrAfter}}">
+      <saml:AudienceRestriction><saml:Audience>{{.Audience}}</saml:Audience></saml:AudienceRestriction>
+    </saml:Conditions>
+    <saml:AuthnStatement AuthnInstant="{{.NotBefore}}" SessionNotOnOrAfter="{{.NotOnOrAfter}}">
+      <saml:AuthnContext><saml:AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport</saml:AuthnContextClassRef></saml:AuthnContext>
+    </saml:AuthnStatement>
+    <saml:AttributeStatement>{{.Attributes}}</saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`))
+
+func (res testResponse) String() string {
+	var buf bytes.Buffer
+	if err := testResponseTemplate.Execute(&buf, res); err != nil {
+		panic(err)
+	}
+	return buf.String()
+}
+
+// sign adds an enveloped signature to the element with the id, after its
+// issuer.
+func (idp *testIdP) sign(t *testing.T, doc, id string) string {
+	t.Helper()
+
+	return idp.signWith(t, doc, id, crypto.SHA256, rsaSHA256SignatureAlgorithm, sha256DigestAlgorithm)
+}
+
+// signWith signs the element with the id using the given signature and
+// digest algorithms, which must both use h.
+func (idp *testIdP) signWith(t *testing.T, doc, id string, h crypto.Hash, signatureMethod, digestMethod string) string {
+	t.Helper()
+
+	issuerEnd := "</saml:Issuer>"
+	start := strings.Index(doc, `ID="`+id+`"`)
+	require.True(t, start >= 0)
+	insertAt := start + strings.Index(doc[start:], issuerEnd) + len(issuerEnd)
+	doc = doc[:insertAt] + `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo>` +
+		`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>` +
+		`<ds:SignatureMethod Algorithm="` + signatureMethod + `"/>` +
+		`<ds:Reference URI="#` + id + `"><ds:Transforms>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#">` +
+		`<ec:InclusiveNamespaces xmlns:ec="http://www.w3.org/2001/10/xml-exc-c14n#" PrefixList="xs"/></ds:Transform>` +
+		`</ds:Transforms><ds:DigestMethod Algorithm="` + digestMethod + `"/>` +
+		`<ds:DigestValue>DIGEST</ds:DigestValue></ds:Reference></ds:SignedInfo>` +
+		`<ds:SignatureValue>SIGNATURE</ds:SignatureValue></ds:Signature>` + doc[insertAt:]
+
+	find := func() (*xmlElement, *xmlElement) {
+		root, err := parseXML([]byte(doc))
+		require.NoError(t, err)
+		var el *xmlElement
+		if root.attr("ID") == id {
+			el = root
+		} else {
+			el = root.child(assertionNamespace, "Assertion")
+		}
+		return el, el.child(dsigNamespace, "Signature")
+	}
+
+	el, signature := find()
+	digest := hash(h, canonicalize(el, signature, []string{"xs"}))
+	doc = strings.Replace(doc, "DIGEST", base64.StdEncoding.EncodeToString(digest), 1)
+
+	_, signature = find()
+	signedInfo := canonicalize(signature.child(dsigNamespace, "SignedInfo"), nil, nil)
+	signatureValue, err := rsa.SignPKCS1v15(rand.Reader, idp.key, h, hash(h, signedInfo))
+	require.NoError(t, err)
+	return strings.Replace(doc, "SIGNATURE", base64.StdEncoding.EncodeToString(signatureValue), 1)
+}
+
+func newTestProvider(t *testing.T, providerURL string) *Provider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p, err := New(context.Background(), &oauth.Options{
+		ProviderName: Name,
+		ProviderURL:  providerURL,
+		ClientID:     testSPEntityID,
+		ClientSecret: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		})),
+		RedirectURL: &url.URL{Scheme: "https", Host: "authenticate.example.com", Path: "/oauth2/callback"},
+	})
+	require.NoError(t, err)
+	return p
+}
+
+type testClaims map[string]any
+
+func (claims testClaims) SetRawIDToken(_ string) {}
+
+func TestProvider(t *testing.T) {
+	t.Parallel()
+
+	idp := newTestIdP(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, idp.metadata())
+	}))
+	t.Cleanup(srv.Close)
+
+	p := newTestProvider(t, srv.URL)
+
+	t.Run("sign in", func(t *testing.T) {
+		signInURL, err := p.GetSignInURL(context.Background(), "STATE", append(oauth.S256ChallengeOption(testVerifier),
+			oauth2.SetAuthURLParam("prompt", "login"),
+			oauth2.SetAuthURLParam("acr_values", "urn:example:mfa"))...)
+		require.NoError(t, err)
+		u, err := url.Parse(signInURL)
+		require.NoError(t, err)
+		assert.Equal(t, "idp.example.com", u.Host)
+		assert.Equal(t, "/sso/redirect", u.Path)
+		assert.Equal(t, "STATE", u.Query().Get("RelayState"))
+
+		compressed, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+		require.NoError(t, err)
+		raw, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+		require.NoError(t, err)
+		var req xmlAuthnRequest
+		require.NoError(t, xml.Unmarshal(raw, &req))
+		assert.Equal(t, getRequestID(oauth.S256Challenge(testVerifier)), req.ID)
+		assert.Equal(t, "https://idp.example.com/sso/redirect", req.Destination)
+		assert.Equal(t, testACSURL, req.AssertionConsumerServiceURL)
+		assert.Equal(t, testSPEntityID, req.Issuer)
+		assert.True(t, req.ForceAuthn)
+		if assert.NotNil(t, req.RequestedAuthnContext) {
+			assert.Equal(t, []string{"urn:example:mfa"}, req.RequestedAuthnContext.AuthnContextClassRefs)
+		}
+
+		signature, err := base64.StdEncoding.DecodeString(u.Query().Get("Signature"))
+		require.NoError(t, err)
+		signed := u.RawQuery[:strings.Index(u.RawQuery, "&Signature=")]
+		assert.NoError(t, rsa.VerifyPKCS1v15(&p.signingKey.PublicKey, crypto.SHA256,
+			hash(crypto.SHA256, []byte(signed)), signature))
+
+		_, err = p.GetSignInURL(context.Background(), "STATE")
+		assert.Error(t, err, "should require a code challenge")
+	})
+	t.Run("authenticate", func(t *testing.T) {
+		now := time.Now()
+		res := newTestResponse(now)
+		doc := idp.sign(t, res.String(), res.AssertionID)
+
+		claims := make(testClaims)
+		_, err := p.Authenticate(context.Background(), base64.StdEncoding.EncodeToString([]byte(doc)), &claims)
+		assert.ErrorContains(t, err, "missing code verifier")
+		_, err = p.Authenticate(context.Background(), base64.StdEncoding.EncodeToString([]byte(doc)), &claims,
+			oauth.VerifierOption("OTHER"))
+		assert.ErrorContains(t, err, "not in response to the authentication request")
+
+		token, err := p.Authenticate(context.Background(), base64.StdEncoding.EncodeToString([]byte(doc)), &claims,
+			oauth.VerifierOption(testVerifier))
+		require.NoError(t, err)
+		assert.Equal(t, now.Add(5*time.Minute).UTC().Truncate(time.Second), token.Expiry)
+		assert.Equal(t, testClaims{
+			"sub":                               "user-1",
+			"email":                             "user@example.com",
+			"name":                              "User & Co",
+			"groups":                            []any{"admins", "users"},
+			"displayName":                       "User & Co",
+			"department":                        "engineering",
+			"urn:oid:0.9.2342.19200300.100.1.3": "user@example.com",
+			"auth_time":                         float64(now.Add(-time.Minute).Unix()),
+			"acr":                               "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport",
+		}, claims)
+
+		_, err = p.Authenticate(context.Background(), base64.StdEncoding.EncodeToString([]byte(doc)), &claims,
+			oauth.VerifierOption(testVerifier))
+		assert.ErrorContains(t, err, "already been used", "should not allow assertions to be replayed")
+	})
+}
+
+func TestParseResponse(t *testing.T) {
+	t.Parallel()
+
+	idp := newTestIdP(t)
+	p := newTestProvider(t, idp.metadata())
+	md, err := p.getMetadata()
+	require.NoError(t, err)
+
+	sha1Provider := *p
+	sha1Provider.allowSHA1 = true
+
+	now := time.Now()
+	evilAttributes := `<saml:Attribute Name="groups"><saml:AttributeValue>owners</saml:AttributeValue></saml:Attribute>`
+	for _, tc := range []struct {
+		name     string
+		provider *Provider
+		doc      func() string
+		expect   string
+	}{
+		{"signed assertion", nil, func() string {
+			res := newTestResponse(now)
+			return idp.sign(t, res.String(), res.AssertionID)
+		}, ""},
+		{"signed response", nil, func() string {
+			res := newTestResponse(now)
+			return idp.sign(t, res.String(), res.ResponseID)
+		}, ""},
+		{"sha1", nil, func() string {
+			res := newTestResponse(now)
+			return idp.signWith(t, res.String(), res.AssertionID, crypto.SHA1, rsaSHA1SignatureAlgorithm, sha1DigestAlgorithm)
+		}, "SHA-1 signatures are insecure"},
+		{"sha1 allowed", &sha1Provider, func() string {
+			res := newTestResponse(now)
+			return idp.signWith(t, res.String(), res.AssertionID, crypto.SHA1, rsaSHA1SignatureAlgorithm, sha1DigestAlgorithm)
+		}, ""},
+		{"unsigned", nil, func() string {
+			return newTestResponse(now).String()
+		}, "neither the response nor the assertion is signed"},
+		{"other key", nil, func() string {
+			res := newTestResponse(now)
+			return newTestIdP(t).sign(t, res.String(), res.AssertionID)
+		}, "invalid signature"},
+		{"modified", nil, func() string {
+			res := newTestResponse(now)
+			doc := idp.sign(t, res.String(), res.AssertionID)
+			return strings.Replace(doc, "admins", "owners", 1)
+		}, "invalid digest"},
+		{"wrapped", nil, func() string {
+			res := newTestResponse(now)
+			doc := idp.sign(t, res.String(), res.AssertionID)
+			evil := newTestResponse(now).String()
+			evil = evil[strings.Index(evil, "<saml:Assertion"):strings.Index(evil, "</samlp:Response>")]
+			return strings.Replace(doc, "</samlp:Response>", evil+"</samlp:Response>", 1)
+		}, "exactly one assertion"},
+		{"wrapped in an unsigned assertion", nil, func() string {
+			res := newTestResponse(now)
+			doc := idp.sign(t, res.String(), res.AssertionID)
+			signed := doc[strings.Index(doc, "<saml:Assertion"):strings.Index(doc, "</samlp:Response>")]
+			evilResponse := newTestResponse(now)
+			evilResponse.Attributes = evilAttributes
+			evil := evilResponse.String()
+			evil = evil[strings.Index(evil, "<saml:Assertion"):strings.Index(evil, "</samlp:Response>")]
+			evil = strings.Replace(evil, "<saml:AttributeStatement>", "<saml:Advice>"+signed+"</saml:Advice><saml:AttributeStatement>", 1)
+			return strings.Replace(doc, signed, evil, 1)
+		}, "neither the response nor the assertion is signed"},
+		{"signature moved to an unsigned assertion", nil, func() string {
+			res := newTestResponse(now)
+			doc := idp.sign(t, res.String(), res.AssertionID)
+			signed := doc[strings.Index(doc, "<saml:Assertion"):strings.Index(doc, "</samlp:Response>")]
+			signature := doc[strings.Index(doc, "<ds:Signature") : strings.Index(doc, "</ds:Signature>")+len("</ds:Signature>")]
+			evil := newTestResponse(now)
+			evil.AssertionID = res.AssertionID
+			evil.Attributes = evilAttributes
+			evilAssertion := evil.String()
+			evilAssertion = evilAssertion[strings.Index(evilAssertion, "<saml:Assertion"):strings.Index(evilAssertion, "</samlp:Response>")]
+			evilAssertion = strings.Replace(evilAssertion, "</saml:Issuer>", "</saml:Issuer>"+signature, 1)
+			doc = strings.Replace(doc, signed, evilAssertion, 1)
+			return strings.Replace(doc, "<samlp:Status>", "<samlp:Extensions>"+signed+"</samlp:Extensions><samlp:Status>", 1)
+		}, "invalid digest"},
+		{"failed", nil, func() string {
+			res := newTestResponse(now)
+			res.Status = "urn:oasis:names:tc:SAML:2.0:status:Requester"
+			return res.String()
+		}, "status urn:oasis:names:tc:SAML:2.0:status:Requester"},
+		{"wrong issuer", nil, func() string {
+			res := newTestResponse(now)
+			res.Issuer = "https://other.example.com"
+			return idp.sign(t, res.String(), res.AssertionID)
+		}, "does not match"},
+		{"wrong audience", nil, func() string {
+			res := newTestResponse(now)
+			res.Audience = "https://other.example.com"
+			return idp.sign(t, res.String(), res.AssertionID)
+		}, "does not include"},
+		{"wrong recipient", nil, func() string {
+			res := newTestResponse(now)
+			res.Recipient = "https://other.example.com"
+			return idp.sign(t, res.String(), res.AssertionID)
+		}, "no valid bearer subject confirmation"},
+		{"unsolicited", nil, func() string {
+			res := newTestResponse(now)
+			res.InResponseTo = ""
+			res.ConfirmationInResponseTo = ""
+			return idp.sign(t, res.String(), res.AssertionID)
+		}, "not in response to the authentication request"},
+		{"wrong subject confirmation request", nil, func() string {
+			res := newTestResponse(now)
+			res.ConfirmationInResponseTo = newID()
+			return idp.sign(t, res.String(), res.AssertionID)
+		}, "no valid bearer subject confirmation"},
+		{"wrong destination", nil, func() string {
+			res := newTestResponse(now)
+			res.Destination = "https://other.example.com"
+			return idp.sign(t, res.String(), res.ResponseID)
+		}, "response destination"},
+		{"expired", nil, func() string {
+			res := newTestResponse(now)
+			res.NotOnOrAfter = now.Add(-time.Hour).UTC().Format(time.RFC3339)
+			return idp.sign(t, res.String(), res.AssertionID)
+		}, "expired"},
+		{"not yet valid", nil, func() string {
+			res := newTestResponse(now)
+			res.NotBefore = now.Add(time.Hour).UTC().Format(time.RFC3339)
+			return idp.sign(t, res.String(), res.AssertionID)
+		}, "not valid until"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			provider := p
+			if tc.provider != nil {
+				provider = tc.provider
+			}
+			_, err := provider.parseResponse(md, []byte(tc.doc()), getRequestID(oauth.S256Challenge(testVerifier)), now)
+			if tc.expect == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.expect)
+			}
+		})
+	}
+}
+
+func TestParseResponseFixtures(t *testing.T) {
+	t.Parallel()
+
+	// the responses in testdata were signed by real identity providers, see
+	// testdata/README.md
+	readFixture := func(t *testing.T, name string) []byte {
+		t.Helper()
+
+		raw, err := os.ReadFile(filepath.Join("testdata", name))
+		require.NoError(t, err)
+		return raw
+	}
+	parseTime := func(t *testing.T, value string) time.Time {
+		t.Helper()
+
+		tm, err := time.Parse(time.RFC3339, value)
+		require.NoError(t, err)
+		return tm
+	}
+
+	okta := &Provider{
+		entityID: "123",
+		acsURL:   "http://localhost:8080/v1/_saml_callback",
+	}
+	onelogin := &Provider{
+		entityID:  "https://29ee6d2e.ngrok.io/saml/metadata",
+		acsURL:    "https://29ee6d2e.ngrok.io/saml/acs",
+		allowSHA1: true,
+	}
+	oneloginSHA256Only := *onelogin
+	oneloginSHA256Only.allowSHA1 = false
+	signedAssertion := &Provider{
+		entityID:  "http://sp.example.com/demo1/metadata.php",
+		acsURL:    "http://sp.example.com/demo1/index.php?acs",
+		allowSHA1: true,
+	}
+
+	const (
+		oktaRequestID            = "_213843b4-0693-47b8-b2f6-c41e316015cc"
+		oneloginRequestID        = "id-d40c15c104b52691eccf0a2a5c8a15595be75423"
+		signedAssertionRequestID = "ONELOGIN_4fee3b046395c4e751011e97f8900b5273d56685"
+	)
+
+	for _, tc := range []struct {
+		name      string
+		provider  *Provider
+		metadata  string
+		response  string
+		requestID string
+		now       string
+		nameID    string
+		expect    string
+	}{
+		{"okta", okta, "okta_metadata.xml", "okta_response.xml",
+			oktaRequestID, "2016-03-22T19:22:57Z", "phoebe.simon@scaleft.com", ""},
+		{"okta expired", okta, "okta_metadata.xml", "okta_response.xml",
+			oktaRequestID, "2016-03-22T19:40:00Z", "", "expired"},
+		{"okta other request", okta, "okta_metadata.xml", "okta_response.xml",
+			oneloginRequestID, "2016-03-22T19:22:57Z", "", "not in response to the authentication request"},
+		{"onelogin", onelogin, "onelogin_metadata.xml", "onelogin_response.xml",
+			oneloginRequestID, "2016-01-05T17:53:12Z", "ross@kndr.org", ""},
+		{"onelogin sha1", &oneloginSHA256Only, "onelogin_metadata.xml", "onelogin_response.xml",
+			oneloginRequestID, "2016-01-05T17:53:12Z", "", "SHA-1 signatures are insecure"},
+		{"onelogin other certificate", onelogin, "signed_assertion_metadata.xml", "onelogin_response.xml",
+			oneloginRequestID, "2016-01-05T17:53:12Z", "", "invalid signature"},
+		{"signed assertion", signedAssertion, "signed_assertion_metadata.xml", "signed_assertion_response.xml",
+			signedAssertionRequestID, "2014-07-17T01:02:59Z", "_ce3d2948b4cf20146dee0a0b3dd6f69b6cf86f62d7", ""},
+
+		// signature wrapping attacks on the responses above
+		{"xsw 1", onelogin, "onelogin_metadata.xml", "xsw_1.xml",
+			oneloginRequestID, "2016-01-05T17:53:12Z", "", "signature reference #pfxed88c43d-6504-e1f1-5af0-40be7f279fc5 does not match the signed element"},
+		{"xsw 2", onelogin, "onelogin_metadata.xml", "xsw_2.xml",
+			oneloginRequestID, "2016-01-05T17:53:12Z", "", "signature reference #pfxed88c43d-6504-e1f1-5af0-40be7f279fc5 does not match the signed element"},
+		{"xsw 3", signedAssertion, "signed_assertion_metadata.xml", "xsw_3.xml",
+			signedAssertionRequestID, "2014-07-17T01:02:59Z", "", "exactly one assertion"},
+		{"xsw 4", signedAssertion, "signed_assertion_metadata.xml", "xsw_4.xml",
+			signedAssertionRequestID, "2014-07-17T01:02:59Z", "", "neither the response nor the assertion is signed"},
+		{"xsw 5", signedAssertion, "signed_assertion_metadata.xml", "xsw_5.xml",
+			signedAssertionRequestID, "2014-07-17T01:02:59Z", "", "exactly one assertion"},
+		{"xsw 6", signedAssertion, "signed_assertion_metadata.xml", "xsw_6.xml",
+			signedAssertionRequestID, "2014-07-17T01:02:59Z", "", "invalid signature"},
+		{"xsw 7", signedAssertion, "signed_assertion_metadata.xml", "xsw_7.xml",
+			signedAssertionRequestID, "2014-07-17T01:02:59Z", "", "invalid signature"},
+		{"xsw 8", signedAssertion, "signed_assertion_metadata.xml", "xsw_8.xml",
+			signedAssertionRequestID, "2014-07-17T01:02:59Z", "", "invalid signature"},
+		{"xsw 9", signedAssertion, "signed_assertion_metadata.xml", "xsw_9.xml",
+			signedAssertionRequestID, "2014-07-17T01:02:59Z", "", "invalid signature"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			md, err := parseMetadata(readFixture(t, tc.metadata))
+			require.NoError(t, err)
+
+			assertion, err := tc.provider.parseResponse(md, readFixture(t, tc.response), tc.requestID, parseTime(t, tc.now))
+			if tc.expect == "" {
+				require.NoError(t, err)
+				assert.Equal(t, tc.nameID, assertion.Subject.NameID.Value)
+			} else {
+				assert.ErrorContains(t, err, tc.expect)
+			}
+		})
+	}
+}
+
+func TestGetMetadata(t *testing.T) {
+	t.Parallel()
+
+	idp := newTestIdP(t)
+	md, err := getMetadata(context.Background(), `<md:EntitiesDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata">`+
+		`<md:EntityDescriptor entityID="https://sp.example.com"><md:SPSSODescriptor/></md:EntityDescriptor>`+
+		strings.Replace(idp.metadata(), ` xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata"`, "", 1)+
+		`</md:EntitiesDescriptor>`)
+	require.NoError(t, err)
+	assert.Equal(t, testIdPEntityID, md.entityID)
+	assert.Equal(t, "https://idp.example.com/sso/redirect", md.singleSignOnURL)
+	assert.True(t, md.wantAuthnRequestsSigned)
+	assert.Len(t, md.certificates, 1, "should only use signing certificates")
+
+	_, err = getMetadata(context.Background(), `<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="x"/>`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,177 @@
+package saml
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	_ "crypto/sha1" // for rsa-sha1 and sha1 digests
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	dsigNamespace               = "http://www.w3.org/2000/09/xmldsig#"
+	excC14NAlgorithm            = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	envelopedSignatureAlgorithm = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	rsaSHA1SignatureAlgorithm   = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
+	rsaSHA256SignatureAlgorithm = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	sha1DigestAlgorithm         = "http://www.w3.org/2000/09/xmldsig#sha1"
+	sha256DigestAlgorithm       = "http://www.w3.org/2001/04/xmlenc#sha256"
+)
+
+var (
+	signatureAlgorithms = map[string]crypto.Hash{
+		rsaSHA1SignatureAlgorithm:                           crypto.SHA1,
+		rsaSHA256SignatureAlgorithm:                         crypto.SHA256,
+		"http://www.w3.org/2001/04/xmldsig-more#rsa-sha512": crypto.SHA512,
+	}
+	digestAlgorithms = map[string]crypto.Hash{
+		sha1DigestAlgorithm:                       crypto.SHA1,
+		sha256DigestAlgorithm:                     crypto.SHA256,
+		"http://www.w3.org/2001/04/xmlenc#sha512": crypto.SHA512,
+	}
+)
+
+var (
+	// errMissingSignature indicates that an element isn't signed.
+	errMissingSignature = errors.New("identity/saml: missing signature")
+	// errSHA1NotAllowed indicates that an element is signed with SHA-1.
+	errSHA1NotAllowed = errors.New("identity/saml: SHA-1 signatures are insecure and not allowed " +
+		"unless idp_saml_allow_sha1 is set")
+)
+
+type xmlSignedInfo struct {
+	CanonicalizationMethod xmlTransform `xml:"http://www.w3.org/2000/09/xmldsig# CanonicalizationMethod"`
+	SignatureMethod        struct {
+		Algorithm string `xml:"Algorithm,attr"`
+	} `xml:"http://www.w3.org/2000/09/xmldsig# SignatureMethod"`
+	References []struct {
+		URI          string         `xml:"URI,attr"`
+		Transforms   []xmlTransform `xml:"http://www.w3.org/2000/09/xmldsig# Transforms>Transform"`
+		DigestMethod struct {
+			Algorithm string `xml:"Algorithm,attr"`
+		} `xml:"http://www.w3.org/2000/09/xmldsig# DigestMethod"`
+		DigestValue string `xml:"http://www.w3.org/2000/09/xmldsig# DigestValue"`
+	} `xml:"http://www.w3.org/2000/09/xmldsig# Reference"`
+}
+
+type xmlTransform struct {
+	Algorithm           string `xml:"Algorithm,attr"`
+	InclusiveNamespaces struct {
+		PrefixList string `xml:"PrefixList,attr"`
+	} `xml:"http://www.w3.org/2001/10/xml-exc-c14n# InclusiveNamespaces"`
+}
+
+// verifySignature verifies the enveloped signature of the element with one
+// of the certificates, and returns the canonicalized element that was signed.
+// Only the returned bytes are covered by the signature, so anything read from
+// the signed element must be read from them. SHA-1 signatures and digests are
+// rejected unless allowSHA1 is set.
+//
+// https://www.w3.org/TR/xmldsig-core1/
+func verifySignature(el *xmlElement, certificates []*x509.Certificate, allowSHA1 bool) ([]byte, error) {
+	signature := el.child(dsigNamespace, "Signature")
+	if signature == nil {
+		return nil, errMissingSignature
+	}
+	signedInfoElement := signature.child(dsigNamespace, "SignedInfo")
+	if signedInfoElement == nil {
+		return nil, fmt.Errorf("identity/saml: signature is missing signed info")
+	}
+
+	var signedInfo xmlSignedInfo
+	err := xml.Unmarshal(canonicalize(signedInfoElement, nil, nil), &signedInfo)
+	if err != nil {
+		return nil, fmt.Errorf("identity/saml: invalid signed info: %w", err)
+	}
+
+	// first verify the signature of the signed info...
+	if signedInfo.CanonicalizationMethod.Algorithm != excC14NAlgorithm {
+		return nil, fmt.Errorf("identity/saml: unsupported canonicalization method: %s",
+			signedInfo.CanonicalizationMethod.Algorithm)
+	}
+	signatureHash, ok := signatureAlgorithms[signedInfo.SignatureMethod.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("identity/saml: unsupported signature method: %s", signedInfo.SignatureMethod.Algorithm)
+	} else if signatureHash == crypto.SHA1 && !allowSHA1 {
+		return nil, errSHA1NotAllowed
+	}
+	var signatureValue []byte
+	if e := signature.child(dsigNamespace, "SignatureValue"); e != nil {
+		signatureValue, err = decodeBase64(e.text())
+		if err != nil {
+			return nil, fmt.Errorf("identity/saml: invalid signature value: %w", err)
+		}
+	}
+	hashed := hash(signatureHash, canonicalize(signedInfoElement, nil,
+		strings.Fields(signedInfo.CanonicalizationMethod.InclusiveNamespaces.PrefixList)))
+	verified := false
+	for _, certificate := range certificates {
+		publicKey, ok := certificate.PublicKey.(*rsa.PublicKey)
+		if ok && rsa.VerifyPKCS1v15(publicKey, signatureHash, hashed, signatureValue) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("identity/saml: invalid signature")
+	}
+
+	// ...and then the digest of the element
+	if len(signedInfo.References) != 1 {
+		return nil, fmt.Errorf("identity/saml: signature must have exactly one reference")
+	}
+	reference := signedInfo.References[0]
+	if id := el.attr("ID"); id == "" || reference.URI != "#"+id {
+		return nil, fmt.Errorf("identity/saml: signature reference %s does not match the signed element", reference.URI)
+	}
+	enveloped := false
+	var inclusivePrefixes []string
+	for _, transform := range reference.Transforms {
+		switch transform.Algorithm {
+		case envelopedSignatureAlgorithm:
+			enveloped = true
+		case excC14NAlgorithm:
+			inclusivePrefixes = strings.Fields(transform.InclusiveNamespaces.PrefixList)
+		default:
+			return nil, fmt.Errorf("identity/saml: unsupported signature transform: %s", transform.Algorithm)
+		}
+	}
+	if !enveloped {
+		return nil, fmt.Errorf("identity/saml: signature must be an enveloped signature")
+	}
+	digestHash, ok := digestAlgorithms[reference.DigestMethod.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("identity/saml: unsupported digest method: %s", reference.DigestMethod.Algorithm)
+	} else if digestHash == crypto.SHA1 && !allowSHA1 {
+		return nil, errSHA1NotAllowed
+	}
+	digestValue, err := decodeBase64(reference.DigestValue)
+	if err != nil {
+		return nil, fmt.Errorf("identity/saml: invalid digest value: %w", err)
+	}
+
+	signed := canonicalize(el, signature, inclusivePrefixes)
+	if !bytes.Equal(hash(digestHash, signed), digestValue) {
+		return nil, fmt.Errorf("identity/saml: invalid digest")
+	}
+	return signed, nil
+}
+
+func hash(h crypto.Hash, data []byte) []byte {
+	hh := h.New()
+	_, _ = hh.Write(data)
+	return hh.Sum(nil)
+}
+
+// decodeBase64 decodes base64 encoded xml content, which may be split across
+// lines.
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
@@ -0,0 +1,317 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/maps"
+)
+
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// An xmlElement is an element of a parsed XML document. Unlike encoding/xml,
+// prefixes are kept as written so that the element can be canonicalized.
+type xmlElement struct {
+	prefix string
+	local  string
+	// attrs are the attributes of the element, excluding namespace
+	// declarations. The Name.Space of an attribute is its prefix.
+	attrs []xml.Attr
+	// scope maps the prefixes in scope to their namespaces
+	scope map[string]string
+	// children are *xmlElement, xml.CharData or xml.ProcInst nodes
+	children []any
+}
+
+// parseXML parses an XML document. Comments are dropped, and documents with
+// directives are rejected.
+func parseXML(raw []byte) (*xmlElement, error) {
+	d := xml.NewDecoder(bytes.NewReader(raw))
+
+	var root *xmlElement
+	var stack []*xmlElement
+	for {
+		tok, err := d.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			el, err := newXMLElement(tok, stack)
+			if err != nil {
+				return nil, err
+			}
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, fmt.Errorf("identity/saml: xml document has multiple root elements")
+				}
+				root = el
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, el)
+			}
+			stack = append(stack, el)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("identity/saml: unexpected xml end element: %s", tok.Name.Local)
+			}
+			el := stack[len(stack)-1]
+			if el.prefix != tok.Name.Space || el.local != tok.Name.Local {
+				return nil, fmt.Errorf("identity/saml: xml element %s closed by %s", el.local, tok.Name.Local)
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, tok.Copy())
+			}
+		case xml.ProcInst:
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, tok.Copy())
+			}
+		case xml.Directive:
+			return nil, fmt.Errorf("identity/saml: xml directives are not supported")
+		}
+	}
+	if root == nil || len(stack) > 0 {
+		return nil, fmt.Errorf("identity/saml: incomplete xml document")
+	}
+	return root, nil
+}
+
+func newXMLElement(tok xml.StartElement, stack []*xmlElement) (*xmlElement, error) {
+	scope := map[string]string{"xml": xmlNamespace}
+	if len(stack) > 0 {
+		scope = stack[len(stack)-1].scope
+	}
+
+	el := &xmlElement{
+		prefix: tok.Name.Space,
+		local:  tok.Name.Local,
+		scope:  scope,
+	}
+	copied := false
+	for _, attr := range tok.Attr {
+		var prefix string
+		switch {
+		case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+			prefix = ""
+		case attr.Name.Space == "xmlns":
+			prefix = attr.Name.Local
+		default:
+			el.attrs = append(el.attrs, attr)
+			continue
+		}
+		// only copy the parent's scope if the element declares namespaces
+		if !copied {
+			el.scope = maps.Clone(scope)
+			copied = true
+		}
+		el.scope[prefix] = attr.Value
+	}
+
+	if _, ok := el.scope[el.prefix]; !ok && el.prefix != "" {
+		return nil, fmt.Errorf("identity/saml: undeclared xml namespace prefix: %s", el.prefix)
+	}
+	for _, attr := range el.attrs {
+		if _, ok := el.scope[attr.Name.Space]; !ok && attr.Name.Space != "" {
+			return nil, fmt.Errorf("identity/saml: undeclared xml namespace prefix: %s", attr.Name.Space)
+		}
+	}
+	return el, nil
+}
+
+// namespace returns the namespace of the element.
+func (el *xmlElement) namespace() string {
+	return el.scope[el.prefix]
+}
+
+// attr returns the value of the unprefixed attribute with the given name.
+func (el *xmlElement) attr(local string) string {
+	for _, attr := range el.attrs {
+		if attr.Name.Space == "" && attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// child returns the first child element with the given namespace and name.
+func (el *xmlElement) child(namespace, local string) *xmlElement {
+	for _, c := range el.childElements(namespace, local) {
+		return c
+	}
+	return nil
+}
+
+// childElements returns the child elements with the given namespace and
+// name.
+func (el *xmlElement) childElements(namespace, local string) []*xmlElement {
+	var elements []*xmlElement
+	for _, node := range el.children {
+		c, ok := node.(*xmlElement)
+		if ok && c.local == local && c.namespace() == namespace {
+			elements = append(elements, c)
+		}
+	}
+	return elements
+}
+
+// text returns the character data of the element.
+func (el *xmlElement) text() string {
+	var sb strings.Builder
+	for _, node := range el.children {
+		if data, ok := node.(xml.CharData); ok {
+			sb.Write(data)
+		}
+	}
+	return sb.String()
+}
+
+var (
+	canonicalTextReplacer = strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		">", "&gt;",
+		"\r", "&#xD;",
+	)
+	canonicalAttrReplacer = strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		`"`, "&quot;",
+		"\t", "&#x9;",
+		"\n", "&#xA;",
+		"\r", "&#xD;",
+	)
+)
+
+// canonicalize returns the exclusive XML canonicalization, without comments,
+// of the element. The exclude element, if set, is omitted from the output, as
+// done by the enveloped signature transform. Namespaces with the inclusive
+// prefixes are rendered as they would be by inclusive canonicalization.
+//
+// https://www.w3.org/TR/xml-exc-c14n/
+func canonicalize(el, exclude *xmlElement, inclusivePrefixes []string) []byte {
+	var buf bytes.Buffer
+	writeCanonical(&buf, el, exclude, map[string]string{}, inclusivePrefixes)
+	return buf.Bytes()
+}
+
+func writeCanonical(
+	buf *bytes.Buffer,
+	el, exclude *xmlElement,
+	rendered map[string]string,
+	inclusivePrefixes []string,
+) {
+	// namespaces are rendered when they are visibly utilized by the element or
+	// its attributes, unless an output ancestor already rendered them
+	prefixes := map[string]struct{}{el.prefix: {}}
+	for _, attr := range el.attrs {
+		if attr.Name.Space != "" {
+			prefixes[attr.Name.Space] = struct{}{}
+		}
+	}
+	for _, prefix := range inclusivePrefixes {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		if _, ok := el.scope[prefix]; ok {
+			prefixes[prefix] = struct{}{}
+		}
+	}
+	sortedPrefixes := maps.Keys(prefixes)
+	sort.Strings(sortedPrefixes)
+
+	buf.WriteString("<")
+	writeQName(buf, el.prefix, el.local)
+
+	childRendered, copied := rendered, false
+	for _, prefix := range sortedPrefixes {
+		if prefix == "xml" {
+			continue
+		}
+		namespace := el.scope[prefix]
+		previous, ok := rendered[prefix]
+		if (ok && previous == namespace) || (!ok && prefix == "" && namespace == "") {
+			continue
+		}
+
+		if !copied {
+			childRendered = maps.Clone(rendered)
+			copied = true
+		}
+		childRendered[prefix] = namespace
+
+		buf.WriteString(" ")
+		writeQName(buf, "xmlns", prefix)
+		buf.WriteString(`="`)
+		buf.WriteString(canonicalAttrReplacer.Replace(namespace))
+		buf.WriteString(`"`)
+	}
+
+	// attributes are sorted by namespace and then by local name
+	attrs := append([]xml.Attr{}, el.attrs...)
+	attrNamespace := func(attr xml.Attr) string {
+		if attr.Name.Space == "" {
+			return ""
+		}
+		return el.scope[attr.Name.Space]
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		ni, nj := attrNamespace(attrs[i]), attrNamespace(attrs[j])
+		if ni != nj {
+			return ni < nj
+		}
+		return attrs[i].Name.Local < attrs[j].Name.Local
+	})
+	for _, attr := range attrs {
+		buf.WriteString(" ")
+		writeQName(buf, attr.Name.Space, attr.Name.Local)
+		buf.WriteString(`="`)
+		buf.WriteString(canonicalAttrReplacer.Replace(attr.Value))
+		buf.WriteString(`"`)
+	}
+	buf.WriteString(">")
+
+	for _, node := range el.children {
+		switch node := node.(type) {
+		case *xmlElement:
+			if node != exclude {
+				writeCanonical(buf, node, exclude, childRendered, inclusivePrefixes)
+			}
+		case xml.CharData:
+			buf.WriteString(canonicalTextReplacer.Replace(string(node)))
+		case xml.ProcInst:
+			buf.WriteString("<?")
+			buf.WriteString(node.Target)
+			if len(node.Inst) > 0 {
+				buf.WriteString(" ")
+				buf.Write(node.Inst)
+			}
+			buf.WriteString("?>")
+		}
+	}
+
+	buf.WriteString("</")
+	writeQName(buf, el.prefix, el.local)
+	buf.WriteString(">")
+}
+
+func writeQName(buf *bytes.Buffer, prefix, local string) {
+	if prefix != "" {
+		buf.WriteString(prefix)
+		if local != "" {
+			buf.WriteString(":")
+		}
+	}
+	buf.WriteString(local)
+}
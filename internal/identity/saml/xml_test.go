@@ -0,0 +1,57 @@
+package saml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalize(t *testing.T) {
+	t.Parallel()
+
+	root, err := parseXML([]byte(`<?xml version="1.0"?>
+<a:root xmlns:a="urn:a" xmlns:b="urn:b" xmlns:unused="urn:unused" z="1" b:y="2" a="3"><!-- comment -->` +
+		`<child xmlns="urn:default" attr='x"y'>text &amp; &lt;more&gt;<![CDATA[<cdata>]]></child>` +
+		`<a:empty/><b:excluded/><none xmlns=""/></a:root>`))
+	require.NoError(t, err)
+
+	excluded := root.child("urn:b", "excluded")
+	require.NotNil(t, excluded)
+
+	assert.Equal(t, `<a:root xmlns:a="urn:a" xmlns:b="urn:b" a="3" z="1" b:y="2">`+
+		`<child xmlns="urn:default" attr="x&quot;y">text &amp; &lt;more&gt;&lt;cdata&gt;</child>`+
+		`<a:empty></a:empty><none></none></a:root>`,
+		string(canonicalize(root, excluded, nil)))
+
+	assert.Equal(t, `<a:root xmlns:a="urn:a" xmlns:b="urn:b" xmlns:unused="urn:unused" a="3" z="1" b:y="2">`+
+		`<child xmlns="urn:default" attr="x&quot;y">text &amp; &lt;more&gt;&lt;cdata&gt;</child>`+
+		`<a:empty></a:empty><b:excluded></b:excluded><none></none></a:root>`,
+		string(canonicalize(root, nil, []string{"unused"})),
+		"should render the inclusive namespaces")
+
+	assert.Equal(t, `<a:empty xmlns:a="urn:a"></a:empty>`,
+		string(canonicalize(root.child("urn:a", "empty"), nil, nil)),
+		"should render the namespaces of ancestors which aren't output")
+
+	root, err = parseXML([]byte(`<root xmlns="urn:x"><child xmlns=""/></root>`))
+	require.NoError(t, err)
+	assert.Equal(t, `<root xmlns="urn:x"><child xmlns=""></child></root>`,
+		string(canonicalize(root, nil, nil)),
+		"should undeclare the default namespace")
+}
+
+func TestParseXML(t *testing.T) {
+	t.Parallel()
+
+	for _, raw := range []string{
+		`<!DOCTYPE root [<!ENTITY e "e">]><root/>`,
+		`<a:root/>`,
+		`<root><child></root>`,
+		`<root/><root/>`,
+		``,
+	} {
+		_, err := parseXML([]byte(raw))
+		assert.Error(t, err, raw)
+	}
+}
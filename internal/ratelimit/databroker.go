@@ -0,0 +1,251 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+// DataBrokerCounterType is the type of the databroker records which store the
+// counts of each replica.
+const DataBrokerCounterType = "pomerium.io/RateLimitCounter"
+
+const (
+	dataBrokerCounterCapacity      = 100_000
+	dataBrokerCounterFlushInterval = time.Second
+	dataBrokerCounterFlushTimeout  = 3 * time.Second
+)
+
+// A DataBrokerCounterProvider provides the databroker service client for
+// sharing counts.
+type DataBrokerCounterProvider interface {
+	GetDataBrokerServiceClient() databroker.DataBrokerServiceClient
+}
+
+// A DataBrokerCounter counts requests across replicas. Each replica counts its
+// own requests in memory and periodically stores the counts in the databroker.
+// The counts of the other replicas are synced from the databroker and added to
+// the replica's own count, so the total may lag behind by about a second.
+type DataBrokerCounter struct {
+	provider DataBrokerCounterProvider
+	id       string
+	syncer   *databroker.Syncer
+
+	mu             sync.Mutex
+	local          map[counterKey]uint64
+	dirty          map[counterKey]struct{}
+	remote         map[string]remoteCount
+	remoteTotals   map[counterKey]uint64
+	hasSetCapacity bool
+}
+
+type remoteCount struct {
+	key   counterKey
+	count uint64
+}
+
+// NewDataBrokerCounter creates a new DataBrokerCounter.
+func NewDataBrokerCounter(provider DataBrokerCounterProvider) *DataBrokerCounter {
+	c := &DataBrokerCounter{
+		provider:     provider,
+		id:           uuid.NewString(),
+		local:        make(map[counterKey]uint64),
+		dirty:        make(map[counterKey]struct{}),
+		remote:       make(map[string]remoteCount),
+		remoteTotals: make(map[counterKey]uint64),
+	}
+	c.syncer = databroker.NewSyncer("rate_limit", c, databroker.WithTypeURL(DataBrokerCounterType))
+	return c
+}
+
+// Run syncs the counts of the other replicas and stores the counts of this
+// replica until the context is done.
+func (c *DataBrokerCounter) Run(ctx context.Context) error {
+	go func() {
+		ticker := time.NewTicker(dataBrokerCounterFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if err := c.flush(ctx, now); err != nil {
+					log.Error(ctx).Err(err).Msg("ratelimit: error storing counts")
+				}
+			}
+		}
+	}()
+	return c.syncer.Run(ctx)
+}
+
+// Increment increments the number of requests for the key in the window and
+// returns the total number of requests across all the replicas.
+func (c *DataBrokerCounter) Increment(key string, window Window) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := newCounterKey(key, window)
+	c.local[k]++
+	c.dirty[k] = struct{}{}
+	return c.local[k] + c.remoteTotals[k]
+}
+
+// GetDataBrokerServiceClient returns the databroker service client.
+func (c *DataBrokerCounter) GetDataBrokerServiceClient() databroker.DataBrokerServiceClient {
+	return c.provider.GetDataBrokerServiceClient()
+}
+
+// ClearRecords clears the counts of the other replicas.
+func (c *DataBrokerCounter) ClearRecords(_ context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.remote = make(map[string]remoteCount)
+	c.remoteTotals = make(map[counterKey]uint64)
+}
+
+// UpdateRecords updates the counts of the other replicas.
+func (c *DataBrokerCounter) UpdateRecords(ctx context.Context, _ uint64, records []*databroker.Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, record := range records {
+		if previous, ok := c.remote[record.GetId()]; ok {
+			c.remoteTotals[previous.key] -= previous.count
+			if c.remoteTotals[previous.key] == 0 {
+				delete(c.remoteTotals, previous.key)
+			}
+			delete(c.remote, record.GetId())
+		}
+		if record.GetDeletedAt() != nil {
+			continue
+		}
+
+		id, rc, err := decodeCounterRecord(record)
+		if err != nil {
+			log.Warn(ctx).Err(err).Str("id", record.GetId()).Msg("ratelimit: invalid counter record")
+			continue
+		}
+		if id == c.id {
+			continue
+		}
+		c.remote[record.GetId()] = rc
+		c.remoteTotals[rc.key] += rc.count
+	}
+}
+
+// flush stores the changed counts in the databroker and deletes the counts of
+// windows that have ended.
+func (c *DataBrokerCounter) flush(ctx context.Context, now time.Time) error {
+	c.mu.Lock()
+	var records []*databroker.Record
+	var keys []counterKey
+	for k := range c.dirty {
+		records = append(records, c.newRecord(k, c.local[k]))
+		keys = append(keys, k)
+	}
+	c.dirty = make(map[counterKey]struct{})
+	for k, count := range c.local {
+		if k.end().Before(now) {
+			record := c.newRecord(k, count)
+			record.DeletedAt = timestamppb.New(now)
+			records = append(records, record)
+			delete(c.local, k)
+		}
+	}
+	// forget the other replicas' counts for windows that have ended, in case
+	// a replica went away before deleting them
+	for id, rc := range c.remote {
+		if rc.key.end().Before(now) {
+			delete(c.remote, id)
+			delete(c.remoteTotals, rc.key)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dataBrokerCounterFlushTimeout)
+	defer cancel()
+
+	err := c.put(ctx, records)
+	if err != nil {
+		// try again on the next flush
+		c.mu.Lock()
+		for _, k := range keys {
+			if _, ok := c.local[k]; ok {
+				c.dirty[k] = struct{}{}
+			}
+		}
+		c.mu.Unlock()
+	}
+	return err
+}
+
+func (c *DataBrokerCounter) put(ctx context.Context, records []*databroker.Record) error {
+	client := c.provider.GetDataBrokerServiceClient()
+
+	if !c.hasSetCapacity {
+		_, err := client.SetOptions(ctx, &databroker.SetOptionsRequest{
+			Type: DataBrokerCounterType,
+			Options: &databroker.Options{
+				Capacity: proto.Uint64(dataBrokerCounterCapacity),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("ratelimit: error setting databroker capacity: %w", err)
+		}
+		c.hasSetCapacity = true
+	}
+
+	_, err := client.Put(ctx, &databroker.PutRequest{Records: records})
+	if err != nil {
+		return fmt.Errorf("ratelimit: error storing counts in databroker: %w", err)
+	}
+	return nil
+}
+
+func (c *DataBrokerCounter) newRecord(k counterKey, count uint64) *databroker.Record {
+	data := &structpb.Struct{Fields: map[string]*structpb.Value{
+		"replica_id": structpb.NewStringValue(c.id),
+		"key":        structpb.NewStringValue(k.key),
+		"start":      structpb.NewNumberValue(float64(k.start)),
+		"period":     structpb.NewNumberValue(float64(k.period.Milliseconds())),
+		"count":      structpb.NewNumberValue(float64(count)),
+	}}
+	return &databroker.Record{
+		Type: DataBrokerCounterType,
+		Id:   fmt.Sprintf("%s/%d/%d/%s", c.id, k.start, k.period.Milliseconds(), k.key),
+		Data: protoutil.NewAny(data),
+	}
+}
+
+func decodeCounterRecord(record *databroker.Record) (replicaID string, rc remoteCount, err error) {
+	var data structpb.Struct
+	if err := record.GetData().UnmarshalTo(&data); err != nil {
+		return "", rc, err
+	}
+
+	fields := data.GetFields()
+	replicaID = fields["replica_id"].GetStringValue()
+	rc.key = counterKey{
+		key:    fields["key"].GetStringValue(),
+		start:  int64(fields["start"].GetNumberValue()),
+		period: time.Duration(fields["period"].GetNumberValue()) * time.Millisecond,
+	}
+	rc.count = uint64(fields["count"].GetNumberValue())
+	return replicaID, rc, nil
+}
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type testDataBrokerClient struct {
+	databroker.DataBrokerServiceClient
+
+	options []*databroker.SetOptionsRequest
+	records []*databroker.Record
+}
+
+func (client *testDataBrokerClient) GetDataBrokerServiceClient() databroker.DataBrokerServiceClient {
+	return client
+}
+
+func (client *testDataBrokerClient) Put(_ context.Context, in *databroker.PutRequest, _ ...grpc.CallOption) (*databroker.PutResponse, error) {
+	client.records = append(client.records, in.GetRecords()...)
+	return &databroker.PutResponse{Records: in.GetRecords()}, nil
+}
+
+func (client *testDataBrokerClient) SetOptions(_ context.Context, in *databroker.SetOptionsRequest, _ ...grpc.CallOption) (*databroker.SetOptionsResponse, error) {
+	client.options = append(client.options, in)
+	return &databroker.SetOptionsResponse{Options: in.GetOptions()}, nil
+}
+
+func TestDataBrokerCounter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	window := NewWindow(now, time.Minute)
+
+	client1, client2 := new(testDataBrokerClient), new(testDataBrokerClient)
+	counter1, counter2 := NewDataBrokerCounter(client1), NewDataBrokerCounter(client2)
+
+	assert.Equal(t, uint64(1), counter1.Increment("k1", window))
+	assert.Equal(t, uint64(2), counter1.Increment("k1", window))
+	assert.Equal(t, uint64(1), counter2.Increment("k1", window))
+
+	require.NoError(t, counter1.flush(ctx, now))
+	require.NoError(t, counter2.flush(ctx, now))
+	if assert.Len(t, client1.options, 1) {
+		assert.Equal(t, DataBrokerCounterType, client1.options[0].GetType())
+	}
+	require.Len(t, client1.records, 1)
+	require.Len(t, client2.records, 1)
+
+	// sync the records of both replicas to each replica
+	records := append(client1.records, client2.records...)
+	counter1.UpdateRecords(ctx, 0, records)
+	counter2.UpdateRecords(ctx, 0, records)
+
+	assert.Equal(t, uint64(4), counter1.Increment("k1", window))
+	assert.Equal(t, uint64(4), counter2.Increment("k1", window))
+	assert.Equal(t, uint64(1), counter2.Increment("k2", window))
+
+	// updated counts replace the previous counts
+	require.NoError(t, counter1.flush(ctx, now))
+	counter2.UpdateRecords(ctx, 0, client1.records[1:])
+	assert.Equal(t, uint64(6), counter2.Increment("k1", window))
+
+	// once the window ends the counts are deleted
+	client1.records = nil
+	require.NoError(t, counter1.flush(ctx, window.End().Add(time.Second)))
+	if assert.Len(t, client1.records, 1) {
+		assert.NotNil(t, client1.records[0].GetDeletedAt())
+	}
+	assert.Empty(t, counter1.local)
+
+	counter2.UpdateRecords(ctx, 0, client1.records)
+	assert.Equal(t, uint64(4), counter2.Increment("k1", window))
+}
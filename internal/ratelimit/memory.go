@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+const memoryCounterSweepInterval = time.Minute
+
+// A MemoryCounter counts requests in memory.
+type MemoryCounter struct {
+	mu        sync.Mutex
+	counts    map[counterKey]uint64
+	lastSweep time.Time
+}
+
+// NewMemoryCounter creates a new MemoryCounter.
+func NewMemoryCounter() *MemoryCounter {
+	return &MemoryCounter{
+		counts: make(map[counterKey]uint64),
+	}
+}
+
+// Increment increments the number of requests for the key in the window and
+// returns the new count.
+func (c *MemoryCounter) Increment(key string, window Window) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sweep(window.Start)
+
+	k := newCounterKey(key, window)
+	c.counts[k]++
+	return c.counts[k]
+}
+
+// sweep removes the counts of windows that ended before now.
+func (c *MemoryCounter) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < memoryCounterSweepInterval {
+		return
+	}
+	c.lastSweep = now
+
+	for k := range c.counts {
+		if k.end().Before(now) {
+			delete(c.counts, k)
+		}
+	}
+}
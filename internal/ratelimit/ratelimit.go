@@ -0,0 +1,61 @@
+// Package ratelimit contains counters for limiting the rate of requests.
+package ratelimit
+
+import (
+	"time"
+)
+
+// A Window is a fixed interval of time requests are counted in.
+type Window struct {
+	Start  time.Time
+	Period time.Duration
+}
+
+// NewWindow returns the window with the given period that contains t. Windows
+// are aligned to the zero time, so every replica computes the same windows.
+func NewWindow(t time.Time, period time.Duration) Window {
+	return Window{Start: t.Truncate(period), Period: period}
+}
+
+// End returns the end of the window.
+func (w Window) End() time.Time {
+	return w.Start.Add(w.Period)
+}
+
+// A Limit is the maximum number of requests allowed in a period.
+type Limit struct {
+	Requests uint64
+	Period   time.Duration
+}
+
+// A Counter counts the requests made for keys in windows.
+type Counter interface {
+	// Increment increments the number of requests for the key in the window
+	// and returns the total number of requests.
+	Increment(key string, window Window) uint64
+}
+
+// Allow counts a request for the key at the given time and reports whether it
+// is within the limit. If it isn't, the amount of time until the next window
+// starts is also returned.
+func Allow(counter Counter, key string, limit Limit, now time.Time) (allowed bool, retryAfter time.Duration) {
+	window := NewWindow(now, limit.Period)
+	if counter.Increment(key, window) <= limit.Requests {
+		return true, 0
+	}
+	return false, window.End().Sub(now)
+}
+
+type counterKey struct {
+	key    string
+	start  int64
+	period time.Duration
+}
+
+func newCounterKey(key string, window Window) counterKey {
+	return counterKey{key: key, start: window.Start.UnixMilli(), period: window.Period}
+}
+
+func (k counterKey) end() time.Time {
+	return time.UnixMilli(k.start).Add(k.period)
+}
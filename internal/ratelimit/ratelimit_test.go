@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllow(t *testing.T) {
+	t.Parallel()
+
+	counter := NewMemoryCounter()
+	limit := Limit{Requests: 2, Period: time.Minute}
+	now := time.Date(2022, 1, 1, 12, 0, 15, 0, time.UTC)
+
+	allowed, _ := Allow(counter, "k1", limit, now)
+	assert.True(t, allowed)
+	allowed, _ = Allow(counter, "k1", limit, now.Add(time.Second))
+	assert.True(t, allowed)
+	allowed, retryAfter := Allow(counter, "k1", limit, now.Add(5*time.Second))
+	assert.False(t, allowed)
+	assert.Equal(t, 40*time.Second, retryAfter)
+
+	allowed, _ = Allow(counter, "k2", limit, now)
+	assert.True(t, allowed, "keys should be counted separately")
+
+	allowed, _ = Allow(counter, "k1", limit, now.Add(time.Minute))
+	assert.True(t, allowed, "should be allowed in the next window")
+}
+
+func TestMemoryCounter(t *testing.T) {
+	t.Parallel()
+
+	counter := NewMemoryCounter()
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, uint64(1), counter.Increment("k1", NewWindow(now, time.Minute)))
+	assert.Equal(t, uint64(2), counter.Increment("k1", NewWindow(now, time.Minute)))
+	assert.Equal(t, uint64(1), counter.Increment("k1", NewWindow(now, time.Hour)))
+	assert.Len(t, counter.counts, 2)
+
+	counter.Increment("k2", NewWindow(now.Add(2*time.Hour), time.Minute))
+	assert.Len(t, counter.counts, 1, "should remove the counts of windows that have ended")
+}
@@ -0,0 +1,490 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// A filter matches SCIM resources, represented as decoded JSON objects.
+//
+// https://www.rfc-editor.org/rfc/rfc7644#section-3.4.2.2
+type filter interface {
+	match(obj map[string]any) bool
+}
+
+type andFilter struct{ left, right filter }
+
+func (f andFilter) match(obj map[string]any) bool { return f.left.match(obj) && f.right.match(obj) }
+
+type orFilter struct{ left, right filter }
+
+func (f orFilter) match(obj map[string]any) bool { return f.left.match(obj) || f.right.match(obj) }
+
+type notFilter struct{ filter filter }
+
+func (f notFilter) match(obj map[string]any) bool { return !f.filter.match(obj) }
+
+// A compareFilter compares the values of an attribute to a value. Multi-valued
+// attributes match if any of their values match.
+type compareFilter struct {
+	path  []string
+	op    string
+	value any
+}
+
+func (f compareFilter) match(obj map[string]any) bool {
+	values := lookupPath(obj, f.path)
+	if f.op == "pr" || (f.op == "eq" && f.value == nil) {
+		present := false
+		for _, v := range values {
+			present = present || isPresent(v)
+		}
+		return present == (f.op == "pr")
+	}
+	if f.op == "ne" {
+		for _, v := range values {
+			if compareValues(v, "eq", f.value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		if compareValues(v, f.op, f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// A valuePathFilter matches if any of the values of a complex multi-valued
+// attribute match the nested filter, e.g. emails[type eq "work"].
+type valuePathFilter struct {
+	path   []string
+	filter filter
+}
+
+func (f valuePathFilter) match(obj map[string]any) bool {
+	for _, v := range lookupPath(obj, f.path) {
+		if m, ok := v.(map[string]any); ok && f.filter.match(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFilter parses a SCIM filter expression.
+func parseFilter(expr string) (filter, error) {
+	p, err := newFilterParser(expr)
+	if err != nil {
+		return nil, err
+	}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	return f, nil
+}
+
+// A patchPath is the target of a patch operation: an attribute, optionally
+// restricted to the values matching a filter, and a sub-attribute of those
+// values, e.g. members[value eq "u1"] or emails[type eq "work"].value.
+//
+// https://www.rfc-editor.org/rfc/rfc7644#section-3.5.2
+type patchPath struct {
+	attribute    string
+	subAttribute string
+	filter       filter
+}
+
+// parsePatchPath parses the path of a patch operation.
+func parsePatchPath(expr string) (*patchPath, error) {
+	p, err := newFilterParser(expr)
+	if err != nil {
+		return nil, err
+	}
+	if p.done() || p.peek().kind != tokenWord {
+		return nil, fmt.Errorf("invalid path %q", expr)
+	}
+	path := splitAttributePath(p.next().text)
+	if !isAttributeName(path[0]) {
+		return nil, fmt.Errorf("invalid path %q", expr)
+	}
+	pp := &patchPath{attribute: path[0]}
+	if len(path) > 1 {
+		pp.subAttribute = strings.Join(path[1:], ".")
+	}
+	if !p.done() && p.peek().kind == tokenLeftBracket {
+		if pp.subAttribute != "" {
+			return nil, fmt.Errorf("invalid path %q", expr)
+		}
+		p.next()
+		if pp.filter, err = p.parseOr(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRightBracket); err != nil {
+			return nil, err
+		}
+		if !p.done() {
+			// the tokenizer reads the sub-attribute with its leading dot
+			t := p.next()
+			if t.kind != tokenWord || !strings.HasPrefix(t.text, ".") || len(t.text) < 2 {
+				return nil, fmt.Errorf("invalid path %q", expr)
+			}
+			pp.subAttribute = t.text[1:]
+		}
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("invalid path %q", expr)
+	}
+	return pp, nil
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenLeftParen
+	tokenRightParen
+	tokenLeftBracket
+	tokenRightBracket
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+type filterParser struct {
+	tokens []token
+	pos    int
+}
+
+func newFilterParser(expr string) (*filterParser, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLeftParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRightParen, ")"})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{tokenLeftBracket, "["})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{tokenRightBracket, "]"})
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(expr) && expr[j] != '"'; j++ {
+				if expr[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf("unterminated string in %q", expr)
+			}
+			var s string
+			if err := json.Unmarshal([]byte(expr[i:j+1]), &s); err != nil {
+				return nil, fmt.Errorf("invalid string in %q: %w", expr, err)
+			}
+			tokens = append(tokens, token{tokenString, s})
+			i = j + 1
+		default:
+			j := i
+			for ; j < len(expr) && !strings.ContainsRune(" \t()[]\"", rune(expr[j])); j++ {
+			}
+			tokens = append(tokens, token{tokenWord, expr[i:j]})
+			i = j
+		}
+	}
+	return &filterParser{tokens: tokens}, nil
+}
+
+func (p *filterParser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *filterParser) peek() token { return p.tokens[p.pos] }
+
+func (p *filterParser) next() token {
+	t := p.tokens[p.pos]
+	p.pos++
+	return t
+}
+
+func (p *filterParser) peekKeyword(keyword string) bool {
+	return !p.done() && p.peek().kind == tokenWord && strings.EqualFold(p.peek().text, keyword)
+}
+
+func (p *filterParser) expect(kind tokenKind) error {
+	if p.done() {
+		return fmt.Errorf("unexpected end of filter")
+	}
+	if t := p.next(); t.kind != kind {
+		return fmt.Errorf("unexpected %q", t.text)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orFilter{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andFilter{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filter, error) {
+	if p.done() {
+		return nil, fmt.Errorf("unexpected end of filter")
+	}
+
+	if p.peekKeyword("not") {
+		p.next()
+		if err := p.expect(tokenLeftParen); err != nil {
+			return nil, err
+		}
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRightParen); err != nil {
+			return nil, err
+		}
+		return notFilter{f}, nil
+	}
+
+	t := p.next()
+	switch t.kind {
+	case tokenLeftParen:
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRightParen); err != nil {
+			return nil, err
+		}
+		return f, nil
+	case tokenWord:
+	default:
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	}
+
+	path := splitAttributePath(t.text)
+	if !p.done() && p.peek().kind == tokenLeftBracket {
+		p.next()
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRightBracket); err != nil {
+			return nil, err
+		}
+		return valuePathFilter{path: path, filter: f}, nil
+	}
+
+	if p.done() {
+		return nil, fmt.Errorf("missing operator after %q", t.text)
+	}
+	op := strings.ToLower(p.next().text)
+	switch op {
+	case "pr":
+		return compareFilter{path: path, op: op}, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, fmt.Errorf("unknown operator %q", op)
+	}
+
+	if p.done() {
+		return nil, fmt.Errorf("missing value after %q", op)
+	}
+	vt := p.next()
+	var value any
+	switch {
+	case vt.kind == tokenString:
+		value = vt.text
+	case vt.kind == tokenWord && vt.text == "true":
+		value = true
+	case vt.kind == tokenWord && vt.text == "false":
+		value = false
+	case vt.kind == tokenWord && vt.text == "null":
+		value = nil
+	case vt.kind == tokenWord:
+		var n float64
+		if err := json.Unmarshal([]byte(vt.text), &n); err != nil {
+			return nil, fmt.Errorf("invalid value %q", vt.text)
+		}
+		value = n
+	default:
+		return nil, fmt.Errorf("unexpected %q", vt.text)
+	}
+	return compareFilter{path: path, op: op, value: value}, nil
+}
+
+// splitAttributePath splits an attribute path into the attribute and its
+// sub-attributes, dropping the schema urn of fully qualified paths.
+func splitAttributePath(path string) []string {
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		path = path[strings.LastIndex(path, ":")+1:]
+	}
+	return strings.Split(path, ".")
+}
+
+// lookupPath returns the values at the path of a JSON object, flattening
+// multi-valued attributes. Attribute names are case-insensitive.
+func lookupPath(obj map[string]any, path []string) []any {
+	v, ok := lookupAttribute(obj, path[0])
+	if !ok {
+		return nil
+	}
+
+	var values []any
+	if vs, ok := v.([]any); ok {
+		values = vs
+	} else {
+		values = []any{v}
+	}
+	if len(path) == 1 {
+		return values
+	}
+
+	var result []any
+	for _, v := range values {
+		if m, ok := v.(map[string]any); ok {
+			result = append(result, lookupPath(m, path[1:])...)
+		}
+	}
+	return result
+}
+
+func lookupAttribute(obj map[string]any, name string) (any, bool) {
+	key, ok := findAttributeKey(obj, name)
+	if !ok {
+		return nil, false
+	}
+	return obj[key], true
+}
+
+func findAttributeKey(obj map[string]any, name string) (string, bool) {
+	if _, ok := obj[name]; ok {
+		return name, true
+	}
+	for k := range obj {
+		if strings.EqualFold(k, name) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+func isPresent(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	}
+	return true
+}
+
+// compareValues compares an attribute value to a filter value. Strings are
+// compared case-insensitively.
+func compareValues(v any, op string, value any) bool {
+	switch value := value.(type) {
+	case string:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		s, value = strings.ToLower(s), strings.ToLower(value)
+		switch op {
+		case "eq":
+			return s == value
+		case "co":
+			return strings.Contains(s, value)
+		case "sw":
+			return strings.HasPrefix(s, value)
+		case "ew":
+			return strings.HasSuffix(s, value)
+		case "gt":
+			return s > value
+		case "ge":
+			return s >= value
+		case "lt":
+			return s < value
+		case "le":
+			return s <= value
+		}
+	case float64:
+		n, ok := v.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return n == value
+		case "gt":
+			return n > value
+		case "ge":
+			return n >= value
+		case "lt":
+			return n < value
+		case "le":
+			return n <= value
+		}
+	case bool:
+		return op == "eq" && v == value
+	}
+	return false
+}
+
+// isAttributeName reports whether s is a valid attribute name.
+func isAttributeName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if !unicode.IsLetter(r) && (i == 0 || (!unicode.IsDigit(r) && r != '_' && r != '-' && r != '$')) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package scim
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilter(t *testing.T) {
+	t.Parallel()
+
+	var obj map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"id": "u1",
+		"userName": "Alice@example.com",
+		"active": true,
+		"name": {"givenName": "Alice"},
+		"emails": [
+			{"value": "alice@example.com", "type": "work"},
+			{"value": "alice@home.example.com", "type": "home"}
+		]
+	}`), &obj))
+
+	for _, tc := range []struct {
+		filter string
+		expect bool
+	}{
+		{`userName eq "alice@example.com"`, true},
+		{`USERNAME Eq "alice@example.com"`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName sw "alice"`, true},
+		{`userName ne "alice@example.com"`, false},
+		{`userName co "example"`, true},
+		{`userName ew ".org"`, false},
+		{`name.givenName eq "Alice"`, true},
+		{`emails.value eq "alice@home.example.com"`, true},
+		{`emails[type eq "work" and value co "home"]`, false},
+		{`emails[type eq "home" and value co "home"]`, true},
+		{`active eq true and not (userName pr)`, false},
+		{`active eq false or (id eq "u1" and title pr)`, false},
+		{`active eq false or (id eq "u1" and name pr)`, true},
+		{`displayName eq null`, true},
+	} {
+		f, err := parseFilter(tc.filter)
+		if assert.NoError(t, err, tc.filter) {
+			assert.Equal(t, tc.expect, f.match(obj), tc.filter)
+		}
+	}
+
+	for _, expr := range []string{
+		`userName`,
+		`userName xx "a"`,
+		`userName eq "a`,
+		`(userName eq "a"`,
+		`userName eq "a" and`,
+		`emails[type eq "work"`,
+	} {
+		_, err := parseFilter(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	t.Parallel()
+
+	var obj map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"displayName": "engineering",
+		"members": [{"value": "u1"}, {"value": "u2"}],
+		"name": {"givenName": "Alice"}
+	}`), &obj))
+
+	err := applyPatch(obj, []patchOperation{
+		{Op: "add", Path: "members", Value: []any{map[string]any{"value": "u2"}, map[string]any{"value": "u3"}}},
+		{Op: "Remove", Path: "members", Value: []any{map[string]any{"value": "u1"}}},
+		{Op: "replace", Path: "name.familyName", Value: "Smith"},
+		{Op: "replace", Value: map[string]any{"displayName": "platform"}},
+		{Op: "replace", Path: `members[value eq "u3"].display`, Value: "Carol"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"displayName": "platform",
+		"members":     []any{map[string]any{"value": "u2"}, map[string]any{"value": "u3", "display": "Carol"}},
+		"name":        map[string]any{"givenName": "Alice", "familyName": "Smith"},
+	}, obj)
+
+	err = applyPatch(obj, []patchOperation{{Op: "remove", Path: `members[value eq "u9"]`}})
+	var scimErr *Error
+	if assert.ErrorAs(t, err, &scimErr) {
+		assert.Equal(t, scimTypeNoTarget, scimErr.ScimType)
+	}
+
+	err = applyPatch(obj, []patchOperation{{Op: "move", Path: "displayName"}})
+	if assert.ErrorAs(t, err, &scimErr) {
+		assert.Equal(t, scimTypeInvalidSyntax, scimErr.ScimType)
+	}
+}
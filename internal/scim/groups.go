@@ -0,0 +1,391 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+	"github.com/pomerium/pomerium/pkg/slices"
+)
+
+const (
+	schemaGroup = "urn:ietf:params:scim:schemas:core:2.0:Group"
+
+	// GroupRecordType is the databroker record type of provisioned groups.
+	GroupRecordType = "pomerium.io/Group"
+
+	// GroupsClaim is the user claim listing the names of the provisioned
+	// groups a user is a member of, e.g. for a claim/scim_groups policy.
+	GroupsClaim = "scim_groups"
+)
+
+// A GroupRecord is a provisioned group stored in the databroker.
+type GroupRecord struct {
+	ID          string   `json:"id"`
+	ExternalID  string   `json:"external_id,omitempty"`
+	DisplayName string   `json:"display_name"`
+	MemberIDs   []string `json:"member_ids,omitempty"`
+}
+
+// GetMemberIDs returns the ids of the members of the group.
+func (g *GroupRecord) GetMemberIDs() []string {
+	if g == nil {
+		return nil
+	}
+	return g.MemberIDs
+}
+
+// A Group is a SCIM group resource.
+//
+// https://www.rfc-editor.org/rfc/rfc7643#section-4.2
+type Group struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	DisplayName string      `json:"displayName"`
+	Members     []Reference `json:"members,omitempty"`
+	Meta        *Meta       `json:"meta,omitempty"`
+}
+
+func (sg *Group) validate() error {
+	if sg.DisplayName == "" {
+		return newError(http.StatusBadRequest, scimTypeInvalidValue, "displayName is required")
+	}
+	for _, member := range sg.Members {
+		if member.Value == "" {
+			return newError(http.StatusBadRequest, scimTypeInvalidValue, "members require a value")
+		}
+	}
+	return nil
+}
+
+func (sg *Group) newRecord(id string) *GroupRecord {
+	g := &GroupRecord{
+		ID:          id,
+		ExternalID:  sg.ExternalID,
+		DisplayName: sg.DisplayName,
+	}
+	for _, member := range sg.Members {
+		if !slices.Contains(g.MemberIDs, member.Value) {
+			g.MemberIDs = append(g.MemberIDs, member.Value)
+		}
+	}
+	return g
+}
+
+func (h *Handler) newGroupResource(r *http.Request, g *GroupRecord) *Group {
+	sg := &Group{
+		Schemas:     []string{schemaGroup},
+		ID:          g.ID,
+		ExternalID:  g.ExternalID,
+		DisplayName: g.DisplayName,
+		Meta: &Meta{
+			ResourceType: "Group",
+			Location:     h.location(r, "Groups", g.ID),
+		},
+	}
+	for _, memberID := range g.MemberIDs {
+		sg.Members = append(sg.Members, Reference{
+			Value: memberID,
+			Ref:   h.location(r, "Users", memberID),
+		})
+	}
+	return sg
+}
+
+func (h *Handler) listGroups(w http.ResponseWriter, r *http.Request, state *State) error {
+	groups, err := listGroupRecords(r.Context(), state.Client, "")
+	if err != nil {
+		return err
+	}
+
+	resources := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		resources = append(resources, h.newGroupResource(r, g))
+	}
+	return renderList(w, r, resources, func(sg *Group) string { return sg.ID })
+}
+
+func (h *Handler) getGroup(w http.ResponseWriter, r *http.Request, state *State) error {
+	g, err := GetGroup(r.Context(), state.Client, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+	renderSCIM(w, http.StatusOK, h.newGroupResource(r, g))
+	return nil
+}
+
+func (h *Handler) createGroup(w http.ResponseWriter, r *http.Request, state *State) error {
+	var sg Group
+	if err := decodeRequest(r, &sg); err != nil {
+		return err
+	}
+	if err := sg.validate(); err != nil {
+		return err
+	}
+
+	g, err := saveGroup(r.Context(), state.Client, nil, sg.newRecord(uuid.NewString()))
+	if err != nil {
+		return err
+	}
+
+	resource := h.newGroupResource(r, g)
+	w.Header().Set("Location", resource.Meta.Location)
+	renderSCIM(w, http.StatusCreated, resource)
+	return nil
+}
+
+func (h *Handler) replaceGroup(w http.ResponseWriter, r *http.Request, state *State) error {
+	existing, err := GetGroup(r.Context(), state.Client, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	var sg Group
+	if err := decodeRequest(r, &sg); err != nil {
+		return err
+	}
+	if err := sg.validate(); err != nil {
+		return err
+	}
+
+	g, err := saveGroup(r.Context(), state.Client, existing, sg.newRecord(existing.ID))
+	if err != nil {
+		return err
+	}
+	renderSCIM(w, http.StatusOK, h.newGroupResource(r, g))
+	return nil
+}
+
+func (h *Handler) patchGroup(w http.ResponseWriter, r *http.Request, state *State) error {
+	existing, err := GetGroup(r.Context(), state.Client, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	sg := h.newGroupResource(r, existing)
+	if err := decodePatchRequest(r, sg); err != nil {
+		return err
+	}
+	if err := sg.validate(); err != nil {
+		return err
+	}
+
+	g, err := saveGroup(r.Context(), state.Client, existing, sg.newRecord(existing.ID))
+	if err != nil {
+		return err
+	}
+	renderSCIM(w, http.StatusOK, h.newGroupResource(r, g))
+	return nil
+}
+
+func (h *Handler) deleteGroup(w http.ResponseWriter, r *http.Request, state *State) error {
+	ctx := r.Context()
+
+	g, err := GetGroup(ctx, state.Client, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	record, err := newGroupRecord(g)
+	if err != nil {
+		return err
+	}
+	record.DeletedAt = timestamppb.Now()
+	if _, err := state.Client.Put(ctx, &databroker.PutRequest{Records: []*databroker.Record{record}}); err != nil {
+		return err
+	}
+	if err := syncUserGroups(ctx, state.Client, g.MemberIDs...); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// saveGroup saves a group, and updates the groups claim of the members that
+// were added or removed.
+func saveGroup(ctx context.Context, client databroker.DataBrokerServiceClient, existing, g *GroupRecord) (*GroupRecord, error) {
+	groups, err := listGroupRecords(ctx, client, g.DisplayName)
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range groups {
+		if other.ID != g.ID && strings.EqualFold(other.DisplayName, g.DisplayName) {
+			return nil, newError(http.StatusConflict, scimTypeUniqueness, "displayName %s is already in use", g.DisplayName)
+		}
+	}
+
+	record, err := newGroupRecord(g)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := client.Put(ctx, &databroker.PutRequest{Records: []*databroker.Record{record}}); err != nil {
+		return nil, err
+	}
+
+	// a renamed group changes the claim of all its members
+	var changed []string
+	for _, memberID := range g.MemberIDs {
+		if existing == nil || existing.DisplayName != g.DisplayName || !slices.Contains(existing.MemberIDs, memberID) {
+			changed = append(changed, memberID)
+		}
+	}
+	for _, memberID := range existing.GetMemberIDs() {
+		if !slices.Contains(g.MemberIDs, memberID) {
+			changed = append(changed, memberID)
+		}
+	}
+	return g, syncUserGroups(ctx, client, changed...)
+}
+
+// GetGroup gets a provisioned group from the databroker.
+func GetGroup(ctx context.Context, client databroker.DataBrokerServiceClient, groupID string) (*GroupRecord, error) {
+	res, err := client.Get(ctx, &databroker.GetRequest{
+		Type: GroupRecordType,
+		Id:   groupID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return decodeGroupRecord(res.GetRecord())
+}
+
+// GetUserGroups gets the provisioned groups a user is a member of.
+func GetUserGroups(ctx context.Context, client databroker.DataBrokerServiceClient, userID string) ([]*GroupRecord, error) {
+	groups, err := listGroupRecords(ctx, client, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the query matches any field, so only keep the user's groups
+	var userGroups []*GroupRecord
+	for _, g := range groups {
+		if slices.Contains(g.MemberIDs, userID) {
+			userGroups = append(userGroups, g)
+		}
+	}
+	return userGroups, nil
+}
+
+// removeGroupMember removes a deleted user from the groups it is a member of.
+func removeGroupMember(ctx context.Context, client databroker.DataBrokerServiceClient, userID string) error {
+	groups, err := GetUserGroups(ctx, client, userID)
+	if err != nil {
+		return err
+	}
+
+	var records []*databroker.Record
+	for _, g := range groups {
+		g.MemberIDs = slices.Remove(g.MemberIDs, userID)
+		record, err := newGroupRecord(g)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	_, err = client.Put(ctx, &databroker.PutRequest{Records: records})
+	return err
+}
+
+// syncUserGroups sets the groups claim of the users to the names of the
+// provisioned groups they are a member of.
+func syncUserGroups(ctx context.Context, client databroker.DataBrokerServiceClient, userIDs ...string) error {
+	for _, userID := range userIDs {
+		u, err := user.Get(ctx, client, userID)
+		if status.Code(err) == codes.NotFound {
+			// the user has not been provisioned yet
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		groups, err := GetUserGroups(ctx, client, userID)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(groups))
+		for _, g := range groups {
+			names = append(names, g.DisplayName)
+		}
+		sort.Strings(names)
+
+		if len(names) == 0 {
+			delete(u.Claims, GroupsClaim)
+		} else {
+			values := make([]*structpb.Value, 0, len(names))
+			for _, name := range names {
+				values = append(values, structpb.NewStringValue(name))
+			}
+			setClaim(u, GroupsClaim, values...)
+		}
+		if _, err := databroker.Put(ctx, client, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func listGroupRecords(ctx context.Context, client databroker.DataBrokerServiceClient, query string) ([]*GroupRecord, error) {
+	records, err := queryRecords(ctx, client, GroupRecordType, query)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]*GroupRecord, 0, len(records))
+	for _, record := range records {
+		g, err := decodeGroupRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+func newGroupRecord(g *GroupRecord) (*databroker.Record, error) {
+	bs, err := json.Marshal(g)
+	if err != nil {
+		return nil, err
+	}
+	data := new(structpb.Struct)
+	if err := data.UnmarshalJSON(bs); err != nil {
+		return nil, err
+	}
+	return &databroker.Record{
+		Type: GroupRecordType,
+		Id:   g.ID,
+		Data: protoutil.NewAny(data),
+	}, nil
+}
+
+func decodeGroupRecord(record *databroker.Record) (*GroupRecord, error) {
+	var data structpb.Struct
+	if err := record.GetData().UnmarshalTo(&data); err != nil {
+		return nil, err
+	}
+	bs, err := data.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	g := new(GroupRecord)
+	if err := json.Unmarshal(bs, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
@@ -0,0 +1,209 @@
+package scim
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// A patchRequest modifies a resource.
+//
+// https://www.rfc-editor.org/rfc/rfc7644#section-3.5.2
+type patchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []patchOperation `json:"Operations"`
+}
+
+type patchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+// applyPatch applies the patch operations to a resource, represented as a
+// decoded JSON object.
+func applyPatch(obj map[string]any, ops []patchOperation) error {
+	for _, op := range ops {
+		if err := applyPatchOperation(obj, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyPatchOperation(obj map[string]any, op patchOperation) error {
+	// operation names are case-insensitive, Azure AD sends them capitalized
+	kind := strings.ToLower(op.Op)
+	switch kind {
+	case "add", "replace", "remove":
+	default:
+		return newError(http.StatusBadRequest, scimTypeInvalidSyntax, "unknown patch operation %q", op.Op)
+	}
+
+	// without a path the value holds the attributes to modify
+	if op.Path == "" {
+		if kind == "remove" {
+			return newError(http.StatusBadRequest, scimTypeNoTarget, "remove operations require a path")
+		}
+		values, ok := op.Value.(map[string]any)
+		if !ok {
+			return newError(http.StatusBadRequest, scimTypeInvalidValue, "%s operations without a path require an object value", kind)
+		}
+		for name, value := range values {
+			if err := applyPatchOperation(obj, patchOperation{Op: kind, Path: name, Value: value}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	pp, err := parsePatchPath(op.Path)
+	if err != nil {
+		return newError(http.StatusBadRequest, scimTypeInvalidPath, "%s", err)
+	}
+
+	if pp.filter != nil {
+		return applyFilteredPatchOperation(obj, kind, pp, op.Value)
+	}
+
+	if pp.subAttribute != "" {
+		key, ok := findAttributeKey(obj, pp.attribute)
+		if !ok {
+			key = pp.attribute
+		}
+		m, _ := obj[key].(map[string]any)
+		if m == nil {
+			if kind == "remove" {
+				return nil
+			}
+			m = make(map[string]any)
+			obj[key] = m
+		}
+		applyAttributeOperation(m, kind, pp.subAttribute, op.Value)
+		return nil
+	}
+
+	applyAttributeOperation(obj, kind, pp.attribute, op.Value)
+	return nil
+}
+
+// applyFilteredPatchOperation applies an operation to the values of a
+// multi-valued attribute matching the path filter.
+func applyFilteredPatchOperation(obj map[string]any, kind string, pp *patchPath, value any) error {
+	key, _ := findAttributeKey(obj, pp.attribute)
+	values, _ := obj[key].([]any)
+
+	matched := false
+	result := make([]any, 0, len(values))
+	for _, v := range values {
+		m, ok := v.(map[string]any)
+		if !ok || !pp.filter.match(m) {
+			result = append(result, v)
+			continue
+		}
+		matched = true
+
+		switch {
+		case kind == "remove" && pp.subAttribute == "":
+			continue
+		case pp.subAttribute != "":
+			applyAttributeOperation(m, kind, pp.subAttribute, value)
+		default:
+			vm, ok := value.(map[string]any)
+			if !ok {
+				return newError(http.StatusBadRequest, scimTypeInvalidValue, "%s requires an object value", pp.attribute)
+			}
+			for k, v := range vm {
+				applyAttributeOperation(m, "replace", k, v)
+			}
+		}
+		result = append(result, m)
+	}
+	if !matched {
+		return newError(http.StatusBadRequest, scimTypeNoTarget, "no values of %s match the path filter", pp.attribute)
+	}
+	obj[key] = result
+	return nil
+}
+
+func applyAttributeOperation(obj map[string]any, kind, name string, value any) {
+	key, ok := findAttributeKey(obj, name)
+	if !ok {
+		key = name
+	}
+	existing := obj[key]
+
+	switch kind {
+	case "add":
+		switch existing := existing.(type) {
+		case []any:
+			obj[key] = appendValues(existing, toValues(value))
+			return
+		case map[string]any:
+			if vm, ok := value.(map[string]any); ok {
+				for k, v := range vm {
+					applyAttributeOperation(existing, "replace", k, v)
+				}
+				return
+			}
+		}
+		obj[key] = value
+	case "replace":
+		obj[key] = value
+	case "remove":
+		// a value removes only the matching values of a multi-valued
+		// attribute, as sent by Azure AD for group members
+		if vs, ok := existing.([]any); ok && value != nil {
+			obj[key] = removeValues(vs, toValues(value))
+			return
+		}
+		delete(obj, key)
+	}
+}
+
+func toValues(value any) []any {
+	if vs, ok := value.([]any); ok {
+		return vs
+	}
+	return []any{value}
+}
+
+func appendValues(values, added []any) []any {
+	for _, a := range added {
+		if indexOfValue(values, a) < 0 {
+			values = append(values, a)
+		}
+	}
+	return values
+}
+
+func removeValues(values, removed []any) []any {
+	result := make([]any, 0, len(values))
+	for _, v := range values {
+		if indexOfValue(removed, v) < 0 {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// indexOfValue returns the index of a value in a multi-valued attribute.
+// Complex values are identified by their "value" sub-attribute.
+func indexOfValue(values []any, value any) int {
+	vm, _ := value.(map[string]any)
+	for i, v := range values {
+		m, _ := v.(map[string]any)
+		if vm != nil && m != nil {
+			if id, ok := lookupAttribute(vm, "value"); ok {
+				if other, ok := lookupAttribute(m, "value"); ok && reflect.DeepEqual(id, other) {
+					return i
+				}
+				continue
+			}
+		}
+		if reflect.DeepEqual(v, value) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,384 @@
+// Package scim contains a SCIM 2.0 server, which identity providers use to
+// provision users and groups into the databroker.
+//
+// https://www.rfc-editor.org/rfc/rfc7644
+package scim
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+const (
+	schemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	schemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	schemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+	scimTypeInvalidFilter = "invalidFilter"
+	scimTypeInvalidPath   = "invalidPath"
+	scimTypeInvalidSyntax = "invalidSyntax"
+	scimTypeInvalidValue  = "invalidValue"
+	scimTypeNoTarget      = "noTarget"
+	scimTypeUniqueness    = "uniqueness"
+
+	contentType = "application/scim+json"
+
+	maxRequestSize   = 1 << 20
+	defaultListCount = 100
+	maxListCount     = 1000
+)
+
+// An Error is a SCIM error response.
+//
+// https://www.rfc-editor.org/rfc/rfc7644#section-3.12
+type Error struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func newError(status int, scimType, format string, args ...any) *Error {
+	return &Error{Status: status, ScimType: scimType, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Error implements the error interface.
+func (err *Error) Error() string {
+	return fmt.Sprintf("scim: %d %s", err.Status, err.Detail)
+}
+
+type errorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// State is the state needed by the Handler to handle requests.
+type State struct {
+	// BearerToken authenticates the identity provider. If it is empty the
+	// server is disabled.
+	BearerToken string
+	Client      databroker.DataBrokerServiceClient
+}
+
+// A StateProvider provides state for the handler.
+type StateProvider = func(*http.Request) (*State, error)
+
+// Handler is the SCIM 2.0 server.
+type Handler struct {
+	prefix   string
+	getState StateProvider
+	router   *mux.Router
+}
+
+// New creates a new Handler serving the SCIM endpoints under the path prefix.
+func New(prefix string, getState StateProvider) *Handler {
+	h := &Handler{
+		prefix:   prefix,
+		getState: getState,
+	}
+
+	h.router = mux.NewRouter()
+	h.router.NotFoundHandler = h.handlerFunc(func(w http.ResponseWriter, r *http.Request, state *State) error {
+		return newError(http.StatusNotFound, "", "unknown endpoint %s", r.URL.Path)
+	})
+	h.router.MethodNotAllowedHandler = h.handlerFunc(func(w http.ResponseWriter, r *http.Request, state *State) error {
+		return newError(http.StatusMethodNotAllowed, "", "method %s is not allowed", r.Method)
+	})
+
+	sr := h.router.PathPrefix(prefix).Subrouter()
+	sr.Path("/ServiceProviderConfig").Handler(h.handlerFunc(h.getServiceProviderConfig)).Methods(http.MethodGet)
+	sr.Path("/Users").Handler(h.handlerFunc(h.listUsers)).Methods(http.MethodGet)
+	sr.Path("/Users").Handler(h.handlerFunc(h.createUser)).Methods(http.MethodPost)
+	sr.Path("/Users/{id}").Handler(h.handlerFunc(h.getUser)).Methods(http.MethodGet)
+	sr.Path("/Users/{id}").Handler(h.handlerFunc(h.replaceUser)).Methods(http.MethodPut)
+	sr.Path("/Users/{id}").Handler(h.handlerFunc(h.patchUser)).Methods(http.MethodPatch)
+	sr.Path("/Users/{id}").Handler(h.handlerFunc(h.deleteUser)).Methods(http.MethodDelete)
+	sr.Path("/Groups").Handler(h.handlerFunc(h.listGroups)).Methods(http.MethodGet)
+	sr.Path("/Groups").Handler(h.handlerFunc(h.createGroup)).Methods(http.MethodPost)
+	sr.Path("/Groups/{id}").Handler(h.handlerFunc(h.getGroup)).Methods(http.MethodGet)
+	sr.Path("/Groups/{id}").Handler(h.handlerFunc(h.replaceGroup)).Methods(http.MethodPut)
+	sr.Path("/Groups/{id}").Handler(h.handlerFunc(h.patchGroup)).Methods(http.MethodPatch)
+	sr.Path("/Groups/{id}").Handler(h.handlerFunc(h.deleteGroup)).Methods(http.MethodDelete)
+
+	return h
+}
+
+// ServeHTTP serves the HTTP handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.router.ServeHTTP(w, r)
+}
+
+// handlerFunc authenticates requests and renders returned errors as SCIM
+// error responses.
+func (h *Handler) handlerFunc(fn func(w http.ResponseWriter, r *http.Request, state *State) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := h.serve(w, r, fn)
+		if err == nil {
+			return
+		}
+
+		var scimErr *Error
+		switch {
+		case errors.As(err, &scimErr):
+		case status.Code(err) == codes.NotFound:
+			scimErr = newError(http.StatusNotFound, "", "resource not found")
+		default:
+			log.Error(r.Context()).Err(err).Msg("scim: error handling request")
+			scimErr = newError(http.StatusInternalServerError, "", "internal error")
+		}
+		if scimErr.Status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+		}
+		renderSCIM(w, scimErr.Status, errorResponse{
+			Schemas:  []string{schemaError},
+			Status:   strconv.Itoa(scimErr.Status),
+			ScimType: scimErr.ScimType,
+			Detail:   scimErr.Detail,
+		})
+	})
+}
+
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request, fn func(w http.ResponseWriter, r *http.Request, state *State) error) error {
+	state, err := h.getState(r)
+	if err != nil {
+		return err
+	}
+	if state.BearerToken == "" {
+		return newError(http.StatusNotFound, "", "scim is not enabled")
+	}
+
+	var token string
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		token = auth[7:]
+	}
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(state.BearerToken)) != 1 {
+		return newError(http.StatusUnauthorized, "", "invalid bearer token")
+	}
+
+	return fn(w, r, state)
+}
+
+func (h *Handler) getServiceProviderConfig(w http.ResponseWriter, r *http.Request, state *State) error {
+	renderSCIM(w, http.StatusOK, map[string]any{
+		"schemas":        []string{schemaServiceProviderConfig},
+		"patch":          map[string]any{"supported": true},
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": maxListCount},
+		"changePassword": map[string]any{"supported": false},
+		"sort":           map[string]any{"supported": false},
+		"etag":           map[string]any{"supported": false},
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication using the bearer token from the scim settings",
+			"primary":     true,
+		}},
+	})
+	return nil
+}
+
+// location returns the url of a resource.
+func (h *Handler) location(r *http.Request, resourceType, id string) string {
+	u := url.URL{
+		Scheme: "https",
+		Host:   r.Host,
+		Path:   h.prefix + "/" + resourceType + "/" + id,
+	}
+	return u.String()
+}
+
+// A Meta holds the metadata of a resource.
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location,omitempty"`
+}
+
+// A Reference references another resource.
+type Reference struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type listResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+// renderList filters the resources with the filter query parameter and
+// renders the page selected by the startIndex and count query parameters.
+func renderList[T any](w http.ResponseWriter, r *http.Request, resources []T, id func(T) string) error {
+	var f filter
+	if expr := r.FormValue("filter"); expr != "" {
+		var err error
+		f, err = parseFilter(expr)
+		if err != nil {
+			return newError(http.StatusBadRequest, scimTypeInvalidFilter, "%s", err)
+		}
+	}
+
+	startIndex, count := 1, defaultListCount
+	if v := r.FormValue("startIndex"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return newError(http.StatusBadRequest, scimTypeInvalidValue, "invalid startIndex: %s", v)
+		}
+		// values less than one are interpreted as one
+		if i > 1 {
+			startIndex = i
+		}
+	}
+	if v := r.FormValue("count"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return newError(http.StatusBadRequest, scimTypeInvalidValue, "invalid count: %s", v)
+		}
+		count = i
+	}
+	if count < 0 {
+		count = 0
+	} else if count > maxListCount {
+		count = maxListCount
+	}
+
+	sort.Slice(resources, func(i, j int) bool {
+		return id(resources[i]) < id(resources[j])
+	})
+
+	var matched []any
+	for _, resource := range resources {
+		if f != nil {
+			obj, err := toObject(resource)
+			if err != nil {
+				return err
+			}
+			if !f.match(obj) {
+				continue
+			}
+		}
+		matched = append(matched, resource)
+	}
+
+	page := []any{}
+	if startIndex <= len(matched) {
+		page = matched[startIndex-1:]
+		if len(page) > count {
+			page = page[:count]
+		}
+	}
+
+	renderSCIM(w, http.StatusOK, listResponse{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: len(matched),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	})
+	return nil
+}
+
+// queryRecords queries all the records of a type matching the query.
+func queryRecords(ctx context.Context, client databroker.DataBrokerServiceClient, recordType, query string) ([]*databroker.Record, error) {
+	const pageSize = 1000
+
+	var records []*databroker.Record
+	for {
+		res, err := client.Query(ctx, &databroker.QueryRequest{
+			Type:   recordType,
+			Query:  query,
+			Offset: int64(len(records)),
+			Limit:  pageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, res.GetRecords()...)
+		if len(res.GetRecords()) == 0 || int64(len(records)) >= res.GetTotalCount() {
+			return records, nil
+		}
+	}
+}
+
+// decodeRequest decodes the JSON body of a request.
+func decodeRequest(r *http.Request, v any) error {
+	bs, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(bs, v); err != nil {
+		return newError(http.StatusBadRequest, scimTypeInvalidSyntax, "invalid request body: %s", err)
+	}
+	return nil
+}
+
+// decodePatchRequest decodes a patch request and applies it to the resource.
+func decodePatchRequest[T any](r *http.Request, resource *T) error {
+	var req patchRequest
+	if err := decodeRequest(r, &req); err != nil {
+		return err
+	}
+
+	obj, err := toObject(resource)
+	if err != nil {
+		return err
+	}
+	if err := applyPatch(obj, req.Operations); err != nil {
+		return err
+	}
+	bs, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	var patched T
+	if err := json.Unmarshal(bs, &patched); err != nil {
+		return newError(http.StatusBadRequest, scimTypeInvalidValue, "invalid patch: %s", err)
+	}
+	*resource = patched
+	return nil
+}
+
+// toObject converts a resource to a decoded JSON object.
+func toObject(v any) (map[string]any, error) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(bs, &obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func renderSCIM(w http.ResponseWriter, code int, v any) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	_, _ = w.Write(bs)
+}
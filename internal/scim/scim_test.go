@@ -0,0 +1,244 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	internal_databroker "github.com/pomerium/pomerium/internal/databroker"
+	"github.com/pomerium/pomerium/internal/identity"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func newTestDataBrokerClient(t *testing.T) databroker.DataBrokerServiceClient {
+	t.Helper()
+
+	li := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	databroker.RegisterDataBrokerServiceServer(srv, internal_databroker.New())
+	go func() { _ = srv.Serve(li) }()
+	t.Cleanup(srv.Stop)
+
+	cc, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return li.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cc.Close() })
+
+	return databroker.NewDataBrokerServiceClient(cc)
+}
+
+type testSCIMClient struct {
+	t       *testing.T
+	handler http.Handler
+	token   string
+}
+
+func (c *testSCIMClient) do(method, path string, body any) (int, map[string]any) {
+	c.t.Helper()
+
+	var r *http.Request
+	if body != nil {
+		bs, err := json.Marshal(body)
+		require.NoError(c.t, err)
+		r = httptest.NewRequest(method, "https://authenticate.example.com/scim/v2"+path, strings.NewReader(string(bs)))
+	} else {
+		r = httptest.NewRequest(method, "https://authenticate.example.com/scim/v2"+path, nil)
+	}
+	r.Header.Set("Authorization", "Bearer "+c.token)
+	w := httptest.NewRecorder()
+	c.handler.ServeHTTP(w, r)
+
+	var res map[string]any
+	if w.Body.Len() > 0 {
+		assert.Equal(c.t, contentType, w.Header().Get("Content-Type"))
+		require.NoError(c.t, json.Unmarshal(w.Body.Bytes(), &res))
+	}
+	return w.Code, res
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	t.Cleanup(clearTimeout)
+
+	client := newTestDataBrokerClient(t)
+	h := New("/scim/v2", func(r *http.Request) (*State, error) {
+		return &State{BearerToken: "TOKEN", Client: client}, nil
+	})
+	c := &testSCIMClient{t: t, handler: h, token: "TOKEN"}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		c := &testSCIMClient{t: t, handler: h, token: "WRONG"}
+		code, res := c.do(http.MethodGet, "/Users", nil)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, "401", res["status"])
+	})
+
+	// a user that signed in before being provisioned
+	_, err := databroker.Put(ctx, client, &user.User{Id: "u1", Email: "alice@example.com"})
+	require.NoError(t, err)
+	_, err = session.Put(ctx, client, &session.Session{Id: "s1", UserId: "u1"})
+	require.NoError(t, err)
+	_, err = session.Put(ctx, client, &session.Session{Id: "s2", UserId: "u2"})
+	require.NoError(t, err)
+
+	code, res := c.do(http.MethodPost, "/Users", map[string]any{
+		"schemas":    []string{schemaUser},
+		"externalId": "u1",
+		"userName":   "alice@example.com",
+		"name":       map[string]any{"givenName": "Alice", "familyName": "Smith"},
+		"active":     true,
+	})
+	require.Equal(t, http.StatusCreated, code, res)
+	assert.Equal(t, "u1", res["id"])
+	assert.Equal(t, "Alice Smith", res["displayName"])
+
+	code, res = c.do(http.MethodPost, "/Users", map[string]any{
+		"externalId": "u2",
+		"userName":   "bob@example.com",
+		"emails":     []map[string]any{{"value": "bob@example.com", "primary": true}},
+	})
+	require.Equal(t, http.StatusCreated, code, res)
+
+	t.Run("duplicate user", func(t *testing.T) {
+		code, res := c.do(http.MethodPost, "/Users", map[string]any{
+			"externalId": "u3",
+			"userName":   "ALICE@example.com",
+		})
+		assert.Equal(t, http.StatusConflict, code)
+		assert.Equal(t, scimTypeUniqueness, res["scimType"])
+	})
+
+	t.Run("filter users", func(t *testing.T) {
+		code, res := c.do(http.MethodGet, "/Users?filter="+url.QueryEscape(`userName eq "bob@example.com"`), nil)
+		require.Equal(t, http.StatusOK, code, res)
+		assert.Equal(t, float64(1), res["totalResults"])
+		resources := res["Resources"].([]any)
+		assert.Equal(t, "u2", resources[0].(map[string]any)["id"])
+
+		code, res = c.do(http.MethodGet, "/Users?filter="+url.QueryEscape(`userName eq`), nil)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, scimTypeInvalidFilter, res["scimType"])
+	})
+
+	code, res = c.do(http.MethodPost, "/Groups", map[string]any{
+		"displayName": "engineering",
+		"members":     []map[string]any{{"value": "u1"}},
+	})
+	require.Equal(t, http.StatusCreated, code, res)
+	groupID := res["id"].(string)
+
+	u, err := user.Get(ctx, client, "u1")
+	require.NoError(t, err)
+	assert.Equal(t, []any{"engineering"}, u.GetClaim(GroupsClaim))
+
+	t.Run("patch group", func(t *testing.T) {
+		code, res := c.do(http.MethodPatch, "/Groups/"+groupID, map[string]any{
+			"schemas": []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+			"Operations": []map[string]any{
+				{"op": "add", "path": "members", "value": []map[string]any{{"value": "u2"}}},
+				{"op": "remove", "path": `members[value eq "u1"]`},
+				{"op": "replace", "path": "displayName", "value": "platform"},
+			},
+		})
+		require.Equal(t, http.StatusOK, code, res)
+		assert.Equal(t, "platform", res["displayName"])
+
+		u1, err := user.Get(ctx, client, "u1")
+		require.NoError(t, err)
+		assert.Empty(t, u1.GetClaim(GroupsClaim))
+		u2, err := user.Get(ctx, client, "u2")
+		require.NoError(t, err)
+		assert.Equal(t, []any{"platform"}, u2.GetClaim(GroupsClaim))
+	})
+
+	t.Run("deactivate user", func(t *testing.T) {
+		code, res := c.do(http.MethodPatch, "/Users/u1", map[string]any{
+			"Operations": []map[string]any{
+				{"op": "Replace", "path": "active", "value": "False"},
+			},
+		})
+		require.Equal(t, http.StatusOK, code, res)
+		assert.Equal(t, false, res["active"])
+
+		_, err := session.Get(ctx, client, "s1")
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		_, err = session.Get(ctx, client, "s2")
+		assert.NoError(t, err)
+	})
+
+	t.Run("delete user", func(t *testing.T) {
+		code, _ := c.do(http.MethodDelete, "/Users/u2", nil)
+		require.Equal(t, http.StatusNoContent, code)
+
+		_, err := session.Get(ctx, client, "s2")
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		u2, err := user.Get(ctx, client, "u2")
+		require.NoError(t, err)
+		assert.True(t, IsUserDeactivated(u2), "deleted users should be kept deactivated")
+
+		g, err := GetGroup(ctx, client, groupID)
+		require.NoError(t, err)
+		assert.Empty(t, g.MemberIDs)
+
+		code, _ = c.do(http.MethodGet, "/Users/u2", nil)
+		assert.Equal(t, http.StatusNotFound, code)
+		code, res := c.do(http.MethodGet, "/Users?filter="+url.QueryEscape(`userName eq "bob@example.com"`), nil)
+		require.Equal(t, http.StatusOK, code, res)
+		assert.Equal(t, float64(0), res["totalResults"])
+
+		// signing in again updates the existing user record
+		u2, err = user.Get(ctx, client, "u2")
+		require.NoError(t, err)
+		u2.Email = "bob@example.com"
+		u2.AddClaims(identity.FlattenedClaims{"email": {"bob@example.com"}})
+		_, err = databroker.Put(ctx, client, u2)
+		require.NoError(t, err)
+		_, err = session.Put(ctx, client, &session.Session{Id: "s3", UserId: "u2"})
+		require.NoError(t, err)
+
+		u2, err = user.Get(ctx, client, "u2")
+		require.NoError(t, err)
+		assert.True(t, IsUserDeactivated(u2), "users should stay deactivated after signing in again")
+
+		// provisioning the user again reactivates them
+		code, res = c.do(http.MethodPost, "/Users", map[string]any{
+			"externalId": "u2",
+			"userName":   "bob@example.com",
+		})
+		require.Equal(t, http.StatusCreated, code, res)
+		assert.Equal(t, true, res["active"])
+		u2, err = user.Get(ctx, client, "u2")
+		require.NoError(t, err)
+		assert.False(t, IsUserDeactivated(u2))
+	})
+}
+
+func TestHandler_Disabled(t *testing.T) {
+	t.Parallel()
+
+	h := New("/scim/v2", func(r *http.Request) (*State, error) {
+		return &State{}, nil
+	})
+	c := &testSCIMClient{t: t, handler: h}
+	code, _ := c.do(http.MethodGet, "/Users", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
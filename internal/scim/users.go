@@ -0,0 +1,412 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+const (
+	schemaUser = "urn:ietf:params:scim:schemas:core:2.0:User"
+
+	// the SCIM attributes without a user field are stored as user claims
+	userNameClaim   = "scim_user_name"
+	externalIDClaim = "scim_external_id"
+	activeClaim     = "scim_active"
+	givenNameClaim  = "given_name"
+	familyNameClaim = "family_name"
+)
+
+// A User is a SCIM user resource.
+//
+// https://www.rfc-editor.org/rfc/rfc7643#section-4.1
+type User struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	UserName    string   `json:"userName"`
+	Name        *Name    `json:"name,omitempty"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Emails      []Email  `json:"emails,omitempty"`
+	Active      *Boolean `json:"active,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// A Name is the name of a user.
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// An Email is an email address of a user.
+type Email struct {
+	Value   string  `json:"value"`
+	Type    string  `json:"type,omitempty"`
+	Primary Boolean `json:"primary,omitempty"`
+}
+
+// A Boolean is a SCIM boolean. Azure AD sends booleans as the strings "True"
+// and "False", so those are accepted as well.
+type Boolean bool
+
+// UnmarshalJSON unmarshals a boolean or a boolean string.
+func (b *Boolean) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*b = Boolean(v)
+	case string:
+		switch strings.ToLower(v) {
+		case "true":
+			*b = true
+		case "false":
+			*b = false
+		default:
+			return fmt.Errorf("invalid boolean: %q", v)
+		}
+	default:
+		return fmt.Errorf("invalid boolean: %s", data)
+	}
+	return nil
+}
+
+// IsActive returns whether the user is active. Users are active unless
+// deactivated explicitly.
+func (su *User) IsActive() bool {
+	return su.Active == nil || bool(*su.Active)
+}
+
+func (su *User) validate() error {
+	if su.UserName == "" {
+		return newError(http.StatusBadRequest, scimTypeInvalidValue, "userName is required")
+	}
+	return nil
+}
+
+// applyTo sets the fields and claims of the databroker user from the SCIM
+// user. Fields the SCIM user does not set are kept, as they may have been set
+// by the identity provider when the user signed in.
+func (su *User) applyTo(u *user.User) {
+	switch {
+	case su.DisplayName != "":
+		u.Name = su.DisplayName
+	case su.Name != nil && su.Name.Formatted != "":
+		u.Name = su.Name.Formatted
+	case su.Name != nil && (su.Name.GivenName != "" || su.Name.FamilyName != ""):
+		u.Name = strings.TrimSpace(su.Name.GivenName + " " + su.Name.FamilyName)
+	}
+	if email := su.primaryEmail(); email != "" {
+		u.Email = email
+	}
+
+	setClaim(u, userNameClaim, structpb.NewStringValue(su.UserName))
+	setClaim(u, activeClaim, structpb.NewBoolValue(su.IsActive()))
+	if su.ExternalID != "" {
+		setClaim(u, externalIDClaim, structpb.NewStringValue(su.ExternalID))
+	} else {
+		delete(u.Claims, externalIDClaim)
+	}
+	if su.Name != nil && su.Name.GivenName != "" {
+		setClaim(u, givenNameClaim, structpb.NewStringValue(su.Name.GivenName))
+	}
+	if su.Name != nil && su.Name.FamilyName != "" {
+		setClaim(u, familyNameClaim, structpb.NewStringValue(su.Name.FamilyName))
+	}
+}
+
+func (su *User) primaryEmail() string {
+	for _, email := range su.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(su.Emails) > 0 {
+		return su.Emails[0].Value
+	}
+	if strings.Contains(su.UserName, "@") {
+		return su.UserName
+	}
+	return ""
+}
+
+// isProvisioned returns whether the user was provisioned with SCIM. Users
+// that only signed in are not SCIM resources.
+func isProvisioned(u *user.User) bool {
+	_, ok := u.GetClaims()[userNameClaim]
+	return ok
+}
+
+func (h *Handler) newUserResource(r *http.Request, u *user.User) *User {
+	su := &User{
+		Schemas:     []string{schemaUser},
+		ID:          u.GetId(),
+		ExternalID:  getClaimString(u, externalIDClaim),
+		UserName:    getClaimString(u, userNameClaim),
+		DisplayName: u.GetName(),
+		Meta: &Meta{
+			ResourceType: "User",
+			Location:     h.location(r, "Users", u.GetId()),
+		},
+	}
+	active := Boolean(true)
+	if vs := u.GetClaims()[activeClaim].GetValues(); len(vs) > 0 {
+		active = Boolean(vs[0].GetBoolValue())
+	}
+	su.Active = &active
+	if givenName, familyName := getClaimString(u, givenNameClaim), getClaimString(u, familyNameClaim); givenName != "" || familyName != "" {
+		su.Name = &Name{GivenName: givenName, FamilyName: familyName}
+	}
+	if u.GetEmail() != "" {
+		su.Emails = []Email{{Value: u.GetEmail(), Type: "work", Primary: true}}
+	}
+	return su
+}
+
+func (h *Handler) listUsers(w http.ResponseWriter, r *http.Request, state *State) error {
+	records, err := queryRecords(r.Context(), state.Client, grpcutil.GetTypeURL(new(user.User)), "")
+	if err != nil {
+		return err
+	}
+
+	var users []*User
+	for _, record := range records {
+		var u user.User
+		if err := record.GetData().UnmarshalTo(&u); err != nil {
+			return err
+		}
+		if isProvisioned(&u) {
+			users = append(users, h.newUserResource(r, &u))
+		}
+	}
+	return renderList(w, r, users, func(su *User) string { return su.ID })
+}
+
+func (h *Handler) getUser(w http.ResponseWriter, r *http.Request, state *State) error {
+	u, err := getProvisionedUser(r.Context(), state.Client, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+	renderSCIM(w, http.StatusOK, h.newUserResource(r, u))
+	return nil
+}
+
+func (h *Handler) createUser(w http.ResponseWriter, r *http.Request, state *State) error {
+	var su User
+	if err := decodeRequest(r, &su); err != nil {
+		return err
+	}
+	if err := su.validate(); err != nil {
+		return err
+	}
+	if err := checkUserNameIsUnique(r.Context(), state.Client, "", su.UserName); err != nil {
+		return err
+	}
+
+	// the external id is the id of the user in the identity provider, which
+	// is also the id of the user when they sign in
+	id := su.ExternalID
+	if id == "" {
+		id = uuid.NewString()
+	}
+
+	u, err := user.Get(r.Context(), state.Client, id)
+	switch {
+	case status.Code(err) == codes.NotFound:
+		u = &user.User{Id: id}
+	case err != nil:
+		return err
+	case isProvisioned(u):
+		return newError(http.StatusConflict, scimTypeUniqueness, "user %s already exists", id)
+	}
+
+	su.applyTo(u)
+	if err := putUser(r.Context(), state.Client, u, su.IsActive()); err != nil {
+		return err
+	}
+	// groups may reference users before they are provisioned
+	if err := syncUserGroups(r.Context(), state.Client, u.GetId()); err != nil {
+		return err
+	}
+
+	resource := h.newUserResource(r, u)
+	w.Header().Set("Location", resource.Meta.Location)
+	renderSCIM(w, http.StatusCreated, resource)
+	return nil
+}
+
+func (h *Handler) replaceUser(w http.ResponseWriter, r *http.Request, state *State) error {
+	u, err := getProvisionedUser(r.Context(), state.Client, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	var su User
+	if err := decodeRequest(r, &su); err != nil {
+		return err
+	}
+	return h.updateUser(w, r, state, u, &su)
+}
+
+func (h *Handler) patchUser(w http.ResponseWriter, r *http.Request, state *State) error {
+	u, err := getProvisionedUser(r.Context(), state.Client, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	su := h.newUserResource(r, u)
+	if err := decodePatchRequest(r, su); err != nil {
+		return err
+	}
+	return h.updateUser(w, r, state, u, su)
+}
+
+func (h *Handler) updateUser(w http.ResponseWriter, r *http.Request, state *State, u *user.User, su *User) error {
+	if err := su.validate(); err != nil {
+		return err
+	}
+	if err := checkUserNameIsUnique(r.Context(), state.Client, u.GetId(), su.UserName); err != nil {
+		return err
+	}
+
+	su.applyTo(u)
+	if err := putUser(r.Context(), state.Client, u, su.IsActive()); err != nil {
+		return err
+	}
+
+	renderSCIM(w, http.StatusOK, h.newUserResource(r, u))
+	return nil
+}
+
+func (h *Handler) deleteUser(w http.ResponseWriter, r *http.Request, state *State) error {
+	ctx := r.Context()
+
+	u, err := getProvisionedUser(ctx, state.Client, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	if err := revokeUserSessions(ctx, state.Client, u.GetId()); err != nil {
+		return err
+	}
+	if err := removeGroupMember(ctx, state.Client, u.GetId()); err != nil {
+		return err
+	}
+
+	// the user record is kept as a deactivated tombstone. Signing in again
+	// updates the existing record, so deleting it would let the user back in.
+	delete(u.Claims, userNameClaim)
+	delete(u.Claims, externalIDClaim)
+	setClaim(u, activeClaim, structpb.NewBoolValue(false))
+	if _, err := databroker.Put(ctx, state.Client, u); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func getProvisionedUser(ctx context.Context, client databroker.DataBrokerServiceClient, userID string) (*user.User, error) {
+	u, err := user.Get(ctx, client, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isProvisioned(u) {
+		return nil, newError(http.StatusNotFound, "", "user %s not found", userID)
+	}
+	return u, nil
+}
+
+// putUser saves the user. The sessions of inactive users are revoked, and
+// authorize denies their requests if they sign in again.
+func putUser(ctx context.Context, client databroker.DataBrokerServiceClient, u *user.User, active bool) error {
+	if _, err := databroker.Put(ctx, client, u); err != nil {
+		return err
+	}
+	if !active {
+		return revokeUserSessions(ctx, client, u.GetId())
+	}
+	return nil
+}
+
+func checkUserNameIsUnique(ctx context.Context, client databroker.DataBrokerServiceClient, userID, userName string) error {
+	records, err := queryRecords(ctx, client, grpcutil.GetTypeURL(new(user.User)), userName)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		var u user.User
+		if err := record.GetData().UnmarshalTo(&u); err != nil {
+			return err
+		}
+		if u.GetId() != userID && strings.EqualFold(getClaimString(&u, userNameClaim), userName) {
+			return newError(http.StatusConflict, scimTypeUniqueness, "userName %s is already in use", userName)
+		}
+	}
+	return nil
+}
+
+// IsUserDeactivated returns true if the user was deactivated or deleted by
+// the SCIM client. Users which weren't provisioned with SCIM are never
+// deactivated.
+func IsUserDeactivated(u *user.User) bool {
+	vs := u.GetClaims()[activeClaim].GetValues()
+	if len(vs) == 0 {
+		return false
+	}
+	active, ok := vs[0].GetKind().(*structpb.Value_BoolValue)
+	return ok && !active.BoolValue
+}
+
+// revokeUserSessions deletes the sessions of a user.
+func revokeUserSessions(ctx context.Context, client databroker.DataBrokerServiceClient, userID string) error {
+	records, err := queryRecords(ctx, client, grpcutil.GetTypeURL(new(session.Session)), userID)
+	if err != nil {
+		return err
+	}
+	// the query matches any field, so only delete the user's sessions
+	for _, record := range records {
+		var s session.Session
+		if err := record.GetData().UnmarshalTo(&s); err != nil {
+			return err
+		}
+		if s.GetUserId() != userID {
+			continue
+		}
+		if err := session.Delete(ctx, client, s.GetId()); err != nil {
+			return fmt.Errorf("error revoking session %s: %w", s.GetId(), err)
+		}
+	}
+	return nil
+}
+
+func setClaim(u *user.User, claim string, values ...*structpb.Value) {
+	if u.Claims == nil {
+		u.Claims = make(map[string]*structpb.ListValue)
+	}
+	u.Claims[claim] = &structpb.ListValue{Values: values}
+}
+
+func getClaimString(u *user.User, claim string) string {
+	vs := u.GetClaims()[claim].GetValues()
+	if len(vs) == 0 {
+		return ""
+	}
+	return vs[0].GetStringValue()
+}
@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+var (
+	// AuthorizeViews contains opencensus views for authorize metrics
+	AuthorizeViews = []*view.View{
+		AuthorizeShadowPolicyMismatchView,
+		AuthorizeDecisionsView,
+		AuthorizePolicyEvaluationDurationView,
+		AuthorizeHeadersEvaluationDurationView,
+	}
+
+	authorizeShadowPolicyMismatch = stats.Int64(
+		"authorize_shadow_policy_mismatch_total",
+		"Total authorize checks where the shadow policy decision differed from the enforced decision",
+		stats.UnitDimensionless)
+
+	// AuthorizeShadowPolicyMismatchView is an OpenCensus view that counts shadow
+	// policy decisions which differ from the enforced decision by route
+	AuthorizeShadowPolicyMismatchView = &view.View{
+		Name:        authorizeShadowPolicyMismatch.Name(),
+		Description: authorizeShadowPolicyMismatch.Description(),
+		Measure:     authorizeShadowPolicyMismatch,
+		TagKeys:     []tag.Key{TagKeyService, TagKeyRoute, TagKeyDecision, TagKeyShadowDecision},
+		Aggregation: view.Count(),
+	}
+
+	authorizeDecisions = stats.Int64(
+		"authorize_decisions_total",
+		"Total authorize decisions by the reasons for the decision",
+		stats.UnitDimensionless)
+
+	// AuthorizeDecisionsView is an OpenCensus view that counts authorize
+	// decisions by route, decision and reason. A decision with several reasons
+	// is counted once for each reason.
+	AuthorizeDecisionsView = &view.View{
+		Name:        authorizeDecisions.Name(),
+		Description: authorizeDecisions.Description(),
+		Measure:     authorizeDecisions,
+		TagKeys:     []tag.Key{TagKeyService, TagKeyRoute, TagKeyDecision, TagKeyReason},
+		Aggregation: view.Count(),
+	}
+
+	authorizePolicyEvaluationDuration = stats.Float64(
+		"authorize_policy_evaluation_duration_ms",
+		"Duration of route policy evaluations",
+		stats.UnitMilliseconds)
+
+	// AuthorizePolicyEvaluationDurationView is an OpenCensus view that tracks
+	// the duration of route policy evaluations by route
+	AuthorizePolicyEvaluationDurationView = &view.View{
+		Name:        authorizePolicyEvaluationDuration.Name(),
+		Description: authorizePolicyEvaluationDuration.Description(),
+		Measure:     authorizePolicyEvaluationDuration,
+		TagKeys:     []tag.Key{TagKeyService, TagKeyRoute},
+		Aggregation: DefaultMillisecondsDistribution,
+	}
+
+	authorizeHeadersEvaluationDuration = stats.Float64(
+		"authorize_headers_evaluation_duration_ms",
+		"Duration of identity headers evaluations",
+		stats.UnitMilliseconds)
+
+	// AuthorizeHeadersEvaluationDurationView is an OpenCensus view that tracks
+	// the duration of identity headers evaluations
+	AuthorizeHeadersEvaluationDurationView = &view.View{
+		Name:        authorizeHeadersEvaluationDuration.Name(),
+		Description: authorizeHeadersEvaluationDuration.Description(),
+		Measure:     authorizeHeadersEvaluationDuration,
+		TagKeys:     []tag.Key{TagKeyService},
+		Aggregation: DefaultMillisecondsDistribution,
+	}
+)
+
+// RecordAuthorizeShadowPolicyMismatch records a shadow policy decision which
+// differs from the enforced decision.
+func RecordAuthorizeShadowPolicyMismatch(ctx context.Context, route string, allowed, shadowAllowed bool) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(TagKeyService, "authorize"),
+			tag.Upsert(TagKeyRoute, route),
+			tag.Upsert(TagKeyDecision, decisionString(allowed)),
+			tag.Upsert(TagKeyShadowDecision, decisionString(shadowAllowed)),
+		},
+		authorizeShadowPolicyMismatch.M(1),
+	)
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// RecordAuthorizeDecision records an authorize decision for each of its
+// reasons.
+func RecordAuthorizeDecision(ctx context.Context, route string, allowed bool, reasons []string) {
+	for _, reason := range reasons {
+		err := stats.RecordWithTags(ctx,
+			[]tag.Mutator{
+				tag.Upsert(TagKeyService, "authorize"),
+				tag.Upsert(TagKeyRoute, route),
+				tag.Upsert(TagKeyDecision, decisionString(allowed)),
+				tag.Upsert(TagKeyReason, reason),
+			},
+			authorizeDecisions.M(1),
+		)
+		if err != nil {
+			log.Warn(ctx).Err(err).Msg("internal/telemetry/metrics: failed to record")
+		}
+	}
+}
+
+// RecordAuthorizePolicyEvaluation records the duration of a route policy
+// evaluation.
+func RecordAuthorizePolicyEvaluation(ctx context.Context, route string, duration time.Duration) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(TagKeyService, "authorize"),
+			tag.Upsert(TagKeyRoute, route),
+		},
+		authorizePolicyEvaluationDuration.M(float64(duration)/float64(time.Millisecond)),
+	)
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// RecordAuthorizeHeadersEvaluation records the duration of an identity
+// headers evaluation.
+func RecordAuthorizeHeadersEvaluation(ctx context.Context, duration time.Duration) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(TagKeyService, "authorize"),
+		},
+		authorizeHeadersEvaluationDuration.M(float64(duration)/float64(time.Millisecond)),
+	)
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+func decisionString(allowed bool) string {
+	if allowed {
+		return "allow"
+	}
+	return "deny"
+}
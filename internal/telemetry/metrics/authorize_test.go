@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+)
+
+func Test_RecordAuthorizeDecision(t *testing.T) {
+	view.Unregister(AuthorizeDecisionsView)
+	require.NoError(t, view.Register(AuthorizeDecisionsView))
+	t.Cleanup(func() { view.Unregister(AuthorizeDecisionsView) })
+
+	RecordAuthorizeDecision(context.Background(), "https://from.example.com", false,
+		[]string{"user-unauthorized", "rate-limited"})
+	RecordAuthorizeDecision(context.Background(), "https://from.example.com", false,
+		[]string{"rate-limited"})
+
+	rows, err := view.RetrieveData(AuthorizeDecisionsView.Name)
+	require.NoError(t, err)
+
+	counts := make(map[string]int64)
+	for _, row := range rows {
+		var reason string
+		for _, tag := range row.Tags {
+			if tag.Key == TagKeyReason {
+				reason = tag.Value
+			}
+		}
+		counts[reason] = row.Data.(*view.CountData).Value
+	}
+	assert.Equal(t, map[string]int64{
+		"rate-limited":      2,
+		"user-unauthorized": 1,
+	}, counts)
+}
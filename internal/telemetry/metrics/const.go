@@ -18,6 +18,11 @@ var (
 	TagKeyStorageOperation = tag.MustNewKey("operation")
 	TagKeyStorageResult    = tag.MustNewKey("result")
 	TagKeyStorageBackend   = tag.MustNewKey("backend")
+
+	TagKeyRoute          = tag.MustNewKey("route")
+	TagKeyDecision       = tag.MustNewKey("decision")
+	TagKeyShadowDecision = tag.MustNewKey("shadow_decision")
+	TagKeyReason         = tag.MustNewKey("reason")
 )
 
 // Default distributions used by views in this package.
@@ -44,5 +49,6 @@ var (
 		HTTPServerViews,
 		InfoViews,
 		StorageViews,
+		AuthorizeViews,
 	}
 )
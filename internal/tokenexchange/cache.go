@@ -0,0 +1,130 @@
+package tokenexchange
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// tokens are exchanged again this long before they expire
+	cacheExpiryDelta = 30 * time.Second
+	// tokens without an expiry are cached for this long
+	cacheDefaultTTL    = 5 * time.Minute
+	cacheSweepInterval = time.Minute
+)
+
+// A Cache exchanges tokens and caches the exchanged tokens until shortly
+// before they expire.
+type Cache struct {
+	client       *http.Client
+	singleflight singleflight.Group
+
+	mu        sync.Mutex
+	entries   map[string]cacheEntry
+	tokenURLs map[string]string
+	lastSweep time.Time
+}
+
+type cacheEntry struct {
+	token  *Token
+	expiry time.Time
+}
+
+// NewCache creates a new Cache.
+func NewCache(client *http.Client) *Cache {
+	return &Cache{
+		client:    client,
+		entries:   make(map[string]cacheEntry),
+		tokenURLs: make(map[string]string),
+	}
+}
+
+// Exchange returns the cached token for the key, or exchanges the subject
+// token if there isn't one.
+func (c *Cache) Exchange(ctx context.Context, key string, req *Request) (*Token, error) {
+	now := time.Now()
+	if token, ok := c.get(key, now); ok {
+		return token, nil
+	}
+
+	v, err, _ := c.singleflight.Do(key, func() (interface{}, error) {
+		token, err := Exchange(ctx, c.client, req)
+		if err != nil {
+			return nil, err
+		}
+		c.set(key, token, time.Now())
+		return token, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Token), nil
+}
+
+// TokenURL returns the token endpoint of an OpenID Connect issuer. Token
+// endpoints are discovered once for each issuer.
+func (c *Cache) TokenURL(ctx context.Context, issuer string) (string, error) {
+	c.mu.Lock()
+	tokenURL, ok := c.tokenURLs[issuer]
+	c.mu.Unlock()
+	if ok {
+		return tokenURL, nil
+	}
+
+	v, err, _ := c.singleflight.Do("discover/"+issuer, func() (interface{}, error) {
+		tokenURL, err := DiscoverTokenURL(ctx, c.client, issuer)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.tokenURLs[issuer] = tokenURL
+		c.mu.Unlock()
+		return tokenURL, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+func (c *Cache) get(key string, now time.Time) (*Token, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !now.Before(entry.expiry) {
+		return nil, false
+	}
+	return entry.token, true
+}
+
+func (c *Cache) set(key string, token *Token, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sweep(now)
+
+	expiry := now.Add(cacheDefaultTTL)
+	if !token.Expiry.IsZero() {
+		expiry = token.Expiry.Add(-cacheExpiryDelta)
+	}
+	c.entries[key] = cacheEntry{token: token, expiry: expiry}
+}
+
+// sweep removes expired tokens.
+func (c *Cache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < cacheSweepInterval {
+		return
+	}
+	c.lastSweep = now
+
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiry) {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Package tokenexchange implements OAuth 2.0 Token Exchange (RFC 8693).
+package tokenexchange
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Token types
+const (
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeIDToken     = "urn:ietf:params:oauth:token-type:id_token"
+)
+
+const (
+	grantType       = "urn:ietf:params:oauth:grant-type:token-exchange"
+	maxResponseSize = 1024 * 1024
+)
+
+// A Request is a token exchange request.
+type Request struct {
+	TokenURL         string
+	ClientID         string
+	ClientSecret     string
+	SubjectToken     string
+	SubjectTokenType string
+	Audience         string
+	Resource         string
+	Scopes           []string
+}
+
+// A Token is an exchanged token.
+type Token struct {
+	AccessToken     string
+	IssuedTokenType string
+	TokenType       string
+	// Expiry is zero if the token endpoint didn't say when the token expires.
+	Expiry time.Time
+}
+
+// An Error is an error response from the token endpoint.
+type Error struct {
+	Status      int
+	Code        string
+	Description string
+}
+
+// Error implements the error interface.
+func (err *Error) Error() string {
+	str := fmt.Sprintf("tokenexchange: token endpoint returned %d", err.Status)
+	if err.Code != "" {
+		str += ": " + err.Code
+	}
+	if err.Description != "" {
+		str += ": " + err.Description
+	}
+	return str
+}
+
+// Exchange exchanges the subject token at the token endpoint.
+func Exchange(ctx context.Context, client *http.Client, req *Request) (*Token, error) {
+	form := url.Values{
+		"grant_type":         {grantType},
+		"subject_token":      {req.SubjectToken},
+		"subject_token_type": {req.SubjectTokenType},
+	}
+	if req.Audience != "" {
+		form.Set("audience", req.Audience)
+	}
+	if req.Resource != "" {
+		form.Set("resource", req.Resource)
+	}
+	if len(req.Scopes) > 0 {
+		form.Set("scope", strings.Join(req.Scopes, " "))
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("tokenexchange: error creating request: %w", err)
+	}
+	hreq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	hreq.Header.Set("Accept", "application/json")
+	if req.ClientID != "" {
+		hreq.SetBasicAuth(url.QueryEscape(req.ClientID), url.QueryEscape(req.ClientSecret))
+	}
+
+	now := time.Now()
+	hres, err := client.Do(hreq)
+	if err != nil {
+		return nil, fmt.Errorf("tokenexchange: error calling token endpoint: %w", err)
+	}
+	defer hres.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(hres.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("tokenexchange: error reading token endpoint response: %w", err)
+	}
+
+	if hres.StatusCode/100 != 2 {
+		var res struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		_ = json.Unmarshal(body, &res)
+		return nil, &Error{Status: hres.StatusCode, Code: res.Error, Description: res.ErrorDescription}
+	}
+
+	var res struct {
+		AccessToken     string `json:"access_token"`
+		IssuedTokenType string `json:"issued_token_type"`
+		TokenType       string `json:"token_type"`
+		ExpiresIn       int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("tokenexchange: invalid token endpoint response: %w", err)
+	}
+	if res.AccessToken == "" {
+		return nil, errors.New("tokenexchange: token endpoint response is missing the access_token")
+	}
+
+	token := &Token{
+		AccessToken:     res.AccessToken,
+		IssuedTokenType: res.IssuedTokenType,
+		TokenType:       res.TokenType,
+	}
+	if res.ExpiresIn > 0 {
+		token.Expiry = now.Add(time.Duration(res.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// DiscoverTokenURL returns the token endpoint of an OpenID Connect issuer.
+func DiscoverTokenURL(ctx context.Context, client *http.Client, issuer string) (string, error) {
+	wellKnown := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return "", fmt.Errorf("tokenexchange: error creating discovery request: %w", err)
+	}
+
+	hres, err := client.Do(hreq)
+	if err != nil {
+		return "", fmt.Errorf("tokenexchange: error fetching openid configuration: %w", err)
+	}
+	defer hres.Body.Close()
+
+	if hres.StatusCode/100 != 2 {
+		return "", fmt.Errorf("tokenexchange: openid configuration returned %d", hres.StatusCode)
+	}
+
+	var res struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	if err := json.NewDecoder(io.LimitReader(hres.Body, maxResponseSize)).Decode(&res); err != nil {
+		return "", fmt.Errorf("tokenexchange: invalid openid configuration: %w", err)
+	}
+	if res.TokenEndpoint == "" {
+		return "", errors.New("tokenexchange: openid configuration is missing the token_endpoint")
+	}
+	return res.TokenEndpoint, nil
+}
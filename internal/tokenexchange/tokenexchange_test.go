@@ -0,0 +1,133 @@
+package tokenexchange
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeTokenEndpoint(t *testing.T, calls *int64) *httptest.Server {
+	t.Helper()
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"issuer":         srv.URL,
+				"token_endpoint": srv.URL + "/token",
+			})
+			return
+		case "/token":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		atomic.AddInt64(calls, 1)
+		clientID, clientSecret, _ := r.BasicAuth()
+		if clientID != "CLIENT_ID" || clientSecret != "CLIENT_SECRET" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		if r.FormValue("grant_type") != grantType ||
+			r.FormValue("subject_token") != "SUBJECT_TOKEN" ||
+			r.FormValue("subject_token_type") != TokenTypeAccessToken {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_request","error_description":"bad subject token"}`))
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":      "EXCHANGED/" + r.FormValue("audience") + "/" + r.FormValue("scope"),
+			"issued_token_type": TokenTypeAccessToken,
+			"token_type":        "Bearer",
+			"expires_in":        3600,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestExchange(t *testing.T) {
+	t.Parallel()
+
+	var calls int64
+	srv := newFakeTokenEndpoint(t, &calls)
+
+	req := &Request{
+		TokenURL:         srv.URL + "/token",
+		ClientID:         "CLIENT_ID",
+		ClientSecret:     "CLIENT_SECRET",
+		SubjectToken:     "SUBJECT_TOKEN",
+		SubjectTokenType: TokenTypeAccessToken,
+		Audience:         "api",
+		Scopes:           []string{"read", "write"},
+	}
+
+	token, err := Exchange(context.Background(), srv.Client(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "EXCHANGED/api/read write", token.AccessToken)
+	assert.Equal(t, TokenTypeAccessToken, token.IssuedTokenType)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), token.Expiry, time.Minute)
+
+	t.Run("error", func(t *testing.T) {
+		req := *req
+		req.SubjectToken = "OTHER"
+		_, err := Exchange(context.Background(), srv.Client(), &req)
+		var tokenErr *Error
+		require.ErrorAs(t, err, &tokenErr)
+		assert.Equal(t, http.StatusBadRequest, tokenErr.Status)
+		assert.Equal(t, "invalid_request", tokenErr.Code)
+		assert.Equal(t, "bad subject token", tokenErr.Description)
+	})
+}
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	var calls int64
+	srv := newFakeTokenEndpoint(t, &calls)
+	c := NewCache(srv.Client())
+
+	tokenURL, err := c.TokenURL(context.Background(), srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/token", tokenURL)
+
+	req := &Request{
+		TokenURL:         tokenURL,
+		ClientID:         "CLIENT_ID",
+		ClientSecret:     "CLIENT_SECRET",
+		SubjectToken:     "SUBJECT_TOKEN",
+		SubjectTokenType: TokenTypeAccessToken,
+		Audience:         "api",
+	}
+	for i := 0; i < 3; i++ {
+		token, err := c.Exchange(context.Background(), "s1/1", req)
+		require.NoError(t, err)
+		assert.Equal(t, "EXCHANGED/api/", token.AccessToken)
+	}
+	assert.Equal(t, int64(1), atomic.LoadInt64(&calls), "should cache exchanged tokens")
+
+	_, err = c.Exchange(context.Background(), "s2/1", req)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&calls), "should cache tokens for each key")
+
+	t.Run("expired", func(t *testing.T) {
+		c.set("s3/1", &Token{AccessToken: "OLD", Expiry: time.Now().Add(time.Second)}, time.Now())
+		token, err := c.Exchange(context.Background(), "s3/1", req)
+		require.NoError(t, err)
+		assert.Equal(t, "EXCHANGED/api/", token.AccessToken,
+			"should exchange tokens that are about to expire")
+	})
+}
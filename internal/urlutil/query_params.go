@@ -4,6 +4,7 @@ package urlutil
 // services over HTTP calls and redirects. They are typically used in
 // conjunction with a HMAC to ensure authenticity.
 const (
+	QueryACRValues          = "pomerium_acr_values"
 	QueryCallbackURI        = "pomerium_callback_uri"
 	QueryDeviceCredentialID = "pomerium_device_credential_id"
 	QueryDeviceType         = "pomerium_device_type"
@@ -13,6 +14,7 @@ const (
 	QueryIdentityProviderID = "pomerium_idp_id"
 	QueryIsProgrammatic     = "pomerium_programmatic"
 	QueryIssued             = "pomerium_issued"
+	QueryMaxAge             = "pomerium_max_age"
 	QueryPomeriumJWT        = "pomerium_jwt"
 	QueryRedirectURI        = "pomerium_redirect_uri"
 	QuerySession            = "pomerium_session"
@@ -182,6 +182,9 @@ func setupAuthorize(ctx context.Context, src config.Source, controlPlane *contro
 		return nil, fmt.Errorf("error creating authorize service: %w", err)
 	}
 	envoy_service_auth_v3.RegisterAuthorizationServer(controlPlane.GRPCServer, svc)
+	controlPlane.DebugRouter.Path("/debug/authorize/dry-run").Handler(svc.DryRunHandler())
+	controlPlane.DebugRouter.Path("/debug/authorize/denials").Handler(svc.DenialsHandler())
+	controlPlane.DebugRouter.Path("/debug/authorize/access-history").Handler(svc.AccessHistoryHandler())
 
 	log.Info(ctx).Msg("enabled authorize service")
 	src.OnConfigChange(ctx, svc.OnConfigChange)
@@ -3,6 +3,7 @@ package cryptutil
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/hex"
@@ -110,6 +111,8 @@ func loadPublicKey(b []byte) (interface{}, error) {
 			return k.Public(), nil
 		case *ecdsa.PrivateKey:
 			return k.Public(), nil
+		case ed25519.PrivateKey:
+			return k.Public(), nil
 		default:
 			return nil, fmt.Errorf("private key is unsupported type")
 		}
@@ -136,6 +139,8 @@ func SignatureAlgorithmForKey(key interface{}) (jose.SignatureAlgorithm, error)
 		return jose.ES256, nil
 	case *rsa.PrivateKey, *rsa.PublicKey:
 		return jose.RS256, nil
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return jose.EdDSA, nil
 	default:
 		return "", fmt.Errorf("crypto: unsupported key type for signing: %T", key)
 	}
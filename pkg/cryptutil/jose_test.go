@@ -135,9 +135,11 @@ func TestSignatureAlgorithmForKey(t *testing.T) {
 	t.Run("ed25519", func(t *testing.T) {
 		pub, priv, err := ed25519.GenerateKey(rand.Reader)
 		require.NoError(t, err)
-		_, err = SignatureAlgorithmForKey(priv)
-		assert.Error(t, err)
-		_, err = SignatureAlgorithmForKey(pub)
-		assert.Error(t, err)
+		alg, err := SignatureAlgorithmForKey(priv)
+		assert.NoError(t, err)
+		assert.Equal(t, jose.EdDSA, alg)
+		alg, err = SignatureAlgorithmForKey(pub)
+		assert.NoError(t, err)
+		assert.Equal(t, jose.EdDSA, alg)
 	})
 }
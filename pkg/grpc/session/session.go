@@ -15,6 +15,10 @@ import (
 	"github.com/pomerium/pomerium/pkg/slices"
 )
 
+// IdentityProviderIDClaim is the session claim containing the id of the
+// identity provider the user signed in with.
+const IdentityProviderIDClaim = "idp_id"
+
 // Delete deletes a session from the databroker.
 func Delete(ctx context.Context, client databroker.DataBrokerServiceClient, sessionID string) error {
 	any := protoutil.NewAny(new(Session))
@@ -80,6 +84,25 @@ func (x *Session) SetRawIDToken(rawIDToken string) {
 	x.IdToken.Raw = rawIDToken
 }
 
+// GetIdentityProviderID gets the id of the identity provider the user signed in with.
+func (x *Session) GetIdentityProviderID() string {
+	values := x.GetClaims()[IdentityProviderIDClaim].GetValues()
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0].GetStringValue()
+}
+
+// SetIdentityProviderID sets the id of the identity provider the user signed in with.
+func (x *Session) SetIdentityProviderID(idpID string) {
+	if x.Claims == nil {
+		x.Claims = make(map[string]*structpb.ListValue)
+	}
+	x.Claims[IdentityProviderIDClaim] = &structpb.ListValue{
+		Values: []*structpb.Value{structpb.NewStringValue(idpID)},
+	}
+}
+
 // RemoveDeviceCredentialID removes a device credential id.
 func (x *Session) RemoveDeviceCredentialID(deviceCredentialID string) {
 	x.DeviceCredentials = slices.Filter(x.DeviceCredentials, func(el *Session_DeviceCredential) bool {
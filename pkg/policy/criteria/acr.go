@@ -0,0 +1,101 @@
+package criteria
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+	"github.com/pomerium/pomerium/pkg/policy/rules"
+)
+
+var acrBody = ast.Body{
+	ast.MustParseExpr(`session := get_session(input.session.id)`),
+	ast.MustParseExpr(`session.id != ""`),
+	ast.MustParseExpr(`acr := object.get(object.get(session, "claims", {}), "acr", [])[0]`),
+	ast.MustParseExpr(`acr_values[_] == acr`),
+}
+
+type acrCriterion struct {
+	g *Generator
+}
+
+func (acrCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (acrCriterion) Name() string {
+	return "acr"
+}
+
+func (c acrCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	acrValues, err := getACRValues(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid acr criterion: %w", err)
+	}
+
+	var terms []*ast.Term
+	for _, v := range acrValues {
+		terms = append(terms, ast.StringTerm(v))
+	}
+	body := append(ast.Body{
+		ast.Assign.Expr(ast.VarTerm("acr_values"), ast.ArrayTerm(terms...)),
+	}, acrBody...)
+
+	// the acr values are requested from the identity provider when the user
+	// needs to log in again
+	additionalData := map[string]interface{}{
+		"acr_values": strings.Join(acrValues, " "),
+	}
+
+	rule := NewCriterionSessionRuleWithAdditionalData(c.g, c.Name(),
+		ReasonACROK, ReasonACRUnauthorized,
+		body, additionalData)
+
+	return rule, []*ast.Rule{
+		rules.GetSession(),
+	}, nil
+}
+
+// ACR returns a Criterion which matches the authentication context class
+// reference (acr) of the session against a list of acceptable values, in order
+// of preference.
+func ACR(generator *Generator) Criterion {
+	return acrCriterion{g: generator}
+}
+
+func init() {
+	Register(ACR)
+}
+
+// getACRValues returns the acr values for a string or list of strings.
+func getACRValues(v parser.Value) ([]string, error) {
+	var values []string
+	switch t := v.(type) {
+	case parser.String:
+		values = append(values, string(t))
+	case parser.Array:
+		for _, vv := range t {
+			s, ok := vv.(parser.String)
+			if !ok {
+				return nil, fmt.Errorf("expected string for acr value, got: %T", vv)
+			}
+			values = append(values, string(s))
+		}
+	default:
+		return nil, fmt.Errorf("expected string or array of acr values, got: %T", v)
+	}
+
+	for _, s := range values {
+		// acr_values is a space separated list
+		if s == "" || strings.ContainsAny(s, " \t\n") {
+			return nil, fmt.Errorf("invalid acr value: %q", s)
+		}
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("at least one acr value is required")
+	}
+	return values, nil
+}
@@ -0,0 +1,77 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestACR(t *testing.T) {
+	mkSession := func(sessionID string, acr ...interface{}) *session.Session {
+		s := &session.Session{Id: sessionID}
+		if len(acr) > 0 {
+			v, _ := structpb.NewList(acr)
+			s.Claims = map[string]*structpb.ListValue{"acr": v}
+		}
+		return s
+	}
+	acrValues := M{"acr_values": "phrh phr"}
+
+	t.Run("no session", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - acr: [phrh, phr]
+`, []dataBrokerRecord{}, Input{Session: InputSession{ID: "s1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonUserUnauthenticated}, acrValues}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("ok", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - acr: [phrh, phr]
+`, []dataBrokerRecord{
+			mkSession("s1", "phr"),
+		}, Input{Session: InputSession{ID: "s1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonACROK}, acrValues}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("unauthorized", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - acr: phrh
+`, []dataBrokerRecord{
+			mkSession("s1", "phr"),
+		}, Input{Session: InputSession{ID: "s1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonACRUnauthorized}, M{"acr_values": "phrh"}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("missing claim", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - acr: phrh
+`, []dataBrokerRecord{
+			mkSession("s1"),
+		}, Input{Session: InputSession{ID: "s1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonACRUnauthorized}, M{"acr_values": "phrh"}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("invalid", func(t *testing.T) {
+		_, err := evaluate(t, `
+allow:
+  and:
+    - acr: "a b"
+`, []dataBrokerRecord{}, Input{})
+		require.Error(t, err)
+	})
+}
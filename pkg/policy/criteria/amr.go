@@ -0,0 +1,70 @@
+package criteria
+
+import (
+	"fmt"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+	"github.com/pomerium/pomerium/pkg/policy/rules"
+)
+
+var amrBody = ast.Body{
+	ast.MustParseExpr(`session := get_session(input.session.id)`),
+	ast.MustParseExpr(`session.id != ""`),
+	ast.MustParseExpr(`amr := object.get(object.get(session, "claims", {}), "amr", [])`),
+}
+
+type amrCriterion struct {
+	g *Generator
+}
+
+func (amrCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (amrCriterion) Name() string {
+	return "amr"
+}
+
+func (c amrCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	var matcher parser.Value
+	switch t := data.(type) {
+	case parser.String:
+		// a single method must be used
+		matcher = parser.Object{"has": t}
+	case parser.Array:
+		// all the methods must be used
+		matcher = parser.Object{"has_all": t}
+	case parser.Object:
+		matcher = t
+	default:
+		return nil, nil, fmt.Errorf("expected string, array or string list matcher for amr criterion, got: %T", data)
+	}
+
+	var body ast.Body
+	body = append(body, amrBody...)
+	err := matchStringList(&body, ast.VarTerm("amr"), matcher)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid amr criterion: %w", err)
+	}
+
+	rule := NewCriterionSessionRule(c.g, c.Name(),
+		ReasonAMROK, ReasonAMRUnauthorized,
+		body)
+
+	return rule, []*ast.Rule{
+		rules.GetSession(),
+	}, nil
+}
+
+// AMR returns a Criterion which matches the authentication methods references
+// (amr) of the session, e.g. "mfa" or "otp".
+func AMR(generator *Generator) Criterion {
+	return amrCriterion{g: generator}
+}
+
+func init() {
+	Register(AMR)
+}
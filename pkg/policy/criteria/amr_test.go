@@ -0,0 +1,68 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestAMR(t *testing.T) {
+	mkSession := func(sessionID string, amr ...interface{}) *session.Session {
+		v, _ := structpb.NewList(amr)
+		return &session.Session{
+			Id:     sessionID,
+			Claims: map[string]*structpb.ListValue{"amr": v},
+		}
+	}
+
+	t.Run("no session", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - amr: mfa
+`, []dataBrokerRecord{}, Input{Session: InputSession{ID: "s1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonUserUnauthenticated}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("string", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - amr: mfa
+`, []dataBrokerRecord{
+			mkSession("s1", "pwd", "mfa"),
+		}, Input{Session: InputSession{ID: "s1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonAMROK}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("array", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - amr: [pwd, otp]
+`, []dataBrokerRecord{
+			mkSession("s1", "pwd", "mfa"),
+		}, Input{Session: InputSession{ID: "s1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonAMRUnauthorized}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("matcher", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - amr:
+        has_any: [otp, hwk]
+`, []dataBrokerRecord{
+			mkSession("s1", "pwd", "hwk"),
+		}, Input{Session: InputSession{ID: "s1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonAMROK}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+}
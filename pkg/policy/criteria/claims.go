@@ -27,9 +27,6 @@ var claimsBody = ast.Body{
 	ast.MustParseExpr(`
 		values := object_get(all_claims, rule_path, [])
 	`),
-	ast.MustParseExpr(`
-		rule_data == values[_]
-	`),
 }
 
 type claimsCriterion struct {
@@ -45,12 +42,52 @@ func (claimsCriterion) Name() string {
 }
 
 func (c claimsCriterion) GenerateRule(subPath string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	var body ast.Body
+	body = append(body, ast.Assign.Expr(ast.VarTerm("rule_data"), ast.NewTerm(data.RegoValue())))
+	body = append(body, ast.Assign.Expr(ast.VarTerm("rule_path"), ast.NewTerm(ast.MustInterfaceToValue(subPath))))
+	body = append(body, claimsBody...)
+	// one of the claim values must equal the data
+	body = append(body, ast.MustParseExpr(`rule_data == values[_]`))
+
 	rule := NewCriterionSessionRule(c.g, c.Name(),
 		ReasonClaimOK, ReasonClaimUnauthorized,
-		append(ast.Body{
-			ast.Assign.Expr(ast.VarTerm("rule_data"), ast.NewTerm(data.RegoValue())),
-			ast.Assign.Expr(ast.VarTerm("rule_path"), ast.NewTerm(ast.MustInterfaceToValue(subPath))),
-		}, claimsBody...))
+		body)
+	return rule, []*ast.Rule{
+		rules.GetSession(),
+		rules.GetUser(),
+		rules.ObjectGet(),
+	}, nil
+}
+
+// claimMatcherCriterion matches the values of a claim using the string list
+// matcher operators, e.g. { "has_any": ["a", "b"] }. Unlike the claim
+// criterion, the data is always a matcher, so claims with object values can
+// still be compared with the claim criterion.
+type claimMatcherCriterion struct {
+	g *Generator
+}
+
+func (claimMatcherCriterion) DataType() CriterionDataType {
+	return CriterionDataTypeStringListMatcher
+}
+
+func (claimMatcherCriterion) Name() string {
+	return "claim_matcher"
+}
+
+func (c claimMatcherCriterion) GenerateRule(subPath string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	var body ast.Body
+	body = append(body, ast.Assign.Expr(ast.VarTerm("rule_path"), ast.NewTerm(ast.MustInterfaceToValue(subPath))))
+	body = append(body, claimsBody...)
+
+	err := matchStringList(&body, ast.VarTerm("values"), data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rule := NewCriterionSessionRule(c.g, c.Name(),
+		ReasonClaimOK, ReasonClaimUnauthorized,
+		body)
 	return rule, []*ast.Rule{
 		rules.GetSession(),
 		rules.GetUser(),
@@ -63,6 +100,12 @@ func Claims(generator *Generator) Criterion {
 	return claimsCriterion{g: generator}
 }
 
+// ClaimMatchers returns a Criterion that matches IDP claims with string list matchers.
+func ClaimMatchers(generator *Generator) Criterion {
+	return claimMatcherCriterion{g: generator}
+}
+
 func init() {
 	Register(Claims)
+	Register(ClaimMatchers)
 }
@@ -86,6 +86,34 @@ allow:
 		require.Equal(t, A{true, A{ReasonClaimOK}, M{}}, res["allow"])
 		require.Equal(t, A{false, A{}}, res["deny"])
 	})
+	t.Run("by user groups", func(t *testing.T) {
+		// groups from a directory are merged into the groups claim of the user
+		res, err := evaluate(t, `
+allow:
+  and:
+    - claim/groups: admins
+`,
+			[]dataBrokerRecord{
+				&session.Session{
+					Id:     "SESSION_ID",
+					UserId: "USER_ID",
+				},
+				&user.User{
+					Id:    "USER_ID",
+					Email: "test@example.com",
+					Claims: map[string]*structpb.ListValue{
+						"groups": {Values: []*structpb.Value{
+							structpb.NewStringValue("engineering"),
+							structpb.NewStringValue("admins"),
+						}},
+					},
+				},
+			},
+			Input{Session: InputSession{ID: "SESSION_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonClaimOK}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
 	t.Run("special keys", func(t *testing.T) {
 		res, err := evaluate(t, `
 allow:
@@ -110,4 +138,74 @@ allow:
 		require.Equal(t, A{true, A{ReasonClaimOK}, M{}}, res["allow"])
 		require.Equal(t, A{false, A{}}, res["deny"])
 	})
+	t.Run("object value", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - claim/role:
+        is: admin
+`,
+			[]dataBrokerRecord{
+				&session.Session{
+					Id:     "SESSION_ID",
+					UserId: "USER_ID",
+					Claims: map[string]*structpb.ListValue{
+						"role": {Values: []*structpb.Value{structpb.NewStructValue(&structpb.Struct{
+							Fields: map[string]*structpb.Value{"is": structpb.NewStringValue("admin")},
+						})}},
+					},
+				},
+				&user.User{
+					Id: "USER_ID",
+				},
+			},
+			Input{Session: InputSession{ID: "SESSION_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonClaimOK}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("matchers", func(t *testing.T) {
+		records := []dataBrokerRecord{
+			&session.Session{
+				Id:     "SESSION_ID",
+				UserId: "USER_ID",
+				Claims: map[string]*structpb.ListValue{
+					"clearance":  {Values: []*structpb.Value{structpb.NewNumberValue(3)}},
+					"start_date": {Values: []*structpb.Value{structpb.NewStringValue("2019-04-01")}},
+					"groups": {Values: []*structpb.Value{
+						structpb.NewStringValue("admin"),
+						structpb.NewStringValue("engineering"),
+					}},
+				},
+			},
+			&user.User{
+				Id: "USER_ID",
+			},
+		}
+		for _, tc := range []struct {
+			policy string
+			expect bool
+		}{
+			{`claim_matcher/clearance: { gte: 3 }`, true},
+			{`claim_matcher/clearance: { gt: 3 }`, false},
+			{`claim_matcher/start_date: { lt: "2020-01-01" }`, true},
+			{`claim_matcher/start_date: { lt: "2019-01-01" }`, false},
+			{`claim_matcher/groups: { has_any: [admin, sales] }`, true},
+			{`claim_matcher/groups: { has_all: [admin, sales] }`, false},
+			{`claim_matcher/groups: { has_all: [admin, engineering] }`, true},
+			{`claim_matcher/groups: { regex: "^eng" }`, true},
+		} {
+			res, err := evaluate(t, `
+allow:
+  and:
+    - `+tc.policy+`
+`, records, Input{Session: InputSession{ID: "SESSION_ID"}})
+			require.NoError(t, err, tc.policy)
+			if tc.expect {
+				require.Equal(t, A{true, A{ReasonClaimOK}, M{}}, res["allow"], tc.policy)
+			} else {
+				require.Equal(t, A{false, A{ReasonClaimUnauthorized}, M{}}, res["allow"], tc.policy)
+			}
+		}
+	})
 }
@@ -177,6 +177,47 @@ func NewCriterionSessionRule(
 	return r1
 }
 
+// NewCriterionSessionRuleWithAdditionalData generates a new rule for a criterion
+// which requires a session, like NewCriterionSessionRule, and includes additional
+// data in every result.
+func NewCriterionSessionRuleWithAdditionalData(
+	g *generator.Generator,
+	name string,
+	passReason, failReason Reason,
+	body ast.Body,
+	additionalData map[string]interface{},
+) *ast.Rule {
+	// case 1: rule passes, session exists
+	r1 := g.NewRule(name)
+	r1.Head.Value = NewCriterionTermWithAdditionalData(true, passReason, additionalData)
+	r1.Body = body
+
+	// case 2: rule fails, session exists
+	r2 := &ast.Rule{
+		Head: &ast.Head{
+			Value: NewCriterionTermWithAdditionalData(false, failReason, additionalData),
+		},
+		Body: ast.Body{
+			ast.MustParseExpr(`session := get_session(input.session.id)`),
+			ast.MustParseExpr(`session.id != ""`),
+		},
+	}
+	r1.Else = r2
+
+	// case 3: user not authenticated, session does not exist
+	r3 := &ast.Rule{
+		Head: &ast.Head{
+			Value: NewCriterionTermWithAdditionalData(false, ReasonUserUnauthenticated, additionalData),
+		},
+		Body: ast.Body{
+			ast.NewExpr(ast.BooleanTerm(true)),
+		},
+	}
+	r2.Else = r3
+
+	return r1
+}
+
 // NewCriterionTerm creates a new rego term for a criterion:
 //
 //	[true, {"reason"}]
@@ -33,7 +33,10 @@ type (
 	InputHTTP struct {
 		Method  string              `json:"method"`
 		Path    string              `json:"path"`
-		Headers map[string][]string `json:"headers"`
+		URL     string              `json:"url"`
+		Query   map[string][]string `json:"query"`
+		Headers map[string]string   `json:"headers"`
+		IP      string              `json:"ip"`
 	}
 	InputSession struct {
 		ID string `json:"id"`
@@ -0,0 +1,114 @@
+package criteria
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+const (
+	dateOperatorAfter    = "after"
+	dateOperatorBefore   = "before"
+	dateOperatorTimezone = "timezone"
+)
+
+var dateOperatorLookup = map[string]struct{}{
+	dateOperatorAfter:    {},
+	dateOperatorBefore:   {},
+	dateOperatorTimezone: {},
+}
+
+type dateCriterion struct {
+	g *Generator
+}
+
+func (dateCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (dateCriterion) Name() string {
+	return "date"
+}
+
+func (c dateCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	obj, ok := data.(parser.Object)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected object for date criterion, got: %T", data)
+	}
+
+	for k := range obj {
+		_, ok := dateOperatorLookup[k]
+		if !ok {
+			return nil, nil, fmt.Errorf("unexpected field in date criterion: %s", k)
+		}
+	}
+
+	tz, err := getTimezone(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body := ast.Body{
+		ast.MustParseExpr(`now := time.now_ns()`),
+	}
+
+	// after is inclusive
+	if v, ok := obj[dateOperatorAfter]; ok {
+		after, err := parseDate(v, tz)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid date criterion after: %w", err)
+		}
+		body = append(body, ast.GreaterThanEq.Expr(ast.VarTerm("now"), ast.IntNumberTerm(int(after.UnixNano()))))
+	}
+
+	// before is exclusive
+	if v, ok := obj[dateOperatorBefore]; ok {
+		before, err := parseDate(v, tz)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid date criterion before: %w", err)
+		}
+		body = append(body, ast.LessThan.Expr(ast.VarTerm("now"), ast.IntNumberTerm(int(before.UnixNano()))))
+	}
+
+	rule := NewCriterionRule(c.g, c.Name(),
+		ReasonDateOK, ReasonDateUnauthorized,
+		body)
+
+	return rule, nil, nil
+}
+
+// Date returns a Criterion which matches the current date and time against a range.
+func Date(generator *Generator) Criterion {
+	return dateCriterion{g: generator}
+}
+
+func init() {
+	Register(Date)
+}
+
+// parseDate parses a date ("2006-01-02") or a date and time (RFC 3339). Dates and
+// date times without an offset are interpreted in the given timezone.
+func parseDate(v parser.Value, tz *time.Location) (time.Time, error) {
+	s, ok := v.(parser.String)
+	if !ok {
+		return time.Time{}, fmt.Errorf("expected string, got: %T", v)
+	}
+
+	raw := string(s)
+	for _, layout := range []string{"2006-01-02", "2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		t, err := time.ParseInLocation(layout, raw, tz)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a date (YYYY-MM-DD) or an RFC 3339 date time: %s", raw)
+	}
+	return t, nil
+}
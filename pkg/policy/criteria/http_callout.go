@@ -0,0 +1,225 @@
+package criteria
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+	"github.com/pomerium/pomerium/pkg/policy/rules"
+)
+
+const (
+	httpCalloutOperatorCacheTTL       = "cache_ttl"
+	httpCalloutOperatorFailOpen       = "fail_open"
+	httpCalloutOperatorForwardHeaders = "forward_headers"
+	httpCalloutOperatorHeaders        = "headers"
+	httpCalloutOperatorTimeout        = "timeout"
+	httpCalloutOperatorURL            = "url"
+)
+
+var httpCalloutOperatorLookup = map[string]struct{}{
+	httpCalloutOperatorCacheTTL:       {},
+	httpCalloutOperatorFailOpen:       {},
+	httpCalloutOperatorForwardHeaders: {},
+	httpCalloutOperatorHeaders:        {},
+	httpCalloutOperatorTimeout:        {},
+	httpCalloutOperatorURL:            {},
+}
+
+const (
+	defaultHTTPCalloutCacheTTL = time.Minute
+	defaultHTTPCalloutTimeout  = 5 * time.Second
+)
+
+// only the request headers listed in forward_headers are sent to the callout url
+var httpCalloutBody = ast.Body{
+	ast.MustParseExpr(`session := get_session(input.session.id)`),
+	ast.MustParseExpr(`session.id != ""`),
+	ast.MustParseExpr(`user := get_user(session)`),
+	ast.MustParseExpr(`claims := object.union(object.get(session, "claims", {}), object.get(user, "claims", {}))`),
+	ast.MustParseExpr(`request_headers := {k: v | v := input.http.headers[k]}`),
+	ast.MustParseExpr(`
+		http_callout_document := {
+			"request": {
+				"method": input.http.method,
+				"url": input.http.url,
+				"headers": object.filter(request_headers, http_callout_config.forward_headers),
+				"ip": input.http.ip,
+			},
+			"route": object.get(input, "route", {}),
+			"session": {
+				"id": session.id,
+				"user_id": object.get(session, "user_id", ""),
+			},
+			"user": {
+				"id": object.get(user, "id", ""),
+				"email": object.get(user, "email", ""),
+				"name": object.get(user, "name", ""),
+			},
+			"claims": claims,
+		}
+	`),
+	ast.MustParseExpr(`http_callout_result := http_callout(http_callout_config, http_callout_document)`),
+	ast.MustParseExpr(`http_callout_result.allow == true`),
+}
+
+type httpCalloutCriterion struct {
+	g *Generator
+}
+
+func (httpCalloutCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (httpCalloutCriterion) Name() string {
+	return "http_callout"
+}
+
+func (c httpCalloutCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	cfg, err := getHTTPCalloutConfig(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid http_callout criterion: %w", err)
+	}
+
+	body := append(ast.Body{
+		ast.Assign.Expr(ast.VarTerm("http_callout_config"), ast.NewTerm(ast.MustInterfaceToValue(cfg))),
+	}, httpCalloutBody...)
+
+	rule := NewCriterionSessionRule(c.g, c.Name(),
+		ReasonHTTPCalloutOK, ReasonHTTPCalloutUnauthorized,
+		body)
+
+	return rule, []*ast.Rule{
+		rules.GetSession(),
+		rules.GetUser(),
+	}, nil
+}
+
+// HTTPCallout returns a Criterion which POSTs details about the request to an
+// external service which decides whether or not to allow it.
+//
+// fail_open applies to the final decision rather than to the criterion: when
+// the callout fails the request is denied, unless fail_open is set, in which
+// case the callout's failure alone never denies the request, wherever the
+// criterion appears in the policy.
+func HTTPCallout(generator *Generator) Criterion {
+	return httpCalloutCriterion{g: generator}
+}
+
+func init() {
+	Register(HTTPCallout)
+}
+
+// getHTTPCalloutConfig validates the http_callout criterion data and returns the
+// config passed to the http_callout rego function.
+func getHTTPCalloutConfig(data parser.Value) (map[string]interface{}, error) {
+	obj, ok := data.(parser.Object)
+	if !ok {
+		return nil, fmt.Errorf("expected object, got: %T", data)
+	}
+
+	for k := range obj {
+		_, ok := httpCalloutOperatorLookup[k]
+		if !ok {
+			return nil, fmt.Errorf("unexpected field: %s", k)
+		}
+	}
+
+	rawURL, ok := obj[httpCalloutOperatorURL].(parser.String)
+	if !ok {
+		return nil, fmt.Errorf("expected string for url, got: %T", obj[httpCalloutOperatorURL])
+	}
+	u, err := url.Parse(string(rawURL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid url: %s", rawURL)
+	}
+
+	headers := map[string]interface{}{}
+	if v, ok := obj[httpCalloutOperatorHeaders]; ok {
+		hobj, ok := v.(parser.Object)
+		if !ok {
+			return nil, fmt.Errorf("expected object for headers, got: %T", v)
+		}
+		for k, vv := range hobj {
+			s, ok := vv.(parser.String)
+			if !ok {
+				return nil, fmt.Errorf("expected string for header %s, got: %T", k, vv)
+			}
+			headers[k] = string(s)
+		}
+	}
+
+	timeout, err := getHTTPCalloutDuration(obj, httpCalloutOperatorTimeout, defaultHTTPCalloutTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("expected a positive timeout, got: %s", timeout)
+	}
+
+	cacheTTL, err := getHTTPCalloutDuration(obj, httpCalloutOperatorCacheTTL, defaultHTTPCalloutCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	forwardHeaders := []interface{}{}
+	if v, ok := obj[httpCalloutOperatorForwardHeaders]; ok {
+		a, ok := v.(parser.Array)
+		if !ok {
+			return nil, fmt.Errorf("expected array for forward_headers, got: %T", v)
+		}
+		for _, vv := range a {
+			s, ok := vv.(parser.String)
+			if !ok {
+				return nil, fmt.Errorf("expected string for forwarded header, got: %T", vv)
+			}
+			// request headers are canonicalized
+			forwardHeaders = append(forwardHeaders, http.CanonicalHeaderKey(string(s)))
+		}
+	}
+
+	failOpen := false
+	if v, ok := obj[httpCalloutOperatorFailOpen]; ok {
+		b, ok := v.(parser.Boolean)
+		if !ok {
+			return nil, fmt.Errorf("expected boolean for fail_open, got: %T", v)
+		}
+		failOpen = bool(b)
+	}
+
+	return map[string]interface{}{
+		"url":             u.String(),
+		"headers":         headers,
+		"forward_headers": forwardHeaders,
+		"timeout":         timeout.String(),
+		"cache_ttl":       cacheTTL.String(),
+		"fail_open":       failOpen,
+	}, nil
+}
+
+func getHTTPCalloutDuration(obj parser.Object, field string, def time.Duration) (time.Duration, error) {
+	v, ok := obj[field]
+	if !ok {
+		return def, nil
+	}
+	s, ok := v.(parser.String)
+	if !ok {
+		return 0, fmt.Errorf("expected duration string for %s, got: %T", field, v)
+	}
+	d, err := time.ParseDuration(string(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", field, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("expected a non-negative %s, got: %s", field, d)
+	}
+	return d, nil
+}
@@ -0,0 +1,67 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPCallout(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		rego, err := generateRegoFromYAML(`
+allow:
+  and:
+    - http_callout:
+        url: https://entitlements.example.com/check
+        headers:
+          X-API-Key: KEY
+        forward_headers: [x-tenant]
+        timeout: 2s
+        fail_open: true
+`)
+		require.NoError(t, err)
+		assert.Contains(t, rego, `"url": "https://entitlements.example.com/check"`)
+		assert.Contains(t, rego, `"headers": {"X-API-Key": "KEY"}`)
+		assert.Contains(t, rego, `"forward_headers": ["X-Tenant"]`)
+		assert.Contains(t, rego, `"timeout": "2s"`)
+		assert.Contains(t, rego, `"cache_ttl": "1m0s"`)
+		assert.Contains(t, rego, `"fail_open": true`)
+		assert.Contains(t, rego, `http_callout(http_callout_config, http_callout_document)`)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, policy := range []string{
+			`
+allow:
+  and:
+    - http_callout: https://entitlements.example.com/check
+`, `
+allow:
+  and:
+    - http_callout:
+        url: entitlements.example.com
+`, `
+allow:
+  and:
+    - http_callout:
+        url: https://entitlements.example.com/check
+        timeout: soon
+`, `
+allow:
+  and:
+    - http_callout:
+        url: https://entitlements.example.com/check
+        method: GET
+`, `
+allow:
+  and:
+    - http_callout:
+        url: https://entitlements.example.com/check
+        forward_headers: X-Tenant
+`,
+		} {
+			_, err := generateRegoFromYAML(policy)
+			assert.Error(t, err, policy)
+		}
+	})
+}
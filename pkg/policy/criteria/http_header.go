@@ -0,0 +1,57 @@
+package criteria
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+var httpHeaderBody = ast.Body{
+	ast.MustParseExpr(`header := input.http.headers[header_name]`),
+}
+
+type httpHeaderCriterion struct {
+	g *Generator
+}
+
+func (httpHeaderCriterion) DataType() CriterionDataType {
+	return CriterionDataTypeStringMatcher
+}
+
+func (httpHeaderCriterion) Name() string {
+	return "http_header"
+}
+
+func (c httpHeaderCriterion) GenerateRule(subPath string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	if subPath == "" {
+		return nil, nil, fmt.Errorf("http_header criterion requires a header name, e.g. http_header/X-Tenant")
+	}
+
+	body := ast.Body{
+		ast.Assign.Expr(ast.VarTerm("header_name"), ast.StringTerm(http.CanonicalHeaderKey(subPath))),
+	}
+	body = append(body, httpHeaderBody...)
+
+	err := matchString(&body, ast.VarTerm("header"), data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rule := NewCriterionRule(c.g, c.Name(),
+		ReasonHTTPHeaderOK, ReasonHTTPHeaderUnauthorized,
+		body)
+
+	return rule, nil, nil
+}
+
+// HTTPHeader returns a Criterion which matches an HTTP request header.
+func HTTPHeader(generator *Generator) Criterion {
+	return httpHeaderCriterion{g: generator}
+}
+
+func init() {
+	Register(HTTPHeader)
+}
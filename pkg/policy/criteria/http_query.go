@@ -0,0 +1,76 @@
+package criteria
+
+import (
+	"fmt"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+var (
+	httpQueryBody = ast.Body{
+		ast.MustParseExpr(`values := input.http.query[query_name]`),
+	}
+	httpQueryValueBody = ast.Body{
+		ast.MustParseExpr(`value := values[_]`),
+	}
+)
+
+type httpQueryCriterion struct {
+	g *Generator
+}
+
+func (httpQueryCriterion) DataType() CriterionDataType {
+	return CriterionDataTypeStringMatcher
+}
+
+func (httpQueryCriterion) Name() string {
+	return "http_query"
+}
+
+func (c httpQueryCriterion) GenerateRule(subPath string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	if subPath == "" {
+		return nil, nil, fmt.Errorf("http_query criterion requires a query parameter name, e.g. http_query/debug")
+	}
+
+	body := ast.Body{
+		ast.Assign.Expr(ast.VarTerm("query_name"), ast.StringTerm(subPath)),
+	}
+	body = append(body, httpQueryBody...)
+
+	valueBody := ast.Body{}
+	valueBody = append(valueBody, httpQueryValueBody...)
+	err := matchString(&valueBody, ast.VarTerm("value"), data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if c.g.CriterionGrantsAccess() {
+		// applications may read any of the values of a repeated query
+		// parameter, so every value must match to grant access
+		body = append(body,
+			ast.MustParseExpr(`count(values) > 0`),
+			ast.Assign.Expr(ast.VarTerm("matched"), ast.ArrayComprehensionTerm(ast.VarTerm("value"), valueBody)),
+			ast.MustParseExpr(`count(matched) == count(values)`),
+		)
+	} else {
+		// and any of the values matching denies access
+		body = append(body, valueBody...)
+	}
+
+	rule := NewCriterionRule(c.g, c.Name(),
+		ReasonHTTPQueryOK, ReasonHTTPQueryUnauthorized,
+		body)
+
+	return rule, nil, nil
+}
+
+// HTTPQuery returns a Criterion which matches an HTTP query parameter.
+func HTTPQuery(generator *Generator) Criterion {
+	return httpQueryCriterion{g: generator}
+}
+
+func init() {
+	Register(HTTPQuery)
+}
@@ -0,0 +1,87 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPQuery(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		res, err := evaluate(t, `
+deny:
+  and:
+    - http_query/debug:
+        is: "1"
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{Query: map[string][]string{"x": {"y"}, "debug": {"0", "1"}}}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{}}, res["allow"])
+		require.Equal(t, A{true, A{ReasonHTTPQueryOK}, M{}}, res["deny"])
+	})
+	t.Run("decoded", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - http_query/q:
+        contains: "a b"
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{Query: map[string][]string{"q": {"a b"}}}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonHTTPQueryOK}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("repeated", func(t *testing.T) {
+		query := map[string][]string{"tenant": {"evil", "mine"}}
+
+		res, err := evaluate(t, `
+allow:
+  and:
+    - http_query/tenant:
+        is: mine
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{Query: query}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonHTTPQueryUnauthorized}, M{}}, res["allow"],
+			"should require every value to match to grant access")
+
+		res, err = evaluate(t, `
+deny:
+  not:
+    - http_query/tenant:
+        is: mine
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{Query: query}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonHTTPQueryUnauthorized}, M{}}, res["deny"],
+			"should require every value to match to grant access")
+
+		res, err = evaluate(t, `
+allow:
+  not:
+    - http_query/tenant:
+        is: evil
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{Query: query}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonHTTPQueryOK}, M{}}, res["allow"],
+			"should deny access if any value matches")
+	})
+	t.Run("unauthorized", func(t *testing.T) {
+		res, err := evaluate(t, `
+deny:
+  and:
+    - http_query/debug:
+        is: "1"
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{Query: map[string][]string{"debug": {"0"}}}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{}}, res["allow"])
+		require.Equal(t, A{false, A{ReasonHTTPQueryUnauthorized}, M{}}, res["deny"])
+	})
+	t.Run("no query string", func(t *testing.T) {
+		res, err := evaluate(t, `
+deny:
+  and:
+    - http_query/debug:
+        is: "1"
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{}}, res["allow"])
+		require.Equal(t, A{false, A{ReasonHTTPQueryUnauthorized}, M{}}, res["deny"])
+	})
+}
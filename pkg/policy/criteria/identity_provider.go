@@ -0,0 +1,61 @@
+package criteria
+
+import (
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+	"github.com/pomerium/pomerium/pkg/policy/rules"
+)
+
+var identityProviderBody = ast.Body{
+	ast.MustParseExpr(`
+		session := get_session(input.session.id)
+	`),
+	ast.MustParseExpr(`
+		session.id != ""
+	`),
+	ast.MustParseExpr(`
+		identity_provider := object.get(object.get(session, "claims", {}), "` + session.IdentityProviderIDClaim + `", [])[0]
+	`),
+}
+
+type identityProviderCriterion struct {
+	g *Generator
+}
+
+func (identityProviderCriterion) DataType() CriterionDataType {
+	return CriterionDataTypeStringMatcher
+}
+
+func (identityProviderCriterion) Name() string {
+	return "identity_provider"
+}
+
+func (c identityProviderCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	var body ast.Body
+	body = append(body, identityProviderBody...)
+
+	err := matchString(&body, ast.VarTerm("identity_provider"), data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rule := NewCriterionSessionRule(c.g, c.Name(),
+		ReasonIdentityProviderOK, ReasonIdentityProviderUnauthorized,
+		body)
+
+	return rule, []*ast.Rule{
+		rules.GetSession(),
+	}, nil
+}
+
+// IdentityProvider returns a Criterion on the id of the identity provider the
+// user signed in with.
+func IdentityProvider(generator *Generator) Criterion {
+	return identityProviderCriterion{g: generator}
+}
+
+func init() {
+	Register(IdentityProvider)
+}
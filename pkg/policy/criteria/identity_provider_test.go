@@ -0,0 +1,70 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestIdentityProvider(t *testing.T) {
+	mkSession := func(sessionID, idpID string) *session.Session {
+		s := &session.Session{Id: sessionID}
+		if idpID != "" {
+			s.SetIdentityProviderID(idpID)
+		}
+		return s
+	}
+
+	t.Run("no session", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - identity_provider:
+        is: okta
+`, []dataBrokerRecord{}, Input{Session: InputSession{ID: "s1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonUserUnauthenticated}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("ok", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - identity_provider:
+        is: okta
+`, []dataBrokerRecord{
+			mkSession("s1", "okta"),
+		}, Input{Session: InputSession{ID: "s1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonIdentityProviderOK}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("unauthorized", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - identity_provider:
+        is: okta
+`, []dataBrokerRecord{
+			mkSession("s1", "azure"),
+		}, Input{Session: InputSession{ID: "s1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonIdentityProviderUnauthorized}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("missing claim", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - identity_provider:
+        is: okta
+`, []dataBrokerRecord{
+			mkSession("s1", ""),
+		}, Input{Session: InputSession{ID: "s1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonIdentityProviderUnauthorized}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+}
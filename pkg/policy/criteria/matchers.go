@@ -2,6 +2,7 @@ package criteria
 
 import (
 	"fmt"
+	"regexp"
 
 	"github.com/open-policy-agent/opa/ast"
 
@@ -10,20 +11,33 @@ import (
 
 type matcher func(*ast.Body, *ast.Term, parser.Value) error
 
+var stringMatchers = map[string]matcher{
+	"contains":    matchStringContains,
+	"ends_with":   matchStringEndsWith,
+	"gt":          matchStringCompare(ast.GreaterThan),
+	"gte":         matchStringCompare(ast.GreaterThanEq),
+	"is":          matchStringIs,
+	"lt":          matchStringCompare(ast.LessThan),
+	"lte":         matchStringCompare(ast.LessThanEq),
+	"matches":     matchStringRegex,
+	"regex":       matchStringRegex, // an alias of matches
+	"starts_with": matchStringStartsWith,
+}
+
+var stringListMatchers = map[string]matcher{
+	"has":     matchStringListHas,
+	"has_all": matchStringListHasAll,
+	"has_any": matchStringListHasAny,
+}
+
 func matchString(dst *ast.Body, left *ast.Term, right parser.Value) error {
 	obj, ok := right.(parser.Object)
 	if !ok {
 		return fmt.Errorf("expected object for string matcher, got: %T", right)
 	}
 
-	lookup := map[string]matcher{
-		"contains":    matchStringContains,
-		"ends_with":   matchStringEndsWith,
-		"is":          matchStringIs,
-		"starts_with": matchStringStartsWith,
-	}
 	for k, v := range obj {
-		f, ok := lookup[k]
+		f, ok := stringMatchers[k]
 		if !ok {
 			return fmt.Errorf("unknown string matcher operator: %s", k)
 		}
@@ -50,24 +64,59 @@ func matchStringIs(dst *ast.Body, left *ast.Term, right parser.Value) error {
 	return nil
 }
 
+// matchStringCompare compares numbers numerically and strings lexicographically,
+// which also works for ISO 8601 dates.
+func matchStringCompare(op *ast.Builtin) matcher {
+	return func(dst *ast.Body, left *ast.Term, right parser.Value) error {
+		switch t := right.(type) {
+		case parser.Number:
+			*dst = append(*dst, op.Expr(ast.ToNumber.Call(left), ast.NewTerm(t.RegoValue())))
+		case parser.String:
+			*dst = append(*dst,
+				ast.IsString.Expr(left),
+				op.Expr(left, ast.NewTerm(t.RegoValue())))
+		default:
+			return fmt.Errorf("expected number or string for %s, got: %T", op.Infix, right)
+		}
+		return nil
+	}
+}
+
+func matchStringRegex(dst *ast.Body, left *ast.Term, right parser.Value) error {
+	s, ok := right.(parser.String)
+	if !ok {
+		return fmt.Errorf("expected string for regex, got: %T", right)
+	}
+	// validate the pattern now so that an invalid regex is reported when the policy is generated
+	if _, err := regexp.Compile(string(s)); err != nil {
+		return fmt.Errorf("invalid regex: %w", err)
+	}
+	*dst = append(*dst, ast.RegexMatch.Expr(ast.StringTerm(string(s)), left))
+	return nil
+}
+
 func matchStringStartsWith(dst *ast.Body, left *ast.Term, right parser.Value) error {
 	*dst = append(*dst, ast.StartsWith.Expr(left, ast.NewTerm(right.RegoValue())))
 	return nil
 }
 
+// matchStringList matches a list of strings. In addition to the list operators,
+// any string matcher operator can be used, in which case at least one of the
+// strings in the list must match.
 func matchStringList(dst *ast.Body, left *ast.Term, right parser.Value) error {
 	obj, ok := right.(parser.Object)
 	if !ok {
 		return fmt.Errorf("expected object for string list matcher, got: %T", right)
 	}
 
-	lookup := map[string]matcher{
-		"has": matchStringListHas,
-	}
 	for k, v := range obj {
-		f, ok := lookup[k]
+		f, ok := stringListMatchers[k]
 		if !ok {
-			return fmt.Errorf("unknown string list matcher operator: %s", k)
+			sf, ok := stringMatchers[k]
+			if !ok {
+				return fmt.Errorf("unknown string list matcher operator: %s", k)
+			}
+			f = matchStringListAny(sf)
 		}
 		err := f(dst, left, v)
 		if err != nil {
@@ -77,23 +126,89 @@ func matchStringList(dst *ast.Body, left *ast.Term, right parser.Value) error {
 	return nil
 }
 
+func matchStringListAny(f matcher) matcher {
+	return func(dst *ast.Body, left *ast.Term, right parser.Value) error {
+		body := ast.Body{
+			ast.MustParseExpr("some v"),
+			ast.Equality.Expr(ast.VarTerm("v"), ast.RefTerm(left, ast.VarTerm("$0"))),
+		}
+		err := f(&body, ast.VarTerm("v"), right)
+		if err != nil {
+			return err
+		}
+		*dst = append(*dst, ast.GreaterThan.Expr(
+			ast.Count.Call(
+				ast.ArrayComprehensionTerm(
+					ast.BooleanTerm(true),
+					body,
+				),
+			),
+			ast.IntNumberTerm(0),
+		))
+		return nil
+	}
+}
+
 func matchStringListHas(dst *ast.Body, left *ast.Term, right parser.Value) error {
-	body := ast.Body{
-		ast.MustParseExpr("some v"),
-		ast.Equality.Expr(ast.VarTerm("v"), ast.RefTerm(left, ast.VarTerm("$0"))),
+	return matchStringListAny(matchStringIs)(dst, left, right)
+}
+
+func matchStringListHasAll(dst *ast.Body, left *ast.Term, right parser.Value) error {
+	expect, err := getStringListMatcherSet(right)
+	if err != nil {
+		return fmt.Errorf("invalid has_all: %w", err)
 	}
-	err := matchStringIs(&body, ast.VarTerm("v"), right)
+	// every expected value must be in the list
+	*dst = append(*dst, ast.Equal.Expr(
+		ast.Count.Call(
+			ast.Minus.Call(
+				expect,
+				ast.SetComprehensionTerm(
+					ast.VarTerm("v"),
+					ast.Body{
+						ast.MustParseExpr("some v"),
+						ast.Equality.Expr(ast.VarTerm("v"), ast.RefTerm(left, ast.VarTerm("$0"))),
+					},
+				),
+			),
+		),
+		ast.IntNumberTerm(0),
+	))
+	return nil
+}
+
+func matchStringListHasAny(dst *ast.Body, left *ast.Term, right parser.Value) error {
+	expect, err := getStringListMatcherSet(right)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid has_any: %w", err)
 	}
+	// at least one of the expected values must be in the list
 	*dst = append(*dst, ast.GreaterThan.Expr(
 		ast.Count.Call(
-			ast.ArrayComprehensionTerm(
-				ast.BooleanTerm(true),
-				body,
+			ast.And.Call(
+				expect,
+				ast.SetComprehensionTerm(
+					ast.VarTerm("v"),
+					ast.Body{
+						ast.MustParseExpr("some v"),
+						ast.Equality.Expr(ast.VarTerm("v"), ast.RefTerm(left, ast.VarTerm("$0"))),
+					},
+				),
 			),
 		),
 		ast.IntNumberTerm(0),
 	))
 	return nil
 }
+
+func getStringListMatcherSet(v parser.Value) (*ast.Term, error) {
+	a, ok := v.(parser.Array)
+	if !ok {
+		return nil, fmt.Errorf("expected array, got: %T", v)
+	}
+	var terms []*ast.Term
+	for _, vv := range a {
+		terms = append(terms, ast.NewTerm(vv.RegoValue()))
+	}
+	return ast.SetTerm(terms...), nil
+}
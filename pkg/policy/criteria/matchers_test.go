@@ -42,6 +42,48 @@ func TestStringMatcher(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, `example == "test"`, str(body))
 	})
+	t.Run("gte", func(t *testing.T) {
+		var body ast.Body
+		err := matchString(&body, ast.VarTerm("example"), parser.Object{
+			"gte": parser.Number("3"),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, `to_number(example) >= 3`, str(body))
+	})
+	t.Run("lt", func(t *testing.T) {
+		var body ast.Body
+		err := matchString(&body, ast.VarTerm("example"), parser.Object{
+			"lt": parser.String("2020-01-01"),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "is_string(example)\nexample < \"2020-01-01\"", str(body))
+
+		err = matchString(&body, ast.VarTerm("example"), parser.Object{
+			"lt": parser.Boolean(true),
+		})
+		assert.Error(t, err)
+	})
+	t.Run("matches", func(t *testing.T) {
+		var body ast.Body
+		err := matchString(&body, ast.VarTerm("example"), parser.Object{
+			"matches": parser.String("^te.t$"),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, `regex.match("^te.t$", example)`, str(body))
+	})
+	t.Run("regex", func(t *testing.T) {
+		var body ast.Body
+		err := matchString(&body, ast.VarTerm("example"), parser.Object{
+			"regex": parser.String("^te.t$"),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, `regex.match("^te.t$", example)`, str(body))
+
+		err = matchString(&body, ast.VarTerm("example"), parser.Object{
+			"regex": parser.String("("),
+		})
+		assert.Error(t, err)
+	})
 	t.Run("starts_with", func(t *testing.T) {
 		var body ast.Body
 		err := matchString(&body, ast.VarTerm("example"), parser.Object{
@@ -66,4 +108,33 @@ func TestStringListMatcher(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, `count([true | some v; v = example[_]; v == "test"]) > 0`, str(body))
 	})
+	t.Run("has_all", func(t *testing.T) {
+		var body ast.Body
+		err := matchStringList(&body, ast.VarTerm("example"), parser.Object{
+			"has_all": parser.Array{parser.String("a"), parser.String("b")},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, `count({"a", "b"} - {v | some v; v = example[_]}) == 0`, str(body))
+	})
+	t.Run("has_any", func(t *testing.T) {
+		var body ast.Body
+		err := matchStringList(&body, ast.VarTerm("example"), parser.Object{
+			"has_any": parser.Array{parser.String("a"), parser.String("b")},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, `count({"a", "b"} & {v | some v; v = example[_]}) > 0`, str(body))
+
+		err = matchStringList(&body, ast.VarTerm("example"), parser.Object{
+			"has_any": parser.String("a"),
+		})
+		assert.Error(t, err)
+	})
+	t.Run("string matcher", func(t *testing.T) {
+		var body ast.Body
+		err := matchStringList(&body, ast.VarTerm("example"), parser.Object{
+			"starts_with": parser.String("test"),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, `count([true | some v; v = example[_]; startswith(v, "test")]) > 0`, str(body))
+	})
 }
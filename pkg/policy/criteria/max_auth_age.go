@@ -0,0 +1,89 @@
+package criteria
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+	"github.com/pomerium/pomerium/pkg/policy/rules"
+)
+
+var maxAuthAgeBody = ast.Body{
+	ast.MustParseExpr(`session := get_session(input.session.id)`),
+	ast.MustParseExpr(`session.id != ""`),
+	ast.MustParseExpr(`auth_time := get_session_auth_time(session)`),
+	ast.MustParseExpr(`auth_time > 0`),
+	ast.MustParseExpr(`(time.now_ns() / 1000000000) - auth_time <= max_age`),
+}
+
+type maxAuthAgeCriterion struct {
+	g *Generator
+}
+
+func (maxAuthAgeCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (maxAuthAgeCriterion) Name() string {
+	return "max_auth_age"
+}
+
+func (c maxAuthAgeCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	maxAge, err := getMaxAuthAge(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid max_auth_age criterion: %w", err)
+	}
+
+	seconds := int(maxAge / time.Second)
+	additionalData := map[string]interface{}{
+		"max_age": seconds,
+	}
+
+	body := append(ast.Body{
+		ast.Assign.Expr(ast.VarTerm("max_age"), ast.IntNumberTerm(seconds)),
+	}, maxAuthAgeBody...)
+
+	rule := NewCriterionSessionRuleWithAdditionalData(c.g, c.Name(),
+		ReasonMaxAuthAgeOK, ReasonMaxAuthAgeExceeded,
+		body, additionalData)
+
+	return rule, []*ast.Rule{
+		rules.GetSession(),
+		rules.GetSessionAuthTime(),
+	}, nil
+}
+
+// MaxAuthAge returns a Criterion which requires the user to have authenticated
+// within a maximum amount of time.
+func MaxAuthAge(generator *Generator) Criterion {
+	return maxAuthAgeCriterion{g: generator}
+}
+
+func init() {
+	Register(MaxAuthAge)
+}
+
+// getMaxAuthAge returns the max auth age for a duration string ("15m") or a
+// number of seconds.
+func getMaxAuthAge(v parser.Value) (time.Duration, error) {
+	var maxAge time.Duration
+	switch t := v.(type) {
+	case parser.Number:
+		maxAge = time.Duration(t.Float64() * float64(time.Second))
+	case parser.String:
+		var err error
+		maxAge, err = time.ParseDuration(string(t))
+		if err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("expected duration or number of seconds, got: %T", v)
+	}
+	if maxAge < time.Second {
+		return 0, fmt.Errorf("expected a duration of at least one second, got: %s", maxAge)
+	}
+	return maxAge, nil
+}
@@ -0,0 +1,86 @@
+package criteria
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestMaxAuthAge(t *testing.T) {
+	maxAge := M{"max_age": json.Number("900")}
+
+	t.Run("no session", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - max_auth_age: 15m
+`, []dataBrokerRecord{}, Input{Session: InputSession{ID: "s1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonUserUnauthenticated}, maxAge}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("issued at ok", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - max_auth_age: 900
+`, []dataBrokerRecord{
+			&session.Session{
+				Id:       "s1",
+				IssuedAt: timestamppb.New(testingNow.Add(-10 * time.Minute)),
+			},
+		}, Input{Session: InputSession{ID: "s1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonMaxAuthAgeOK}, maxAge}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("issued at exceeded", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - max_auth_age: 15m
+`, []dataBrokerRecord{
+			&session.Session{
+				Id:       "s1",
+				IssuedAt: timestamppb.New(testingNow.Add(-20 * time.Minute)),
+			},
+		}, Input{Session: InputSession{ID: "s1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonMaxAuthAgeExceeded}, maxAge}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("auth time exceeded", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - max_auth_age: 15m
+`, []dataBrokerRecord{
+			&session.Session{
+				Id:       "s1",
+				IssuedAt: timestamppb.New(testingNow),
+				Claims: map[string]*structpb.ListValue{
+					"auth_time": {Values: []*structpb.Value{
+						structpb.NewNumberValue(float64(testingNow.Add(-time.Hour).Unix())),
+					}},
+				},
+			},
+		}, Input{Session: InputSession{ID: "s1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonMaxAuthAgeExceeded}, maxAge}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("invalid", func(t *testing.T) {
+		_, err := evaluate(t, `
+allow:
+  and:
+    - max_auth_age: soon
+`, []dataBrokerRecord{}, Input{})
+		require.Error(t, err)
+	})
+}
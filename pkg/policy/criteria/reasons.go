@@ -7,10 +7,16 @@ type Reason string
 
 // Well-known reasons.
 const (
+	ReasonACROK                                = "acr-ok"
+	ReasonACRUnauthorized                      = "acr-unauthorized" // user needs to log in with a different authentication context
+	ReasonAMROK                                = "amr-ok"
+	ReasonAMRUnauthorized                      = "amr-unauthorized"
 	ReasonAccept                               = "accept"
 	ReasonClaimOK                              = "claim-ok"
 	ReasonClaimUnauthorized                    = "claim-unauthorized"
 	ReasonCORSRequest                          = "cors-request"
+	ReasonDateOK                               = "date-ok"
+	ReasonDateUnauthorized                     = "date-unauthorized"
 	ReasonDeviceOK                             = "device-ok"
 	ReasonDeviceUnauthenticated                = "device-unauthenticated"
 	ReasonDeviceUnauthorized                   = "device-unauthorized"
@@ -18,16 +24,34 @@ const (
 	ReasonDomainUnauthorized                   = "domain-unauthorized"
 	ReasonEmailOK                              = "email-ok"
 	ReasonEmailUnauthorized                    = "email-unauthorized"
+	ReasonHTTPCalloutError                     = "http-callout-error"
+	ReasonHTTPCalloutOK                        = "http-callout-ok"
+	ReasonHTTPCalloutUnauthorized              = "http-callout-unauthorized"
+	ReasonHTTPHeaderOK                         = "http-header-ok"
+	ReasonHTTPHeaderUnauthorized               = "http-header-unauthorized"
 	ReasonHTTPMethodOK                         = "http-method-ok"
 	ReasonHTTPMethodUnauthorized               = "http-method-unauthorized"
 	ReasonHTTPPathOK                           = "http-path-ok"
 	ReasonHTTPPathUnauthorized                 = "http-path-unauthorized"
+	ReasonHTTPQueryOK                          = "http-query-ok"
+	ReasonHTTPQueryUnauthorized                = "http-query-unauthorized"
+	ReasonIdentityProviderOK                   = "identity-provider-ok"
+	ReasonIdentityProviderUnauthorized         = "identity-provider-unauthorized"
 	ReasonInvalidClientCertificate             = "invalid-client-certificate"
+	ReasonMaxAuthAgeExceeded                   = "max-auth-age-exceeded" // user needs to log in again
+	ReasonMaxAuthAgeOK                         = "max-auth-age-ok"
 	ReasonNonCORSRequest                       = "non-cors-request"
 	ReasonNonPomeriumRoute                     = "non-pomerium-route"
 	ReasonPomeriumRoute                        = "pomerium-route"
+	ReasonRateLimited                          = "rate-limited" // too many requests were made to the route
 	ReasonReject                               = "reject"
 	ReasonRouteNotFound                        = "route-not-found"
+	ReasonSourceIPOK                           = "source-ip-ok"
+	ReasonSourceIPUnauthorized                 = "source-ip-unauthorized"
+	ReasonTimeOfDayOK                          = "time-of-day-ok"
+	ReasonTimeOfDayUnauthorized                = "time-of-day-unauthorized"
+	ReasonTokenExchangeFailed                  = "token-exchange-failed" // the upstream token couldn't be obtained
+	ReasonUserDeactivated                      = "user-deactivated"      // user was deactivated by the SCIM client
 	ReasonUserOK                               = "user-ok"
 	ReasonUserUnauthenticated                  = "user-unauthenticated" // user needs to log in
 	ReasonUserUnauthorized                     = "user-unauthorized"    // user does not have access
@@ -0,0 +1,136 @@
+package criteria
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+const (
+	sourceIPOperatorIn    = "in"
+	sourceIPOperatorNotIn = "not_in"
+)
+
+var sourceIPBody = ast.Body{
+	ast.MustParseExpr(`ip := input.http.ip`),
+	ast.MustParseExpr(`ip != ""`),
+}
+
+type sourceIPCriterion struct {
+	g *Generator
+}
+
+func (sourceIPCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (sourceIPCriterion) Name() string {
+	return "source_ip"
+}
+
+func (c sourceIPCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	obj, ok := data.(parser.Object)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected object for source_ip criterion, got: %T", data)
+	}
+
+	for k := range obj {
+		switch k {
+		case sourceIPOperatorIn, sourceIPOperatorNotIn:
+		default:
+			return nil, nil, fmt.Errorf("unexpected field in source_ip criterion: %s", k)
+		}
+	}
+
+	var body ast.Body
+	body = append(body, sourceIPBody...)
+
+	for _, op := range []string{sourceIPOperatorIn, sourceIPOperatorNotIn} {
+		v, ok := obj[op]
+		if !ok {
+			continue
+		}
+
+		cidrs, err := getCIDRs(v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid source_ip criterion %s operator: %w", op, err)
+		}
+
+		var terms []*ast.Term
+		for _, cidr := range cidrs {
+			terms = append(terms, ast.StringTerm(cidr.String()))
+		}
+		matches := ast.Count.Call(ast.ArrayComprehensionTerm(
+			ast.BooleanTerm(true),
+			ast.Body{
+				ast.Assign.Expr(ast.VarTerm("cidrs"), ast.ArrayTerm(terms...)),
+				ast.MustParseExpr(`net.cidr_contains(cidrs[_], ip)`),
+			},
+		))
+
+		if op == sourceIPOperatorIn {
+			body = append(body, ast.GreaterThan.Expr(matches, ast.IntNumberTerm(0)))
+		} else {
+			body = append(body, ast.Equal.Expr(matches, ast.IntNumberTerm(0)))
+		}
+	}
+
+	rule := NewCriterionRule(c.g, c.Name(),
+		ReasonSourceIPOK, ReasonSourceIPUnauthorized,
+		body)
+
+	return rule, nil, nil
+}
+
+// SourceIP returns a Criterion which matches the downstream client IP address against CIDR ranges.
+func SourceIP(generator *Generator) Criterion {
+	return sourceIPCriterion{g: generator}
+}
+
+func init() {
+	Register(SourceIP)
+}
+
+// getCIDRs returns the CIDR ranges for a string or list of strings. Plain IP
+// addresses are treated as single address ranges.
+func getCIDRs(v parser.Value) ([]netip.Prefix, error) {
+	var strs []string
+	switch t := v.(type) {
+	case parser.String:
+		strs = append(strs, string(t))
+	case parser.Array:
+		for _, vv := range t {
+			s, ok := vv.(parser.String)
+			if !ok {
+				return nil, fmt.Errorf("expected string for CIDR, got: %T", vv)
+			}
+			strs = append(strs, string(s))
+		}
+	default:
+		return nil, fmt.Errorf("expected string or array of CIDRs, got: %T", v)
+	}
+
+	var cidrs []netip.Prefix
+	for _, s := range strs {
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP address: %w", err)
+			}
+			cidrs = append(cidrs, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		cidr, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR: %w", err)
+		}
+		cidrs = append(cidrs, cidr.Masked())
+	}
+	return cidrs, nil
+}
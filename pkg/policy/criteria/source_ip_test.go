@@ -0,0 +1,78 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceIP(t *testing.T) {
+	t.Run("in", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - source_ip:
+        in: [10.0.0.0/8, 192.168.1.1]
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{IP: "10.1.2.3"}})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonSourceIPOK}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("in single address", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - source_ip:
+        in: 192.168.1.1
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{IP: "192.168.1.2"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonSourceIPUnauthorized}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("not_in", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - source_ip:
+        in: 10.0.0.0/8
+        not_in: [10.0.0.0/16, "2001:db8::/32"]
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{IP: "10.0.1.1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonSourceIPUnauthorized}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("ipv6", func(t *testing.T) {
+		res, err := evaluate(t, `
+deny:
+  and:
+    - source_ip:
+        not_in: "2001:db8::/32"
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{IP: "2001:db8::1"}})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{}}, res["allow"])
+		require.Equal(t, A{false, A{ReasonSourceIPUnauthorized}, M{}}, res["deny"])
+	})
+	t.Run("missing ip", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - source_ip:
+        not_in: 10.0.0.0/8
+`, []dataBrokerRecord{}, Input{})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonSourceIPUnauthorized}, M{}}, res["allow"])
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, policy := range []string{
+			`{ "in": "10.0.0.0/33" }`,
+			`{ "in": ["not-an-ip"] }`,
+			`{ "is": "10.0.0.1" }`,
+		} {
+			_, err := evaluate(t, `
+allow:
+  and:
+    - source_ip: `+policy, []dataBrokerRecord{}, Input{})
+			require.Error(t, err, policy)
+		}
+	})
+}
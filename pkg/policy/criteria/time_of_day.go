@@ -0,0 +1,217 @@
+package criteria
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+const (
+	timeOfDayOperatorAfter    = "after"
+	timeOfDayOperatorBefore   = "before"
+	timeOfDayOperatorDays     = "days"
+	timeOfDayOperatorTimezone = "timezone"
+)
+
+var timeOfDayOperatorLookup = map[string]struct{}{
+	timeOfDayOperatorAfter:    {},
+	timeOfDayOperatorBefore:   {},
+	timeOfDayOperatorDays:     {},
+	timeOfDayOperatorTimezone: {},
+}
+
+const secondsPerDay = 24 * 60 * 60
+
+var timeOfDayBody = ast.Body{
+	ast.MustParseExpr(`now := time.now_ns()`),
+	ast.MustParseExpr(`clock := time.clock([now, tz])`),
+	ast.MustParseExpr(`seconds := ((clock[0] * 3600) + (clock[1] * 60)) + clock[2]`),
+}
+
+type timeOfDayCriterion struct {
+	g *Generator
+}
+
+func (timeOfDayCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (timeOfDayCriterion) Name() string {
+	return "time_of_day"
+}
+
+func (c timeOfDayCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	obj, ok := data.(parser.Object)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected object for time_of_day criterion, got: %T", data)
+	}
+
+	for k := range obj {
+		_, ok := timeOfDayOperatorLookup[k]
+		if !ok {
+			return nil, nil, fmt.Errorf("unexpected field in time_of_day criterion: %s", k)
+		}
+	}
+
+	tz, err := getTimezone(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body := ast.Body{
+		ast.Assign.Expr(ast.VarTerm("tz"), ast.StringTerm(tz.String())),
+	}
+	body = append(body, timeOfDayBody...)
+
+	after, hasAfter, err := getTimeOfDay(obj, timeOfDayOperatorAfter)
+	if err != nil {
+		return nil, nil, err
+	}
+	before, hasBefore, err := getTimeOfDay(obj, timeOfDayOperatorBefore)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case hasAfter && hasBefore:
+		if after == before {
+			return nil, nil, fmt.Errorf("time_of_day criterion after and before must be different")
+		}
+		// shift the clock so that the range starts at 0, this also supports ranges
+		// that span midnight (e.g. after 22:00, before 06:00)
+		body = append(body,
+			ast.Assign.Expr(ast.VarTerm("start"), ast.IntNumberTerm(after)),
+			ast.Assign.Expr(ast.VarTerm("length"), ast.IntNumberTerm((before-after+secondsPerDay)%secondsPerDay)),
+			ast.MustParseExpr(`((seconds - start) + 86400) % 86400 < length`),
+		)
+	case hasAfter:
+		body = append(body, ast.GreaterThanEq.Expr(ast.VarTerm("seconds"), ast.IntNumberTerm(after)))
+	case hasBefore:
+		body = append(body, ast.LessThan.Expr(ast.VarTerm("seconds"), ast.IntNumberTerm(before)))
+	}
+
+	if v, ok := obj[timeOfDayOperatorDays]; ok {
+		days, err := getDaysOfWeek(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		var terms []*ast.Term
+		for _, day := range days {
+			terms = append(terms, ast.StringTerm(day.String()))
+		}
+		body = append(body,
+			ast.Assign.Expr(ast.VarTerm("days"), ast.SetTerm(terms...)),
+			ast.MustParseExpr(`weekday := time.weekday([now, tz])`),
+			ast.MustParseExpr(`days[weekday]`),
+		)
+	}
+
+	rule := NewCriterionRule(c.g, c.Name(),
+		ReasonTimeOfDayOK, ReasonTimeOfDayUnauthorized,
+		body)
+
+	return rule, nil, nil
+}
+
+// TimeOfDay returns a Criterion which matches the current time of day and day of the week.
+func TimeOfDay(generator *Generator) Criterion {
+	return timeOfDayCriterion{g: generator}
+}
+
+func init() {
+	Register(TimeOfDay)
+}
+
+// getTimezone returns the location referenced by the "timezone" field. If no
+// timezone is set, UTC is used.
+func getTimezone(obj parser.Object) (*time.Location, error) {
+	v, ok := obj[timeOfDayOperatorTimezone]
+	if !ok {
+		return time.UTC, nil
+	}
+
+	s, ok := v.(parser.String)
+	if !ok {
+		return nil, fmt.Errorf("expected string for timezone, got: %T", v)
+	}
+
+	// Local depends on the machine evaluating the policy, so it isn't allowed
+	if s == "" || s == "Local" {
+		return nil, fmt.Errorf("invalid timezone: %q", string(s))
+	}
+
+	tz, err := time.LoadLocation(string(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone: %w", err)
+	}
+	return tz, nil
+}
+
+// getTimeOfDay returns the number of seconds since midnight for an "HH:MM" or
+// "HH:MM:SS" field.
+func getTimeOfDay(obj parser.Object, field string) (seconds int, ok bool, err error) {
+	v, ok := obj[field]
+	if !ok {
+		return 0, false, nil
+	}
+
+	s, ok := v.(parser.String)
+	if !ok {
+		return 0, false, fmt.Errorf("expected string for time_of_day %s, got: %T", field, v)
+	}
+
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		t, err := time.Parse(layout, string(s))
+		if err == nil {
+			return t.Hour()*3600 + t.Minute()*60 + t.Second(), true, nil
+		}
+	}
+
+	return 0, false, fmt.Errorf("invalid time_of_day %s, expected HH:MM or HH:MM:SS: %s", field, string(s))
+}
+
+// getDaysOfWeek returns the days of the week for a string or list of strings.
+// Both full ("monday") and abbreviated ("mon") names are supported.
+func getDaysOfWeek(v parser.Value) ([]time.Weekday, error) {
+	var names []string
+	switch t := v.(type) {
+	case parser.String:
+		names = append(names, string(t))
+	case parser.Array:
+		for _, vv := range t {
+			s, ok := vv.(parser.String)
+			if !ok {
+				return nil, fmt.Errorf("expected string for day of the week, got: %T", vv)
+			}
+			names = append(names, string(s))
+		}
+	default:
+		return nil, fmt.Errorf("expected string or array for days of the week, got: %T", v)
+	}
+
+	var days []time.Weekday
+	for _, name := range names {
+		day, ok := lookupWeekday(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown day of the week: %s", name)
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+func lookupWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(name)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,102 @@
+package criteria
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeOfDay(t *testing.T) {
+	tz, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	now := testingNow.In(tz)
+
+	t.Run("ok", func(t *testing.T) {
+		res, err := evaluate(t, fmt.Sprintf(`
+allow:
+  and:
+    - time_of_day:
+        timezone: America/New_York
+        after: "%s"
+        before: "%s"
+`, now.Add(-time.Hour).Format("15:04"), now.Add(time.Hour).Format("15:04")), []dataBrokerRecord{}, Input{})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonTimeOfDayOK}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("unauthorized", func(t *testing.T) {
+		res, err := evaluate(t, fmt.Sprintf(`
+allow:
+  and:
+    - time_of_day:
+        timezone: America/New_York
+        after: "%s"
+        before: "%s"
+`, now.Add(time.Hour).Format("15:04"), now.Add(2*time.Hour).Format("15:04")), []dataBrokerRecord{}, Input{})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonTimeOfDayUnauthorized}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+	})
+	t.Run("spans midnight", func(t *testing.T) {
+		res, err := evaluate(t, fmt.Sprintf(`
+allow:
+  and:
+    - time_of_day:
+        timezone: America/New_York
+        after: "%s"
+        before: "%s"
+`, now.Add(time.Minute).Format("15:04"), now.Format("15:04")), []dataBrokerRecord{}, Input{})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonTimeOfDayUnauthorized}, M{}}, res["allow"])
+		require.Equal(t, A{false, A{}}, res["deny"])
+
+		res, err = evaluate(t, fmt.Sprintf(`
+allow:
+  and:
+    - time_of_day:
+        timezone: America/New_York
+        after: "%s"
+        before: "%s"
+`, now.Add(2*time.Minute).Format("15:04"), now.Add(time.Minute).Format("15:04")), []dataBrokerRecord{}, Input{})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonTimeOfDayOK}, M{}}, res["allow"])
+	})
+	t.Run("days", func(t *testing.T) {
+		res, err := evaluate(t, fmt.Sprintf(`
+allow:
+  and:
+    - time_of_day:
+        timezone: America/New_York
+        days: [%s]
+`, now.Weekday().String()), []dataBrokerRecord{}, Input{})
+		require.NoError(t, err)
+		require.Equal(t, A{true, A{ReasonTimeOfDayOK}, M{}}, res["allow"])
+
+		res, err = evaluate(t, fmt.Sprintf(`
+allow:
+  and:
+    - time_of_day:
+        timezone: America/New_York
+        days: %s
+`, (now.Weekday() + 1).String()[:3]), []dataBrokerRecord{}, Input{})
+		require.NoError(t, err)
+		require.Equal(t, A{false, A{ReasonTimeOfDayUnauthorized}, M{}}, res["allow"])
+	})
+	t.Run("invalid", func(t *testing.T) {
+		for _, policy := range []string{
+			`{ "timezone": "Not/A_Timezone" }`,
+			`{ "after": "25:00" }`,
+			`{ "after": "10:00", "before": "10:00" }`,
+			`{ "days": ["someday"] }`,
+			`{ "hours": 1 }`,
+		} {
+			_, err := evaluate(t, `
+allow:
+  and:
+    - time_of_day: `+policy, []dataBrokerRecord{}, Input{})
+			require.Error(t, err, policy)
+		}
+	})
+}
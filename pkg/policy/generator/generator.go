@@ -15,6 +15,9 @@ import (
 type Generator struct {
 	ids      map[string]int
 	criteria map[string]Criterion
+	// grantsAccess is whether the criteria being generated grant access when
+	// they match.
+	grantsAccess bool
 }
 
 // An Option configures the Generator.
@@ -40,6 +43,15 @@ func New(options ...Option) *Generator {
 	return g
 }
 
+// CriterionGrantsAccess returns true if the criterion being generated grants
+// access when it matches, which is the case for the and and or operators of an
+// allow rule and the not and nor operators of a deny rule. Criteria matching
+// one of several values, which an upstream may not read the same way, use it
+// to require every value to match when granting access.
+func (g *Generator) CriterionGrantsAccess() bool {
+	return g.grantsAccess
+}
+
 // GetCriterion gets a Criterion for the given name.
 func (g *Generator) GetCriterion(name string) (Criterion, bool) {
 	c, ok := g.criteria[name]
@@ -64,6 +76,7 @@ func (g *Generator) Generate(policy *parser.Policy) (*ast.Module, error) {
 				continue
 			}
 
+			g.grantsAccess = action == parser.ActionAllow
 			if len(policyRule.And) > 0 {
 				subRule, err := g.generateAndRule(&rs, policyRule.And)
 				if err != nil {
@@ -78,6 +91,7 @@ func (g *Generator) Generate(policy *parser.Policy) (*ast.Module, error) {
 				}
 				terms = append(terms, ast.VarTerm(string(subRule.Head.Name)))
 			}
+			g.grantsAccess = action == parser.ActionDeny
 			if len(policyRule.Not) > 0 {
 				subRule, err := g.generateNotRule(&rs, policyRule.Not)
 				if err != nil {
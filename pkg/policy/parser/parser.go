@@ -52,6 +52,10 @@
 //	          "type": "array",
 //	          "items": { "$ref": "#/definitions/criteria" }
 //	        },
+//	        "nor": {
+//	          "type": "array",
+//	          "items": { "$ref": "#/definitions/criteria" }
+//	        },
 //	        "not": {
 //	          "type": "array",
 //	          "items": { "$ref": "#/definitions/criteria" }
@@ -65,9 +69,157 @@
 //	    },
 //	    "criteria": {
 //	      "type": "object",
+//	      "properties": {
+//	        "accept": { "$ref": "#/definitions/unused" },
+//	        "acr": { "$ref": "#/definitions/string_or_string_array" },
+//	        "amr": {
+//	          "anyOf": [
+//	            { "$ref": "#/definitions/string_or_string_array" },
+//	            { "$ref": "#/definitions/string_list_matcher" }
+//	          ]
+//	        },
+//	        "authenticated_user": { "$ref": "#/definitions/unused" },
+//	        "cors_preflight": { "$ref": "#/definitions/unused" },
+//	        "date": {
+//	          "type": "object",
+//	          "properties": {
+//	            "after": { "type": "string" },
+//	            "before": { "type": "string" },
+//	            "timezone": { "type": "string" }
+//	          },
+//	          "additionalProperties": false,
+//	          "minProperties": 1
+//	        },
+//	        "device": {
+//	          "type": "object",
+//	          "properties": {
+//	            "approved": { "type": "boolean" },
+//	            "is": { "type": "string" },
+//	            "type": { "type": "string" }
+//	          },
+//	          "additionalProperties": false
+//	        },
+//	        "domain": { "$ref": "#/definitions/string_matcher" },
+//	        "email": { "$ref": "#/definitions/string_matcher" },
+//	        "http_callout": {
+//	          "type": "object",
+//	          "properties": {
+//	            "url": { "type": "string", "format": "uri" },
+//	            "headers": {
+//	              "type": "object",
+//	              "additionalProperties": { "type": "string" }
+//	            },
+//	            "forward_headers": {
+//	              "type": "array",
+//	              "items": { "type": "string" }
+//	            },
+//	            "timeout": { "type": "string" },
+//	            "cache_ttl": { "type": "string" },
+//	            "fail_open": { "type": "boolean" }
+//	          },
+//	          "required": ["url"],
+//	          "additionalProperties": false
+//	        },
+//	        "http_method": { "$ref": "#/definitions/string_matcher" },
+//	        "http_path": { "$ref": "#/definitions/string_matcher" },
+//	        "identity_provider": { "$ref": "#/definitions/string_matcher" },
+//	        "invalid_client_certificate": { "$ref": "#/definitions/unused" },
+//	        "max_auth_age": {
+//	          "description": "a duration (e.g. 1h) or a number of seconds",
+//	          "type": ["number", "string"]
+//	        },
+//	        "pomerium_routes": { "$ref": "#/definitions/unused" },
+//	        "reject": { "$ref": "#/definitions/unused" },
+//	        "source_ip": {
+//	          "type": "object",
+//	          "properties": {
+//	            "in": { "$ref": "#/definitions/string_or_string_array" },
+//	            "not_in": { "$ref": "#/definitions/string_or_string_array" }
+//	          },
+//	          "additionalProperties": false,
+//	          "minProperties": 1
+//	        },
+//	        "time_of_day": {
+//	          "type": "object",
+//	          "properties": {
+//	            "after": { "type": "string" },
+//	            "before": { "type": "string" },
+//	            "days": { "$ref": "#/definitions/string_or_string_array" },
+//	            "timezone": { "type": "string" }
+//	          },
+//	          "additionalProperties": false,
+//	          "minProperties": 1
+//	        },
+//	        "user": { "$ref": "#/definitions/string_matcher" }
+//	      },
+//	      "patternProperties": {
+//	        "^claim/": {},
+//	        "^claim_matcher/": { "$ref": "#/definitions/string_list_matcher" },
+//	        "^http_header/": { "$ref": "#/definitions/string_matcher" },
+//	        "^http_query/": { "$ref": "#/definitions/string_matcher" }
+//	      },
 //	      "additionalProperties": true,
 //	      "minProperties": 1,
 //	      "maxProperties": 1
+//	    },
+//	    "unused": {
+//	      "description": "the data is ignored, e.g. accept: 1"
+//	    },
+//	    "string_or_string_array": {
+//	      "anyOf": [
+//	        { "type": "string" },
+//	        {
+//	          "type": "array",
+//	          "items": { "type": "string" }
+//	        }
+//	      ]
+//	    },
+//	    "string_matcher": {
+//	      "type": "object",
+//	      "properties": {
+//	        "contains": { "type": "string" },
+//	        "ends_with": { "type": "string" },
+//	        "is": { "type": "string" },
+//	        "matches": { "type": "string", "format": "regex" },
+//	        "regex": { "type": "string", "format": "regex" },
+//	        "starts_with": { "type": "string" },
+//	        "gt": { "$ref": "#/definitions/comparable" },
+//	        "gte": { "$ref": "#/definitions/comparable" },
+//	        "lt": { "$ref": "#/definitions/comparable" },
+//	        "lte": { "$ref": "#/definitions/comparable" }
+//	      },
+//	      "additionalProperties": false,
+//	      "minProperties": 1
+//	    },
+//	    "string_list_matcher": {
+//	      "type": "object",
+//	      "properties": {
+//	        "has": { "type": "string" },
+//	        "has_all": {
+//	          "type": "array",
+//	          "items": { "type": "string" }
+//	        },
+//	        "has_any": {
+//	          "type": "array",
+//	          "items": { "type": "string" }
+//	        },
+//	        "contains": { "type": "string" },
+//	        "ends_with": { "type": "string" },
+//	        "is": { "type": "string" },
+//	        "matches": { "type": "string", "format": "regex" },
+//	        "regex": { "type": "string", "format": "regex" },
+//	        "starts_with": { "type": "string" },
+//	        "gt": { "$ref": "#/definitions/comparable" },
+//	        "gte": { "$ref": "#/definitions/comparable" },
+//	        "lt": { "$ref": "#/definitions/comparable" },
+//	        "lte": { "$ref": "#/definitions/comparable" }
+//	      },
+//	      "additionalProperties": false,
+//	      "minProperties": 1
+//	    },
+//	    "comparable": {
+//	      "description": "numbers are compared numerically, strings (e.g. ISO 8601 dates) lexicographically",
+//	      "type": ["number", "string"]
 //	    }
 //	  }
 //	}
@@ -101,8 +253,15 @@ func (p *Parser) ParseJSON(r io.Reader) (*Policy, error) {
 
 // ParseYAML parses a raw YAML document into a policy.
 func (p *Parser) ParseYAML(r io.Reader) (*Policy, error) {
+	var node yaml.Node
+	err := yaml.NewDecoder(r).Decode(&node)
+	if err != nil {
+		return nil, err
+	}
+	UntagTimestamps(&node)
+
 	var obj interface{}
-	err := yaml.NewDecoder(r).Decode(&obj)
+	err = node.Decode(&obj)
 	if err != nil {
 		return nil, err
 	}
@@ -113,6 +272,18 @@ func (p *Parser) ParseYAML(r io.Reader) (*Policy, error) {
 	return p.ParseJSON(bytes.NewReader(bs))
 }
 
+// UntagTimestamps marks the timestamps in a YAML node as strings, so that they
+// are kept as they were written and criteria can interpret them (for example a
+// date in a specific timezone).
+func UntagTimestamps(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!timestamp" {
+		node.Tag = "!!str"
+	}
+	for _, child := range node.Content {
+		UntagTimestamps(child)
+	}
+}
+
 // ParseJSON creates a parser and calls ParseJSON on it.
 func ParseJSON(r io.Reader) (*Policy, error) {
 	return New().ParseJSON(r)
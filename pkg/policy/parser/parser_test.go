@@ -169,4 +169,22 @@ deny:
 			},
 		}, p)
 	})
+	t.Run("timestamps", func(t *testing.T) {
+		p, err := ParseYAML(strings.NewReader(`
+allow:
+  and:
+    - criterion1: 2023-01-02
+    - criterion2: "2023-01-02"
+`))
+		assert.NoError(t, err)
+		assert.Equal(t, &Policy{
+			Rules: []Rule{{
+				Action: ActionAllow,
+				And: []Criterion{
+					{Name: "criterion1", Data: String("2023-01-02")},
+					{Name: "criterion2", Data: String("2023-01-02")},
+				},
+			}},
+		}, p)
+	})
 }
@@ -49,6 +49,21 @@ get_user_email(session, user) = v {
 `)
 }
 
+// GetSessionAuthTime gets the time, in seconds since the epoch, the user last
+// authenticated for the given session. The ID token auth_time claim is used if
+// available, otherwise the session issued at time.
+func GetSessionAuthTime() *ast.Rule {
+	return ast.MustParseRule(`
+get_session_auth_time(session) = v {
+	v = to_number(session.claims.auth_time[0])
+} else = v {
+	v = session.issued_at.seconds
+} else = 0 {
+	true
+}
+`)
+}
+
 // GetDeviceCredential gets the device credential for the given session.
 func GetDeviceCredential() *ast.Rule {
 	return ast.MustParseRule(`
@@ -10,6 +10,7 @@ import (
 	"github.com/pomerium/pomerium/internal/handlers"
 	"github.com/pomerium/pomerium/internal/handlers/webauthn"
 	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/scim"
 	"github.com/pomerium/pomerium/internal/sessions"
 	"github.com/pomerium/pomerium/internal/urlutil"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
@@ -143,3 +144,20 @@ func (p *Proxy) getWebauthnState(r *http.Request) (*webauthn.State, error) {
 		BrandingOptions:         options.BrandingOptions,
 	}, nil
 }
+
+func (p *Proxy) getSCIMState(_ *http.Request) (*scim.State, error) {
+	options := p.currentOptions.Load()
+	state := p.state.Load()
+
+	s := &scim.State{
+		Client: state.dataBrokerClient,
+	}
+	if options.SCIM != nil {
+		var err error
+		s.BearerToken, err = options.SCIM.GetBearerToken()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
@@ -47,6 +47,9 @@ func (p *Proxy) registerDashboardHandlers(r *mux.Router) *mux.Router {
 		Queries(urlutil.QueryRedirectURI, "").
 		Methods(http.MethodGet)
 
+	// scim api used by identity providers to provision users and groups
+	r.PathPrefix(scimPath).Handler(p.scim)
+
 	return r
 }
 
@@ -210,10 +213,15 @@ func (p *Proxy) ProgrammaticLogin(w http.ResponseWriter, r *http.Request) error
 		return httputil.NewError(http.StatusBadRequest, errors.New("invalid redirect uri"))
 	}
 
-	idp, err := options.GetIdentityProviderForRequestURL(urlutil.GetAbsoluteURL(r).String())
+	idps, err := options.GetIdentityProvidersForRequestURL(urlutil.GetAbsoluteURL(r).String())
 	if err != nil {
 		return httputil.NewError(http.StatusInternalServerError, err)
 	}
+	// with several identity providers, authenticate lets the user choose one
+	idpID := ""
+	if len(idps) == 1 {
+		idpID = idps[0].GetId()
+	}
 
 	hpkeAuthenticateKey, err := state.authenticateKeyFetcher.FetchPublicKey(r.Context())
 	if err != nil {
@@ -228,7 +236,7 @@ func (p *Proxy) ProgrammaticLogin(w http.ResponseWriter, r *http.Request) error
 	q.Set(urlutil.QueryIsProgrammatic, "true")
 	signinURL.RawQuery = q.Encode()
 
-	rawURL, err := urlutil.SignInURL(state.hpkePrivateKey, hpkeAuthenticateKey, &signinURL, redirectURI, idp.GetId())
+	rawURL, err := urlutil.SignInURL(state.hpkePrivateKey, hpkeAuthenticateKey, &signinURL, redirectURI, idpID)
 	if err != nil {
 		return httputil.NewError(http.StatusInternalServerError, err)
 	}
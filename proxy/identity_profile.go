@@ -60,6 +60,9 @@ func populateSessionFromProfile(s *session.Session, p *identitypb.Profile, ss *s
 	for k, vs := range identity.Claims(claims).Flatten().ToPB() {
 		s.Claims[k] = vs
 	}
+	if idpID := p.GetProviderId(); idpID != "" {
+		s.SetIdentityProviderID(idpID)
+	}
 }
 
 func populateUserFromProfile(u *user.User, p *identitypb.Profile, ss *sessions.State) {
@@ -16,6 +16,7 @@ import (
 	"github.com/pomerium/pomerium/internal/handlers/webauthn"
 	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/scim"
 	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 )
@@ -25,6 +26,7 @@ const (
 	dashboardPath = "/.pomerium"
 	signinURL     = "/.pomerium/sign_in"
 	refreshURL    = "/.pomerium/refresh"
+	scimPath      = "/.pomerium/scim/v2"
 )
 
 // ValidateOptions checks that proper configuration settings are set to create
@@ -56,6 +58,7 @@ type Proxy struct {
 	currentOptions *atomicutil.Value[*config.Options]
 	currentRouter  *atomicutil.Value[*mux.Router]
 	webauthn       *webauthn.Handler
+	scim           *scim.Handler
 }
 
 // New takes a Proxy service from options and a validation function.
@@ -72,6 +75,7 @@ func New(cfg *config.Config) (*Proxy, error) {
 		currentRouter:  atomicutil.NewValue(httputil.NewRouter()),
 	}
 	p.webauthn = webauthn.New(p.getWebauthnState)
+	p.scim = scim.New(scimPath, p.getSCIMState)
 
 	metrics.AddPolicyCountCallback("pomerium-proxy", func() int64 {
 		return int64(len(p.currentOptions.Load().GetAllPolicies()))
@@ -6,6 +6,7 @@ import React, {FC, useLayoutEffect} from "react";
 import ErrorPage from "./components/ErrorPage";
 import Footer from "./components/Footer";
 import Header from "./components/Header";
+import SelectIdentityProviderPage from "./components/SelectIdentityProviderPage";
 import SignOutConfirmPage from "./components/SignOutConfirmPage";
 import { ToolbarOffset } from "./components/ToolbarOffset";
 import UserInfoPage from "./components/UserInfoPage";
@@ -24,6 +25,9 @@ const App: FC = () => {
     case "Error":
       body = <ErrorPage data={data} />;
       break;
+    case "SelectIdentityProvider":
+      body = <SelectIdentityProviderPage data={data} />;
+      break;
     case "SignOutConfirm":
       body = <SignOutConfirmPage data={data} />;
       break;
@@ -0,0 +1,56 @@
+import Button from "@mui/material/Button";
+import Container from "@mui/material/Container";
+import Divider from "@mui/material/Divider";
+import Stack from "@mui/material/Stack";
+import TextField from "@mui/material/TextField";
+import React, { FC, useState } from "react";
+import { SelectIdentityProviderPageData } from "src/types";
+
+import Section from "./Section";
+
+type SelectIdentityProviderPageProps = {
+  data: SelectIdentityProviderPageData;
+};
+const SelectIdentityProviderPage: FC<SelectIdentityProviderPageProps> = ({
+  data,
+}) => {
+  const [email, setEmail] = useState("");
+
+  function handleSubmit(evt: React.FormEvent) {
+    evt.preventDefault();
+    const url = new URL(data.url, location.href);
+    url.searchParams.set("login_hint", email);
+    location.href = url.toString();
+  }
+
+  return (
+    <Container maxWidth="sm">
+      <Section title="Sign in">
+        <Stack spacing={2}>
+          <form onSubmit={handleSubmit}>
+            <Stack direction="row" spacing={1}>
+              <TextField
+                type="email"
+                label="Email"
+                size="small"
+                fullWidth
+                value={email}
+                onChange={(evt) => setEmail(evt.target.value)}
+              />
+              <Button type="submit" variant="contained">
+                Continue
+              </Button>
+            </Stack>
+          </form>
+          <Divider>or</Divider>
+          {data.identityProviders?.map((idp) => (
+            <Button key={idp.id} variant="outlined" href={idp.url}>
+              Sign in with {idp.name}
+            </Button>
+          ))}
+        </Stack>
+      </Section>
+    </Container>
+  );
+};
+export default SelectIdentityProviderPage;
@@ -127,6 +127,18 @@ export type DeviceEnrolledPageData = BasePageData &
     page: "DeviceEnrolled";
   };
 
+export type IdentityProvider = {
+  id: string;
+  name: string;
+  url: string;
+};
+
+export type SelectIdentityProviderPageData = BasePageData & {
+  page: "SelectIdentityProvider";
+  identityProviders?: IdentityProvider[];
+  url: string;
+};
+
 export type SignOutConfirmPageData = BasePageData & {
   page: "SignOutConfirm";
   url: string;
@@ -149,6 +161,7 @@ export type WebAuthnRegistrationPageData = BasePageData & {
 export type PageData =
   | ErrorPageData
   | DeviceEnrolledPageData
+  | SelectIdentityProviderPageData
   | SignOutConfirmPageData
   | UserInfoPageData
   | WebAuthnRegistrationPageData;